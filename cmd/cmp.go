@@ -1,31 +1,144 @@
 package cmd
 
 import (
+	"cmp"
+	"database/sql"
+	_ "embed"
 	"errors"
 	"fmt"
 	"log"
 	"maps"
+	"math"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
+	"text/template"
 
 	"github.com/bjackman/falba/internal/anal"
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
 	"github.com/bjackman/falba/internal/unit"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 	"golang.org/x/text/number"
 )
 
 var (
-	cmpFlagMetric      string
-	cmpFlagFact        string
-	cmpFlagFilter      string
-	cmpFlagHistWidth   int
-	cmpFlagIgnoreFacts []string
+	cmpFlagMetric        string
+	cmpFlagFact          string
+	cmpFlagFactCombine   []string
+	cmpFlagFilter        string
+	cmpFlagHistWidth     int
+	cmpFlagHistLegend    bool
+	cmpFlagSortHist      bool
+	cmpFlagHistClip      float64
+	cmpFlagVerify        bool
+	cmpFlagIgnoreFacts   []string
+	cmpFlagWarnThresh    float64
+	cmpFlagFailThresh    float64
+	cmpFlagAgg           string
+	cmpFlagFactOrder     string
+	cmpFlagTopValues     int
+	cmpFlagTop           int
+	cmpFlagTopBy         string
+	cmpFlagTemplate      string
+	cmpFlagPrintTemplate bool
+	cmpFlagMaxWidth      int
+	cmpFlagAbsDelta      bool
+	cmpFlagWindow        string
+	cmpFlagTimeFact      string
+	cmpFlagTest          string
+	cmpFlagRequireAll    bool
+	cmpFlagSLO           string
+	cmpFlagFactHint      string
+	cmpFlagPairBy        string
 )
 
+// The fact that --window groups by.
+const windowFact = "time_window"
+
+// Whether sortGroupKeys already suggested --fact-type-hint, so it doesn't
+// repeat it for every metric.
+var cmpSuggestedFactHint bool
+
+// sortGroupKeys sorts the group keys according to --fact-order. Without it,
+// the keys are sorted in natural order if they're all numbers, otherwise
+// lexically. Natural rather than numeric, since strings that look like numbers
+// are often versions, where 6.10 comes after 6.9. Int and float facts really
+// are numbers though, so they're sorted numerically.
+func sortGroupKeys(falbaDB *db.DB, keys []string) error {
+	order := cmpFlagFactOrder
+	if order == "" && anal.AllNumeric(keys) {
+		switch falbaDB.FactTypes[cmpFlagFact].Type {
+		case falba.ValueInt, falba.ValueFloat:
+			order = "numeric"
+		default:
+			order = "natural"
+		}
+		if falbaDB.FactTypes[cmpFlagFact].Type == falba.ValueString && !cmpSuggestedFactHint {
+			log.Printf("Fact %q is a string but all its values are numbers, sorting them in natural order. "+
+				"Use --fact-type-hint to treat it as a number everywhere.", cmpFlagFact)
+			cmpSuggestedFactHint = true
+		}
+	}
+	if err := anal.SortGroupKeys(keys, order); err != nil {
+		return fmt.Errorf("--fact-order: %v", err)
+	}
+	return nil
+}
+
+// convertFactForHint returns a function for setupSQL that converts --fact to the
+// type from --fact-type-hint.
+func convertFactForHint() (func(*db.DB) error, error) {
+	if cmpFlagFact == "" || cmpFlagFactCombine != nil || cmpFlagWindow != "" {
+		return nil, fmt.Errorf("--fact-type-hint only works with --fact")
+	}
+	t, err := falba.ParseValueType(cmpFlagFactHint)
+	if err != nil || (t != falba.ValueInt && t != falba.ValueFloat) {
+		return nil, fmt.Errorf("invalid --fact-type-hint %q, expect 'int' or 'float'", cmpFlagFactHint)
+	}
+	return func(falbaDB *db.DB) error {
+		if err := falbaDB.ConvertFact(cmpFlagFact, t); err != nil {
+			return fmt.Errorf("--fact-type-hint: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// addWindowFact adds windowFact to the results, for --window.
+func addWindowFact(falbaDB *db.DB) error {
+	window, err := parseAge(cmpFlagWindow)
+	if err != nil {
+		return fmt.Errorf("parsing --window: %v", err)
+	}
+	times, err := falbaDB.ResultTimes(cmpFlagTimeFact)
+	if err != nil {
+		return fmt.Errorf("getting result times: %v", err)
+	}
+	// Results without the --time-fact don't have a time, so they'd all end up
+	// in a meaningless NULL window. Leave them out of the comparison instead.
+	if len(times) == 0 {
+		return fmt.Errorf("no results have the --time-fact %q", cmpFlagTimeFact)
+	}
+	if missing := len(falbaDB.Results) - len(times); missing > 0 {
+		log.Printf("Leaving out %d result(s) that don't have the --time-fact %q", missing, cmpFlagTimeFact)
+		*falbaDB = *falbaDB.Filter(func(r *falba.Result) bool {
+			_, ok := times[r.ResultID]
+			return ok
+		})
+	}
+	windows, err := anal.TimeWindows(times, window)
+	if err != nil {
+		return fmt.Errorf("--window: %v", err)
+	}
+	return falbaDB.AddFact(windowFact, falba.FactType{Type: falba.ValueString}, windows)
+}
+
 var printer *message.Printer = message.NewPrinter(language.English)
 
 // transformBigNumber is a text.Transformer for formatting larger numbers
@@ -34,110 +147,554 @@ func transformBigNumber(v any) string {
 	switch v := v.(type) {
 	case float64:
 		var opts []number.Option
-		if v > 100 {
+		if math.Abs(v) > 100 {
 			opts = append(opts, number.MaxFractionDigits(0))
 		}
 		return printer.Sprintf("%v", number.Decimal(v, opts...))
 	case int:
 		return printer.Sprintf("%v", number.Decimal(v))
+	case nil:
+		return ""
 	default:
 		log.Printf("No transformer logic for value of type %T", v)
 		return printer.Sprintf("%v", v)
 	}
 }
 
-func formatTime(v any, u *unit.Unit) string {
-	var val float64
+// formatWithUnit formats a number from a table cell in the unit.
+func formatWithUnit(v any, u *unit.Unit) string {
 	switch t := v.(type) {
 	case float64:
-		val = t
+		return u.Format(t)
 	case int:
-		val = float64(t)
+		return u.Format(float64(t))
 	case int64:
-		val = float64(t)
+		return u.Format(float64(t))
+	case nil:
+		return ""
 	default:
 		return fmt.Sprintf("%v", v) // fallback
 	}
+}
 
-	// Convert original value to nanoseconds to have a base unit.
-	var ns float64
-	switch u.ShortName {
-	case "ns":
-		ns = val
-	case "us":
-		ns = val * 1e3
-	case "ms":
-		ns = val * 1e6
-	case "s":
-		ns = val * 1e9
-	default:
-		// Not a time unit we can convert from.
-		return printer.Sprintf("%v%s", number.Decimal(val), u.ShortName)
-	}
+// Shown in the delta column when the baseline is 0, see anal.RelativeDelta.
+const zeroBaselineDelta = "n/a (baseline=0)"
 
-	// Now convert from nanoseconds to a more readable unit.
-	if ns < 1000 {
-		return printer.Sprintf("%.0fns", number.Decimal(ns))
-	}
-	us := ns / 1e3
-	if us < 1000 {
-		return printer.Sprintf("%.2fus", number.Decimal(us))
+func transformToPercentage(v any) string {
+	if s, ok := v.(string); ok {
+		return s
 	}
-	ms := us / 1e3
-	if ms < 1000 {
-		return printer.Sprintf("%.2fms", number.Decimal(ms))
+	delta, ok := v.(float64)
+	if !ok {
+		return ""
 	}
-	s := ms / 1e3
-	if s < 60 {
-		return printer.Sprintf("%.2fs", number.Decimal(s))
+	return printer.Sprintf("%+.1f%%", number.Decimal(delta*100))
+}
+
+// Name of the --pair-by column with the mean of the per-pair differences.
+const pairedDeltaName = "paired Δμ"
+
+func transformPValue(v any) string {
+	p, ok := v.(float64)
+	if !ok {
+		return ""
 	}
-	min := s / 60
-	if min < 60 {
-		return printer.Sprintf("%.2fm", number.Decimal(min))
+	if p < 0.001 {
+		return "<0.001"
 	}
-	hr := min / 60
-	return printer.Sprintf("%.2fh", number.Decimal(hr))
+	return printer.Sprintf("%.3f", p)
 }
 
-func transformToPercentage(v any) string {
-	delta, ok := v.(float64)
+func transformToProportion(v any) string {
+	p, ok := v.(float64)
 	if !ok {
 		return ""
 	}
-	return printer.Sprintf("%+.1f%%", number.Decimal(delta*100))
+	return printer.Sprintf("%.1f%%", number.Decimal(p*100))
 }
 
 func newTransformer(unit *unit.Unit) func(v any) string {
-	if unit != nil && unit.Family == "time" {
+	if unit != nil {
 		return func(v any) string {
-			return formatTime(v, unit)
+			return formatWithUnit(v, unit)
 		}
 	}
 	return transformBigNumber
 }
 
+func newCmpTable() table.Writer {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(table.Style{
+		Name: "mystyle",
+		Box:  table.StyleBoxDefault,
+		// Needs to be set explicitly for some reason, otherwise the table
+		// boxes don't show up.
+		Options: table.OptionsDefault,
+		Format: table.FormatOptions{
+			Header: text.FormatDefault,
+			Row:    text.FormatDefault,
+		},
+	})
+	return t
+}
+
+// Below this the histogram isn't worth showing, so --max-width drops it.
+const minHistWidth = 5
+
+// tableWidth returns the width in characters of the widest line of the
+// rendered table, without printing it.
+func tableWidth(t table.Writer) int {
+	t.SetOutputMirror(nil)
+	defer t.SetOutputMirror(os.Stdout)
+	width := 0
+	for _, line := range strings.Split(t.Render(), "\n") {
+		width = max(width, text.RuneWidthWithoutEscSequences(line))
+	}
+	return width
+}
+
+// groupingError decorates an error from grouping the results.
+func groupingError(cmd *cobra.Command, err error) error {
+	if errors.Is(err, anal.ErrNoData) {
+		// Not a usage error, the command was fine there just wasn't
+		// anything to show.
+		cmd.SilenceUsage = true
+	}
+	if errors.Is(err, anal.ErrFactNotDeterminant) {
+		return fmt.Errorf("grouping by fact: %v\n\nTip: You can use the --ignore-fact flag to bypass this check for facts you don't care about.", err)
+	}
+	return fmt.Errorf("grouping by fact: %v", err)
+}
+
+// checkCoverage warns about results that have no samples of the metric, and
+// returns the groups they're in. They just don't show up in the groups, so if
+// some configs failed to produce the metric the comparison can be quietly
+// biased.
+func checkCoverage(sqlDB *sql.DB) ([]string, error) {
+	coverage, err := anal.MetricCoverage(sqlDB, cmpFlagFact, cmpFlagMetric, cmpFlagFilter)
+	if err != nil {
+		return nil, fmt.Errorf("checking which results have samples: %v", err)
+	}
+	var incomplete, details []string
+	for _, key := range slices.Sorted(maps.Keys(coverage)) {
+		if c := coverage[key]; !c.Complete() {
+			incomplete = append(incomplete, key)
+			details = append(details, fmt.Sprintf("%s (%d of %d)", key, c.Results-c.WithSamples, c.Results))
+		}
+	}
+	if len(incomplete) > 0 {
+		log.Printf("WARNING: Some results have no %s samples so they aren't counted, by %s: %s",
+			cmpFlagMetric, cmpFlagFact, strings.Join(details, ", "))
+	}
+	return incomplete, nil
+}
+
+// requireAllError is the error for --require-all, if it's set and there were
+// groups with results missing samples. cmp returns this after showing the table.
+func requireAllError(incomplete []string) error {
+	if !cmpFlagRequireAll || len(incomplete) == 0 {
+		return nil
+	}
+	return &exitCodeError{code: exitFailure, err: fmt.Errorf("%d group(s) have results without %s samples (--require-all): %v",
+		len(incomplete), cmpFlagMetric, incomplete)}
+}
+
+// unsupportedCmpFlags returns the flags that were passed but don't work for
+// metrics of type t.
+func unsupportedCmpFlags(t falba.ValueType) []string {
+	var flags []string
+	switch t {
+	case falba.ValueString:
+		for flag, set := range map[string]bool{
+			"--warn-threshold": cmpFlagWarnThresh > 0,
+			"--fail-threshold": cmpFlagFailThresh > 0,
+			"--slo":            cmpFlagSLO != "",
+			"--pair-by":        cmpFlagPairBy != "",
+			"--template":       cmpFlagTemplate != "",
+		} {
+			if set {
+				flags = append(flags, flag)
+			}
+		}
+	case falba.ValueBool:
+		if cmpFlagPairBy != "" {
+			flags = append(flags, "--pair-by")
+		}
+	}
+	slices.Sort(flags)
+	return flags
+}
+
+// cmpValues is cmp for string metrics. It shows how often the most common
+// values occur in each group.
+func cmpValues(cmd *cobra.Command, falbaDB *db.DB, sqlDB *sql.DB) error {
+	if flags := unsupportedCmpFlags(falba.ValueString); len(flags) > 0 {
+		return fmt.Errorf("%s not supported for string metrics", strings.Join(flags, ", "))
+	}
+	groups, err := anal.CountValues(sqlDB, falbaDB, cmpFlagFact, cmpFlagMetric, cmpFlagFilter, cmpFlagIgnoreFacts)
+	if err != nil {
+		return groupingError(cmd, err)
+	}
+	cmd.SilenceUsage = true
+	incomplete, err := checkCoverage(sqlDB)
+	if err != nil {
+		return err
+	}
+
+	groupKeys := slices.Collect(maps.Keys(groups))
+	if err := sortGroupKeys(falbaDB, groupKeys); err != nil {
+		return err
+	}
+
+	// Columns for the most common values overall, the rest get lumped
+	// together.
+	totals := make(map[string]int)
+	for _, group := range groups {
+		for value, count := range group.Counts {
+			totals[value] += count
+		}
+	}
+	values := slices.SortedFunc(maps.Keys(totals), func(a, b string) int {
+		return cmp.Or(cmp.Compare(totals[b], totals[a]), cmp.Compare(a, b))
+	})
+	var others []string
+	if cmpFlagTopValues > 0 && len(values) > cmpFlagTopValues {
+		values, others = values[:cmpFlagTopValues], values[cmpFlagTopValues:]
+	}
+
+	fmt.Printf("metric: %v   |  test: %v\n", cmpFlagMetric, groups[groupKeys[0]].TestName)
+	t := newCmpTable()
+	header := table.Row{cmpFlagFact, "samples"}
+	for _, v := range values {
+		header = append(header, v)
+	}
+	if len(others) > 0 {
+		header = append(header, fmt.Sprintf("(%d others)", len(others)))
+	}
+	t.AppendHeader(header)
+	for _, factVal := range groupKeys {
+		group := groups[factVal]
+		cell := func(count int) string {
+			if count == 0 {
+				return ""
+			}
+			return printer.Sprintf("%d (%.0f%%)", count, float64(count)*100/float64(group.Samples))
+		}
+		row := table.Row{factVal, group.Samples}
+		for _, v := range values {
+			row = append(row, cell(group.Counts[v]))
+		}
+		if len(others) > 0 {
+			var count int
+			for _, v := range others {
+				count += group.Counts[v]
+			}
+			row = append(row, cell(count))
+		}
+		t.AppendRow(row)
+	}
+	t.Render()
+	cmd.SilenceUsage = true
+	return requireAllError(incomplete)
+}
+
+// topGroups picks the n groups to show (always including the baseline, which
+// is the first one) and returns them along with the rest, both in the same
+// order as groupKeys. The most significant groups (according to score) are
+// shown.
+func topGroups(groupKeys []string, n int, score func(key string) float64) (shown []string, hidden []string) {
+	if n <= 0 || len(groupKeys) <= n {
+		return groupKeys, nil
+	}
+	ranked := slices.Clone(groupKeys[1:])
+	slices.SortStableFunc(ranked, func(a, b string) int {
+		return cmp.Compare(score(b), score(a))
+	})
+	keep := map[string]bool{groupKeys[0]: true}
+	for _, key := range ranked[:n-1] {
+		keep[key] = true
+	}
+	for _, key := range groupKeys {
+		if keep[key] {
+			shown = append(shown, key)
+		} else {
+			hidden = append(hidden, key)
+		}
+	}
+	return shown, hidden
+}
+
+// cmpTemplateData is what the --template gets rendered with.
+type cmpTemplateData struct {
+	// As passed to --metric, including any label matchers.
+	Metric string
+	// Nil if the metric has no unit.
+	Unit *unit.Unit
+	Test string
+	// The fact the results are grouped by, or the combined facts like "a/b".
+	Fact string
+	// Names of the Agg and Delta columns, e.g. "median" and "Δmedian".
+	AggName   string
+	DeltaName string
+	// The --slo, formatted like "<= 50.00ms". Empty if there isn't one.
+	SLO string
+	// The --pair-by fact, empty if there isn't one.
+	PairBy string
+	// In the same order as the rows of the table, so the baseline is first and
+	// the groups hidden by --top are merged into a last row.
+	Rows []*cmpTemplateRow
+}
+
+type cmpTemplateRow struct {
+	// The fact value, or "(N others)".
+	Key string
+	*anal.MetricGroup
+	// The statistic chosen with --agg, NaN if there isn't one.
+	Agg float64
+	// Difference from the baseline, only meaningful if HasDelta.
+	Delta    float64
+	HasDelta bool
+	// Whether the Agg meets the --slo. For the merged row, whether all the
+	// merged groups do.
+	MeetsSLO bool
+	// The comparison with the baseline for --pair-by. Nil for the baseline
+	// and the merged row, and without --pair-by.
+	Paired *anal.PairedStats
+}
+
+// defaultCmpTemplate is what cmp renders when there's no --template.
+//
+//go:embed cmp_default.tmpl
+var defaultCmpTemplate string
+
+// renderCmpTemplate renders the data with the text/template in path, or the
+// default one if path is empty. As well as the usual builtins, the template
+// gets:
+//
+//	format:  formats a number in the metric's unit (or as a percentage for
+//	         bool metrics), like the table does.
+//	percent: formats a delta as a percentage, e.g. +1.2%.
+//	table:   renders t, the usual cmp table.
+func renderCmpTemplate(path string, data *cmpTemplateData, format func(v any) string, t table.Writer) error {
+	funcs := template.FuncMap{
+		"format":  format,
+		"percent": transformToPercentage,
+		"table": func() string {
+			t.SetOutputMirror(nil)
+			defer t.SetOutputMirror(os.Stdout)
+			return t.Render()
+		},
+	}
+	var tmpl *template.Template
+	var err error
+	if path == "" {
+		tmpl, err = template.New("default").Funcs(funcs).Parse(defaultCmpTemplate)
+		if err != nil {
+			return internalError(fmt.Errorf("parsing default template: %v", err))
+		}
+	} else {
+		tmpl, err = template.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+		if err != nil {
+			return fmt.Errorf("parsing --template: %v", err)
+		}
+	}
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
+		return fmt.Errorf("rendering --template: %v", err)
+	}
+	return nil
+}
+
+// verifyCounts checks that the groups contain all the samples they should. This
+// is meant to catch bugs in the SQL queries in GroupByFact, so a mismatch is
+// just logged.
+func verifyCounts(sqlDB *sql.DB, groups map[string]*anal.MetricGroup) error {
+	want, err := anal.CountMetricSamples(sqlDB, cmpFlagMetric, cmpFlagFilter)
+	if err != nil {
+		return err
+	}
+	var samples, histSamples int
+	for _, group := range groups {
+		samples += group.Samples
+		histSamples += int(group.Histogram.TotalSize)
+	}
+	if samples != want {
+		log.Printf("WARNING: --verify-counts: groups contain %d samples but there are %d %q rows in the metrics table, this is a bug!",
+			samples, want, cmpFlagMetric)
+	}
+	// When the histogram is clipped it's expected to have fewer samples.
+	if cmpFlagHistWidth > 0 && cmpFlagHistClip == 0 && histSamples != want {
+		log.Printf("WARNING: --verify-counts: histograms contain %d samples but there are %d %q rows in the metrics table, this is a bug!",
+			histSamples, want, cmpFlagMetric)
+	}
+	return nil
+}
+
 func cmdCmp(cmd *cobra.Command, args []string) error {
-	falbaDB, sqlDB, err := setupSQL()
+	if cmpFlagPrintTemplate {
+		fmt.Print(defaultCmpTemplate)
+		return nil
+	}
+	// Name of the central tendency column and of the delta column.
+	var aggName, deltaName string
+	switch cmpFlagAgg {
+	case "mean":
+		aggName, deltaName = "mean", "Δμ"
+	case "median":
+		aggName, deltaName = "median", "Δmedian"
+	default:
+		return fmt.Errorf("invalid --agg %q, expect 'mean' or 'median'", cmpFlagAgg)
+	}
+	// Returns the statistic chosen with --agg.
+	agg := func(g *anal.MetricGroup) float64 {
+		if cmpFlagAgg == "median" {
+			return g.Median
+		}
+		return g.Mean
+	}
+
+	var slo *anal.SLO
+	if cmpFlagSLO != "" {
+		var err error
+		if slo, err = anal.ParseSLO(cmpFlagSLO); err != nil {
+			return fmt.Errorf("--slo: %v", err)
+		}
+	}
+
+	var prepare func(*db.DB) error
+	if cmpFlagFactHint != "" {
+		var err error
+		if prepare, err = convertFactForHint(); err != nil {
+			return err
+		}
+	}
+	if cmpFlagWindow != "" {
+		prepare = addWindowFact
+		cmpFlagFact = windowFact
+	} else if cmpFlagTimeFact != "" {
+		return fmt.Errorf("--time-fact only makes sense with --window")
+	}
+	falbaDB, sqlDB, err := setupSQL(prepare)
 	if err != nil {
-		log.Fatalf("Setting up SQL DB: %v", err)
+		cmd.SilenceUsage = true
+		return fmt.Errorf("setting up SQL DB: %w", err)
 	}
 
-	// Just to produce a nice error message, check the fact exists.
-	_, ok := falbaDB.FactTypes[cmpFlagFact]
-	if !ok {
-		return fmt.Errorf("no fact %q\n\nAvailable facts:\n%s\n", cmpFlagFact, anal.ReadableList(maps.Keys(falbaDB.FactTypes)))
+	if len(falbaDB.Results) == 0 {
+		cmd.SilenceUsage = true
+		if flagHasArtifact != "" {
+			return fmt.Errorf("no results have an artifact matching --has-artifact %q", flagHasArtifact)
+		}
+		return fmt.Errorf("no results in the DB (%v), try 'falba import'", strings.Join(falbaDB.RootDirs, ", "))
+	}
+
+	if cmpFlagFactCombine != nil {
+		if len(cmpFlagFactCombine) < 2 {
+			return fmt.Errorf("--fact-combine needs at least two facts")
+		}
+		cmpFlagFact = anal.CombineFacts(cmpFlagFactCombine)
+	}
+
+	facts := anal.SplitFacts(cmpFlagFact)
+	if cmpFlagPairBy != "" {
+		if slices.Contains(facts, cmpFlagPairBy) {
+			return fmt.Errorf("--pair-by fact %q is also being grouped by", cmpFlagPairBy)
+		}
+		facts = append(facts, cmpFlagPairBy)
+		// The pair fact is expected to vary within each group.
+		cmpFlagIgnoreFacts = append(cmpFlagIgnoreFacts, cmpFlagPairBy)
+	}
+
+	// Just to produce a nice error message, check the facts exist.
+	for _, fact := range facts {
+		if _, ok := falbaDB.FactTypes[fact]; !ok {
+			return fmt.Errorf("no fact %q\n\nAvailable facts:\n%s\n", fact, anal.ReadableList(maps.Keys(falbaDB.FactTypes)))
+		}
 	}
 
-	groups, err := anal.GroupByFact(sqlDB, falbaDB, cmpFlagFact, cmpFlagMetric, cmpFlagFilter, cmpFlagHistWidth, cmpFlagIgnoreFacts)
+	if cmpFlagTest != "" {
+		cmpFlagFilter = anal.TestFilter(cmpFlagFilter, cmpFlagTest)
+	}
+	if cmpFlagMetric != "" {
+		return cmpMetric(cmd, falbaDB, sqlDB, aggName, deltaName, agg, slo)
+	}
+	if cmpFlagTest == "" {
+		return fmt.Errorf("need --metric, or --test to compare all the metrics of a test")
+	}
+
+	// Compare every metric that the test has samples of.
+	metrics, err := anal.MetricsForTest(sqlDB, cmpFlagTest, cmpFlagFilter)
 	if err != nil {
-		if errors.Is(err, anal.ErrFactNotDeterminant) {
-			return fmt.Errorf("grouping by fact: %v\n\nTip: You can use the --ignore-fact flag to bypass this check for facts you don't care about.", err)
+		return err
+	}
+	if len(metrics) == 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("no metric samples for test %q (with --filter %q)", cmpFlagTest, cmpFlagFilter)
+	}
+	log.Printf("No --metric, comparing all %d metrics for test %s: %s", len(metrics), cmpFlagTest, strings.Join(metrics, ", "))
+	// Carry on past threshold failures so every metric gets shown.
+	var failedMetrics []string
+	compared := 0
+	for _, metric := range metrics {
+		// One metric that can't be compared the way the user asked shouldn't
+		// stop the others from being compared.
+		metricType := falbaDB.MetricTypes[metric].Type
+		if flags := unsupportedCmpFlags(metricType); len(flags) > 0 {
+			log.Printf("Skipping %s, %s not supported for %v metrics", metric, strings.Join(flags, ", "), metricType)
+			continue
+		}
+		if compared > 0 {
+			fmt.Println()
 		}
-		return fmt.Errorf("grouping by fact: %v", err)
+		compared++
+		cmpFlagMetric = metric
+		err := cmpMetric(cmd, falbaDB, sqlDB, aggName, deltaName, agg, slo)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) && exitErr.code == exitFailure {
+			failedMetrics = append(failedMetrics, metric)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("metric %s: %w", metric, err)
+		}
+	}
+	if compared == 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("none of the metrics for test %q support the given flags", cmpFlagTest)
+	}
+	if len(failedMetrics) > 0 {
+		return &exitCodeError{code: exitFailure, err: fmt.Errorf("%d metric(s) failed --fail-threshold, --slo or --require-all: %v", len(failedMetrics), failedMetrics)}
+	}
+	return nil
+}
+
+// cmpMetric shows the comparison for cmpFlagMetric. The agg arguments are the
+// ones set up for --agg, slo is the parsed --slo or nil.
+func cmpMetric(cmd *cobra.Command, falbaDB *db.DB, sqlDB *sql.DB, aggName, deltaName string, agg func(*anal.MetricGroup) float64, slo *anal.SLO) error {
+	// If the selector is invalid, GroupByFact will report it.
+	if metricName, _, err := anal.ParseMetricSelector(cmpFlagMetric); err == nil &&
+		falbaDB.MetricTypes[metricName].Type == falba.ValueString {
+		return cmpValues(cmd, falbaDB, sqlDB)
 	}
 
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, cmpFlagFact, cmpFlagMetric, cmpFlagFilter, cmpFlagHistWidth, cmpFlagHistClip/100, cmpFlagIgnoreFacts)
+	if err != nil {
+		return groupingError(cmd, err)
+	}
+
+	// GroupByFact should have returned ErrNoData, but just in case.
 	if len(groups) == 0 {
-		return fmt.Errorf("found no data\n")
+		return fmt.Errorf("found no data")
+	}
+	incomplete, err := checkCoverage(sqlDB)
+	if err != nil {
+		return err
+	}
+
+	if cmpFlagVerify {
+		if err := verifyCounts(sqlDB, groups); err != nil {
+			return fmt.Errorf("verifying sample counts: %v", err)
+		}
 	}
 
 	// TODO: It's kinda wrong that we support each group being for a different test...
@@ -151,88 +708,470 @@ func cmdCmp(cmd *cobra.Command, args []string) error {
 		log.Printf("WARNING: Enountered %d tests (%v), this is probably wrong.", len(allTests), allTests)
 	}
 
-	metricType := falbaDB.MetricTypes[cmpFlagMetric]
-	metricString := cmpFlagMetric
-	if metricType.Unit != nil {
-		metricString = fmt.Sprintf("%s (%s)", cmpFlagMetric, metricType.Unit.ShortName)
-	}
-
-	fmt.Printf("metric: %v   |  test: %v\n", metricString, allTests[0])
-	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-
-	header := table.Row{cmpFlagFact, "samples", "mean", "min"}
-	if cmpFlagHistWidth > 0 {
-		header = append(header, "histogram")
+	// The selector was already validated above.
+	metricName, _, _ := anal.ParseMetricSelector(cmpFlagMetric)
+	metricType := falbaDB.MetricTypes[metricName]
+	// Bool metrics are shown as the proportion that are true, and compared
+	// by the difference in that proportion. The other stats don't mean much.
+	isBool := metricType.Type == falba.ValueBool
+	if isBool {
+		aggName, deltaName = "% true", "Δ"
+		agg = func(g *anal.MetricGroup) float64 { return g.Mean }
 	}
-	header = append(header, "max", "Δμ")
-	t.AppendHeader(header)
+	showHist := cmpFlagHistWidth > 0 && !isBool
 
 	// Sort group keys so we have a consistent baseline.
 	groupKeys := slices.Collect(maps.Keys(groups))
-	slices.Sort(groupKeys)
+	if err := sortGroupKeys(falbaDB, groupKeys); err != nil {
+		return err
+	}
+
+	baseline := agg(groups[groupKeys[0]])
+	if baseline == 0 && len(groupKeys) > 1 && !isBool {
+		log.Printf("Baseline (%s = %s) has %s 0, can't compute %s (try --abs-delta)", cmpFlagFact, groupKeys[0], aggName, deltaName)
+	}
+	// For bools the delta is already absolute.
+	showAbsDelta := cmpFlagAbsDelta && !isBool
+	absDeltaName := deltaName + " abs"
 
-	var baselineMean float64
-	if len(groupKeys) > 0 {
-		baselineMean = groups[groupKeys[0]].Mean
+	// Returns the difference between the group and the baseline, with ok
+	// false if there isn't a meaningful one.
+	delta := func(group *anal.MetricGroup) (d float64, ok bool) {
+		if agg(group) == baseline || math.IsNaN(agg(group)) {
+			return 0, false
+		}
+		// For bools this is in percentage points, since a relative change in
+		// a proportion is pretty confusing.
+		if isBool {
+			return agg(group) - baseline, true
+		}
+		d, err := anal.RelativeDelta(agg(group), baseline)
+		if err != nil || math.IsNaN(d) {
+			return 0, false
+		}
+		return d, true
 	}
+	// If the delta is missing because the baseline is 0, the table says so
+	// instead of leaving a blank.
+	zeroBaseline := baseline == 0 && !isBool
 
+	// Groups whose delta exceeded the thresholds. The messages get printed
+	// after the table. This looks at all groups, even those hidden by
+	// --top.
+	var warnGroups, failGroups, threshMsgs []string
 	for _, factVal := range groupKeys {
-		group := groups[factVal]
-		var delta any
-		if group.Mean != baselineMean {
-			delta = (group.Mean - baselineMean) / baselineMean
+		if d, ok := delta(groups[factVal]); ok {
+			percent := math.Abs(d * 100)
+			if cmpFlagFailThresh > 0 && percent > cmpFlagFailThresh {
+				failGroups = append(failGroups, factVal)
+				threshMsgs = append(threshMsgs, fmt.Sprintf("%s = %s: %s %s exceeds --fail-threshold %v%%",
+					cmpFlagFact, factVal, deltaName, transformToPercentage(d), cmpFlagFailThresh))
+			} else if cmpFlagWarnThresh > 0 && percent > cmpFlagWarnThresh {
+				warnGroups = append(warnGroups, factVal)
+				threshMsgs = append(threshMsgs, fmt.Sprintf("%s = %s: %s %s exceeds --warn-threshold %v%%",
+					cmpFlagFact, factVal, deltaName, transformToPercentage(d), cmpFlagWarnThresh))
+			}
 		}
+	}
 
-		row := table.Row{
-			factVal,
-			group.Histogram.TotalSize,
-			group.Mean,
-			group.Min,
+	// With --pair-by, each group is also compared with the baseline pair by
+	// pair. Unlike the thresholds this doesn't affect the exit code.
+	var paired map[string]*anal.PairedStats
+	if cmpFlagPairBy != "" {
+		if isBool {
+			return fmt.Errorf("--pair-by isn't supported for bool metrics")
 		}
-		if cmpFlagHistWidth > 0 {
-			row = append(row, group.Histogram.PlotUnicode())
+		means, err := anal.PairedMeans(sqlDB, falbaDB, cmpFlagFact, cmpFlagPairBy, cmpFlagMetric, cmpFlagFilter)
+		if err != nil {
+			return groupingError(cmd, err)
+		}
+		paired = make(map[string]*anal.PairedStats)
+		for _, key := range groupKeys[1:] {
+			paired[key] = anal.PairedTTest(means[groupKeys[0]], means[key])
+			if paired[key].Pairs < 2 {
+				log.Printf("%s = %s: only %d %s value(s) in common with the baseline, need at least 2 for a paired comparison",
+					cmpFlagFact, key, paired[key].Pairs, cmpFlagPairBy)
+			}
 		}
-		row = append(row, group.Max, delta)
-		t.AppendRow(row)
 	}
-	t.SetStyle(table.Style{
-		Name: "mystyle",
-		Box:  table.StyleBoxDefault,
-		// Needs to be set explicitly for some reason, otherwise the table
-		// boxes don't show up.
-		Options: table.OptionsDefault,
-		Format: table.FormatOptions{
-			Header: text.FormatDefault,
-			Row:    text.FormatDefault,
-		},
-	})
+
+	var score func(key string) float64
+	switch cmpFlagTopBy {
+	case "samples":
+		score = func(key string) float64 { return float64(groups[key].Samples) }
+	case "delta":
+		score = func(key string) float64 {
+			d, _ := delta(groups[key])
+			return math.Abs(d)
+		}
+	default:
+		return fmt.Errorf("invalid --top-by %q, expect 'samples' or 'delta'", cmpFlagTopBy)
+	}
+	shownKeys, hiddenKeys := topGroups(groupKeys, cmpFlagTop, score)
+
 	transformer := newTransformer(metricType.Unit)
-	t.SetColumnConfigs([]table.ColumnConfig{
-		{Name: "mean", Transformer: transformer},
-		{Name: "min", Transformer: transformer},
-		{Name: "max", Transformer: transformer},
-		{Name: "Δμ", Transformer: transformToPercentage},
-	})
-	t.Render()
+	if isBool {
+		transformer = transformToProportion
+	}
 
-	return nil
+	// Like the thresholds, the SLO is checked for every group, including the
+	// ones hidden by --top.
+	var sloString string
+	var sloFailGroups []string
+	meetsSLO := map[string]bool{}
+	if slo != nil {
+		sloString = fmt.Sprintf("%s %s", slo.Op, transformer(slo.Target))
+		for _, key := range groupKeys {
+			meetsSLO[key] = slo.Met(agg(groups[key]))
+			if !meetsSLO[key] {
+				sloFailGroups = append(sloFailGroups, key)
+				threshMsgs = append(threshMsgs, fmt.Sprintf("%s = %s: %s %s doesn't meet --slo %s",
+					cmpFlagFact, key, aggName, transformer(agg(groups[key])), sloString))
+			}
+		}
+	}
+	// Builds the table, and the data for --template, from the current groups.
+	buildTable := func() (table.Writer, *cmpTemplateData) {
+		t := newCmpTable()
+
+		header := table.Row{cmpFlagFact, "samples", aggName}
+		if !isBool {
+			header = append(header, "min")
+			if showHist {
+				header = append(header, "histogram")
+			}
+			header = append(header, "max")
+		}
+		header = append(header, deltaName)
+		if showAbsDelta {
+			header = append(header, absDeltaName)
+		}
+		if slo != nil {
+			header = append(header, "SLO "+sloString)
+		}
+		if paired != nil {
+			header = append(header, "pairs", pairedDeltaName, "p")
+		}
+		t.AppendHeader(header)
+
+		templateData := &cmpTemplateData{
+			Metric:    cmpFlagMetric,
+			Unit:      metricType.Unit,
+			Test:      allTests[0],
+			Fact:      cmpFlagFact,
+			AggName:   aggName,
+			DeltaName: deltaName,
+			SLO:       sloString,
+			PairBy:    cmpFlagPairBy,
+		}
+		// meets is whether the row meets the SLO, ignored without --slo.
+		// pairedStats is nil for rows that don't have a paired comparison.
+		appendRow := func(label string, group *anal.MetricGroup, meets bool, pairedStats *anal.PairedStats) {
+			var aggVal, deltaVal any
+			if v := agg(group); !math.IsNaN(v) {
+				aggVal = v
+			}
+			d, hasDelta := delta(group)
+			if hasDelta {
+				deltaVal = d
+			} else if v := agg(group); zeroBaseline && v != 0 && !math.IsNaN(v) {
+				deltaVal = zeroBaselineDelta
+			}
+			templateData.Rows = append(templateData.Rows, &cmpTemplateRow{
+				Key: label, MetricGroup: group, Agg: agg(group), Delta: d, HasDelta: hasDelta, MeetsSLO: meets,
+				Paired: pairedStats,
+			})
+			row := table.Row{
+				label,
+				group.Samples,
+				aggVal,
+			}
+			if !isBool {
+				row = append(row, group.Min)
+				if showHist {
+					if cmpFlagSortHist {
+						row = append(row, group.Histogram.PlotUnicodeByFrequency())
+					} else {
+						row = append(row, group.Histogram.PlotUnicode())
+					}
+				}
+				row = append(row, group.Max)
+			}
+			row = append(row, deltaVal)
+			if showAbsDelta {
+				// Unlike the relative delta this still works when the
+				// baseline is 0.
+				var absDeltaVal any
+				if v := agg(group); v != baseline && !math.IsNaN(v) && !math.IsNaN(baseline) {
+					absDeltaVal = v - baseline
+				}
+				row = append(row, absDeltaVal)
+			}
+			if slo != nil {
+				row = append(row, map[bool]string{true: "ok", false: "FAIL"}[meets])
+			}
+			if paired != nil {
+				var pairedDelta, p any
+				var pairs any = ""
+				if pairedStats != nil {
+					pairs = pairedStats.Pairs
+					if !math.IsNaN(pairedStats.MeanDiff) {
+						pairedDelta = pairedStats.MeanDiff
+					}
+					if !math.IsNaN(pairedStats.P) {
+						p = pairedStats.P
+					}
+				}
+				row = append(row, pairs, pairedDelta, p)
+			}
+			t.AppendRow(row)
+		}
+		for _, factVal := range shownKeys {
+			appendRow(factVal, groups[factVal], meetsSLO[factVal], paired[factVal])
+		}
+		if len(hiddenKeys) > 0 {
+			var hidden []*anal.MetricGroup
+			hiddenMeetSLO := true
+			for _, key := range hiddenKeys {
+				hidden = append(hidden, groups[key])
+				hiddenMeetSLO = hiddenMeetSLO && meetsSLO[key]
+			}
+			// Pairs can't be merged, so that row doesn't get a paired comparison.
+			appendRow(fmt.Sprintf("(%d others)", len(hiddenKeys)), anal.MergeGroups(hidden), hiddenMeetSLO, nil)
+		}
+		if showHist && cmpFlagHistLegend {
+			// All the groups are binned over the same range, so we just need
+			// one legend for the whole column.
+			all := anal.MergeGroups(slices.Collect(maps.Values(groups)))
+			footer := make(table.Row, len(header))
+			for i := range footer {
+				footer[i] = ""
+			}
+			legend := all.Histogram.Legend(metricType.Unit)
+			if cmpFlagHistClip > 0 {
+				legend += fmt.Sprintf(", p%v–p%v", cmpFlagHistClip, 100-cmpFlagHistClip)
+			}
+			if cmpFlagSortHist {
+				legend += ", by frequency"
+			}
+			footer[slices.Index(header, any("histogram"))] = legend
+			t.AppendFooter(footer)
+		}
+		t.SetColumnConfigs([]table.ColumnConfig{
+			{Name: aggName, Transformer: transformer, Align: text.AlignRight},
+			{Name: "min", Transformer: transformer},
+			{Name: "max", Transformer: transformer},
+			{Name: deltaName, Transformer: transformToPercentage},
+			{Name: absDeltaName, Transformer: transformer, Align: text.AlignRight},
+			{Name: pairedDeltaName, Transformer: transformer, Align: text.AlignRight},
+			{Name: "p", Transformer: transformPValue, Align: text.AlignRight},
+		})
+		return t, templateData
+	}
+	t, templateData := buildTable()
+	if cmpFlagMaxWidth > 0 && showHist && cmpFlagTemplate == "" {
+		// The histogram is the only thing we can squeeze, so shrink it by
+		// however much the table overflows. If that doesn't leave enough
+		// room for it (or the legend is what's too wide), drop it.
+		if overflow := tableWidth(t) - cmpFlagMaxWidth; overflow > 0 {
+			histWidth := cmpFlagHistWidth - overflow
+			if histWidth >= minHistWidth {
+				groups, err = anal.GroupByFact(sqlDB, falbaDB, cmpFlagFact, cmpFlagMetric, cmpFlagFilter, histWidth, cmpFlagHistClip/100, cmpFlagIgnoreFacts)
+				if err != nil {
+					return groupingError(cmd, err)
+				}
+				t, templateData = buildTable()
+			}
+			if histWidth < minHistWidth || tableWidth(t) > cmpFlagMaxWidth {
+				showHist = false
+				t, templateData = buildTable()
+			}
+		}
+	}
+	if err := renderCmpTemplate(cmpFlagTemplate, templateData, transformer, t); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+
+	for _, msg := range threshMsgs {
+		log.Print(msg)
+	}
+
+	// Don't print the usage, these aren't errors in how the command was used.
+	cmd.SilenceUsage = true
+	if len(warnGroups) > 0 {
+		log.Printf("WARNING: %d group(s) exceeded --warn-threshold: %v", len(warnGroups), warnGroups)
+	}
+	var failures []string
+	if len(failGroups) > 0 {
+		failures = append(failures, fmt.Sprintf("%d group(s) exceeded --fail-threshold: %v", len(failGroups), failGroups))
+	}
+	if len(sloFailGroups) > 0 {
+		failures = append(failures, fmt.Sprintf("%d group(s) failed --slo %s: %v", len(sloFailGroups), sloString, sloFailGroups))
+	}
+	if len(failures) > 0 {
+		return &exitCodeError{code: exitFailure, err: errors.New(strings.Join(failures, "; "))}
+	}
+	return requireAllError(incomplete)
 }
 
 var cmpCmd = &cobra.Command{
 	Use:   "cmp",
 	Short: "Compare distributions of grouped metrics",
-	RunE:  cmdCmp,
+	Long: `Compare distributions of grouped metrics.
+
+The first group (in the order set by --fact-order) is the baseline that the
+others are compared against. --warn-threshold and --fail-threshold check
+whether any group's mean (or median, with --agg median) differs from the
+baseline by more than the threshold (in either direction). Groups over the
+warning threshold are just logged, if any group is over the failure threshold
+cmp exits with 2 (see 'falba --help' for the other exit codes).
+
+If the fact has lots of values, --top limits the table to the most interesting
+groups (see --top-by), with the rest combined into a single row. The baseline
+is always shown. The thresholds still apply to the hidden groups.
+
+For string metrics, cmp instead shows how many samples in each group have each
+of the most common values (see --top-values). There's no baseline comparison
+for these.
+
+Percentage deltas are misleading when the baseline is close to 0, and
+impossible when it is 0 (the delta column says "n/a (baseline=0)").
+--abs-delta adds a column with the absolute difference from the baseline,
+formatted in the metric's unit.
+
+For bool metrics, cmp shows the percentage of samples that are true instead,
+and the delta (which the thresholds apply to) is the difference in percentage
+points.
+
+Results that have no samples of the metric don't count towards their group,
+so if some configurations failed to produce the metric, the comparison can be
+quietly biased. cmp logs a warning saying how many results in each group are
+missing samples, and with --require-all it exits with 2 (after showing the
+table) if there are any.
+
+--test NAME only looks at results of that test. If you leave out --metric as
+well, cmp compares every metric that the test has samples of (after
+--filter), one table after another. The thresholds apply to all of them.
+Metrics that don't support the given flags (e.g. string metrics with
+--fail-threshold) are skipped with a log message.
+
+--slo checks each group against an absolute target instead of the baseline,
+e.g. --slo '<=50' with --agg median for a latency metric. The target is in the
+metric's unit (for bool metrics, it's the proportion that are true, from 0 to
+1). Without an operator it means <=. The table gets a column saying whether
+each group meets it, and if any doesn't, cmp exits with 2.
+
+When the same things were measured in every group, e.g. each configuration
+was run on the same set of machines, --pair-by machine_id compares each group
+with the baseline machine by machine. That's much more sensitive than
+comparing the groups as a whole if the machines differ a lot from each other.
+The samples are averaged for each machine, and machines that aren't in both
+the group and the baseline are left out. The table gets columns with the
+number of pairs, the mean of the per-pair differences (paired Δμ, in the
+metric's unit) and the p-value of a paired t-test, i.e. how likely a
+difference that big would be if the group was really the same as the
+baseline. The pair fact is allowed to vary within groups, like with
+--ignore-fact.
+
+If all the groups' fact values are numbers they're sorted in natural order
+(so 6.10 comes after 6.9, like a version), or numerically if the fact is an
+int or float, unless you set --fact-order. For a string fact that holds
+numbers, --fact-type-hint int (or float) converts it first, so that e.g. "08"
+and "8" are the same group and --filter can compare it as a number.
+
+Instead of --fact, you can group by the combination of several facts with
+--fact-combine a,b. The group keys are the values joined with "/" (e.g.
+6.6/eevdf), so the table shows every combination that appears in the data.
+
+To look for drift over time, --window 1d groups by when the results were
+produced instead, in windows of that length (the first window is the
+baseline). By default that's the mtime of the result's directory, i.e. when it
+was imported. Use --time-fact to use a fact instead, like for 'falba prune'.
+Results that don't have that fact are left out.
+The windows are in UTC, and they're available in --filter as the time_window
+fact. As with any fact, the other facts have to be the same within each
+window, so you'll usually want a --filter (or --ignore-fact).
+
+The histogram has one bin per character of --hist-width. If the table would be
+wider than --max-width, the histogram is narrowed to fit, or left out if that
+would make it less than 5 characters wide. With --sort-hist the bins are
+sorted by size, biggest first, instead of by value.
+
+To lay the report out differently (e.g. as Markdown or HTML), pass --template
+with a file containing a Go text/template. It's rendered instead of the
+default template, which just prints the table. --print-template prints the
+default, as a starting point. The rows are the same as the table's. The data has the fields Metric, Unit, Test, Fact, AggName,
+DeltaName, SLO, PairBy and Rows, and each row has Key, Samples, Agg, Mean,
+Median, Min, Max, Histogram, Delta, HasDelta, MeetsSLO and Paired (nil, or
+with Pairs, MeanDiff, StdDev, T and P). The template can use the functions
+"format" (format a number like the table does, in the metric's unit),
+"percent" (format a delta) and "table" (the usual table).`,
+	RunE: cmdCmp,
 }
 
 func init() {
 	rootCmd.AddCommand(cmpCmd)
+	addHasArtifactFlag(cmpCmd)
 
-	cmpCmd.Flags().StringVarP(&cmpFlagMetric, "metric", "m", "", "Metric to compare")
-	cmpCmd.MarkFlagRequired("metric")
+	cmpCmd.Flags().StringVarP(&cmpFlagMetric, "metric", "m", "", "Metric to compare, optionally with label matchers like latency{op=read}")
+	cmpCmd.Flags().BoolVar(&cmpFlagRequireAll, "require-all", false,
+		"Exit with code 2 if any results matching the filter have no samples of the metric")
+	cmpCmd.Flags().StringVarP(&cmpFlagTest, "test", "t", "",
+		"Only compare results of this test. Without --metric, compare every metric it has samples of")
 	cmpCmd.Flags().StringVarP(&cmpFlagFact, "fact", "f", "", "Fact to group by")
-	cmpCmd.MarkFlagRequired("fact")
+	cmpCmd.Flags().StringSliceVar(&cmpFlagFactCombine, "fact-combine", nil,
+		"Group by the combination of these facts instead of a single --fact")
+	cmpCmd.Flags().StringVar(&cmpFlagWindow, "window", "",
+		"Group by when the results were produced, in windows of this length, e.g. '1h' or '1d'")
+	cmpCmd.Flags().StringVar(&cmpFlagTimeFact, "time-fact", "",
+		"With --window, fact that says when the result was produced, instead of using the directory mtime")
 	cmpCmd.Flags().StringVarP(&cmpFlagFilter, "filter", "w", "TRUE", "Filter for results. SQL boolean expression.")
-	cmpCmd.Flags().IntVar(&cmpFlagHistWidth, "hist-width", 20, "Width of the histogram in characters. Set 0 to disable histogram.")
-	cmpCmd.Flags().StringSliceVar(&cmpFlagIgnoreFacts, "ignore-fact", nil, "Facts to ignore (bypass functional dependency check)")
+	cmpCmd.Flags().IntVar(&cmpFlagHistWidth, "hist-width", 20, "Width of the histogram in characters, this is also the number of bins. Set 0 to disable histogram.")
+	cmpCmd.Flags().BoolVar(&cmpFlagAbsDelta, "abs-delta", false,
+		"Also show the absolute difference from the baseline, in the metric's unit")
+	cmpCmd.Flags().IntVar(&cmpFlagMaxWidth, "max-width", 0,
+		"Maximum width of the table in characters, e.g. $COLUMNS. The histogram is narrowed (or dropped) to fit. 0 for no limit.")
+	cmpCmd.Flags().BoolVar(&cmpFlagHistLegend, "hist-legend", false, "Show the range and number of bins of the histogram below it.")
+	cmpCmd.Flags().BoolVar(&cmpFlagSortHist, "sort-hist", false,
+		"Sort the histogram bins by how many samples they have, instead of by value. Shows which values dominate, but not where they are.")
+	cmpCmd.Flags().Float64Var(&cmpFlagHistClip, "exclude-outliers-visualize", 0,
+		"Clip the histogram to between this percentile and 100 minus it (e.g. 1 for p1-p99). Doesn't affect the other columns.")
+	cmpCmd.Flags().BoolVar(&cmpFlagVerify, "verify-counts", false,
+		"Cross-check the number of samples in the table against a separate simpler query, and warn if they differ")
+	cmpCmd.Flags().StringSliceVar(&cmpFlagIgnoreFacts, "ignore-fact", nil,
+		"Facts to leave out of the functional dependency check, e.g. timestamps. Also spelled --no-functional-dependency-for.")
+	cmpCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "no-functional-dependency-for" {
+			name = "ignore-fact"
+		}
+		return pflag.NormalizedName(name)
+	})
+	cmpCmd.Flags().Float64Var(&cmpFlagWarnThresh, "warn-threshold", 0, "Log a warning if any group's delta exceeds this percentage. 0 to disable.")
+	cmpCmd.Flags().Float64Var(&cmpFlagFailThresh, "fail-threshold", 0, "Exit with code 2 if any group's delta exceeds this percentage. 0 to disable.")
+	cmpCmd.Flags().StringVar(&cmpFlagSLO, "slo", "",
+		"Exit with code 2 if any group's --agg statistic doesn't meet this target, in the metric's unit, e.g. '<=50' or '>1000'")
+	cmpCmd.Flags().StringVar(&cmpFlagFactOrder, "fact-order", "",
+		"Order of the rows: 'lexical', 'numeric', 'natural' (e.g. run-2 before run-10) or 'explicit:a,b,c'. The first row is the baseline. "+
+			"By default it's natural if all the values are numbers (numeric for int and float facts), otherwise lexical.")
+	cmpCmd.Flags().StringVar(&cmpFlagFactHint, "fact-type-hint", "",
+		"Treat the --fact as this type ('int' or 'float') instead of a string, for numbers that were parsed as strings")
+	cmpCmd.Flags().StringVar(&cmpFlagPairBy, "pair-by", "",
+		"Fact identifying what was measured in each group (e.g. machine_id), to compare each group with the baseline pair by pair")
+	cmpCmd.Flags().IntVar(&cmpFlagTop, "top", 0,
+		"Only show this many groups (including the baseline), lumping the rest together in an 'others' row. 0 for no limit.")
+	cmpCmd.Flags().StringVar(&cmpFlagTopBy, "top-by", "samples",
+		"How --top picks the groups to show: 'samples' (the most samples) or 'delta' (the biggest difference from the baseline)")
+	cmpCmd.Flags().IntVar(&cmpFlagTopValues, "top-values", 5,
+		"For string metrics, how many of the most common values to show. The rest are counted together. 0 for no limit.")
+	cmpCmd.Flags().StringVar(&cmpFlagTemplate, "template", "",
+		"Render the results with this Go text/template file instead of the default one, which prints the table")
+	cmpCmd.Flags().BoolVar(&cmpFlagPrintTemplate, "print-template", false,
+		"Print the default --template and exit")
+	cmpCmd.Flags().StringVar(&cmpFlagAgg, "agg", "mean",
+		"Statistic to show and compare against the baseline: 'mean' or 'median'. Median is better for skewed data like latencies.")
+	// These go after the flags are defined. --print-template doesn't compare
+	// anything, so it doesn't need something to group by.
+	cmpCmd.MarkFlagsOneRequired("fact", "fact-combine", "window", "print-template")
+	cmpCmd.MarkFlagsMutuallyExclusive("fact", "fact-combine", "window")
 }
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// resetFlags puts the flags of the command and its subcommands back how they
+// were before any were parsed, since the variables outlive each run. This
+// doesn't work for slice flags, which remember that they were set and append
+// to the old value next time, so tests mustn't pass those.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if _, ok := f.Value.(pflag.SliceValue); !ok {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+// runFalba runs the command line in-process against the DB and returns what
+// it printed to stdout.
+func runFalba(t *testing.T, resultDB string, args ...string) string {
+	t.Helper()
+	oldResultDBs := flagResultDBs
+	flagResultDBs = []string{resultDB}
+	defer func() { flagResultDBs = oldResultDBs }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	defer resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	err = rootCmd.Execute()
+	w.Close()
+	out, readErr := io.ReadAll(r)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if err != nil {
+		t.Fatalf("falba %v failed: %v\nOutput:\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+// writeTestDB creates a DB where each result (keyed by ID, all for test
+// my_test) has the given artifacts. The config and ts artifacts are facts, the
+// value artifact is an int metric.
+func writeTestDB(t *testing.T, results map[string]map[string]string) string {
+	t.Helper()
+	resultDB := t.TempDir()
+	parsers := `{
+		"parsers": {
+			"config": {"type": "single_metric", "artifact_regexp": "config", "fact": {"name": "config", "type": "string"}},
+			"ts": {"type": "single_metric", "artifact_regexp": "ts", "fact": {"name": "ts", "type": "int"}},
+			"value": {"type": "single_metric", "artifact_regexp": "value", "metric": {"name": "value", "type": "int"}},
+			"label": {"type": "single_metric", "artifact_regexp": "label", "metric": {"name": "label", "type": "string"}}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(resultDB, "parsers.json"), []byte(parsers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for resultID, artifacts := range results {
+		artifactsDir := filepath.Join(resultDB, "my_test:"+resultID, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range artifacts {
+			if err := os.WriteFile(filepath.Join(artifactsDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return resultDB
+}
+
+func TestCmp_ZeroBaseline(t *testing.T) {
+	// Keep the DuckDB file out of the source tree.
+	t.Chdir(t.TempDir())
+	resultDB := writeTestDB(t, map[string]map[string]string{
+		"aaaa": {"config": "base", "value": "0"},
+		"bbbb": {"config": "other", "value": "5"},
+		"cccc": {"config": "same", "value": "0"},
+	})
+
+	out := runFalba(t, resultDB, "cmp", "--fact", "config", "--metric", "value",
+		"--fact-order", "explicit:base,other,same")
+	rows := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		for _, key := range []string{"base", "other", "same"} {
+			if strings.Contains(line, " "+key+" ") {
+				rows[key] = line
+			}
+		}
+	}
+	if !strings.Contains(rows["other"], zeroBaselineDelta) {
+		t.Errorf("Row for a nonzero group doesn't say %q:\n%s", zeroBaselineDelta, out)
+	}
+	// There's no delta at all if the group is 0 too.
+	for _, key := range []string{"base", "same"} {
+		if row, ok := rows[key]; !ok || strings.Contains(row, zeroBaselineDelta) {
+			t.Errorf("Row for %s missing or has a delta:\n%s", key, out)
+		}
+	}
+}
+
+func TestCmp_WindowMissingTimeFact(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resultDB := writeTestDB(t, map[string]map[string]string{
+		"aaaa": {"ts": "0", "value": "1"},
+		"bbbb": {"ts": "100000", "value": "2"},
+		"cccc": {"value": "100"},
+	})
+
+	out := runFalba(t, resultDB, "cmp", "--metric", "value",
+		"--window", "1d", "--time-fact", "ts")
+	if strings.Contains(out, "<NULL>") {
+		t.Errorf("Result without the --time-fact got a window:\n%s", out)
+	}
+	for _, window := range []string{"1970-01-01", "1970-01-02"} {
+		if !strings.Contains(out, window) {
+			t.Errorf("No row for window %s:\n%s", window, out)
+		}
+	}
+}
+
+func TestCmp_DefaultOrderVersions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resultDB := writeTestDB(t, map[string]map[string]string{
+		"aaaa": {"config": "6.10", "value": "1"},
+		"bbbb": {"config": "6.9", "value": "2"},
+		"cccc": {"config": "6.1", "value": "3"},
+	})
+
+	out := runFalba(t, resultDB, "cmp", "--fact", "config", "--metric", "value")
+	var got []string
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && strings.HasPrefix(fields[1], "6.") {
+			got = append(got, fields[1])
+		}
+	}
+	if want := []string{"6.1", "6.9", "6.10"}; !slices.Equal(got, want) {
+		t.Errorf("Rows in order %v, want %v:\n%s", got, want, out)
+	}
+}
+
+func TestCmp_DefaultTemplate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resultDB := writeTestDB(t, map[string]map[string]string{
+		"aaaa": {"config": "base", "value": "1"},
+		"bbbb": {"config": "other", "value": "2"},
+	})
+	tmplPath := filepath.Join(t.TempDir(), "default.tmpl")
+	if err := os.WriteFile(tmplPath, []byte(runFalba(t, resultDB, "cmp", "--print-template")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The default output comes from the default template, so rendering a copy
+	// of it should give exactly the same thing.
+	want := runFalba(t, resultDB, "cmp", "--fact", "config", "--metric", "value")
+	got := runFalba(t, resultDB, "cmp", "--fact", "config", "--metric", "value", "--template", tmplPath)
+	if got != want {
+		t.Errorf("Output with the printed default template:\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(want, "metric: value") || !strings.Contains(want, "| other ") {
+		t.Errorf("Default output doesn't look like the table:\n%s", want)
+	}
+}
+
+func TestCmp_TestSkipsUnsupportedMetrics(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resultDB := writeTestDB(t, map[string]map[string]string{
+		"aaaa": {"config": "base", "value": "10", "label": "foo"},
+		"bbbb": {"config": "other", "value": "11", "label": "bar"},
+	})
+
+	// --fail-threshold doesn't work for the string metric, that shouldn't
+	// stop the int metric from being compared.
+	out := runFalba(t, resultDB, "cmp", "--fact", "config", "--test", "my_test",
+		"--fail-threshold", "50")
+	if !strings.Contains(out, "metric: value") {
+		t.Errorf("Output doesn't have the value metric:\n%s", out)
+	}
+	if strings.Contains(out, "metric: label") {
+		t.Errorf("Output has the string metric despite --fail-threshold:\n%s", out)
+	}
+}
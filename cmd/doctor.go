@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorFlagMaxCoV float64
+	doctorFlagJSON   bool
+)
+
+// doctorReport is the output of doctor --json. Scripts depend on this so only
+// add fields, don't change the existing ones.
+type doctorReport struct {
+	Results int `json:"results"`
+	// Sorted by name.
+	Parsers []doctorParser `json:"parsers"`
+	// Names of parsers that didn't match any artifacts, these also show up
+	// as findings.
+	UnmatchedParsers []string `json:"unmatched_parsers"`
+	// Most severe first.
+	Findings []doctorFinding `json:"findings"`
+	Errors   int             `json:"errors"`
+	Warnings int             `json:"warnings"`
+	Info     int             `json:"info"`
+}
+
+type doctorParser struct {
+	Name             string `json:"name"`
+	MatchedArtifacts int    `json:"matched_artifacts"`
+	ProducedValues   int    `json:"produced_values"`
+}
+
+type doctorFinding struct {
+	// "error", "warning" or "info".
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+func newDoctorReport(falbaDB *db.DB, findings []*db.Finding) *doctorReport {
+	report := &doctorReport{
+		Results:          len(falbaDB.Results),
+		Parsers:          []doctorParser{},
+		UnmatchedParsers: falbaDB.UnmatchedParsers(),
+		Findings:         []doctorFinding{},
+	}
+	if report.UnmatchedParsers == nil {
+		report.UnmatchedParsers = []string{}
+	}
+	for _, name := range slices.Sorted(maps.Keys(falbaDB.ParserStats)) {
+		stats := falbaDB.ParserStats[name]
+		report.Parsers = append(report.Parsers, doctorParser{
+			Name:             name,
+			MatchedArtifacts: stats.MatchedArtifacts,
+			ProducedValues:   stats.ProducedValues,
+		})
+	}
+	for _, f := range findings {
+		report.Findings = append(report.Findings, doctorFinding{
+			Severity: strings.ToLower(f.Severity.String()),
+			Check:    f.Check,
+			Message:  f.Message,
+		})
+		switch f.Severity {
+		case db.SeverityError:
+			report.Errors++
+		case db.SeverityWarning:
+			report.Warnings++
+		case db.SeverityInfo:
+			report.Info++
+		}
+	}
+	return report
+}
+
+func cmdDoctor(cmd *cobra.Command, args []string) error {
+	falbaDB, err := readDB(flagResultDBs)
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	findings := falbaDB.Doctor(db.DoctorOptions{MaxCoV: doctorFlagMaxCoV})
+	report := newDoctorReport(falbaDB, findings)
+	if doctorFlagJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("encoding JSON: %v", err)
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		fmt.Printf("%d results: %d errors, %d warnings, %d info\n", report.Results,
+			report.Errors, report.Warnings, report.Info)
+	}
+	if report.Errors > 0 {
+		return &exitCodeError{code: exitFailure, err: fmt.Errorf("found %d errors", report.Errors)}
+	}
+	return nil
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the DB for problems",
+	Long: `Run a bunch of checks over the DB and report anything that looks wrong, most
+severe first. This looks for parsers that never matched, metrics with no
+samples, results that seem to be missing artifacts, very noisy metrics, facts
+that are the same for every result and name collisions.
+
+Exits with 2 if any errors were found. Warnings don't affect the exit code.
+
+With --json, prints a JSON object instead, for scripts. This has "results"
+(the number of results), "parsers" (a list of objects with "name",
+"matched_artifacts" and "produced_values"), "unmatched_parsers" (a list of
+names), "findings" (a list of objects with "severity", which is "error",
+"warning" or "info", "check" and "message") and the total "errors",
+"warnings" and "info".`,
+	Args: cobra.NoArgs,
+	RunE: cmdDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().Float64Var(&doctorFlagMaxCoV, "max-cov", 0.1,
+		"Report metrics whose coefficient of variation within a result is above this")
+	doctorCmd.Flags().BoolVar(&doctorFlagJSON, "json", false, "Print the report as JSON")
+}
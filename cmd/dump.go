@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	dumpFlagFormat  string
+	dumpFlagMetrics bool
+)
+
+func cmdDump(cmd *cobra.Command, args []string) error {
+	_, sqlDB, err := setupSQL(nil)
+	if err != nil {
+		return fmt.Errorf("setting up SQL DB: %w", err)
+	}
+	defer sqlDB.Close()
+	cmd.SilenceUsage = true
+
+	query := "SELECT * FROM results ORDER BY result_id"
+	if dumpFlagMetrics {
+		// One row per metric sample, with the facts of the result it came
+		// from.
+		query = `SELECT * EXCLUDE (metric_samples)
+			FROM results INNER JOIN metrics USING (result_id)
+			ORDER BY result_id, metric`
+	}
+	return runQuery(sqlDB, query, dumpFlagFormat)
+}
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the whole DB",
+	Long: `Print the results table, with one row per result and one column per fact. With
+--metrics, print every metric sample instead, joined with the facts of its
+result.
+
+This is a shortcut for 'falba sql --query', for when you just want to get the
+data into some other tool.`,
+	Args: cobra.NoArgs,
+	RunE: cmdDump,
+}
+
+func init() {
+	rootCmd.AddCommand(dumpCmd)
+	addHasArtifactFlag(dumpCmd)
+	dumpCmd.Flags().StringVar(&dumpFlagFormat, "format", "table", "Output format: table, csv or json")
+	dumpCmd.Flags().BoolVar(&dumpFlagMetrics, "metrics", false, "Print a row per metric sample instead of per result")
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bjackman/falba/internal/anal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	histFlagMetric string
+	histFlagFact   string
+	histFlagFilter string
+	histFlagBins   int
+	histFlagLog    bool
+	histFlagWidth  int
+)
+
+// horizontalBar returns a bar of block elements that's width characters long
+// when fraction is 1, using the partial blocks for finer resolution.
+func horizontalBar(fraction float64, width int) string {
+	partials := []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉'}
+	eighths := int(math.Round(fraction * float64(width) * 8))
+	bar := strings.Repeat("█", eighths/8)
+	if eighths%8 != 0 {
+		bar += string(partials[eighths%8])
+	}
+	return bar
+}
+
+// printHistogram prints one line per bin, with the range, the count and a
+// bar.
+func printHistogram(h *anal.Histogram, transformer func(v any) string) {
+	var labels []string
+	lo := h.MinBoundary()
+	for i, bin := range h.Bins() {
+		open := "("
+		if i == 0 {
+			open = "["
+		}
+		labels = append(labels, fmt.Sprintf("%s%s, %s]", open, transformer(lo), transformer(bin.Boundary())))
+		lo = bin.Boundary()
+	}
+	labelWidth := 0
+	for _, l := range labels {
+		labelWidth = max(labelWidth, len([]rune(l)))
+	}
+	countWidth := len(fmt.Sprint(h.MaxSize()))
+	for i, bin := range h.Bins() {
+		fraction := 0.0
+		if h.MaxSize() > 0 {
+			fraction = float64(bin.Size()) / float64(h.MaxSize())
+		}
+		fmt.Printf("  %-*s %*d │%s\n", labelWidth, labels[i], countWidth, bin.Size(),
+			horizontalBar(fraction, histFlagWidth))
+	}
+}
+
+func cmdHist(cmd *cobra.Command, args []string) error {
+	if histFlagBins <= 0 {
+		return fmt.Errorf("--bins must be positive")
+	}
+	if histFlagWidth <= 0 {
+		return fmt.Errorf("--width must be positive")
+	}
+	falbaDB, sqlDB, err := setupSQL(nil)
+	if err != nil {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("setting up SQL DB: %w", err)
+	}
+
+	var facts []string
+	if histFlagFact != "" {
+		facts = []string{histFlagFact}
+	}
+	groups, err := anal.Groups(sqlDB, falbaDB, facts, histFlagMetric, histFlagFilter)
+	if err != nil {
+		if errors.Is(err, anal.ErrNoData) {
+			cmd.SilenceUsage = true
+		}
+		return fmt.Errorf("getting samples: %v", err)
+	}
+	cmd.SilenceUsage = true
+
+	// The selector was already validated above.
+	metricName, _, _ := anal.ParseMetricSelector(histFlagMetric)
+	metricType := falbaDB.MetricTypes[metricName]
+	metricString := histFlagMetric
+	if metricType.Unit != nil {
+		metricString = fmt.Sprintf("%s (%s)", histFlagMetric, metricType.Unit.ShortName)
+	}
+	transformer := newTransformer(metricType.Unit)
+
+	// Use the same range for every group so they can be compared.
+	var all []float64
+	for _, samples := range groups {
+		all = append(all, samples...)
+	}
+	lo, hi := slices.Min(all), slices.Max(all)
+	numBins := histFlagBins
+	if lo == hi {
+		// All the bins would be the same, one line is enough.
+		numBins = 1
+	}
+	keys := slices.Sorted(maps.Keys(groups))
+	for i, key := range keys {
+		if i > 0 {
+			fmt.Println()
+		}
+		samples := groups[key]
+		title := metricString
+		if histFlagFact != "" {
+			title = fmt.Sprintf("%s  |  %s = %s", metricString, histFlagFact, key)
+		}
+		fmt.Printf("%s  |  %d samples, mean %s, median %s\n", title, len(samples),
+			transformer(anal.Mean(samples)), transformer(anal.Median(samples)))
+		h, err := anal.HistogramOf(samples, lo, hi, numBins, histFlagLog)
+		if err != nil {
+			return err
+		}
+		printHistogram(&h, transformer)
+	}
+	return nil
+}
+
+var histCmd = &cobra.Command{
+	Use:   "hist",
+	Short: "Show a detailed histogram of a metric",
+	Long: `Show a detailed histogram of a metric, with one line per bin showing the range
+of the bin, the number of samples in it and a bar.
+
+With --fact, there's a separate histogram for each value of the fact, all with
+the same bins.`,
+	Args: cobra.NoArgs,
+	RunE: cmdHist,
+}
+
+func init() {
+	rootCmd.AddCommand(histCmd)
+	addHasArtifactFlag(histCmd)
+
+	histCmd.Flags().StringVarP(&histFlagMetric, "metric", "m", "", "Metric to show")
+	histCmd.MarkFlagRequired("metric")
+	histCmd.Flags().StringVarP(&histFlagFact, "fact", "f", "", "Fact to group by (optional)")
+	histCmd.Flags().StringVarP(&histFlagFilter, "filter", "w", "TRUE", "Filter for results. SQL boolean expression.")
+	histCmd.Flags().IntVar(&histFlagBins, "bins", 20, "Number of bins")
+	histCmd.Flags().BoolVar(&histFlagLog, "log", false, "Use a logarithmic x-axis, i.e. bins of equal width in log space")
+	histCmd.Flags().IntVar(&histFlagWidth, "width", 50, "Width of the longest bar in characters")
+}
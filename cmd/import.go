@@ -1,24 +1,168 @@
 package cmd
 
 import (
+	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/bjackman/falba/internal/csvimport"
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+	"github.com/bjackman/falba/internal/walk"
 	"github.com/spf13/cobra"
 )
 
 var (
-	importFlagTestName string
+	importFlagTestName     string
+	importFlagTestNameFrom string
+	importFlagDryRun       bool
+	importFlagIDLength     int
+	importFlagFromCSV      string
+	importFlagCSVSchema    string
+	importFlagVerify       bool
+	importFlagDedup        bool
 )
 
+// testNameFromArtifacts evaluates the JSONPath expression on each of the
+// artifacts and returns the string it produces. Artifacts where that fails
+// (e.g. because they aren't JSON) are skipped. If several artifacts produce
+// a name they have to agree. Returns "" if no artifact produced a name.
+func testNameFromArtifacts(jsonPath string, artifacts []*falba.Artifact) (string, error) {
+	extractor, err := parser.NewJSONPathExtractor(jsonPath, falba.ValueString)
+	if err != nil {
+		return "", fmt.Errorf("setting up JSONPath extractor: %v", err)
+	}
+	var name string
+	var nameFrom *falba.Artifact
+	for _, artifact := range artifacts {
+		vals, err := extractor.Extract(artifact)
+		if err != nil || len(vals) != 1 {
+			continue
+		}
+		n := vals[0].StringValue()
+		if nameFrom != nil && n != name {
+			return "", fmt.Errorf("%v gives test name %q but %v gives %q", nameFrom.Name, name, artifact.Name, n)
+		}
+		name, nameFrom = n, artifact
+	}
+	if nameFrom != nil {
+		log.Printf("Got test name %q from %v", name, nameFrom.Name)
+	}
+	return name, nil
+}
+
+// existingResultIDs maps the IDs of the results already in the DB to their
+// test names.
+func existingResultIDs(resultDB string) (map[string]string, error) {
+	entries, err := os.ReadDir(resultDB)
+	if err != nil {
+		return nil, fmt.Errorf("reading DB dir: %v", err)
+	}
+	existing := make(map[string]string)
+	for _, entry := range entries {
+		if name, id, ok := strings.Cut(entry.Name(), ":"); ok && !strings.HasPrefix(entry.Name(), ".") {
+			existing[id] = name
+		}
+	}
+	return existing, nil
+}
+
+// pickResultID returns the shortest prefix of the hash (but at least minLength
+// chars) that isn't already the ID of a result in existing (see
+// existingResultIDs), so that short IDs don't collide. If the ID belongs to a
+// result for the same test, isSame is called with the ID to check whether it's
+// really the same result being imported twice, rather than a different one
+// whose hash happens to start the same. If it is, that ID is returned with
+// exists set.
+func pickResultID(existing map[string]string, testName string, hash string, minLength int, isSame func(id string) (bool, error)) (id string, exists bool, err error) {
+	for n := minLength; n <= len(hash); n++ {
+		id := hash[:n]
+		otherTest, ok := existing[id]
+		if !ok {
+			return id, false, nil
+		}
+		if otherTest == testName {
+			same, err := isSame(id)
+			if err != nil {
+				return "", false, err
+			}
+			if same {
+				return id, true, nil
+			}
+			log.Printf("Result ID %s is already used by a different %q result, making it longer", id, otherTest)
+			continue
+		}
+		log.Printf("Result ID %s is already used by test %q, making it longer", id, otherTest)
+	}
+	return "", false, fmt.Errorf("no unique result ID for hash %s", hash)
+}
+
+// sameArtifacts reports whether the artifacts of the result in resultDir are
+// exactly the ones in want, which maps paths relative to the artifacts dir to
+// the hex SHA-256 of their content. A result dir that doesn't exist (yet) has
+// no artifacts.
+func sameArtifacts(resultDir string, want map[string]string) (bool, error) {
+	artifactsDir := filepath.Join(resultDir, "artifacts")
+	got := make(map[string]string)
+	err := filepath.WalkDir(artifactsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(artifactsDir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		got[rel] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading artifacts of %s: %w", resultDir, err)
+	}
+	return maps.Equal(got, want), nil
+}
+
 func importCmdRunE(cmd *cobra.Command, args []string) error {
 	artifactPaths := args
 
+	resultDB, err := singleResultDB()
+	if err != nil {
+		return err
+	}
+	if importFlagIDLength < 4 || importFlagIDLength > sha256.Size*2 {
+		return fmt.Errorf("--id-length must be between 4 and %d", sha256.Size*2)
+	}
+	if importFlagFromCSV != "" {
+		if len(artifactPaths) != 0 {
+			return fmt.Errorf("can't pass artifact paths with --from-csv")
+		}
+		return importCSV(resultDB)
+	}
+	if len(artifactPaths) == 0 {
+		return fmt.Errorf("need at least one artifact path (or --from-csv)")
+	}
+
 	// Helper to walk through the files. This implements the logic where we
 	// treat individial files individually (copying them straight to the root of
 	// the artifacts dir), and directories as a special group (maintaining their
@@ -28,6 +172,8 @@ func importCmdRunE(cmd *cobra.Command, args []string) error {
 		currentPath string
 		// Where it needs to go, relative to artifacts/
 		relativePath string
+		// Hex SHA-256 of the content, for --dedup.
+		sha string
 	}
 	var artifactsToProcess []artifactEntry
 
@@ -38,21 +184,16 @@ func importCmdRunE(cmd *cobra.Command, args []string) error {
 		}
 
 		if info.IsDir() {
-			err := filepath.WalkDir(inputPath, func(path string, d os.DirEntry, err error) error {
+			err := walk.Files(inputPath, !flagNoFollowSymlinks, func(path string) error {
+				parentDir := filepath.Dir(filepath.Clean(inputPath))
+				relPath, err := filepath.Rel(parentDir, path)
 				if err != nil {
-					return err
-				}
-				if !d.IsDir() {
-					parentDir := filepath.Dir(filepath.Clean(inputPath))
-					relPath, err := filepath.Rel(parentDir, path)
-					if err != nil {
-						return fmt.Errorf("failed to get relative path for %s: %w", path, err)
-					}
-					artifactsToProcess = append(artifactsToProcess, artifactEntry{
-						currentPath:  path,
-						relativePath: relPath,
-					})
+					return fmt.Errorf("failed to get relative path for %s: %w", path, err)
 				}
+				artifactsToProcess = append(artifactsToProcess, artifactEntry{
+					currentPath:  path,
+					relativePath: relPath,
+				})
 				return nil
 			})
 			if err != nil {
@@ -63,9 +204,34 @@ func importCmdRunE(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	testName := importFlagTestName
+	if importFlagTestNameFrom != "" {
+		var artifacts []*falba.Artifact
+		for _, entry := range artifactsToProcess {
+			artifacts = append(artifacts, &falba.Artifact{Name: entry.relativePath, Path: entry.currentPath})
+		}
+		name, err := testNameFromArtifacts(importFlagTestNameFrom, artifacts)
+		if err != nil {
+			return fmt.Errorf("getting test name from artifacts: %v", err)
+		}
+		if name != "" {
+			testName = name
+		} else if testName == "" {
+			return fmt.Errorf("no artifact had a string at %v, and no --test-name to fall back to", importFlagTestNameFrom)
+		} else {
+			log.Printf("No artifact had a string at %v, falling back to --test-name", importFlagTestNameFrom)
+		}
+	}
+	if testName == "" {
+		return fmt.Errorf("need --test-name or --test-name-from")
+	}
+	if err := db.CheckTestName(testName); err != nil {
+		return err
+	}
+
 	// Calculate result ID.
 	hash := sha256.New()
-	for _, entry := range artifactsToProcess {
+	for i, entry := range artifactsToProcess {
 		f, err := os.Open(entry.currentPath)
 		if err != nil {
 			return fmt.Errorf("failed to open artifact %s for hashing: %w", entry.currentPath, err)
@@ -77,65 +243,335 @@ func importCmdRunE(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to hash content of %s: %w", entry.currentPath, err)
 		}
 		hash.Write(fileHash.Sum(nil))
+		artifactsToProcess[i].sha = hex.EncodeToString(fileHash.Sum(nil))
+	}
+	existing, err := existingResultIDs(resultDB)
+	if err != nil {
+		return err
+	}
+	shas := make(map[string]string)
+	for _, entry := range artifactsToProcess {
+		shas[entry.relativePath] = entry.sha
+	}
+	isSame := func(id string) (bool, error) {
+		return sameArtifacts(filepath.Join(resultDB, fmt.Sprintf("%s:%s", testName, id)), shas)
+	}
+	hashStr, exists, err := pickResultID(existing, testName, hex.EncodeToString(hash.Sum(nil)), importFlagIDLength, isSame)
+	if err != nil {
+		return err
 	}
-	hashStr := hex.EncodeToString(hash.Sum(nil))[:12]
 
-	resultDir := filepath.Join(flagResultDB, fmt.Sprintf("%s:%s", importFlagTestName, hashStr))
+	resultDir := filepath.Join(resultDB, fmt.Sprintf("%s:%s", testName, hashStr))
 
-	err := os.Mkdir(resultDir, 0755)
-	if err != nil {
-		if os.IsExist(err) {
-			return fmt.Errorf("result directory %s already exists", resultDir)
+	if importFlagDryRun {
+		fmt.Printf("Test name: %s\n", testName)
+		fmt.Printf("Result ID: %s\n", hashStr)
+		fmt.Printf("Result dir: %s\n", resultDir)
+		if exists {
+			fmt.Printf("  (already exists, import would fail)\n")
+		}
+		fmt.Printf("Artifacts (%d):\n", len(artifactsToProcess))
+		for _, entry := range artifactsToProcess {
+			fmt.Printf("  %s -> artifacts/%s\n", entry.currentPath, entry.relativePath)
 		}
-		return fmt.Errorf("failed to create result directory %s: %w", resultDir, err)
+		return nil
+	}
+
+	if exists {
+		return fmt.Errorf("result directory %s already exists", resultDir)
 	}
 
-	artifactsDir := filepath.Join(resultDir, "artifacts")
 	numCopied := 0
-	for _, entry := range artifactsToProcess {
-		destPath := filepath.Join(artifactsDir, entry.relativePath)
+	dedup := importFlagDedup
+	err = installResult(resultDB, hashStr, resultDir, func(artifactsDir string) error {
+		for _, entry := range artifactsToProcess {
+			destPath := filepath.Join(artifactsDir, entry.relativePath)
 
-		err := os.MkdirAll(filepath.Dir(destPath), 0755)
-		if err != nil {
-			return fmt.Errorf("failed to create parent directory for %s: %w", destPath, err)
+			err := os.MkdirAll(filepath.Dir(destPath), 0755)
+			if err != nil {
+				return internalError(fmt.Errorf("failed to create parent directory for %s: %w", destPath, err))
+			}
+			if dedup {
+				err := db.LinkBlob(resultDB, entry.sha, entry.currentPath, destPath)
+				if err == nil {
+					numCopied++
+					continue
+				}
+				log.Printf("Can't hardlink %s to the blob store, copying artifacts instead: %v", entry.relativePath, err)
+				dedup = false
+			}
+			if err := copyFile(entry.currentPath, destPath); err != nil {
+				return internalError(fmt.Errorf("failed to copy artifact from %s to %s: %w", entry.currentPath, destPath, err))
+			}
+			numCopied++
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		sourceFile, err := os.Open(entry.currentPath)
+	log.Printf("Imported %d artifacts to %s", numCopied, resultDir)
+
+	if importFlagVerify {
+		falbaDB, err := readDB([]string{resultDB})
 		if err != nil {
-			return fmt.Errorf("failed to open source artifact %s: %w", entry.currentPath, err)
+			return err
+		}
+		result, ok := falbaDB.Results[hashStr]
+		if !ok {
+			return fmt.Errorf("imported result %s not found when re-reading the DB", hashStr)
+		}
+		printResult(os.Stdout, result)
+	}
+	return nil
+}
+
+// printResult shows what the parsers and derivers made of a result, so you
+// can check they worked.
+func printResult(w io.Writer, result *falba.Result) {
+	fmt.Fprintf(w, "Result %s (test %s)\n", result.ResultID, result.TestName)
+	fmt.Fprintf(w, "Facts (%d):\n", len(result.Facts))
+	for _, name := range slices.Sorted(maps.Keys(result.Facts)) {
+		fmt.Fprintf(w, "  %s = %v\n", name, falba.ValueValue(result.Facts[name]))
+	}
+	fmt.Fprintf(w, "Metrics (%d):\n", len(result.Metrics))
+	for _, m := range result.Metrics {
+		name := m.Name
+		if len(m.Labels) > 0 {
+			var labels []string
+			for _, k := range slices.Sorted(maps.Keys(m.Labels)) {
+				labels = append(labels, k+"="+m.Labels[k])
+			}
+			name += "{" + strings.Join(labels, ",") + "}"
 		}
-		defer sourceFile.Close()
+		if m.Repetition != nil {
+			name += fmt.Sprintf(" (repetition %d)", *m.Repetition)
+		}
+		fmt.Fprintf(w, "  %s = %v\n", name, falba.ValueValue(m.Value))
+	}
+	for _, e := range result.ParseErrors {
+		fmt.Fprintf(w, "Parse error: parser %s on %s: %s\n", e.Parser, e.Artifact, e.Message)
+	}
+}
 
-		destFile, err := os.Create(destPath)
+// installResult creates resultDir, with writeArtifacts filling in its
+// artifacts dir. Everything is written into a hidden temp dir (which ReadDB
+// ignores) and then renamed into place, so that a failure part-way through
+// doesn't leave a half-imported result in the DB. If we got killed during a
+// previous attempt there might be a stale temp dir, it's fine to clobber that.
+func installResult(resultDB string, resultID string, resultDir string, writeArtifacts func(artifactsDir string) error) error {
+	tmpDir := filepath.Join(resultDB, ".importing-"+resultID)
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return internalError(fmt.Errorf("failed to remove stale temp directory %s: %w", tmpDir, err))
+	}
+	if err := os.Mkdir(tmpDir, 0755); err != nil {
+		return internalError(fmt.Errorf("failed to create temp directory %s: %w", tmpDir, err))
+	}
+	defer os.RemoveAll(tmpDir)
+
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	if err := os.Mkdir(artifactsDir, 0755); err != nil {
+		return internalError(fmt.Errorf("failed to create artifacts directory %s: %w", artifactsDir, err))
+	}
+	if err := writeArtifacts(artifactsDir); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpDir, resultDir); err != nil {
+		return internalError(fmt.Errorf("failed to move %s into place: %w", tmpDir, err))
+	}
+	return nil
+}
+
+// importCSV creates a result for each row of the --from-csv file. The file is
+// streamed, so it can be bigger than memory. Rows that were already imported
+// are skipped, so it's fine to re-run after adding rows to the file.
+func importCSV(resultDB string) error {
+	if importFlagCSVSchema == "" {
+		return fmt.Errorf("--from-csv needs --csv-schema")
+	}
+	schema, err := csvimport.ParseSchema(importFlagCSVSchema)
+	if err != nil {
+		return fmt.Errorf("parsing --csv-schema: %v", err)
+	}
+	f, err := os.Open(importFlagFromCSV)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	delimiter := ','
+	if strings.HasSuffix(importFlagFromCSV, ".tsv") {
+		delimiter = '\t'
+	}
+	reader, err := csvimport.NewReader(bufio.NewReader(f), delimiter, schema)
+	if err != nil {
+		return fmt.Errorf("reading %v: %v", importFlagFromCSV, err)
+	}
+	existing, err := existingResultIDs(resultDB)
+	if err != nil {
+		return err
+	}
+
+	// Counts rows with the same content. Identical rows are probably just
+	// repeated measurements that happened to give the same numbers, so they
+	// need separate results.
+	occurrences := make(map[string]int)
+	var numImported, numSkipped int
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return fmt.Errorf("failed to create destination artifact %s: %w", destPath, err)
+			return fmt.Errorf("reading %v: %v", importFlagFromCSV, err)
+		}
+		testName := row.TestName
+		if testName == "" {
+			testName = importFlagTestName
+		}
+		if testName == "" {
+			return fmt.Errorf("line %d: no test name in the row, and no --test-name to fall back to", row.Line)
+		}
+		if err := db.CheckTestName(testName); err != nil {
+			return fmt.Errorf("line %d: %v", row.Line, err)
 		}
-		defer destFile.Close()
 
-		_, err = io.Copy(destFile, sourceFile)
+		// Same scheme as for normal imports, so the ID only depends on the
+		// artifacts, except that repeats of a row also mix in how many times
+		// it's been seen. That way re-importing the file is still a no-op.
+		hash := sha256.New()
+		shas := make(map[string]string)
+		for _, a := range row.Artifacts {
+			fileHash := sha256.Sum256(a.Content)
+			hash.Write(fileHash[:])
+			shas[a.Name] = hex.EncodeToString(fileHash[:])
+		}
+		key := testName + ":" + hex.EncodeToString(hash.Sum(nil))
+		if n := occurrences[key]; n > 0 {
+			fmt.Fprintf(hash, "repeat %d", n)
+		}
+		occurrences[key]++
+		isSame := func(id string) (bool, error) {
+			return sameArtifacts(filepath.Join(resultDB, fmt.Sprintf("%s:%s", testName, id)), shas)
+		}
+		resultID, exists, err := pickResultID(existing, testName, hex.EncodeToString(hash.Sum(nil)), importFlagIDLength, isSame)
 		if err != nil {
-			return fmt.Errorf("failed to copy artifact from %s to %s: %w", entry.currentPath, destPath, err)
+			return fmt.Errorf("line %d: %v", row.Line, err)
+		}
+		resultDir := filepath.Join(resultDB, fmt.Sprintf("%s:%s", testName, resultID))
+		if exists {
+			log.Printf("Line %d is already in the DB as %s, skipping", row.Line, resultDir)
+			numSkipped++
+			continue
 		}
-		numCopied++
+		if importFlagDryRun {
+			fmt.Printf("Line %d -> %s\n", row.Line, resultDir)
+		} else {
+			err := installResult(resultDB, resultID, resultDir, func(artifactsDir string) error {
+				for _, a := range row.Artifacts {
+					if err := os.WriteFile(filepath.Join(artifactsDir, a.Name), a.Content, 0644); err != nil {
+						return internalError(fmt.Errorf("writing artifact %v: %w", a.Name, err))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		}
+		// Later rows need to see this one, in case they're duplicates.
+		existing[resultID] = testName
+		numImported++
+	}
+	if importFlagDryRun {
+		log.Printf("Would import %d results (%d already imported)", numImported, numSkipped)
+	} else {
+		log.Printf("Imported %d results (%d already imported)", numImported, numSkipped)
 	}
-
-	log.Printf("Imported %d artifacts to %s", numCopied, resultDir)
 	return nil
 }
 
+// copyFile copies the content of src to a new file at dst. Unlike just
+// deferring Close, this reports errors from closing dst, which is where
+// running out of disk space can show up.
+func copyFile(src string, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		destFile.Close()
+		return err
+	}
+	return destFile.Close()
+}
+
 var importCmd = &cobra.Command{
-	Use:   "import [flags] artifact_path [artifact_path...]",
+	Use:   "import [flags] {artifact_path [artifact_path...] | --from-csv file}",
 	Short: "Import a new result into the database.",
 	Long: `Add a result to the database. Update the db in memory too.
 
 Files specified directly are added by name to the root of the artifacts
-tree. Directories are copied recursively, preserving their structure.`,
+tree. Directories are copied recursively, preserving their structure.
+Symlinks inside directories are followed (copying the content they point to)
+unless --no-follow-symlinks is set, symlinks that would form a loop are
+skipped.
+
+With --dry-run, the result ID is computed and the planned copies are printed,
+but nothing is written to the database.
+
+With --verify, the DB is read back after the import (running the parsers and
+derivers) and the facts and metrics of the new result are printed, so you can
+check your parsers worked without a separate query.
+
+With --from-csv, instead of importing a single result from artifact paths,
+each row of a CSV file (or TSV, if the name ends with .tsv) becomes a result.
+--csv-schema says what to do with the columns. It's a comma-separated list of
+COLUMN:KIND[:TYPE], where KIND is fact, metric or test. TYPE is int, float,
+string or bool, the default is string for facts and float for metrics. Columns
+that aren't in the schema are ignored, and so are empty cells. The test column
+gives the test name for each row, otherwise --test-name is used.
+
+The facts and metrics for each row are written as JSON objects to the
+artifacts facts.json and metrics.json, keyed by column name, so you still need
+parsers for them (e.g. with a jsonpath parser). Rows that are already in the DB
+are skipped, so you can re-run the import after appending rows to the file.
+
+With --dedup, each artifact is stored once in the DB's .blobs directory, keyed
+by its SHA-256, and the result's artifacts are hardlinks to it. So results that
+share artifacts (the same config file, the same binary) don't use the disk
+space twice. If hardlinks don't work, the artifacts are copied as usual. The
+artifacts are still normal files so nothing else needs to know about this, but
+the blobs are read-only, since editing one would change every result linking
+to it.`,
 	RunE: importCmdRunE,
-	Args: cobra.MinimumNArgs(1),
 }
 
 func init() {
 	rootCmd.AddCommand(importCmd)
 	importCmd.Flags().StringVarP(&importFlagTestName, "test-name", "t", "", "Name of the test")
-	importCmd.MarkFlagRequired("test-name")
+	importCmd.Flags().StringVar(&importFlagTestNameFrom, "test-name-from", "",
+		"JSONPath (e.g. '$.test') to read the test name from the artifacts, falling back to --test-name")
+	importCmd.Flags().BoolVarP(&importFlagDryRun, "dry-run", "n", false,
+		"Print the result ID and the artifacts that would be copied, without modifying the DB")
+	importCmd.Flags().IntVar(&importFlagIDLength, "id-length", 12,
+		"Minimum length of the result ID in hex chars. It's made longer if needed to avoid colliding with an existing result")
+	importCmd.Flags().StringVar(&importFlagFromCSV, "from-csv", "",
+		"Import a result for each row of this CSV (or .tsv) file instead of from artifact paths")
+	importCmd.Flags().StringVar(&importFlagCSVSchema, "csv-schema", "",
+		"How to import the --from-csv columns, e.g. 'kernel:fact,latency:metric:int,benchmark:test'")
+	importCmd.Flags().BoolVar(&importFlagVerify, "verify", false,
+		"After importing, re-read the DB and print the facts and metrics of the new result")
+	importCmd.Flags().BoolVar(&importFlagDedup, "dedup", false,
+		"Store each artifact once in the DB's content-addressed blob store and hardlink results to it")
+	importCmd.MarkFlagsMutuallyExclusive("verify", "dry-run")
+	importCmd.MarkFlagsMutuallyExclusive("dedup", "from-csv")
+	importCmd.MarkFlagsMutuallyExclusive("verify", "from-csv")
 }
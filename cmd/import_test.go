@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPickResultID(t *testing.T) {
+	resultDB := t.TempDir()
+	artifactsDir := filepath.Join(resultDB, "my_test:abcd", "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "out"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	shaOf := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+	existing := map[string]string{"abcd": "my_test"}
+
+	testCases := []struct {
+		desc       string
+		testName   string
+		artifacts  map[string]string
+		wantID     string
+		wantExists bool
+	}{
+		{
+			desc:       "same result",
+			testName:   "my_test",
+			artifacts:  map[string]string{"out": shaOf("foo")},
+			wantID:     "abcd",
+			wantExists: true,
+		},
+		{
+			desc:      "different content",
+			testName:  "my_test",
+			artifacts: map[string]string{"out": shaOf("bar")},
+			wantID:    "abcde",
+		},
+		{
+			desc:      "extra artifact",
+			testName:  "my_test",
+			artifacts: map[string]string{"out": shaOf("foo"), "other": shaOf("bar")},
+			wantID:    "abcde",
+		},
+		{
+			desc:      "different test",
+			testName:  "other_test",
+			artifacts: map[string]string{"out": shaOf("foo")},
+			wantID:    "abcde",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			isSame := func(id string) (bool, error) {
+				return sameArtifacts(filepath.Join(resultDB, tc.testName+":"+id), tc.artifacts)
+			}
+			id, exists, err := pickResultID(existing, tc.testName, "abcdef", 4, isSame)
+			if err != nil {
+				t.Fatalf("pickResultID failed: %v", err)
+			}
+			if id != tc.wantID || exists != tc.wantExists {
+				t.Errorf("pickResultID gave (%q, %v), want (%q, %v)", id, exists, tc.wantID, tc.wantExists)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/spf13/cobra"
+)
+
+// Profiling is for measuring Falba itself on real DBs, so the flags are hidden.
+var (
+	flagPprofCPU string
+	flagPprofMem string
+	// Set while a CPU profile is being written.
+	cpuProfile *os.File
+	// Set once stopProfiling has run, so the panic handler can call it again.
+	profilingStopped bool
+)
+
+// startProfiling is the root command's PersistentPreRunE, so it runs after the
+// flags are parsed but before the command.
+func startProfiling(cmd *cobra.Command, args []string) error {
+	if flagPprofCPU == "" {
+		return nil
+	}
+	f, err := os.Create(flagPprofCPU)
+	if err != nil {
+		return fmt.Errorf("creating --pprof-cpu file: %v", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return internalError(fmt.Errorf("starting CPU profile: %v", err))
+	}
+	cpuProfile = f
+	return nil
+}
+
+// stopProfiling finishes the CPU profile and writes the heap profile. It's
+// called whether or not the command worked, since profiling a failure can be
+// useful too. Problems are only logged so they don't change the exit code.
+// Calls after the first do nothing.
+func stopProfiling() {
+	if profilingStopped {
+		return
+	}
+	profilingStopped = true
+	if cpuProfile != nil {
+		pprof.StopCPUProfile()
+		if err := cpuProfile.Close(); err != nil {
+			log.Printf("Writing CPU profile: %v", err)
+		}
+		cpuProfile = nil
+	}
+	if flagPprofMem == "" {
+		return
+	}
+	f, err := os.Create(flagPprofMem)
+	if err != nil {
+		log.Printf("Creating --pprof-mem file: %v", err)
+		return
+	}
+	defer f.Close()
+	// Get up-to-date statistics.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		log.Printf("Writing heap profile: %v", err)
+	}
+}
+
+func init() {
+	rootCmd.PersistentPreRunE = startProfiling
+	rootCmd.PersistentFlags().StringVar(&flagPprofCPU, "pprof-cpu", "", "Write a CPU profile of the command to this file")
+	rootCmd.PersistentFlags().StringVar(&flagPprofMem, "pprof-mem", "", "Write a heap profile to this file when the command finishes")
+	rootCmd.PersistentFlags().MarkHidden("pprof-cpu")
+	rootCmd.PersistentFlags().MarkHidden("pprof-mem")
+}
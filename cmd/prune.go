@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneFlagOlderThan string
+	pruneFlagKeep      int
+	pruneFlagTimeFact  string
+	pruneFlagDryRun    bool
+	pruneFlagYes       bool
+)
+
+// parseAge is like time.ParseDuration but also supports days and weeks ("30d",
+// "2w"), which are more useful for this.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+			}
+			return time.Duration(f * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// confirm asks the user a yes/no question on the terminal, the default is no.
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("reading answer: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func cmdPrune(cmd *cobra.Command, args []string) error {
+	resultDB, err := singleResultDB()
+	if err != nil {
+		return err
+	}
+	opts := db.PruneOptions{Keep: pruneFlagKeep, Now: time.Now()}
+	if pruneFlagOlderThan != "" {
+		opts.OlderThan, err = parseAge(pruneFlagOlderThan)
+		if err != nil {
+			return fmt.Errorf("parsing --older-than: %v", err)
+		}
+	}
+	if opts.OlderThan <= 0 && opts.Keep <= 0 {
+		return fmt.Errorf("need --older-than or --keep")
+	}
+	cmd.SilenceUsage = true
+
+	falbaDB, err := readDB([]string{resultDB})
+	if err != nil {
+		return err
+	}
+	times, err := falbaDB.ResultTimes(pruneFlagTimeFact)
+	if err != nil {
+		return fmt.Errorf("getting result times: %v", err)
+	}
+	results, err := falbaDB.SelectForPrune(times, opts)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("Nothing to prune")
+		return nil
+	}
+
+	var dirs []string
+	for _, r := range results {
+		dir, err := falbaDB.ResultDir(r)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s\n", times[r.ResultID].Format(time.DateTime), dir)
+		dirs = append(dirs, dir)
+	}
+	if pruneFlagDryRun {
+		fmt.Printf("Would delete %d of %d results\n", len(dirs), len(falbaDB.Results))
+		return nil
+	}
+	if !pruneFlagYes {
+		ok, err := confirm(fmt.Sprintf("Delete %d of %d results?", len(dirs), len(falbaDB.Results)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return internalError(fmt.Errorf("deleting %v: %v", dir, err))
+		}
+	}
+	log.Printf("Deleted %d results", len(dirs))
+	// Blobs from import --dedup that only the deleted results used.
+	n, err := db.PruneBlobs(resultDB)
+	if err != nil {
+		return internalError(err)
+	}
+	if n > 0 {
+		log.Printf("Deleted %d unused artifact blobs", n)
+	}
+	return nil
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old results from the database",
+	Long: `Delete results that are older than --older-than, or all but the --keep most
+recent results for each test. If both are set, only results that are older than
+the cutoff AND aren't among the most recent are deleted.
+
+By default the age of a result is the mtime of its directory, which is when it
+was imported. Use --time-fact to use a fact instead, it must be an int (Unix
+time) or a string in RFC 3339 format. Results without the fact are never
+deleted.
+
+The results to delete are listed and you're asked to confirm, unless --yes is
+set. With --dry-run, nothing is deleted.
+
+Artifacts stored by import --dedup are deleted once no result uses them.`,
+	Args: cobra.NoArgs,
+	RunE: cmdPrune,
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().StringVar(&pruneFlagOlderThan, "older-than", "",
+		"Delete results older than this, e.g. '30d', '2w' or '12h'")
+	pruneCmd.Flags().IntVar(&pruneFlagKeep, "keep", 0, "Keep this many of the most recent results for each test")
+	pruneCmd.Flags().StringVar(&pruneFlagTimeFact, "time-fact", "",
+		"Fact that says when the result was produced, instead of using the directory mtime")
+	pruneCmd.Flags().BoolVarP(&pruneFlagDryRun, "dry-run", "n", false, "Just print the results that would be deleted")
+	pruneCmd.Flags().BoolVarP(&pruneFlagYes, "yes", "y", false, "Don't ask for confirmation")
+}
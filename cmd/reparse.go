@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/spf13/cobra"
+)
+
+func cmdReparse(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	result, err := db.ReadResult(flagResultDBs, getParsersPaths(), args[0], readOptions())
+	if err != nil {
+		return err
+	}
+	printResult(os.Stdout, result)
+	return nil
+}
+
+var reparseCmd = &cobra.Command{
+	Use:   "reparse <result-id>",
+	Short: "Run the parsers on a single result and show what they produced",
+	Long: `Run the parsers and derivers on a single result and print its facts and
+metrics, along with any parse errors. Only that result is read, so this is
+quick even for a big DB, and it works even if other results are broken. This
+is for iterating on the parser config against a result you know.
+
+Nothing is written, the other commands always re-read the DB so they pick up
+parser changes anyway.`,
+	Args: cobra.ExactArgs(1),
+	RunE: cmdReparse,
+}
+
+func init() {
+	rootCmd.AddCommand(reparseCmd)
+}
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"runtime/debug"
 	"strings"
 
 	"github.com/bjackman/falba/internal/db"
@@ -12,10 +15,26 @@ import (
 )
 
 var (
-	flagResultDB string
-	duckDBPath   string = "falba.duckdb"
+	flagResultDBs        []string
+	flagStrict           bool
+	flagNoFollowSymlinks bool
+	flagWarnEnumMismatch bool
+	flagRebuild          bool
+	flagFailFast         bool
+	flagMetricProvenance bool
+	flagHasArtifact      string
+	duckDBPath           string = "falba.duckdb"
 )
 
+// singleResultDB returns the --result-db for commands that write to the DB,
+// where it doesn't make sense to have several.
+func singleResultDB() (string, error) {
+	if len(flagResultDBs) != 1 {
+		return "", fmt.Errorf("need exactly one --result-db for this command, got %d", len(flagResultDBs))
+	}
+	return flagResultDBs[0], nil
+}
+
 func getParsersPaths() []string {
 	parsersPaths := []string{}
 	if path := os.Getenv("FALBA_PARSERS_PATH"); path != "" {
@@ -33,44 +52,175 @@ func getParsersPaths() []string {
 	return parsersPaths
 }
 
-func setupSQL() (*db.DB, *sql.DB, error) {
-	parsersPaths := getParsersPaths()
+// checkParsers reports parsers that didn't match any artifact in the DB. These
+// are usually a typo in the artifact_regexp. With --strict it's an error.
+func checkParsers(falbaDB *db.DB) error {
+	unmatched := falbaDB.UnmatchedParsers()
+	if len(unmatched) == 0 {
+		return nil
+	}
+	if flagStrict {
+		return fmt.Errorf("parsers matched no artifacts: %v", strings.Join(unmatched, ", "))
+	}
+	for _, name := range unmatched {
+		log.Printf("Warning: parser %q didn't match any artifacts", name)
+	}
+	return nil
+}
+
+func readOptions() db.ReadOptions {
+	return db.ReadOptions{
+		NoFollowSymlinks:   flagNoFollowSymlinks,
+		WarnOnEnumMismatch: flagWarnEnumMismatch,
+		FailFast:           flagFailFast,
+		MetricProvenance:   flagMetricProvenance,
+	}
+}
+
+// readDB reads the DBs at rootDirs, with the parsers and options from the
+// global flags. Every command that reads the DB should go through here.
+func readDB(rootDirs []string) (*db.DB, error) {
+	falbaDB, err := db.ReadDBs(rootDirs, getParsersPaths(), readOptions())
+	if err != nil {
+		return nil, fmt.Errorf("opening Falba DB: %v", err)
+	}
+	return falbaDB, nil
+}
 
-	falbaDB, err := db.ReadDB(flagResultDB, parsersPaths)
+// setupSQL reads the DB and loads it into DuckDB. If prepare isn't nil it gets
+// to modify the DB first, e.g. to add facts.
+func setupSQL(prepare func(*db.DB) error) (*db.DB, *sql.DB, error) {
+	falbaDB, err := readDB(flagResultDBs)
 	if err != nil {
-		return nil, nil, fmt.Errorf("opening Falba DB: %v", err)
+		return nil, nil, err
+	}
+
+	if err := checkParsers(falbaDB); err != nil {
+		return nil, nil, err
 	}
 
+	if flagHasArtifact != "" {
+		re, err := regexp.Compile(flagHasArtifact)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --has-artifact: %v", err)
+		}
+		falbaDB.FilterByArtifact(re)
+	}
+
+	if prepare != nil {
+		if err := prepare(falbaDB); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Problems from here on aren't the user's fault.
 	sqlDB, err := sql.Open("duckdb", duckDBPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't open DuckDB: %v", err)
+		return nil, nil, internalError(fmt.Errorf("couldn't open DuckDB: %v", err))
+	}
+	if err := db.CheckDuckDB(sqlDB); err != nil {
+		return nil, nil, internalError(err)
 	}
 
-	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
-		return nil, nil, fmt.Errorf("creating results SQL table: %w", err)
+	// Loading into DuckDB is slow for big DBs, so the tables are kept in the
+	// DuckDB file and reused if nothing changed since last time.
+	if _, err := falbaDB.LoadIntoDuckDB(sqlDB, flagRebuild); err != nil {
+		return nil, nil, internalError(fmt.Errorf("creating results SQL table: %w", err))
 	}
 
 	return falbaDB, sqlDB, nil
 }
 
+// addHasArtifactFlag adds --has-artifact to a command that uses setupSQL.
+func addHasArtifactFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&flagHasArtifact, "has-artifact", "",
+		"Only include results that have an artifact whose name matches this regexp")
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "falba",
 	Short: "Fully Automated Luxury Benchmark Analysis",
-	Long:  ``,
+	Long: `Fully Automated Luxury Benchmark Analysis.
+
+Every command exits with one of these codes, scripts can rely on them:
+
+  0  Success.
+  1  Usage or configuration error: bad flags, or a DB or parser config that
+     can't be read.
+  2  The command worked but the data failed a check, e.g. 'cmp
+     --fail-threshold' or 'doctor' finding errors.
+  3  Internal error: something went wrong that isn't the fault of the
+     command line or the DB, like failing to write files or a bug.`,
+}
+
+// Exit codes, see the rootCmd help. Scripts rely on these so don't change
+// them. Errors returned from a command's RunE get exitUsage unless they're an
+// exitCodeError.
+const (
+	exitUsage    = 1
+	exitFailure  = 2
+	exitInternal = 3
+)
+
+// exitCodeError is an error that makes the process exit with a specific code,
+// for errors that aren't usage errors.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+// internalError marks err as an internal error, see exitInternal.
+func internalError(err error) error {
+	return &exitCodeError{code: exitInternal, err: err}
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// Go exits with 2 for a panic, which would look like a data failure.
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", r, debug.Stack())
+			// The panic skipped the stopProfiling call below, and a profile
+			// of the run that panicked is still worth having.
+			stopProfiling()
+			os.Exit(exitInternal)
+		}
+	}()
 	err := rootCmd.Execute()
+	stopProfiling()
 	if err != nil {
-		os.Exit(1)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(exitUsage)
 	}
 }
 
 func init() {
 	// "Persistent" means flags that are inherited by subcommands. Persistent
 	// flags on the root command are global flags.
-	rootCmd.PersistentFlags().StringVar(&flagResultDB, "result-db", "./.falba", "Path to Falba DB root")
+	rootCmd.PersistentFlags().StringArrayVar(&flagResultDBs, "result-db", []string{"./.falba"},
+		"Path to Falba DB root. Can be repeated to treat several DBs as one")
+	rootCmd.PersistentFlags().BoolVar(&flagStrict, "strict", false, "Turn warnings about parser configuration into errors")
+	rootCmd.PersistentFlags().BoolVar(&flagNoFollowSymlinks, "no-follow-symlinks", false,
+		"Ignore symlinks when walking artifact directories, instead of following them")
+	rootCmd.PersistentFlags().BoolVar(&flagWarnEnumMismatch, "warn-enum-mismatch", false,
+		"Log a warning instead of failing when a fact value isn't in its enum")
+	rootCmd.PersistentFlags().BoolVar(&flagFailFast, "fail-fast", false,
+		"Stop reading the DB at the first broken result, instead of reporting all of them")
+	rootCmd.PersistentFlags().BoolVar(&flagMetricProvenance, "metric-provenance", false,
+		"Add parser and artifact columns to the metrics table, saying where each sample came from")
+	rootCmd.PersistentFlags().BoolVar(&flagRebuild, "rebuild", false,
+		"Always reload the DuckDB tables, instead of reusing them if the DB hasn't changed")
 }
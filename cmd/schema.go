@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var schemaFlagSQL bool
+
+func cmdSchema(cmd *cobra.Command, args []string) error {
+	falbaDB, err := readDB(flagResultDBs)
+	if err != nil {
+		return err
+	}
+	if err := checkParsers(falbaDB); err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	if schemaFlagSQL {
+		fmt.Print(falbaDB.SchemaSQL())
+		return nil
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(cmd.OutOrStdout())
+	t.AppendHeader(table.Row{"name", "kind", "type", "unit/enum"})
+	for _, name := range slices.Sorted(maps.Keys(falbaDB.FactTypes)) {
+		factType := falbaDB.FactTypes[name]
+		var enum string
+		if len(factType.Enum) != 0 {
+			enum = falba.FormatValues(factType.Enum)
+		}
+		t.AppendRow(table.Row{name, "fact", factType.Type.String(), enum})
+	}
+	for _, name := range slices.Sorted(maps.Keys(falbaDB.MetricTypes)) {
+		metricType := falbaDB.MetricTypes[name]
+		var unit string
+		if metricType.Unit != nil {
+			unit = metricType.Unit.Name
+		}
+		t.AppendRow(table.Row{name, "metric", metricType.Type.String(), unit})
+	}
+	t.Render()
+	return nil
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the facts and metrics in the DB, and their types",
+	Long: `Print every fact and metric in the DB with its type, plus the allowed values
+of enum facts and the units of metrics.
+
+With --sql, print the CREATE TABLE statements for the results, metrics and
+parse_errors tables that 'falba sql' would create from the current DB instead,
+without executing them. This is for creating matching tables in some other
+database, e.g. before loading the output of 'falba dump --format csv' into it.`,
+	Args: cobra.NoArgs,
+	RunE: cmdSchema,
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().BoolVar(&schemaFlagSQL, "sql", false, "Print the DDL for the SQL tables instead")
+}
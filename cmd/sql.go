@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 
 	_ "github.com/marcboeker/go-duckdb"
@@ -13,31 +20,167 @@ import (
 
 var (
 	flagDuckdbCli string
+	sqlFlagQuery  string
+	sqlFlagFormat string
 )
 
-// Here we don't use proper error handling because we are going to exec the
-// DuckDB CLI so defer etc won't work.
-func cmdSQL(cmd *cobra.Command, args []string) {
-	if _, _, err := setupSQL(); err != nil {
-		log.Fatalf("Setting up SQL DB: %v", err)
+// runQuery runs a query over the Go SQL connection and prints the result in
+// the given format ("table", "csv" or "json").
+func runQuery(sqlDB *sql.DB, query string, format string) error {
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		return fmt.Errorf("executing query: %v", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("getting columns: %v", err)
+	}
+
+	var records [][]any
+	for rows.Next() {
+		record := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range record {
+			ptrs[i] = &record[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scanning rows: %v", err)
+		}
+		for i, v := range record {
+			// Don't want these to be base64-encoded in the JSON.
+			if b, ok := v.([]byte); ok {
+				record[i] = string(b)
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating rows: %v", err)
+	}
+
+	switch format {
+	case "json":
+		objs := []map[string]any{}
+		for _, record := range records {
+			obj := make(map[string]any)
+			for i, column := range columns {
+				obj[column] = record[i]
+			}
+			objs = append(objs, obj)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(objs)
+	case "table", "csv":
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		header := table.Row{}
+		for _, column := range columns {
+			header = append(header, column)
+		}
+		t.AppendHeader(header)
+		for _, record := range records {
+			row := table.Row{}
+			for _, v := range record {
+				if v == nil {
+					v = ""
+				}
+				row = append(row, v)
+			}
+			t.AppendRow(row)
+		}
+		if format == "csv" {
+			t.RenderCSV()
+		} else {
+			t.Render()
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown --format %q, expect 'table', 'csv' or 'json'", format)
+	}
+}
+
+// runREPL is a very basic stand-in for the DuckDB CLI. It reads statements
+// (which can span several lines, up to a terminating ';') and prints their
+// results. Errors are printed and then it carries on, until EOF or .quit.
+func runREPL(sqlDB *sql.DB, in io.Reader, format string) error {
+	scanner := bufio.NewScanner(in)
+	var stmt strings.Builder
+	prompt := func() {
+		if stmt.Len() == 0 {
+			fmt.Fprint(os.Stderr, "falba> ")
+		} else {
+			fmt.Fprint(os.Stderr, "  ...> ")
+		}
+	}
+	prompt()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if stmt.Len() == 0 && (line == ".quit" || line == ".exit") {
+			return nil
+		}
+		if line != "" {
+			stmt.WriteString(line)
+			stmt.WriteString("\n")
+		}
+		if strings.HasSuffix(line, ";") {
+			if err := runQuery(sqlDB, stmt.String(), format); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			stmt.Reset()
+		}
+		prompt()
+	}
+	fmt.Fprintln(os.Stderr)
+	return scanner.Err()
+}
+
+func cmdSQL(cmd *cobra.Command, args []string) error {
+	if sqlFlagQuery != "" && len(args) > 0 {
+		return fmt.Errorf("can't use --query together with a positional sql_command")
+	}
+	cmd.SilenceUsage = true
+
+	_, sqlDB, err := setupSQL(nil)
+	if err != nil {
+		return fmt.Errorf("setting up SQL DB: %w", err)
+	}
+
+	if sqlFlagQuery != "" {
+		defer sqlDB.Close()
+		if err := runQuery(sqlDB, sqlFlagQuery, sqlFlagFormat); err != nil {
+			return fmt.Errorf("running --query: %v", err)
+		}
+		return nil
 	}
 
-	// Apparently the 'exec' package doesn't actually support exec-ing lol.
-	// I got this from https://gobyexample.com/execing-processes
 	cliPath, err := exec.LookPath(flagDuckdbCli)
 	if err != nil {
-		log.Fatalf("Searching $PATH for DuckDB CLI (%q, from --duckdb-cli): %v", flagDuckdbCli, err)
+		defer sqlDB.Close()
+		log.Printf("DuckDB CLI (%q, from --duckdb-cli) not found in $PATH, using Falba's built-in minimal REPL instead", flagDuckdbCli)
+		if len(args) > 0 {
+			return runQuery(sqlDB, args[0], sqlFlagFormat)
+		}
+		if err := runREPL(sqlDB, os.Stdin, sqlFlagFormat); err != nil {
+			return internalError(fmt.Errorf("reading stdin: %v", err))
+		}
+		return nil
 	}
+	log.Printf("Using DuckDB CLI %v", cliPath)
+
+	// Make sure DuckDB has flushed everything before the CLI opens the file.
+	sqlDB.Close()
+
+	// Apparently the 'exec' package doesn't actually support exec-ing lol.
+	// I got this from https://gobyexample.com/execing-processes
+	// If this works, the exit code is whatever the CLI exits with.
 	cliArgs := []string{cliPath, duckDBPath}
 	if len(args) > 0 {
 		cliArgs = append(cliArgs, args[0])
 	}
 	err = syscall.Exec(cliPath, cliArgs, os.Environ())
-	if err != nil {
-		log.Fatalf("exec()ing DuckDB CLI: %v", err)
-	}
-	// wat
-	log.Fatalf("Unexpectedly returned from exec()ing DuckDB CLI")
+	return internalError(fmt.Errorf("exec()ing DuckDB CLI: %v", err))
 }
 
 // sqlCmd represents the sql command
@@ -49,13 +192,25 @@ var sqlCmd = &cobra.Command{
 a SQL REPL where you can explore the Falba data.
 
 If an optional SQL command is provided, it will be executed and the command will
-exit immediately.`,
+exit immediately.
+
+With --query, the query is instead run directly by Falba, without needing the
+DuckDB CLI, and the result is printed in the format chosen by --format.
+
+If the DuckDB CLI isn't installed, Falba falls back to its own very basic REPL
+(statements end with ';', .quit to exit), which also prints results in the
+--format format. Use the real CLI if you can, it's much nicer.`,
 	Args: cobra.MaximumNArgs(1),
-	Run:  cmdSQL,
+	RunE: cmdSQL,
 }
 
 func init() {
 	sqlCmd.Flags().StringVar(&flagDuckdbCli, "duckdb-cli", "duckdb",
 		"DuckDB CLI executable. Looked up in $PATH")
+	sqlCmd.Flags().StringVarP(&sqlFlagQuery, "query", "q", "",
+		"Run this query without the DuckDB CLI and print the result")
+	sqlCmd.Flags().StringVar(&sqlFlagFormat, "format", "table",
+		"Output format for --query and the built-in REPL: table, csv or json")
 	rootCmd.AddCommand(sqlCmd)
+	addHasArtifactFlag(sqlCmd)
 }
@@ -10,28 +10,48 @@ import (
 	"iter"
 	"log"
 	"maps"
-	"math/big"
+	"math"
 	"slices"
 	"strings"
 	"text/template"
 
 	"github.com/bjackman/falba/internal/db"
 	"github.com/bjackman/falba/internal/falba"
-	"github.com/marcboeker/go-duckdb"
+	"github.com/bjackman/falba/internal/unit"
 )
 
 var ErrFactNotDeterminant = errors.New("fact not a determinant")
 
+// ErrNoData means there was nothing to analyse, e.g. because the filter didn't
+// match any results.
+var ErrNoData = errors.New("no data")
+
+// ErrZeroBaseline means a relative difference can't be computed because the
+// baseline is 0.
+var ErrZeroBaseline = errors.New("baseline is 0")
+
 // Prepared statements aren't flexible enough so we are just gonna be
 // vulnerable to SQL injection here.
 var filterResultsTemplate = template.Must(template.New("group-by").Parse(`
 	CREATE OR REPLACE TABLE filtered_results AS (
-		SELECT * FROM results WHERE {{.FilterExpression}}
+		SELECT *
+		{{- if .CombinedFacts}},
+			concat_ws('/'
+			{{- range .CombinedFacts -}}
+				, IFNULL(CAST({{.}} AS VARCHAR), '<NULL>')
+			{{- end -}}
+			) AS {{.CombinedColumn}}
+		{{- end}}
+		FROM results WHERE {{.FilterExpression}}
 	);
 `))
 
 type filterResultsTemplateArgs struct {
 	FilterExpression string
+	// If set, an extra column is added with these facts' values joined
+	// together.
+	CombinedFacts  []string
+	CombinedColumn string
 }
 
 func (g *filterResultsTemplateArgs) Execute() (string, error) {
@@ -42,10 +62,14 @@ func (g *filterResultsTemplateArgs) Execute() (string, error) {
 	return b.String(), nil
 }
 
-func createFilteredResults(sqlDB *sql.DB, filterExpression string) error {
+func createFilteredResults(sqlDB *sql.DB, filterExpression string, combinedFacts []string) error {
 	t := filterResultsTemplateArgs{
 		FilterExpression: filterExpression,
 	}
+	if len(combinedFacts) > 1 {
+		t.CombinedFacts = combinedFacts
+		t.CombinedColumn = combinedColumn(combinedFacts)
+	}
 	query, err := t.Execute()
 	if err != nil {
 		return fmt.Errorf("templating group-by query: %v", err)
@@ -115,15 +139,24 @@ func (g *checkFuncDepTemplateArgs) Execute() (string, error) {
 // Note that the "other potentially-relevant columns" includes the test name
 // (since the exact meanings of facts and metrics are assumed to differ between
 // tests) but not the result ID (since that's basically just an arbitrary
-// grouping of data).
+// grouping of data). Facts in ignoreFacts are left out too, this is for facts
+// that are known to be irrelevant noise, like timestamps. For a combined fact
+// (see CombineFacts), all the facts that went into it are left out.
 func checkFunctionalDependency(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, ignoreFacts []string) error {
 	facts := maps.Clone(falbaDB.FactTypes)
-	delete(facts, experimentFact)
+	experimentFacts := SplitFacts(experimentFact)
+	for _, f := range experimentFacts {
+		delete(facts, f)
+	}
 	for _, f := range ignoreFacts {
+		// Catch typos, otherwise the check just fails mysteriously.
+		if _, ok := falbaDB.FactTypes[f]; !ok {
+			return fmt.Errorf("no fact %q to ignore\nAvailable facts:\n%s", f, ReadableList(maps.Keys(falbaDB.FactTypes)))
+		}
 		delete(facts, f)
 	}
 	t := checkFuncDepTemplateArgs{
-		ExperimentFact: experimentFact,
+		ExperimentFact: combinedColumn(experimentFacts),
 		OtherFacts:     slices.Collect(maps.Keys(facts)),
 	}
 	query, err := t.Execute()
@@ -163,123 +196,39 @@ func checkFunctionalDependency(sqlDB *sql.DB, falbaDB *db.DB, experimentFact str
 	return ErrFactNotDeterminant
 }
 
-var groupByTemplate = template.Must(template.New("group-by").Parse(`
-	WITH Results AS (
-		SELECT r.*, m.{{.MetricColumn}} as metric
-		FROM filtered_results r
-		INNER JOIN metrics m USING (result_id)
-		WHERE metric = '{{.Metric}}'
-	)
-	SELECT
-		-- All rows should have the same test name, as enforced by
-		-- checkFunctionalDependency.
-		ANY_VALUE(test_name),
-		{{.Fact}},
-		AVG(CAST(metric AS FLOAT)) AS mean,
-		{{if .HistWidth -}}
-		histogram(
-			metric,
-			equi_width_bins(0, (SELECT MAX(metric) FROM Results),
-			{{.HistWidth}},
-			nice := true)
-		)
-		{{- else -}}
-		NULL
-		{{- end}} AS hist,
-		MIN(metric) AS min_val,
-		MAX(metric) AS max_val
-	FROM Results
-	GROUP BY {{.Fact}}
-`))
-
-type groupByTemplateArgs struct {
-	Fact         string
-	Metric       string
-	MetricColumn string
-	HistWidth    int
-}
-
-func (g *groupByTemplateArgs) Execute() (string, error) {
-	var b bytes.Buffer
-	if err := groupByTemplate.Execute(&b, g); err != nil {
-		return "", err
-	}
-	return b.String(), nil
-}
-
 type HistogramBin struct {
 	boundary float64 // left-open, right-closed.
 	size     uint64  // Number of samples in the bin.
 }
 
 type Histogram struct {
-	bins        []HistogramBin
+	bins []HistogramBin
+	// Lower edge of the first bin.
+	minBoundary float64
 	maxBoundary float64
 	maxSize     uint64
 	TotalSize   uint64
 }
 
-// Annoying boilerplate to read the duckdb.Map that gets returned when we call
-// histogram() in SQL.
-func (h *Histogram) Scan(v any) error {
-	if v == nil {
-		return nil
-	}
-	dm, ok := v.(duckdb.Map)
-	if !ok {
-		return fmt.Errorf("invalid type %T for scanning Histogram, expected duckdb.Map", v)
-	}
-
-	var bins []HistogramBin
-	var maxSize uint64
-	var totalSize uint64
-	var maxBoundary float64
-	var boundary float64
-	for k, v := range dm {
-		switch k := k.(type) {
-		case float64:
-			boundary = k
-		case int64:
-			// If the metric is an int the histogram boundaries will be ints.
-			//
-			// TODO: This is not necessarily accurate so we should ideally
-			// either support both types for bucket boundaries, or we should do
-			// something in the SQL to make this more accurate, I dunno floats
-			// are tricky.
-			boundary = float64(k)
-		case *big.Int:
-			f := new(big.Float).SetInt(k)
-			boundary, _ = f.Float64()
-		default:
-			return fmt.Errorf("invalid type %T for histogram map key, expected float64", k)
-		}
-		size, ok := v.(uint64)
-		if !ok {
-			return fmt.Errorf("invalid type %T for histogram map value, expected uint64", v)
-		}
-		if bins == nil || boundary > maxBoundary {
-			maxBoundary = boundary
-		}
-		if bins == nil || size > maxSize {
-			maxSize = size
-		}
-		totalSize += size
-		bins = append(bins, HistogramBin{boundary: boundary, size: size})
-	}
-	if bins == nil {
-		return fmt.Errorf("empty map, expectedp histogram bins")
-	}
-	binLess := func(x, y HistogramBin) int {
-		return cmp.Compare(x.boundary, y.boundary)
-	}
-	slices.SortFunc(bins, binLess)
-	*h = Histogram{
-		bins:        bins,
-		maxBoundary: maxBoundary,
-		maxSize:     maxSize,
-		TotalSize:   totalSize,
-	}
-	return nil
+// MinBoundary returns the lower boundary of the first bin.
+func (h *Histogram) MinBoundary() float64 {
+	return h.minBoundary
+}
+
+// MaxBoundary returns the upper boundary of the last bin.
+func (h *Histogram) MaxBoundary() float64 {
+	return h.maxBoundary
+}
+
+// NumBins returns the number of bins, including empty ones.
+func (h *Histogram) NumBins() int {
+	return len(h.bins)
+}
+
+// Legend describes the range of the histogram, with the boundaries formatted
+// in the metric's unit (which can be nil), like "1.00ms–5.00ms, 20 bins".
+func (h *Histogram) Legend(u *unit.Unit) string {
+	return fmt.Sprintf("%s–%s, %d bins", u.Format(h.MinBoundary()), u.Format(h.MaxBoundary()), h.NumBins())
 }
 
 // This is the ideal plotting library. You may not like it, but this is what
@@ -289,9 +238,26 @@ func (h *Histogram) Scan(v any) error {
 // distribution. Doesn't include any axis or anything, just the block elems.
 // Width is equal to the number of histogram bins.
 func (h *Histogram) PlotUnicode() string {
+	return h.plotBins(h.bins)
+}
+
+// PlotUnicodeByFrequency is like PlotUnicode but the bins are sorted by size,
+// biggest first (bins of equal size stay in boundary order). This loses the
+// shape of the distribution, but for data with lots of peaks it makes it easy
+// to see how much the biggest ones dominate. The bins themselves (and
+// therefore the Legend) are unaffected.
+func (h *Histogram) PlotUnicodeByFrequency() string {
+	bins := slices.Clone(h.bins)
+	slices.SortStableFunc(bins, func(x, y HistogramBin) int {
+		return cmp.Compare(y.size, x.size)
+	})
+	return h.plotBins(bins)
+}
+
+func (h *Histogram) plotBins(bins []HistogramBin) string {
 	blockElems := []rune{' ', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
 	var b strings.Builder
-	for _, bin := range h.bins {
+	for _, bin := range bins {
 		if bin.size == 0 {
 			b.WriteRune(' ')
 			continue
@@ -318,80 +284,297 @@ func (h *Histogram) PlotUnicode() string {
 // results.
 type MetricGroup struct {
 	TestName string
+	// Number of samples of the metric. This is the total even when the
+	// histogram is clipped.
+	Samples int
 	// Mean of the requested metric for results with the given fact value.
-	// Note we're assuming the value is numeric here.
+	// For bool metrics, true counts as 1 and false as 0, so this is the
+	// proportion of samples that are true.
 	Mean float64
-	Max  float64
-	Min  float64
-	// Histogram where the map keys are upper-boundaries of the bins.
+	// Median is more honest than the mean for skewed data like latencies.
+	Median float64
+	Max    float64
+	Min    float64
+	// Histogram of the samples, over the same range for all the groups. If
+	// GroupByFact was called with a histClip this only includes samples within
+	// the clipped range.
 	Histogram Histogram
 }
 
+// MergeGroups combines several groups from the same GroupByFact call into one,
+// e.g. to lump together groups that aren't interesting enough to show
+// individually. The median can't be computed from the groups so it's NaN.
+func MergeGroups(groups []*MetricGroup) *MetricGroup {
+	merged := &MetricGroup{Median: math.NaN()}
+	if len(groups) == 0 {
+		merged.Mean = math.NaN()
+		return merged
+	}
+	var sum float64
+	// All the histograms from a GroupByFact call have the same bins, but
+	// they're matched up by boundary just in case some are missing.
+	binSizes := make(map[float64]uint64)
+	for i, g := range groups {
+		if i == 0 {
+			merged.TestName = g.TestName
+			merged.Min, merged.Max = g.Min, g.Max
+			merged.Histogram.minBoundary = g.Histogram.minBoundary
+		}
+		merged.Samples += g.Samples
+		sum += g.Mean * float64(g.Samples)
+		merged.Min = min(merged.Min, g.Min)
+		merged.Max = max(merged.Max, g.Max)
+		for _, bin := range g.Histogram.bins {
+			binSizes[bin.boundary] += bin.size
+		}
+	}
+	merged.Mean = sum / float64(merged.Samples)
+	h := &merged.Histogram
+	for _, boundary := range slices.Sorted(maps.Keys(binSizes)) {
+		size := binSizes[boundary]
+		h.bins = append(h.bins, HistogramBin{boundary: boundary, size: size})
+		h.maxBoundary = boundary
+		h.maxSize = max(h.maxSize, size)
+		h.TotalSize += size
+	}
+	return merged
+}
+
+// CombineFacts returns a name that can be used in place of a single fact when
+// grouping results, to group by the values of all the facts joined with "/"
+// (e.g. "6.6/eevdf"). This is a cheap way to compare the cross-product of a
+// few facts.
+func CombineFacts(facts []string) string {
+	return strings.Join(facts, "/")
+}
+
+// SplitFacts is the inverse of CombineFacts. For a plain fact name it just
+// returns that name. Fact names have to be valid SQL identifiers so they can't
+// contain "/".
+func SplitFacts(fact string) []string {
+	return strings.Split(fact, "/")
+}
+
+// Returns the SQL for the column of filtered_results holding the value of the
+// facts (see CombineFacts). For a single fact that's just the fact itself.
+func combinedColumn(facts []string) string {
+	if len(facts) == 1 {
+		return facts[0]
+	}
+	return `"` + CombineFacts(facts) + `"`
+}
+
+// Sets up the filtered_results table and checks that grouping by the fact
+// (which may be a combination of facts, see CombineFacts) makes sense.
+// Returns the number of results that match the filter.
+func prepareGroups(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, filterExpression string, ignoreFacts []string) (int, error) {
+	experimentFacts := SplitFacts(experimentFact)
+	for _, f := range experimentFacts {
+		if _, ok := falbaDB.FactTypes[f]; !ok {
+			return 0, fmt.Errorf("no fact %q\nAvailable facts:\n%s", f, ReadableList(maps.Keys(falbaDB.FactTypes)))
+		}
+	}
+	if err := createFilteredResults(sqlDB, filterExpression, experimentFacts); err != nil {
+		return 0, fmt.Errorf("filtering results: %w", err)
+	}
+	var numResults int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM filtered_results").Scan(&numResults); err != nil {
+		return 0, fmt.Errorf("counting filtered results: %w", err)
+	}
+	if numResults == 0 {
+		return 0, fmt.Errorf("%w: none of the %d results in the DB match the filter %q",
+			ErrNoData, len(falbaDB.Results), filterExpression)
+	}
+
+	if err := checkFunctionalDependency(sqlDB, falbaDB, experimentFact, ignoreFacts); err != nil {
+		return 0, fmt.Errorf("checking functional dependency: %w", err)
+	}
+	return numResults, nil
+}
+
 // Return a map of stringified fact values, to aggregates describing the value
 // of the metric in results where the fact has the value from the map key. Note
 // the map key should probably be a falba.Value but for now it seems like just
-// squashing it into a string is harmless enough. The filterExpression is
-// applied across the whole database before any analysis.
-func GroupByFact(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, metric string, filterExpression string, histWidth int, ignoreFacts []string) (map[string]*MetricGroup, error) {
-	if err := createFilteredResults(sqlDB, filterExpression); err != nil {
-		return nil, fmt.Errorf("filtering results: %w", err)
+// squashing it into a string is harmless enough. The experimentFact can also be
+// a combination of facts from CombineFacts. The filterExpression is
+// applied across the whole database before any analysis. The histogram has
+// exactly histWidth equal-width bins (none if it's 0). If histClip is
+// nonzero, the histogram range is clipped to between the histClip and
+// 1-histClip quantiles (e.g. 0.01 means p1-p99) so that a few extreme outliers
+// don't squash the rest of the distribution into a single bin. This only
+// affects the histogram, not the other aggregates.
+func GroupByFact(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, metric string, filterExpression string, histWidth int, histClip float64, ignoreFacts []string) (map[string]*MetricGroup, error) {
+	if histClip < 0 || histClip >= 0.5 {
+		return nil, fmt.Errorf("histogram clip %v out of range, must be in [0, 0.5)", histClip)
 	}
-
-	if err := checkFunctionalDependency(sqlDB, falbaDB, experimentFact, ignoreFacts); err != nil {
-		return nil, fmt.Errorf("checking functional dependency: %w", err)
+	numResults, err := prepareGroups(sqlDB, falbaDB, experimentFact, filterExpression, ignoreFacts)
+	if err != nil {
+		return nil, err
 	}
 
-	metricType, ok := falbaDB.MetricTypes[metric]
+	metricName, metricCond, err := metricCondition(metric)
+	if err != nil {
+		return nil, err
+	}
+	metricType, ok := falbaDB.MetricTypes[metricName]
 	if !ok {
-		return nil, fmt.Errorf("no metric %q\nAvailable metrics:\n%s", metric, ReadableList(maps.Keys(falbaDB.MetricTypes)))
+		return nil, fmt.Errorf("no metric %q\nAvailable metrics:\n%s", metricName, ReadableList(maps.Keys(falbaDB.MetricTypes)))
 	}
-	if metricType.Type != falba.ValueInt && metricType.Type != falba.ValueFloat {
-		return nil, fmt.Errorf("sorry, only implemented for float and int metrics (%v is %v)",
-			metric, metricType)
+	switch metricType.Type {
+	case falba.ValueInt, falba.ValueFloat, falba.ValueBool:
+	default:
+		return nil, fmt.Errorf("sorry, only implemented for float, int and bool metrics (%v is %v)",
+			metricName, metricType)
 	}
-	t := groupByTemplateArgs{
-		Fact:         experimentFact,
-		Metric:       metric,
-		MetricColumn: metricType.Type.MetricsColumn(),
-		HistWidth:    histWidth,
+	column := "r." + combinedColumn(SplitFacts(experimentFact))
+	groups, err := querySamples(sqlDB, []string{column}, "", metricCond, metricType.Type.MetricsColumn())
+	if err != nil {
+		return nil, err
 	}
-	query, err := t.Execute()
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: none of the %d results matching the filter have any %q samples",
+			ErrNoData, numResults, metric)
+	}
+
+	// Range of the histogram. This is the same for all groups so that they
+	// can be compared visually.
+	var all []float64
+	for _, g := range groups {
+		all = append(all, g.samples...)
+	}
+	lo, hi := min(0, slices.Min(all)), slices.Max(all)
+	if histClip != 0 {
+		lo, hi = quantileDisc(all, histClip), quantileDisc(all, 1-histClip)
+	}
+
+	ret := make(map[string]*MetricGroup)
+	for key, g := range groups {
+		// All results should have the same test name, as enforced by
+		// checkFunctionalDependency.
+		group := &MetricGroup{
+			TestName: g.testName,
+			Samples:  len(g.samples),
+			Mean:     Mean(g.samples),
+			Median:   Median(g.samples),
+			Max:      slices.Max(g.samples),
+			Min:      slices.Min(g.samples),
+		}
+		if histWidth != 0 {
+			group.Histogram, err = HistogramOf(g.samples, lo, hi, histWidth, false)
+			if err != nil {
+				return nil, fmt.Errorf("building histogram for %s: %w", key, err)
+			}
+		}
+		ret[key] = group
+	}
+	return ret, nil
+}
+
+// CountMetricSamples returns the number of samples of the metric in results
+// matching the filter. This is deliberately done with a separate, simpler query
+// than GroupByFact, so it can be used to cross-check it.
+func CountMetricSamples(sqlDB *sql.DB, metric string, filterExpression string) (int, error) {
+	_, metricCond, err := metricCondition(metric)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) FROM metrics
+		WHERE %s AND result_id IN (SELECT result_id FROM results WHERE %s)
+	`, metricCond, filterExpression)
+	var count int
+	if err := sqlDB.QueryRow(query).Scan(&count); err != nil {
+		log.Printf("Failed SQL query: %v", query)
+		return 0, fmt.Errorf("counting samples: %v", err)
+	}
+	return count, nil
+}
+
+// Coverage says how many of the results in a group have samples of a metric.
+type Coverage struct {
+	// Results in the group that match the filter.
+	Results int
+	// How many of those have at least one sample of the metric.
+	WithSamples int
+}
+
+// Complete reports whether every result in the group has samples.
+func (c *Coverage) Complete() bool {
+	return c.WithSamples == c.Results
+}
+
+// MetricCoverage returns the Coverage of the metric for each value of the fact
+// (which can be a combination, see CombineFacts), keyed like the groups from
+// GroupByFact. GroupByFact only sees results that have samples, so a config
+// that failed to produce the metric just silently disappears from it. This is
+// for noticing that. Groups where no result has samples are included too.
+func MetricCoverage(sqlDB *sql.DB, experimentFact string, metric string, filterExpression string) (map[string]*Coverage, error) {
+	_, metricCond, err := metricCondition(metric)
 	if err != nil {
-		return nil, fmt.Errorf("templating group-by query: %v", err)
+		return nil, err
 	}
+	experimentFacts := SplitFacts(experimentFact)
+	if err := createFilteredResults(sqlDB, filterExpression, experimentFacts); err != nil {
+		return nil, fmt.Errorf("filtering results: %w", err)
+	}
+	column := combinedColumn(experimentFacts)
+	query := fmt.Sprintf(`
+		SELECT r.%s, COUNT(*), COUNT(m.result_id)
+		FROM filtered_results r
+		LEFT JOIN (SELECT DISTINCT result_id FROM metrics WHERE %s) m USING (result_id)
+		GROUP BY r.%s
+	`, column, metricCond, column)
 	rows, err := sqlDB.Query(query)
 	if err != nil {
 		log.Printf("Failed SQL query: %v", query)
-		return nil, fmt.Errorf("executing group-by query: %v", err)
+		return nil, fmt.Errorf("counting results with samples: %v", err)
 	}
 	defer rows.Close()
-	ret := make(map[string]*MetricGroup)
+	ret := make(map[string]*Coverage)
 	for rows.Next() {
-		var testName string
-		// Rows.Scan stringifies stuff so for now it seems  we can get away with
-		// just using string vars here. I think the next step up would be to
-		// implement sql.Scanner for falba.Value.
 		var factStr sql.NullString
-		var groupMean float64
-		var groupMax float64
-		var groupMin float64
-		var histogram Histogram
-		if err := rows.Scan(&testName, &factStr, &groupMean, &histogram, &groupMin, &groupMax); err != nil {
-			return nil, fmt.Errorf("scanning group-by rows: %v", err)
+		var c Coverage
+		if err := rows.Scan(&factStr, &c.Results, &c.WithSamples); err != nil {
+			return nil, fmt.Errorf("scanning coverage rows: %v", err)
 		}
 		key := "<NULL>"
 		if factStr.Valid {
 			key = factStr.String
 		}
-		ret[key] = &MetricGroup{
-			TestName:  testName,
-			Mean:      groupMean,
-			Max:       groupMax,
-			Min:       groupMin,
-			Histogram: histogram,
+		ret[key] = &c
+	}
+	return ret, rows.Err()
+}
+
+// TestFilter narrows a filter expression for the results table down to the
+// results of one test.
+func TestFilter(filterExpression string, testName string) string {
+	return fmt.Sprintf("(%s) AND test_name = %s", filterExpression, sqlString(testName))
+}
+
+// MetricsForTest returns the sorted names of the metrics that have samples in
+// results of the test that match the filter.
+func MetricsForTest(sqlDB *sql.DB, testName string, filterExpression string) ([]string, error) {
+	query := fmt.Sprintf(`
+		SELECT DISTINCT metric FROM metrics
+		WHERE result_id IN (SELECT result_id FROM results WHERE %s)
+		ORDER BY metric
+	`, TestFilter(filterExpression, testName))
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		log.Printf("Failed SQL query: %v", query)
+		return nil, fmt.Errorf("finding metrics for test %q: %v", testName, err)
+	}
+	defer rows.Close()
+	var metrics []string
+	for rows.Next() {
+		var metric string
+		if err := rows.Scan(&metric); err != nil {
+			return nil, fmt.Errorf("scanning metric name: %v", err)
 		}
+		metrics = append(metrics, metric)
 	}
-	return ret, nil
+	return metrics, rows.Err()
 }
 
 // ReadableList sorts the items from the iterator and returns them as a single string
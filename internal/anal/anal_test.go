@@ -2,12 +2,18 @@ package anal_test
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"testing"
 
 	"github.com/bjackman/falba/internal/anal"
 	"github.com/bjackman/falba/internal/db"
 	"github.com/bjackman/falba/internal/falba"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	_ "github.com/marcboeker/go-duckdb"
 )
 
@@ -21,7 +27,7 @@ func TestGroupByFact_NullFact(t *testing.T) {
 	// We need to construct a db.DB that has some results where the fact we
 	// group by is missing (thus NULL in the database).
 	falbaDB := &db.DB{
-		RootDir: "dummy",
+		RootDirs: []string{"dummy"},
 		Results: map[string]*falba.Result{
 			"r1": {
 				TestName: "test1",
@@ -44,8 +50,8 @@ func TestGroupByFact_NullFact(t *testing.T) {
 				},
 			},
 		},
-		FactTypes: map[string]falba.ValueType{
-			"my_fact": falba.ValueString,
+		FactTypes: map[string]falba.FactType{
+			"my_fact": {Type: falba.ValueString},
 		},
 		MetricTypes: map[string]falba.MetricType{
 			"my_metric": {Type: falba.ValueInt},
@@ -58,7 +64,7 @@ func TestGroupByFact_NullFact(t *testing.T) {
 	}
 
 	// Call GroupByFact. It should not fail now that we support NULLs.
-	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, nil)
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, 0, nil)
 	if err != nil {
 		t.Fatalf("GroupByFact failed: %v", err)
 	}
@@ -67,13 +73,17 @@ func TestGroupByFact_NullFact(t *testing.T) {
 	wantGroups := map[string]*anal.MetricGroup{
 		"value1": {
 			TestName: "test1",
+			Samples:  1,
 			Mean:     10,
+			Median:   10,
 			Min:      10,
 			Max:      10,
 		},
 		"<NULL>": {
 			TestName: "test1",
+			Samples:  1,
 			Mean:     20,
+			Median:   20,
 			Min:      20,
 			Max:      20,
 		},
@@ -83,3 +93,677 @@ func TestGroupByFact_NullFact(t *testing.T) {
 		t.Errorf("Unexpected groups (-want +got):\n%s", diff)
 	}
 }
+
+func TestGroupByFact_HistClip(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// 1..99 and then one massive outlier.
+	result := &falba.Result{
+		TestName: "test1",
+		ResultID: "r1",
+		Facts: map[string]falba.Value{
+			"my_fact": &falba.StringValue{Value: "value1"},
+		},
+	}
+	for i := 1; i < 100; i++ {
+		result.Metrics = append(result.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: int64(i)}})
+	}
+	result.Metrics = append(result.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 100000}})
+	falbaDB := &db.DB{
+		RootDirs:  []string{"dummy"},
+		Results:   map[string]*falba.Result{"r1": result},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	for _, tc := range []struct {
+		clip            float64
+		wantMinBoundary float64
+		wantMaxBoundary float64
+		wantHistSize    uint64
+	}{
+		{clip: 0, wantMinBoundary: 0, wantMaxBoundary: 100000, wantHistSize: 100},
+		// p5 is 5, p95 is 95.
+		{clip: 0.05, wantMinBoundary: 5, wantMaxBoundary: 95, wantHistSize: 91},
+	} {
+		t.Run(fmt.Sprintf("clip-%v", tc.clip), func(t *testing.T) {
+			groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 10, tc.clip, nil)
+			if err != nil {
+				t.Fatalf("GroupByFact failed: %v", err)
+			}
+			group := groups["value1"]
+			// The stats aren't affected by the clipping.
+			if group.Samples != 100 || group.Max != 100000 {
+				t.Errorf("Got samples %d max %v, want 100 and 100000", group.Samples, group.Max)
+			}
+			// The outlier drags the mean way up, but not the median.
+			if group.Median != 50.5 {
+				t.Errorf("Got median %v, want 50.5", group.Median)
+			}
+			if got := group.Histogram.MinBoundary(); got != tc.wantMinBoundary {
+				t.Errorf("Got histogram min boundary %v, want %v", got, tc.wantMinBoundary)
+			}
+			if got := group.Histogram.MaxBoundary(); got != tc.wantMaxBoundary {
+				t.Errorf("Got histogram max boundary %v, want %v", got, tc.wantMaxBoundary)
+			}
+			// There's a bin per character of --hist-width.
+			if got := group.Histogram.NumBins(); got != 10 {
+				t.Errorf("Got %d histogram bins, want 10", got)
+			}
+			if got := group.Histogram.TotalSize; got != tc.wantHistSize {
+				t.Errorf("Got %d samples in histogram, want %d", got, tc.wantHistSize)
+			}
+		})
+	}
+
+	count, err := anal.CountMetricSamples(sqlDB, "my_metric", "my_fact = 'value1'")
+	if err != nil {
+		t.Fatalf("CountMetricSamples failed: %v", err)
+	}
+	if count != 100 {
+		t.Errorf("CountMetricSamples returned %d, want 100", count)
+	}
+
+	if _, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 10, 0.5, nil); err == nil {
+		t.Errorf("Expected error for histogram clip 0.5, got nil")
+	}
+}
+
+func TestGroupByFact_HistWidth(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// An awkward range, that doesn't divide nicely into any of the widths.
+	result := &falba.Result{
+		TestName: "test1",
+		ResultID: "r1",
+		Facts: map[string]falba.Value{
+			"my_fact": &falba.StringValue{Value: "value1"},
+		},
+	}
+	for i := 0; i < 50; i++ {
+		result.Metrics = append(result.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.FloatValue{Value: 3.7 + float64(i)*1.3}})
+	}
+	falbaDB := &db.DB{
+		RootDirs:  []string{"dummy"},
+		Results:   map[string]*falba.Result{"r1": result},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueFloat},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	for _, width := range []int{1, 7, 20, 65} {
+		t.Run(fmt.Sprintf("width-%d", width), func(t *testing.T) {
+			groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", width, 0, nil)
+			if err != nil {
+				t.Fatalf("GroupByFact failed: %v", err)
+			}
+			hist := groups["value1"].Histogram
+			if got := hist.NumBins(); got != width {
+				t.Errorf("Got %d histogram bins, want %d", got, width)
+			}
+			if got := len([]rune(hist.PlotUnicode())); got != width {
+				t.Errorf("Got %d characters of histogram, want %d", got, width)
+			}
+			if hist.TotalSize != 50 {
+				t.Errorf("Got %d samples in histogram, want 50", hist.TotalSize)
+			}
+		})
+	}
+}
+
+func TestGroupByFact_HistConstant(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// All the samples are 0, so the histogram range is empty.
+	result := &falba.Result{
+		TestName: "test1",
+		ResultID: "r1",
+		Facts: map[string]falba.Value{
+			"my_fact": &falba.StringValue{Value: "value1"},
+		},
+	}
+	for i := 0; i < 5; i++ {
+		result.Metrics = append(result.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 0}})
+	}
+	falbaDB := &db.DB{
+		RootDirs:  []string{"dummy"},
+		Results:   map[string]*falba.Result{"r1": result},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 10, 0, nil)
+	if err != nil {
+		t.Fatalf("GroupByFact failed: %v", err)
+	}
+	hist := groups["value1"].Histogram
+	if got := len([]rune(hist.PlotUnicode())); got != 10 {
+		t.Errorf("Got %d characters of histogram, want 10", got)
+	}
+	if hist.TotalSize != 5 {
+		t.Errorf("Got %d samples in histogram, want 5", hist.TotalSize)
+	}
+}
+
+func TestGroupByFact_NoData(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": {
+				TestName: "test1",
+				ResultID: "r1",
+				Facts: map[string]falba.Value{
+					"my_fact": &falba.StringValue{Value: "value1"},
+				},
+				Metrics: []*falba.Metric{
+					{Name: "my_metric", Value: &falba.IntValue{Value: 10}},
+				},
+			},
+		},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric":    {Type: falba.ValueInt},
+			"other_metric": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		filter string
+		metric string
+	}{
+		{desc: "filter matches nothing", filter: "my_fact = 'nope'", metric: "my_metric"},
+		{desc: "no samples of metric", filter: "TRUE", metric: "other_metric"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", tc.metric, tc.filter, 10, 0, nil)
+			if !errors.Is(err, anal.ErrNoData) {
+				t.Errorf("Expected ErrNoData, got %v (groups: %v)", err, groups)
+			}
+		})
+	}
+}
+
+func TestGroupByFact_Bool(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result := func(id string, factVal string, passes ...bool) *falba.Result {
+		r := &falba.Result{
+			TestName: "test1",
+			ResultID: id,
+			Facts:    map[string]falba.Value{"my_fact": &falba.StringValue{Value: factVal}},
+		}
+		for _, p := range passes {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: "passed", Value: &falba.BoolValue{Value: p}})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("r1", "a", true, true, false, true),
+			"r2": result("r2", "b", false, false),
+		},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"passed": {Type: falba.ValueBool},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "passed", "TRUE", 0, 0, nil)
+	if err != nil {
+		t.Fatalf("GroupByFact failed: %v", err)
+	}
+	wantGroups := map[string]*anal.MetricGroup{
+		"a": {TestName: "test1", Samples: 4, Mean: 0.75, Median: 1, Min: 0, Max: 1},
+		"b": {TestName: "test1", Samples: 2, Mean: 0, Median: 0, Min: 0, Max: 0},
+	}
+	if diff := cmp.Diff(wantGroups, groups, cmp.AllowUnexported(anal.Histogram{})); diff != "" {
+		t.Errorf("Unexpected groups (-want +got):\n%s", diff)
+	}
+}
+
+func TestGroupByFact_LargeInts(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Like a latency in ns, these need more precision than a 32-bit float.
+	const big = 1<<40 + 1
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": {
+				TestName: "test1",
+				ResultID: "r1",
+				Facts:    map[string]falba.Value{"my_fact": &falba.StringValue{Value: "a"}},
+				Metrics: []*falba.Metric{
+					{Name: "my_metric", Value: &falba.IntValue{Value: big}},
+					{Name: "my_metric", Value: &falba.IntValue{Value: big + 2}},
+				},
+			},
+		},
+		FactTypes:   map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{"my_metric": {Type: falba.ValueInt}},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, 0, nil)
+	if err != nil {
+		t.Fatalf("GroupByFact failed: %v", err)
+	}
+	if g := groups["a"]; g.Mean != big+1 || g.Median != big+1 {
+		t.Errorf("Got mean %v and median %v, want %v", g.Mean, g.Median, float64(big+1))
+	}
+}
+
+func TestCountValues(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result := func(id string, factVal string, outcomes ...string) *falba.Result {
+		r := &falba.Result{
+			TestName: "test1",
+			ResultID: id,
+			Facts:    map[string]falba.Value{"my_fact": &falba.StringValue{Value: factVal}},
+		}
+		for _, o := range outcomes {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: "outcome", Value: &falba.StringValue{Value: o}})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("r1", "a", "ok", "ok", "timeout"),
+			"r2": result("r2", "a", "ok"),
+			"r3": result("r3", "b", "crash", "ok"),
+		},
+		FactTypes: map[string]falba.FactType{"my_fact": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"outcome": {Type: falba.ValueString},
+			"other":   {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	groups, err := anal.CountValues(sqlDB, falbaDB, "my_fact", "outcome", "TRUE", nil)
+	if err != nil {
+		t.Fatalf("CountValues failed: %v", err)
+	}
+	wantGroups := map[string]*anal.ValueCounts{
+		"a": {TestName: "test1", Samples: 4, Counts: map[string]int{"ok": 3, "timeout": 1}},
+		"b": {TestName: "test1", Samples: 2, Counts: map[string]int{"ok": 1, "crash": 1}},
+	}
+	if diff := cmp.Diff(wantGroups, groups); diff != "" {
+		t.Errorf("Unexpected groups (-want +got):\n%s", diff)
+	}
+
+	if _, err := anal.CountValues(sqlDB, falbaDB, "my_fact", "other", "TRUE", nil); err == nil {
+		t.Errorf("Expected error for int metric, got nil")
+	}
+}
+
+func TestMergeGroups(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results:  map[string]*falba.Result{},
+		FactTypes: map[string]falba.FactType{
+			"my_fact":    {Type: falba.ValueInt},
+			"everything": {Type: falba.ValueString},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	for i := range 3 {
+		id := fmt.Sprintf("r%d", i)
+		r := &falba.Result{
+			TestName: "test1",
+			ResultID: id,
+			Facts: map[string]falba.Value{
+				"my_fact":    &falba.IntValue{Value: int64(i)},
+				"everything": &falba.StringValue{Value: "x"},
+			},
+		}
+		for j := range 5 * (i + 1) {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: int64(i*10 + j)}})
+		}
+		falbaDB.Results[id] = r
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 5, 0, []string{"everything"})
+	if err != nil {
+		t.Fatalf("GroupByFact failed: %v", err)
+	}
+	merged := anal.MergeGroups(slices.Collect(maps.Values(groups)))
+
+	// Merging all the groups should give the same thing as just having one
+	// group in the first place, apart from the median.
+	want, err := anal.GroupByFact(sqlDB, falbaDB, "everything", "my_metric", "TRUE", 5, 0, []string{"my_fact"})
+	if err != nil {
+		t.Fatalf("GroupByFact failed: %v", err)
+	}
+	opts := []cmp.Option{
+		cmp.AllowUnexported(anal.Histogram{}, anal.HistogramBin{}),
+		cmpopts.IgnoreFields(anal.MetricGroup{}, "Median"),
+		cmpopts.EquateApprox(0, 1e-9),
+	}
+	if diff := cmp.Diff(want["x"], merged, opts...); diff != "" {
+		t.Errorf("Unexpected merged group (-want +got):\n%s", diff)
+	}
+	if !math.IsNaN(merged.Median) {
+		t.Errorf("Got median %v for merged group, want NaN", merged.Median)
+	}
+}
+
+func TestGroupByFact_IgnoreFacts(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Every result has a different timestamp, so it's not determined by
+	// my_fact.
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results:  map[string]*falba.Result{},
+		FactTypes: map[string]falba.FactType{
+			"my_fact":   {Type: falba.ValueString},
+			"timestamp": {Type: falba.ValueInt},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	for i := range 4 {
+		id := fmt.Sprintf("r%d", i)
+		falbaDB.Results[id] = &falba.Result{
+			TestName: "test1",
+			ResultID: id,
+			Facts: map[string]falba.Value{
+				"my_fact":   &falba.StringValue{Value: fmt.Sprintf("value%d", i%2)},
+				"timestamp": &falba.IntValue{Value: int64(1000 + i)},
+			},
+			Metrics: []*falba.Metric{{Name: "my_metric", Value: &falba.IntValue{Value: int64(i)}}},
+		}
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	_, err = anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, 0, nil)
+	if !errors.Is(err, anal.ErrFactNotDeterminant) {
+		t.Errorf("GroupByFact without ignoring timestamp: got error %v, want ErrFactNotDeterminant", err)
+	}
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, 0, []string{"timestamp"})
+	if err != nil {
+		t.Fatalf("GroupByFact ignoring timestamp failed: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Errorf("Got %d groups, want 2", len(groups))
+	}
+	if _, err := anal.GroupByFact(sqlDB, falbaDB, "my_fact", "my_metric", "TRUE", 0, 0, []string{"timestmap"}); err == nil {
+		t.Errorf("GroupByFact ignoring nonexistent fact succeeded, want error")
+	}
+}
+
+func TestGroupByFact_CombineFacts(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Neither kernel nor sched is determined by the other, but together they
+	// determine everything.
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results:  map[string]*falba.Result{},
+		FactTypes: map[string]falba.FactType{
+			"kernel": {Type: falba.ValueString},
+			"sched":  {Type: falba.ValueString},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	for i := range 6 {
+		id := fmt.Sprintf("r%d", i)
+		facts := map[string]falba.Value{
+			"kernel": &falba.StringValue{Value: []string{"6.6", "6.7"}[i%2]},
+		}
+		// One result is missing the sched fact.
+		if i != 5 {
+			facts["sched"] = &falba.StringValue{Value: []string{"cfs", "eevdf"}[(i/2)%2]}
+		}
+		falbaDB.Results[id] = &falba.Result{
+			TestName: "test1",
+			ResultID: id,
+			Facts:    facts,
+			Metrics:  []*falba.Metric{{Name: "my_metric", Value: &falba.IntValue{Value: int64(i)}}},
+		}
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	_, err = anal.GroupByFact(sqlDB, falbaDB, "kernel", "my_metric", "TRUE", 0, 0, nil)
+	if !errors.Is(err, anal.ErrFactNotDeterminant) {
+		t.Errorf("GroupByFact on kernel alone: got error %v, want ErrFactNotDeterminant", err)
+	}
+	combined := anal.CombineFacts([]string{"kernel", "sched"})
+	groups, err := anal.GroupByFact(sqlDB, falbaDB, combined, "my_metric", "TRUE", 0, 0, nil)
+	if err != nil {
+		t.Fatalf("GroupByFact on %q failed: %v", combined, err)
+	}
+	samples := make(map[string]int)
+	for key, g := range groups {
+		samples[key] = g.Samples
+	}
+	want := map[string]int{"6.6/cfs": 2, "6.7/cfs": 1, "6.6/eevdf": 1, "6.7/eevdf": 1, "6.7/<NULL>": 1}
+	if diff := cmp.Diff(want, samples); diff != "" {
+		t.Errorf("Unexpected samples per group (-want +got):\n%s", diff)
+	}
+	if _, err := anal.GroupByFact(sqlDB, falbaDB, "kernel/bogus", "my_metric", "TRUE", 0, 0, nil); err == nil {
+		t.Errorf("GroupByFact combining nonexistent fact succeeded, want error")
+	}
+}
+
+func TestMetricsForTest(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result := func(test, id, kernel string, metrics ...string) *falba.Result {
+		r := &falba.Result{
+			TestName: test,
+			ResultID: id,
+			Facts:    map[string]falba.Value{"kernel": &falba.StringValue{Value: kernel}},
+		}
+		for _, m := range metrics {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: m, Value: &falba.IntValue{Value: 1}})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("fio", "r1", "6.1", "iops", "latency"),
+			"r2": result("fio", "r2", "6.2", "iops", "bandwidth"),
+			"r3": result("it's", "r3", "6.1", "runtime"),
+		},
+		FactTypes: map[string]falba.FactType{"kernel": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"iops":      {Type: falba.ValueInt},
+			"latency":   {Type: falba.ValueInt},
+			"bandwidth": {Type: falba.ValueInt},
+			"runtime":   {Type: falba.ValueInt},
+			"unused":    {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	testCases := []struct {
+		test   string
+		filter string
+		want   []string
+	}{
+		{test: "fio", filter: "TRUE", want: []string{"bandwidth", "iops", "latency"}},
+		{test: "fio", filter: "kernel = '6.1'", want: []string{"iops", "latency"}},
+		{test: "it's", filter: "TRUE", want: []string{"runtime"}},
+		{test: "it's", filter: "kernel = '6.2'", want: nil},
+		{test: "other", filter: "TRUE", want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.test+" "+tc.filter, func(t *testing.T) {
+			got, err := anal.MetricsForTest(sqlDB, tc.test, tc.filter)
+			if err != nil {
+				t.Fatalf("MetricsForTest failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetricCoverage(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Result with the given kernel (nil for none) and a latency sample for
+	// each op.
+	result := func(id string, kernel *string, ops ...string) *falba.Result {
+		r := &falba.Result{TestName: "test1", ResultID: id, Facts: map[string]falba.Value{}}
+		if kernel != nil {
+			r.Facts["kernel"] = &falba.StringValue{Value: *kernel}
+		}
+		for _, op := range ops {
+			r.Metrics = append(r.Metrics, &falba.Metric{
+				Name: "latency", Labels: map[string]string{"op": op}, Value: &falba.IntValue{Value: 1},
+			})
+		}
+		return r
+	}
+	a, b, c := "a", "b", "c"
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("r1", &a, "read", "read", "write"),
+			"r2": result("r2", &a, "read"),
+			"r3": result("r3", &b, "read"),
+			"r4": result("r4", &b),
+			"r5": result("r5", &c),
+			"r6": result("r6", nil),
+		},
+		FactTypes:   map[string]falba.FactType{"kernel": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{"latency": {Type: falba.ValueInt}},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	testCases := []struct {
+		metric string
+		filter string
+		want   map[string]*anal.Coverage
+	}{
+		{
+			metric: "latency",
+			filter: "TRUE",
+			want: map[string]*anal.Coverage{
+				"a":      {Results: 2, WithSamples: 2},
+				"b":      {Results: 2, WithSamples: 1},
+				"c":      {Results: 1, WithSamples: 0},
+				"<NULL>": {Results: 1, WithSamples: 0},
+			},
+		},
+		{
+			metric: "latency{op=write}",
+			filter: "kernel = 'a'",
+			want: map[string]*anal.Coverage{
+				"a": {Results: 2, WithSamples: 1},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.metric+" "+tc.filter, func(t *testing.T) {
+			got, err := anal.MetricCoverage(sqlDB, "kernel", tc.metric, tc.filter)
+			if err != nil {
+				t.Fatalf("MetricCoverage failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected coverage (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package anal
+
+import (
+	"fmt"
+	"math"
+)
+
+// Boundary returns the upper boundary of the bin (bins are left-open,
+// right-closed).
+func (b HistogramBin) Boundary() float64 {
+	return b.boundary
+}
+
+// Size returns the number of samples in the bin.
+func (b HistogramBin) Size() uint64 {
+	return b.size
+}
+
+// Bins returns the bins in order.
+func (h *Histogram) Bins() []HistogramBin {
+	return h.bins
+}
+
+// MaxSize returns the number of samples in the biggest bin.
+func (h *Histogram) MaxSize() uint64 {
+	return h.maxSize
+}
+
+// HistogramOf bins the samples in Go, for use with Groups. The bins exactly
+// cover the range from lo to hi (e.g. the min and max of the samples), like
+// the ones from GroupByFact. Samples outside the range are left out. If
+// logScale is set the bins are of equal width in log space, in that case lo
+// must be positive.
+func HistogramOf(samples []float64, lo, hi float64, numBins int, logScale bool) (Histogram, error) {
+	if numBins <= 0 {
+		return Histogram{}, fmt.Errorf("need a positive number of bins, got %d", numBins)
+	}
+	if hi < lo {
+		return Histogram{}, fmt.Errorf("invalid range %v to %v", lo, hi)
+	}
+	scale, unscale := func(x float64) float64 { return x }, func(x float64) float64 { return x }
+	if logScale {
+		if lo <= 0 {
+			return Histogram{}, fmt.Errorf("can't use a log scale with non-positive values (min is %v)", lo)
+		}
+		scale, unscale = math.Log10, func(x float64) float64 { return math.Pow(10, x) }
+	}
+	width := (scale(hi) - scale(lo)) / float64(numBins)
+	bins := make([]HistogramBin, numBins)
+	for i := range bins {
+		bins[i].boundary = unscale(scale(lo) + float64(i+1)*width)
+	}
+	// Avoid rounding errors leaving hi out of the last bin.
+	bins[numBins-1].boundary = hi
+	h := Histogram{minBoundary: lo, maxBoundary: hi}
+	for _, s := range samples {
+		if s < lo || s > hi {
+			continue
+		}
+		// If lo == hi there's no width, the bins all have the same boundary
+		// and everything goes in the first one. There are still numBins of
+		// them so the plot is as wide as requested.
+		i := 0
+		if width > 0 {
+			// Bins are right-closed so a sample on a boundary goes in the
+			// lower bin.
+			i = int(math.Ceil((scale(s)-scale(lo))/width)) - 1
+		}
+		i = max(0, min(i, numBins-1))
+		bins[i].size++
+		h.TotalSize++
+	}
+	h.bins = bins
+	for _, b := range bins {
+		h.maxSize = max(h.maxSize, b.size)
+	}
+	return h, nil
+}
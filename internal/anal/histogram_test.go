@@ -1,7 +1,10 @@
 package anal
 
 import (
+	"math"
 	"testing"
+
+	"github.com/bjackman/falba/internal/unit"
 )
 
 func TestHistogram_PlotUnicode(t *testing.T) {
@@ -67,3 +70,137 @@ func TestHistogram_PlotUnicode(t *testing.T) {
 		})
 	}
 }
+
+func TestHistogram_PlotUnicodeByFrequency(t *testing.T) {
+	h := Histogram{
+		bins: []HistogramBin{
+			{boundary: 10, size: 1},
+			{boundary: 20, size: 0},
+			{boundary: 30, size: 5},
+			{boundary: 40, size: 3},
+			{boundary: 50, size: 1},
+			{boundary: 60, size: 5},
+		},
+		maxSize:   5,
+		TotalSize: 15,
+	}
+	if got, want := h.PlotUnicodeByFrequency(), "██▅▂▂ "; got != want {
+		t.Errorf("PlotUnicodeByFrequency() = %q, want %q", got, want)
+	}
+	// The bins themselves stay in order.
+	if got, want := h.PlotUnicode(), "▂ █▅▂█"; got != want {
+		t.Errorf("PlotUnicode() after PlotUnicodeByFrequency() = %q, want %q", got, want)
+	}
+	if got := (&Histogram{}).PlotUnicodeByFrequency(); got != "" {
+		t.Errorf("PlotUnicodeByFrequency() for empty histogram = %q, want empty", got)
+	}
+}
+
+func TestHistogram_Legend(t *testing.T) {
+	h := Histogram{
+		bins: []HistogramBin{
+			{boundary: 10, size: 1},
+			{boundary: 20, size: 0},
+			{boundary: 30, size: 2},
+		},
+		minBoundary: 1000,
+		maxBoundary: 3000000,
+		maxSize:     2,
+		TotalSize:   3,
+	}
+	if got := h.MaxBoundary(); got != 3000000 {
+		t.Errorf("MaxBoundary() = %v, want 3000000", got)
+	}
+	if got := h.NumBins(); got != 3 {
+		t.Errorf("NumBins() = %v, want 3", got)
+	}
+	ns, err := unit.Parse("ns")
+	if err != nil {
+		t.Fatalf("unit.Parse failed: %v", err)
+	}
+	if got, want := h.Legend(ns), "1.00us–3.00ms, 3 bins"; got != want {
+		t.Errorf("Legend(ns) = %q, want %q", got, want)
+	}
+	if got, want := h.Legend(nil), "1,000–3,000,000, 3 bins"; got != want {
+		t.Errorf("Legend(nil) = %q, want %q", got, want)
+	}
+}
+
+func TestHistogramOf(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		samples   []float64
+		lo, hi    float64
+		numBins   int
+		logScale  bool
+		wantBins  []HistogramBin
+		expectErr bool
+	}{
+		{
+			desc:     "linear",
+			samples:  []float64{0, 1, 2, 2.5, 4},
+			lo:       0,
+			hi:       4,
+			numBins:  2,
+			wantBins: []HistogramBin{{boundary: 2, size: 3}, {boundary: 4, size: 2}},
+		},
+		{
+			desc:     "log",
+			samples:  []float64{1, 5, 10, 50, 100},
+			lo:       1,
+			hi:       100,
+			numBins:  2,
+			logScale: true,
+			wantBins: []HistogramBin{{boundary: 10, size: 3}, {boundary: 100, size: 2}},
+		},
+		{
+			desc:     "all same",
+			samples:  []float64{3, 3, 3},
+			lo:       3,
+			hi:       3,
+			numBins:  4,
+			wantBins: []HistogramBin{{boundary: 3, size: 3}, {boundary: 3}, {boundary: 3}, {boundary: 3}},
+		},
+		{
+			desc:     "out of range",
+			samples:  []float64{-1, 0, 1, 2, 3},
+			lo:       0,
+			hi:       2,
+			numBins:  2,
+			wantBins: []HistogramBin{{boundary: 1, size: 2}, {boundary: 2, size: 1}},
+		},
+		{desc: "log non-positive", samples: []float64{0, 1}, lo: 0, hi: 1, numBins: 2, logScale: true, expectErr: true},
+		{desc: "no bins", samples: []float64{1}, lo: 1, hi: 1, numBins: 0, expectErr: true},
+		{desc: "bad range", samples: []float64{1}, lo: 2, hi: 1, numBins: 1, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			h, err := HistogramOf(tc.samples, tc.lo, tc.hi, tc.numBins, tc.logScale)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %+v", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HistogramOf failed: %v", err)
+			}
+			if len(h.Bins()) != len(tc.wantBins) {
+				t.Fatalf("Got bins %+v, want %+v", h.Bins(), tc.wantBins)
+			}
+			for i, b := range h.Bins() {
+				want := tc.wantBins[i]
+				if b.Size() != want.size || math.Abs(b.Boundary()-want.boundary) > 1e-9 {
+					t.Errorf("Bin %d: got %+v, want %+v", i, b, want)
+				}
+			}
+			var wantTotal uint64
+			for _, b := range tc.wantBins {
+				wantTotal += b.size
+			}
+			if h.TotalSize != wantTotal {
+				t.Errorf("Got TotalSize %d, want %d", h.TotalSize, wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package anal
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SortGroupKeys sorts the keys of a map returned by GroupByFact (or Groups)
+// in place. The order is one of:
+//
+//   - "lexical" (or ""): plain string order.
+//   - "numeric": keys that parse as numbers come first in numeric order, then
+//     the others in lexical order.
+//   - "natural": runs of digits are compared as numbers, so "run-2" sorts
+//     before "run-10".
+//   - "explicit:a,b,c": the listed keys first in that order, then the others
+//     in lexical order.
+func SortGroupKeys(keys []string, order string) error {
+	switch {
+	case order == "" || order == "lexical":
+		slices.Sort(keys)
+	case order == "numeric":
+		slices.SortFunc(keys, compareNumeric)
+	case order == "natural":
+		slices.SortFunc(keys, compareNatural)
+	case strings.HasPrefix(order, "explicit:"):
+		explicit := strings.Split(strings.TrimPrefix(order, "explicit:"), ",")
+		for _, e := range explicit {
+			if !slices.Contains(keys, e) {
+				log.Printf("Group %q from %q not found", e, order)
+			}
+		}
+		rank := func(k string) int {
+			if i := slices.Index(explicit, k); i >= 0 {
+				return i
+			}
+			return len(explicit)
+		}
+		slices.SortFunc(keys, func(a, b string) int {
+			return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(a, b))
+		})
+	default:
+		return fmt.Errorf("invalid order %q, expect 'lexical', 'numeric', 'natural' or 'explicit:a,b,c'", order)
+	}
+	return nil
+}
+
+// AllNumeric reports whether all the keys (apart from "<NULL>") are numbers,
+// i.e. whether it makes sense to sort them as numbers. False if there aren't
+// any numbers at all.
+func AllNumeric(keys []string) bool {
+	found := false
+	for _, k := range keys {
+		if k == "<NULL>" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(k, 64); err != nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func compareNumeric(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Or(cmp.Compare(fa, fb), cmp.Compare(a, b))
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return cmp.Compare(a, b)
+	}
+}
+
+// Splits s into alternating runs of digits and non-digits.
+func naturalChunks(s string) []string {
+	var chunks []string
+	start := 0
+	for i, r := range s {
+		if i > start && unicode.IsDigit(r) != unicode.IsDigit(rune(s[i-1])) {
+			chunks = append(chunks, s[start:i])
+			start = i
+		}
+	}
+	if start < len(s) {
+		chunks = append(chunks, s[start:])
+	}
+	return chunks
+}
+
+func compareNatural(a, b string) int {
+	ca, cb := naturalChunks(a), naturalChunks(b)
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		na, errA := strconv.ParseUint(ca[i], 10, 64)
+		nb, errB := strconv.ParseUint(cb[i], 10, 64)
+		if errA == nil && errB == nil {
+			if c := cmp.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := cmp.Compare(ca[i], cb[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Or(cmp.Compare(len(ca), len(cb)), cmp.Compare(a, b))
+}
@@ -0,0 +1,56 @@
+package anal_test
+
+import (
+	"testing"
+
+	"github.com/bjackman/falba/internal/anal"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSortGroupKeys(t *testing.T) {
+	testCases := []struct {
+		order string
+		keys  []string
+		want  []string
+	}{
+		{order: "", keys: []string{"2", "10", "1"}, want: []string{"1", "10", "2"}},
+		{order: "lexical", keys: []string{"b", "a"}, want: []string{"a", "b"}},
+		{order: "numeric", keys: []string{"2", "<NULL>", "10", "1.5", "abc"}, want: []string{"1.5", "2", "10", "<NULL>", "abc"}},
+		{order: "natural", keys: []string{"run-10", "run-2", "run-1b", "run-1a", "other"}, want: []string{"other", "run-1a", "run-1b", "run-2", "run-10"}},
+		{order: "natural", keys: []string{"10", "9", "x"}, want: []string{"9", "10", "x"}},
+		{order: "natural", keys: []string{"6.10", "6.9", "6.1"}, want: []string{"6.1", "6.9", "6.10"}},
+		{order: "explicit:small,medium,large", keys: []string{"large", "other", "small", "medium"}, want: []string{"small", "medium", "large", "other"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.order, func(t *testing.T) {
+			if err := anal.SortGroupKeys(tc.keys, tc.order); err != nil {
+				t.Fatalf("SortGroupKeys failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.keys); diff != "" {
+				t.Errorf("Unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if err := anal.SortGroupKeys([]string{"a"}, "random"); err == nil {
+		t.Errorf("Expected error for invalid order, got nil")
+	}
+}
+
+func TestAllNumeric(t *testing.T) {
+	testCases := []struct {
+		keys []string
+		want bool
+	}{
+		{keys: []string{"8", "16", "2.5", "-1"}, want: true},
+		{keys: []string{"8", "<NULL>"}, want: true},
+		{keys: []string{"8", "eight"}, want: false},
+		{keys: []string{"<NULL>"}, want: false},
+		{keys: nil, want: false},
+	}
+	for _, tc := range testCases {
+		if got := anal.AllNumeric(tc.keys); got != tc.want {
+			t.Errorf("AllNumeric(%q) = %v, want %v", tc.keys, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package anal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// PairedMeans is for comparing groups where the same things (e.g. machines)
+// were measured in every group. It returns the mean of the metric for each
+// value of pairFact, for each value of experimentFact (which may be a
+// combination of facts, see CombineFacts). So ret["eevdf"]["host1"] is the
+// mean of all the samples from results with that scheduler on that machine.
+// Results where pairFact is NULL can't be paired so they're left out. Only
+// int and float metrics are supported.
+func PairedMeans(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, pairFact string, metric string, filterExpression string) (map[string]map[string]float64, error) {
+	experimentFacts := SplitFacts(experimentFact)
+	for _, f := range append(slices.Clone(experimentFacts), pairFact) {
+		if _, ok := falbaDB.FactTypes[f]; !ok {
+			return nil, fmt.Errorf("no fact %q\nAvailable facts:\n%s", f, ReadableList(maps.Keys(falbaDB.FactTypes)))
+		}
+	}
+	metricName, metricCond, err := metricCondition(metric)
+	if err != nil {
+		return nil, err
+	}
+	metricType, ok := falbaDB.MetricTypes[metricName]
+	if !ok {
+		return nil, fmt.Errorf("no metric %q\nAvailable metrics:\n%s", metricName, ReadableList(maps.Keys(falbaDB.MetricTypes)))
+	}
+	if metricType.Type != falba.ValueInt && metricType.Type != falba.ValueFloat {
+		return nil, fmt.Errorf("sorry, paired comparison is only implemented for float and int metrics (%v is %v)",
+			metricName, metricType)
+	}
+	if err := createFilteredResults(sqlDB, filterExpression, experimentFacts); err != nil {
+		return nil, fmt.Errorf("filtering results: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT CAST(r.%s AS VARCHAR), CAST(r.%s AS VARCHAR), AVG(CAST(m.%s AS DOUBLE))
+		FROM filtered_results r
+		INNER JOIN metrics m USING (result_id)
+		WHERE %s AND r.%s IS NOT NULL
+		GROUP BY 1, 2
+	`, combinedColumn(experimentFacts), pairFact, metricType.Type.MetricsColumn(), metricCond, pairFact)
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		log.Printf("Failed SQL query: %v", query)
+		return nil, fmt.Errorf("executing query: %v", err)
+	}
+	defer rows.Close()
+
+	ret := make(map[string]map[string]float64)
+	for rows.Next() {
+		var group sql.NullString
+		var pair string
+		var mean float64
+		if err := rows.Scan(&group, &pair, &mean); err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+		key := "<NULL>"
+		if group.Valid {
+			key = group.String
+		}
+		if ret[key] == nil {
+			ret[key] = make(map[string]float64)
+		}
+		ret[key][pair] = mean
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %v", err)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%w: no %q samples with a %s in results matching the filter %q",
+			ErrNoData, metric, pairFact, filterExpression)
+	}
+	return ret, nil
+}
+
+// PairedStats is the result of a paired t-test, see PairedTTest.
+type PairedStats struct {
+	// Number of keys that were in both groups.
+	Pairs int
+	// Mean of the per-pair differences (other - baseline).
+	MeanDiff float64
+	// Sample standard deviation of the differences.
+	StdDev float64
+	// The t statistic, with Pairs-1 degrees of freedom.
+	T float64
+	// Two-sided p-value, i.e. the probability of a MeanDiff at least this far
+	// from 0 if the two groups were really the same.
+	P float64
+}
+
+// PairedTTest compares two groups of values keyed by the thing that was
+// measured (like from PairedMeans), using the differences between the values
+// with the same key. This is much more sensitive than comparing the groups as
+// a whole when the keys differ a lot from each other, e.g. a fast and a slow
+// machine. Keys that are only in one of the groups are ignored. With fewer than
+// two pairs everything but Pairs (and MeanDiff, if there's one pair) is NaN.
+func PairedTTest(baseline, other map[string]float64) *PairedStats {
+	var diffs []float64
+	for key, b := range baseline {
+		if o, ok := other[key]; ok {
+			diffs = append(diffs, o-b)
+		}
+	}
+	s := &PairedStats{
+		Pairs:    len(diffs),
+		MeanDiff: Mean(diffs),
+		StdDev:   StdDev(diffs),
+		T:        math.NaN(),
+		P:        math.NaN(),
+	}
+	if len(diffs) < 2 {
+		return s
+	}
+	if s.StdDev == 0 {
+		// Every pair changed by exactly the same amount.
+		if s.MeanDiff == 0 {
+			s.T, s.P = 0, 1
+		} else {
+			s.T, s.P = math.Copysign(math.Inf(1), s.MeanDiff), 0
+		}
+		return s
+	}
+	s.T = s.MeanDiff / (s.StdDev / math.Sqrt(float64(len(diffs))))
+	s.P = studentTTwoSided(s.T, float64(len(diffs)-1))
+	return s
+}
+
+// studentTTwoSided returns P(|T| >= |t|) for Student's t distribution with df
+// degrees of freedom.
+func studentTTwoSided(t, df float64) float64 {
+	return regIncBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// regIncBeta is the regularized incomplete beta function I_x(a, b), evaluated
+// with a continued fraction as in Numerical Recipes.
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges fast on this side, use the symmetry
+	// I_x(a, b) = 1 - I_{1-x}(b, a) for the other.
+	if x < (a+1)/(a+b+2) {
+		return front * betaContFrac(a, b, x) / a
+	}
+	return 1 - front*betaContFrac(b, a, 1-x)/b
+}
+
+// betaContFrac evaluates the continued fraction for regIncBeta with the
+// modified Lentz method.
+func betaContFrac(a, b, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-15
+		tiny          = 1e-300
+	)
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		m := float64(m)
+		// Even step.
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		// Odd step.
+		num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
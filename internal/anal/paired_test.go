@@ -0,0 +1,151 @@
+package anal_test
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/bjackman/falba/internal/anal"
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPairedTTest(t *testing.T) {
+	// Builds a group from the values, keyed by their index.
+	group := func(vals ...float64) map[string]float64 {
+		m := make(map[string]float64)
+		for i, v := range vals {
+			m[fmt.Sprint(i)] = v
+		}
+		return m
+	}
+	testCases := []struct {
+		desc     string
+		baseline map[string]float64
+		other    map[string]float64
+		want     anal.PairedStats
+	}{
+		{
+			// With one degree of freedom this is the Cauchy distribution,
+			// where P(|T| >= 1) is exactly 0.5.
+			desc:     "t=1",
+			baseline: group(10, 20),
+			other:    group(10, 22),
+			want:     anal.PairedStats{Pairs: 2, MeanDiff: 1, StdDev: math.Sqrt2, T: 1, P: 0.5},
+		},
+		{
+			// 12.7062 is the critical value for p=0.05 with df=1.
+			desc:     "p=0.05",
+			baseline: group(0, 0),
+			other:    group(6.8531, 5.8531),
+			want:     anal.PairedStats{Pairs: 2, MeanDiff: 6.3531, StdDev: math.Sqrt2 / 2, T: 12.7062, P: 0.05},
+		},
+		{
+			desc:     "unmatched-keys-ignored",
+			baseline: map[string]float64{"a": 10, "b": 20, "only-baseline": 1000},
+			other:    map[string]float64{"a": 10, "b": 22, "only-other": -1000},
+			want:     anal.PairedStats{Pairs: 2, MeanDiff: 1, StdDev: math.Sqrt2, T: 1, P: 0.5},
+		},
+		{
+			desc:     "same-difference",
+			baseline: group(1, 2, 3),
+			other:    group(4, 5, 6),
+			want:     anal.PairedStats{Pairs: 3, MeanDiff: 3, StdDev: 0, T: math.Inf(1), P: 0},
+		},
+		{
+			desc:     "no-difference",
+			baseline: group(1, 2, 3),
+			other:    group(1, 2, 3),
+			want:     anal.PairedStats{Pairs: 3, MeanDiff: 0, StdDev: 0, T: 0, P: 1},
+		},
+		{
+			desc:     "one-pair",
+			baseline: group(1),
+			other:    group(3),
+			want:     anal.PairedStats{Pairs: 1, MeanDiff: 2, StdDev: math.NaN(), T: math.NaN(), P: math.NaN()},
+		},
+		{
+			desc:     "no-pairs",
+			baseline: map[string]float64{"a": 1},
+			other:    map[string]float64{"b": 1},
+			want:     anal.PairedStats{Pairs: 0, MeanDiff: math.NaN(), StdDev: math.NaN(), T: math.NaN(), P: math.NaN()},
+		},
+	}
+	approx := cmp.Comparer(func(x, y float64) bool {
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return math.IsNaN(x) && math.IsNaN(y)
+		}
+		if math.IsInf(x, 0) || math.IsInf(y, 0) {
+			return x == y
+		}
+		return math.Abs(x-y) < 1e-4
+	})
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := anal.PairedTTest(tc.baseline, tc.other)
+			if diff := cmp.Diff(tc.want, *got, approx); diff != "" {
+				t.Errorf("Unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPairedMeans(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result := func(id string, sched string, machine string, samples ...int64) *falba.Result {
+		facts := map[string]falba.Value{"sched": &falba.StringValue{Value: sched}}
+		if machine != "" {
+			facts["machine"] = &falba.StringValue{Value: machine}
+		}
+		r := &falba.Result{TestName: "test1", ResultID: id, Facts: facts}
+		for _, s := range samples {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: s}})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("r1", "cfs", "host1", 1, 3),
+			// Several results for the same pair get averaged together.
+			"r2": result("r2", "cfs", "host2", 10),
+			"r3": result("r3", "cfs", "host2", 20),
+			"r4": result("r4", "eevdf", "host1", 4),
+			// Can't be paired.
+			"r5": result("r5", "eevdf", "", 100),
+		},
+		FactTypes: map[string]falba.FactType{
+			"sched":   {Type: falba.ValueString},
+			"machine": {Type: falba.ValueString},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	got, err := anal.PairedMeans(sqlDB, falbaDB, "sched", "machine", "my_metric", "TRUE")
+	if err != nil {
+		t.Fatalf("PairedMeans failed: %v", err)
+	}
+	want := map[string]map[string]float64{
+		"cfs":   {"host1": 2, "host2": 15},
+		"eevdf": {"host1": 4},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected means (-want +got):\n%s", diff)
+	}
+
+	if _, err := anal.PairedMeans(sqlDB, falbaDB, "sched", "nonexistent", "my_metric", "TRUE"); err == nil {
+		t.Errorf("Expected error for nonexistent pair fact, got nil")
+	}
+}
@@ -0,0 +1,199 @@
+package anal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// Groups returns the raw samples of the metric, grouped by the values of the
+// facts, for results matching the filter. The map keys are the fact values
+// (as strings, NULL is "<NULL>") joined with ", ". With no facts, all the
+// samples go in a single group with key "". This is a lower-level
+// alternative to GroupByFact for when you want to compute your own stats, the
+// helpers below (Mean, Median etc) work on the returned slices.
+func Groups(sqlDB *sql.DB, falbaDB *db.DB, facts []string, metric string, filterExpression string) (map[string][]float64, error) {
+	for _, fact := range facts {
+		if _, ok := falbaDB.FactTypes[fact]; !ok {
+			return nil, fmt.Errorf("no fact %q\nAvailable facts:\n%s", fact, ReadableList(maps.Keys(falbaDB.FactTypes)))
+		}
+	}
+	metricName, metricCond, err := metricCondition(metric)
+	if err != nil {
+		return nil, err
+	}
+	metricType, ok := falbaDB.MetricTypes[metricName]
+	if !ok {
+		return nil, fmt.Errorf("no metric %q\nAvailable metrics:\n%s", metricName, ReadableList(maps.Keys(falbaDB.MetricTypes)))
+	}
+	if metricType.Type != falba.ValueInt && metricType.Type != falba.ValueFloat {
+		return nil, fmt.Errorf("sorry, only implemented for float and int metrics (%v is %v)",
+			metricName, metricType)
+	}
+	if err := createFilteredResults(sqlDB, filterExpression, nil); err != nil {
+		return nil, fmt.Errorf("filtering results: %w", err)
+	}
+
+	var columns []string
+	for _, fact := range facts {
+		columns = append(columns, fmt.Sprintf("CAST(r.%s AS VARCHAR)", fact))
+	}
+	groups, err := querySamples(sqlDB, columns, ", ", metricCond, metricType.Type.MetricsColumn())
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%w: no %q samples in results matching the filter %q", ErrNoData, metric, filterExpression)
+	}
+	ret := make(map[string][]float64)
+	for key, g := range groups {
+		ret[key] = g.samples
+	}
+	return ret, nil
+}
+
+// sampleGroup is the samples of a metric from the results with one
+// combination of values of the grouping columns.
+type sampleGroup struct {
+	testName string
+	samples  []float64
+}
+
+// querySamples reads the samples of the metric from the metrics rows matching
+// metricCond, in results from filtered_results, and groups them by the values
+// of the columns (SQL expressions on filtered_results r). The samples are read
+// from metricsColumn converted to a DOUBLE, so bools come out as 0 and 1. The
+// map keys are the column values (NULL is "<NULL>") joined with sep. This is
+// the common core of Groups and GroupByFact.
+func querySamples(sqlDB *sql.DB, columns []string, sep string, metricCond string, metricsColumn string) (map[string]*sampleGroup, error) {
+	selects := append([]string{"r.test_name"}, columns...)
+	selects = append(selects, fmt.Sprintf("CAST(m.%s AS DOUBLE)", metricsColumn))
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM filtered_results r
+		INNER JOIN metrics m USING (result_id)
+		WHERE %s
+	`, strings.Join(selects, ", "), metricCond)
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		log.Printf("Failed SQL query: %v", query)
+		return nil, fmt.Errorf("executing query: %v", err)
+	}
+	defer rows.Close()
+
+	ret := make(map[string]*sampleGroup)
+	var testName string
+	// Rows.Scan stringifies the column values, that's good enough for a key.
+	vals := make([]sql.NullString, len(columns))
+	var sample float64
+	ptrs := []any{&testName}
+	for i := range vals {
+		ptrs = append(ptrs, &vals[i])
+	}
+	ptrs = append(ptrs, &sample)
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("scanning rows: %v", err)
+		}
+		var keyParts []string
+		for _, v := range vals {
+			if v.Valid {
+				keyParts = append(keyParts, v.String)
+			} else {
+				keyParts = append(keyParts, "<NULL>")
+			}
+		}
+		key := strings.Join(keyParts, sep)
+		g, ok := ret[key]
+		if !ok {
+			g = &sampleGroup{testName: testName}
+			ret[key] = g
+		}
+		g.samples = append(g.samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %v", err)
+	}
+	return ret, nil
+}
+
+// Mean returns the arithmetic mean of the samples, or NaN if there are none.
+func Mean(samples []float64) float64 {
+	if len(samples) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / float64(len(samples))
+}
+
+// Quantile returns the q-quantile (q in [0, 1]) of the samples, interpolating
+// linearly between the closest samples like DuckDB's quantile_cont. A q
+// outside [0, 1] is clamped, so it gives the min or max. Returns NaN if there
+// are no samples or q is NaN.
+func Quantile(samples []float64, q float64) float64 {
+	if len(samples) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	q = max(0, min(q, 1))
+	sorted := slices.Sorted(slices.Values(samples))
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+// quantileDisc is like Quantile but it returns the nearest actual sample
+// instead of interpolating, picking the same one as DuckDB's quantile_disc.
+func quantileDisc(samples []float64, q float64) float64 {
+	if len(samples) == 0 {
+		return math.NaN()
+	}
+	sorted := slices.Sorted(slices.Values(samples))
+	n := float64(len(sorted))
+	// Written like this (rather than ceil(n*q)-1) to round the same way as
+	// DuckDB.
+	return sorted[max(1, len(sorted)-int(math.Floor(n-n*q)))-1]
+}
+
+// Median returns the median of the samples, or NaN if there are none.
+func Median(samples []float64) float64 {
+	return Quantile(samples, 0.5)
+}
+
+// StdDev returns the sample standard deviation, or NaN if there are fewer than
+// two samples.
+func StdDev(samples []float64) float64 {
+	if len(samples) < 2 {
+		return math.NaN()
+	}
+	mean := Mean(samples)
+	var sumSq float64
+	for _, s := range samples {
+		sumSq += (s - mean) * (s - mean)
+	}
+	return math.Sqrt(sumSq / float64(len(samples)-1))
+}
+
+// RelativeDelta returns (v - baseline) / baseline. If the baseline is 0 that
+// would be an infinity (or NaN if v is 0 too), so it returns ErrZeroBaseline
+// instead. If either value is NaN (e.g. a group with no samples) so is the
+// result.
+func RelativeDelta(v, baseline float64) (float64, error) {
+	if math.IsNaN(v) || math.IsNaN(baseline) {
+		return math.NaN(), nil
+	}
+	if baseline == 0 {
+		return 0, ErrZeroBaseline
+	}
+	return (v - baseline) / baseline, nil
+}
@@ -0,0 +1,268 @@
+package anal_test
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/bjackman/falba/internal/anal"
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestGroups(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	result := func(id string, facts map[string]falba.Value, samples ...int64) *falba.Result {
+		r := &falba.Result{TestName: "test1", ResultID: id, Facts: facts}
+		for _, s := range samples {
+			r.Metrics = append(r.Metrics, &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: s}})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": result("r1", map[string]falba.Value{
+				"a": &falba.StringValue{Value: "x"},
+				"b": &falba.IntValue{Value: 1},
+			}, 1, 2),
+			"r2": result("r2", map[string]falba.Value{
+				"a": &falba.StringValue{Value: "x"},
+				"b": &falba.IntValue{Value: 2},
+			}, 3),
+			"r3": result("r3", map[string]falba.Value{
+				"b": &falba.IntValue{Value: 2},
+			}, 4),
+		},
+		FactTypes: map[string]falba.FactType{
+			"a": {Type: falba.ValueString},
+			"b": {Type: falba.ValueInt},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"my_metric": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	testCases := []struct {
+		desc   string
+		facts  []string
+		filter string
+		want   map[string][]float64
+	}{
+		{
+			desc:   "one fact",
+			facts:  []string{"a"},
+			filter: "TRUE",
+			want:   map[string][]float64{"x": {1, 2, 3}, "<NULL>": {4}},
+		},
+		{
+			desc:   "two facts",
+			facts:  []string{"a", "b"},
+			filter: "TRUE",
+			want:   map[string][]float64{"x, 1": {1, 2}, "x, 2": {3}, "<NULL>, 2": {4}},
+		},
+		{
+			desc:   "no facts",
+			filter: "TRUE",
+			want:   map[string][]float64{"": {1, 2, 3, 4}},
+		},
+		{
+			desc:   "filter",
+			facts:  []string{"b"},
+			filter: "a = 'x'",
+			want:   map[string][]float64{"1": {1, 2}, "2": {3}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := anal.Groups(sqlDB, falbaDB, tc.facts, "my_metric", tc.filter)
+			if err != nil {
+				t.Fatalf("Groups failed: %v", err)
+			}
+			sortSamples := cmpopts.SortSlices(func(x, y float64) bool { return x < y })
+			if diff := cmp.Diff(tc.want, got, sortSamples); diff != "" {
+				t.Errorf("Unexpected groups (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := anal.Groups(sqlDB, falbaDB, []string{"nonexistent"}, "my_metric", "TRUE"); err == nil {
+		t.Errorf("Expected error for nonexistent fact, got nil")
+	}
+}
+
+func TestGroups_Labels(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	metric := func(val int64, labels map[string]string) *falba.Metric {
+		return &falba.Metric{Name: "latency", Value: &falba.IntValue{Value: val}, Labels: labels}
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"r1": {
+				TestName: "test1",
+				ResultID: "r1",
+				Facts:    map[string]falba.Value{},
+				Metrics: []*falba.Metric{
+					metric(1, map[string]string{"op": "read", "job": "a"}),
+					metric(2, map[string]string{"op": "read", "job": "b"}),
+					metric(3, map[string]string{"op": "write", "job": "a"}),
+					metric(4, nil),
+				},
+			},
+		},
+		FactTypes: map[string]falba.FactType{},
+		MetricTypes: map[string]falba.MetricType{
+			"latency": {Type: falba.ValueInt},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("Failed to insert into DuckDB: %v", err)
+	}
+
+	testCases := []struct {
+		selector string
+		want     []float64
+	}{
+		{selector: "latency", want: []float64{1, 2, 3, 4}},
+		{selector: "latency{op=read}", want: []float64{1, 2}},
+		{selector: "latency{op=read, job=b}", want: []float64{2}},
+		{selector: "latency{ op = 'write' }", want: []float64{3}},
+		{selector: "latency{}", want: []float64{1, 2, 3, 4}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.selector, func(t *testing.T) {
+			got, err := anal.Groups(sqlDB, falbaDB, nil, tc.selector, "TRUE")
+			if err != nil {
+				t.Fatalf("Groups failed: %v", err)
+			}
+			sortSamples := cmpopts.SortSlices(func(x, y float64) bool { return x < y })
+			if diff := cmp.Diff(map[string][]float64{"": tc.want}, got, sortSamples); diff != "" {
+				t.Errorf("Unexpected groups (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := anal.Groups(sqlDB, falbaDB, nil, "latency{op=nonexistent}", "TRUE"); !errors.Is(err, anal.ErrNoData) {
+		t.Errorf("Expected ErrNoData for unmatched label, got %v", err)
+	}
+}
+
+func TestParseMetricSelector(t *testing.T) {
+	testCases := []struct {
+		selector   string
+		wantName   string
+		wantLabels map[string]string
+		wantErr    bool
+	}{
+		{selector: "latency", wantName: "latency", wantLabels: map[string]string{}},
+		{selector: "latency{op=read,job=foo}", wantName: "latency", wantLabels: map[string]string{"op": "read", "job": "foo"}},
+		{selector: `latency{op="read"}`, wantName: "latency", wantLabels: map[string]string{"op": "read"}},
+		{selector: "latency{op}", wantErr: true},
+		{selector: "latency{=read}", wantErr: true},
+		{selector: "latency{op=read", wantErr: true},
+		{selector: "{op=read}", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.selector, func(t *testing.T) {
+			name, labels, err := anal.ParseMetricSelector(tc.selector)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q %v", name, labels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMetricSelector failed: %v", err)
+			}
+			if name != tc.wantName {
+				t.Errorf("Got name %q, want %q", name, tc.wantName)
+			}
+			if diff := cmp.Diff(tc.wantLabels, labels); diff != "" {
+				t.Errorf("Unexpected labels (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	samples := []float64{4, 1, 3, 2, 100}
+	if got := anal.Mean(samples); got != 22 {
+		t.Errorf("Mean: got %v, want 22", got)
+	}
+	if got := anal.Median(samples); got != 3 {
+		t.Errorf("Median: got %v, want 3", got)
+	}
+	if got := anal.Quantile([]float64{1, 2}, 0.5); got != 1.5 {
+		t.Errorf("Quantile: got %v, want 1.5", got)
+	}
+	// Out of range quantiles are clamped.
+	if got := anal.Quantile(samples, -0.5); got != 1 {
+		t.Errorf("Quantile(-0.5): got %v, want 1", got)
+	}
+	if got := anal.Quantile(samples, 1.5); got != 100 {
+		t.Errorf("Quantile(1.5): got %v, want 100", got)
+	}
+	if got := anal.Quantile(samples, math.NaN()); !math.IsNaN(got) {
+		t.Errorf("Quantile(NaN): got %v, want NaN", got)
+	}
+	if got := anal.StdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9}); math.Abs(got-2.138) > 0.001 {
+		t.Errorf("StdDev: got %v, want ~2.138", got)
+	}
+	for name, got := range map[string]float64{
+		"Mean":   anal.Mean(nil),
+		"Median": anal.Median(nil),
+		"StdDev": anal.StdDev([]float64{1}),
+	} {
+		if !math.IsNaN(got) {
+			t.Errorf("%s with no samples: got %v, want NaN", name, got)
+		}
+	}
+}
+
+func TestRelativeDelta(t *testing.T) {
+	testCases := []struct {
+		v, baseline float64
+		want        float64
+		wantErr     error
+	}{
+		{v: 150, baseline: 100, want: 0.5},
+		{v: 50, baseline: 100, want: -0.5},
+		{v: -3, baseline: -2, want: 0.5},
+		{v: 100, baseline: 100, want: 0},
+		{v: 5, baseline: 0, wantErr: anal.ErrZeroBaseline},
+		{v: -5, baseline: 0, wantErr: anal.ErrZeroBaseline},
+		{v: 0, baseline: 0, wantErr: anal.ErrZeroBaseline},
+		{v: math.NaN(), baseline: 100, want: math.NaN()},
+		{v: 5, baseline: math.NaN(), want: math.NaN()},
+	}
+	for _, tc := range testCases {
+		got, err := anal.RelativeDelta(tc.v, tc.baseline)
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("RelativeDelta(%v, %v): got error %v, want %v", tc.v, tc.baseline, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got != tc.want && !(math.IsNaN(got) && math.IsNaN(tc.want)) {
+			t.Errorf("RelativeDelta(%v, %v) = %v, want %v", tc.v, tc.baseline, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package anal
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var selectorRE = regexp.MustCompile(`^([^{}]+)(?:\{(.*)\})?$`)
+
+// ParseMetricSelector parses a metric name optionally followed by label
+// matchers, like "latency{op=read,job=foo}". Only samples with all those
+// label values are selected.
+func ParseMetricSelector(selector string) (string, map[string]string, error) {
+	match := selectorRE.FindStringSubmatch(strings.TrimSpace(selector))
+	if match == nil {
+		return "", nil, fmt.Errorf("invalid metric selector %q, expect e.g. 'latency' or 'latency{op=read}'", selector)
+	}
+	name := strings.TrimSpace(match[1])
+	labels := make(map[string]string)
+	if strings.TrimSpace(match[2]) == "" {
+		return name, labels, nil
+	}
+	for _, matcher := range strings.Split(match[2], ",") {
+		k, v, ok := strings.Cut(matcher, "=")
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if !ok || k == "" {
+			return "", nil, fmt.Errorf("invalid label matcher %q in %q, expect label=value", matcher, selector)
+		}
+		labels[k] = strings.Trim(v, `"'`)
+	}
+	return name, labels, nil
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// metricCondition returns the metric name from the selector and an SQL
+// expression that's true for rows of the metrics table that it selects. The
+// columns must be accessible as metric and labels.
+func metricCondition(selector string) (string, string, error) {
+	name, labels, err := ParseMetricSelector(selector)
+	if err != nil {
+		return "", "", err
+	}
+	conds := []string{"metric = " + sqlString(name)}
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		conds = append(conds, fmt.Sprintf("map_extract(labels, %s) = [%s]", sqlString(k), sqlString(labels[k])))
+	}
+	return name, strings.Join(conds, " AND "), nil
+}
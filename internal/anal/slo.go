@@ -0,0 +1,53 @@
+package anal
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SLO is an absolute target for a statistic, like "<= 50" for a latency.
+type SLO struct {
+	// One of <, <=, > and >=.
+	Op     string
+	Target float64
+}
+
+// ParseSLO parses an SLO like "<=50", ">1000" or just "50". Without an
+// operator it's "<=", since SLOs are usually a limit on something like
+// latency.
+func ParseSLO(s string) (*SLO, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	op := "<="
+	// Longest first so that "<=" isn't parsed as "<".
+	for _, o := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			s = strings.TrimPrefix(s, o)
+			break
+		}
+	}
+	target, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(target) || math.IsInf(target, 0) {
+		return nil, fmt.Errorf("invalid SLO %q, expect a number with an optional <, <=, > or >= in front", orig)
+	}
+	return &SLO{Op: op, Target: target}, nil
+}
+
+// Met reports whether v meets the SLO. NaN never does.
+func (s *SLO) Met(v float64) bool {
+	switch s.Op {
+	case "<":
+		return v < s.Target
+	case "<=":
+		return v <= s.Target
+	case ">":
+		return v > s.Target
+	case ">=":
+		return v >= s.Target
+	default:
+		return false
+	}
+}
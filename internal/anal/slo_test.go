@@ -0,0 +1,41 @@
+package anal_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bjackman/falba/internal/anal"
+)
+
+func TestSLO(t *testing.T) {
+	testCases := []struct {
+		slo  string
+		val  float64
+		want bool
+	}{
+		{slo: "50", val: 50, want: true},
+		{slo: "50", val: 50.1, want: false},
+		{slo: "<50", val: 50, want: false},
+		{slo: "< 50", val: 49, want: true},
+		{slo: ">=0.99", val: 0.99, want: true},
+		{slo: ">1000", val: 1000, want: false},
+		{slo: ">1000", val: 1e6, want: true},
+		{slo: "<=-1", val: -2, want: true},
+		{slo: "50", val: math.NaN(), want: false},
+	}
+	for _, tc := range testCases {
+		slo, err := anal.ParseSLO(tc.slo)
+		if err != nil {
+			t.Fatalf("ParseSLO(%q) failed: %v", tc.slo, err)
+		}
+		if got := slo.Met(tc.val); got != tc.want {
+			t.Errorf("ParseSLO(%q).Met(%v) = %v, want %v", tc.slo, tc.val, got, tc.want)
+		}
+	}
+
+	for _, slo := range []string{"", "<", "fast", "=50", "<<50", "50ms", "NaN"} {
+		if _, err := anal.ParseSLO(slo); err == nil {
+			t.Errorf("ParseSLO(%q) succeeded, want error", slo)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package anal
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"maps"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// ValueCounts is the frequency distribution of a string metric for some
+// collection of results. This is the categorical equivalent of MetricGroup.
+type ValueCounts struct {
+	TestName string
+	// Total number of samples.
+	Samples int
+	// Number of samples with each value.
+	Counts map[string]int
+}
+
+// CountValues is like GroupByFact, but for string metrics. Instead of
+// aggregating the samples it counts how many times each value occurs in each
+// group.
+func CountValues(sqlDB *sql.DB, falbaDB *db.DB, experimentFact string, metric string, filterExpression string, ignoreFacts []string) (map[string]*ValueCounts, error) {
+	numResults, err := prepareGroups(sqlDB, falbaDB, experimentFact, filterExpression, ignoreFacts)
+	if err != nil {
+		return nil, err
+	}
+
+	metricName, metricCond, err := metricCondition(metric)
+	if err != nil {
+		return nil, err
+	}
+	metricType, ok := falbaDB.MetricTypes[metricName]
+	if !ok {
+		return nil, fmt.Errorf("no metric %q\nAvailable metrics:\n%s", metricName, ReadableList(maps.Keys(falbaDB.MetricTypes)))
+	}
+	if metricType.Type != falba.ValueString {
+		return nil, fmt.Errorf("can only count values of string metrics (%v is %v)", metricName, metricType)
+	}
+	column := combinedColumn(SplitFacts(experimentFact))
+	query := fmt.Sprintf(`
+		SELECT ANY_VALUE(r.test_name), r.%s, m.string_value, COUNT(*)
+		FROM filtered_results r
+		INNER JOIN metrics m USING (result_id)
+		WHERE %s
+		GROUP BY r.%s, m.string_value
+	`, column, metricCond, column)
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		log.Printf("Failed SQL query: %v", query)
+		return nil, fmt.Errorf("executing count query: %v", err)
+	}
+	defer rows.Close()
+	ret := make(map[string]*ValueCounts)
+	for rows.Next() {
+		var testName string
+		var factStr sql.NullString
+		var value string
+		var count int
+		if err := rows.Scan(&testName, &factStr, &value, &count); err != nil {
+			return nil, fmt.Errorf("scanning count rows: %v", err)
+		}
+		key := "<NULL>"
+		if factStr.Valid {
+			key = factStr.String
+		}
+		group, ok := ret[key]
+		if !ok {
+			group = &ValueCounts{TestName: testName, Counts: make(map[string]int)}
+			ret[key] = group
+		}
+		group.Samples += count
+		group.Counts[value] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating count rows: %v", err)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%w: none of the %d results matching the filter have any %q samples",
+			ErrNoData, numResults, metric)
+	}
+	return ret, nil
+}
@@ -0,0 +1,28 @@
+package anal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// TimeWindows buckets the times (e.g. from db.ResultTimes) into windows of the
+// given length, returning a string fact value for each key that names the
+// start of its window in UTC. These sort in time order as long as they're all
+// from the same call. Windows that are a whole number of days are named by the
+// date, like "2025-01-31", otherwise they're in RFC 3339 format.
+func TimeWindows(times map[string]time.Time, window time.Duration) (map[string]falba.Value, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("window must be positive, got %v", window)
+	}
+	layout := time.RFC3339
+	if window%(24*time.Hour) == 0 {
+		layout = time.DateOnly
+	}
+	ret := make(map[string]falba.Value, len(times))
+	for key, t := range times {
+		ret[key] = &falba.StringValue{Value: t.UTC().Truncate(window).Format(layout)}
+	}
+	return ret, nil
+}
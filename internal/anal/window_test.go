@@ -0,0 +1,67 @@
+package anal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjackman/falba/internal/anal"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTimeWindows(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("Bad time %q: %v", s, err)
+		}
+		return ts
+	}
+	times := map[string]time.Time{
+		"a": at("2025-01-31T10:05:00Z"),
+		"b": at("2025-01-31T10:59:59Z"),
+		"c": at("2025-01-31T11:00:00Z"),
+		// Windows are in UTC, this is 10:30 UTC.
+		"d": at("2025-01-31T12:30:00+02:00"),
+		"e": at("2025-02-01T09:00:00Z"),
+	}
+	str := func(s string) falba.Value { return &falba.StringValue{Value: s} }
+	for _, tc := range []struct {
+		window time.Duration
+		want   map[string]falba.Value
+	}{
+		{
+			window: time.Hour,
+			want: map[string]falba.Value{
+				"a": str("2025-01-31T10:00:00Z"),
+				"b": str("2025-01-31T10:00:00Z"),
+				"c": str("2025-01-31T11:00:00Z"),
+				"d": str("2025-01-31T10:00:00Z"),
+				"e": str("2025-02-01T09:00:00Z"),
+			},
+		},
+		{
+			window: 24 * time.Hour,
+			want: map[string]falba.Value{
+				"a": str("2025-01-31"),
+				"b": str("2025-01-31"),
+				"c": str("2025-01-31"),
+				"d": str("2025-01-31"),
+				"e": str("2025-02-01"),
+			},
+		},
+	} {
+		got, err := anal.TimeWindows(times, tc.window)
+		if err != nil {
+			t.Fatalf("TimeWindows(%v) failed: %v", tc.window, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("TimeWindows(%v) unexpected result (-want +got):\n%s", tc.window, diff)
+		}
+	}
+
+	if _, err := anal.TimeWindows(times, 0); err == nil {
+		t.Errorf("TimeWindows with a zero window succeeded, want error")
+	}
+}
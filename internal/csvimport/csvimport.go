@@ -0,0 +1,194 @@
+// Package csvimport turns rows of a CSV file into results, for bulk-loading
+// data that was collected before it was in Falba.
+package csvimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+const (
+	// Names of the artifacts produced for each row. Parsers need to be
+	// configured to read them like any other artifact.
+	FactsArtifact   = "facts.json"
+	MetricsArtifact = "metrics.json"
+)
+
+// What a column of the CSV gets turned into.
+type Kind int
+
+const (
+	KindFact Kind = iota
+	KindMetric
+	// The column holds the test name.
+	KindTest
+)
+
+// Column says how to import one column of the CSV. The fact or metric gets
+// the same name as the column.
+type Column struct {
+	Kind Kind
+	Type falba.ValueType
+}
+
+// ParseSchema parses a comma-separated list of COLUMN:KIND[:TYPE], where KIND
+// is fact, metric or test. TYPE defaults to string for facts and float for
+// metrics, it doesn't apply to the test name. The result is keyed by column
+// name.
+func ParseSchema(s string) (map[string]*Column, error) {
+	schema := make(map[string]*Column)
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid schema entry %q, want COLUMN:KIND[:TYPE]", entry)
+		}
+		name := parts[0]
+		if _, ok := schema[name]; ok {
+			return nil, fmt.Errorf("column %q appears twice in schema", name)
+		}
+		col := &Column{}
+		switch parts[1] {
+		case "fact":
+			col.Kind = KindFact
+			col.Type = falba.ValueString
+			if falba.IsReservedFactName(name) {
+				return nil, fmt.Errorf("fact name %q is reserved (%s)", name, falba.GetReservedFactNamesString())
+			}
+		case "metric":
+			col.Kind = KindMetric
+			col.Type = falba.ValueFloat
+		case "test":
+			col.Kind = KindTest
+			if len(parts) == 3 {
+				return nil, fmt.Errorf("test name column %q can't have a type", name)
+			}
+		default:
+			return nil, fmt.Errorf("invalid kind %q for column %q, want fact, metric or test", parts[1], name)
+		}
+		if len(parts) == 3 {
+			t, err := falba.ParseValueType(parts[2])
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %v", name, err)
+			}
+			col.Type = t
+		}
+		schema[name] = col
+	}
+	numTest := 0
+	for _, col := range schema {
+		if col.Kind == KindTest {
+			numTest++
+		}
+	}
+	if numTest > 1 {
+		return nil, fmt.Errorf("only one column can hold the test name")
+	}
+	return schema, nil
+}
+
+// Row is a single result read from the CSV.
+type Row struct {
+	// Line in the CSV, for error messages.
+	Line int
+	// Empty if the schema has no test name column.
+	TestName string
+	// The artifacts for the result, in a fixed order.
+	Artifacts []Artifact
+}
+
+// Artifact is a file to be written into the result's artifacts directory.
+type Artifact struct {
+	Name    string
+	Content []byte
+}
+
+// Reader reads Rows from a CSV one at a time, so that huge files don't need
+// to fit in memory.
+type Reader struct {
+	r       *csv.Reader
+	columns []*Column // Indexed by position in the CSV, nil for ignored ones.
+	names   []string
+}
+
+// NewReader reads the header line of the CSV, which must contain every
+// column in the schema. Columns that aren't in the schema are ignored.
+func NewReader(r io.Reader, delimiter rune, schema map[string]*Column) (*Reader, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = delimiter
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	ret := &Reader{r: cr}
+	seen := make(map[string]bool)
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		if seen[name] {
+			return nil, fmt.Errorf("column %q appears twice in header", name)
+		}
+		seen[name] = true
+		ret.names = append(ret.names, name)
+		ret.columns = append(ret.columns, schema[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(schema)) {
+		if !seen[name] {
+			return nil, fmt.Errorf("no column %q in header (have %s)", name, strings.Join(ret.names, ", "))
+		}
+	}
+	return ret, nil
+}
+
+// Next returns the next row, or io.EOF when there are none left. Empty cells
+// are left out of the artifacts, so the result just won't have that fact or
+// metric.
+func (r *Reader) Next() (*Row, error) {
+	record, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := r.r.FieldPos(0)
+	row := &Row{Line: line}
+	facts := make(map[string]any)
+	metrics := make(map[string]any)
+	for i, cell := range record {
+		col := r.columns[i]
+		cell = strings.TrimSpace(cell)
+		if col == nil || cell == "" {
+			continue
+		}
+		if col.Kind == KindTest {
+			row.TestName = cell
+			continue
+		}
+		v, err := falba.ParseValue(cell, col.Type)
+		if err != nil {
+			return nil, fmt.Errorf("line %d, column %q: %v", line, r.names[i], err)
+		}
+		if col.Kind == KindFact {
+			facts[r.names[i]] = falba.ValueValue(v)
+		} else {
+			metrics[r.names[i]] = falba.ValueValue(v)
+		}
+	}
+	// Maps get marshalled with sorted keys, so the content (and therefore the
+	// result ID) only depends on the values.
+	for _, a := range []struct {
+		name string
+		vals map[string]any
+	}{{FactsArtifact, facts}, {MetricsArtifact, metrics}} {
+		content, err := json.Marshal(a.vals)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: encoding %v: %v", line, a.name, err)
+		}
+		row.Artifacts = append(row.Artifacts, Artifact{Name: a.name, Content: content})
+	}
+	return row, nil
+}
@@ -0,0 +1,124 @@
+package csvimport_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bjackman/falba/internal/csvimport"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSchema(t *testing.T) {
+	testCases := []struct {
+		schema  string
+		want    map[string]*csvimport.Column
+		wantErr bool
+	}{
+		{
+			schema: "kernel:fact, latency:metric:int,bench:test,ok:metric:bool,cpus:fact:int",
+			want: map[string]*csvimport.Column{
+				"kernel":  {Kind: csvimport.KindFact, Type: falba.ValueString},
+				"latency": {Kind: csvimport.KindMetric, Type: falba.ValueInt},
+				"bench":   {Kind: csvimport.KindTest},
+				"ok":      {Kind: csvimport.KindMetric, Type: falba.ValueBool},
+				"cpus":    {Kind: csvimport.KindFact, Type: falba.ValueInt},
+			},
+		},
+		{
+			schema: "iops:metric",
+			want: map[string]*csvimport.Column{
+				"iops": {Kind: csvimport.KindMetric, Type: falba.ValueFloat},
+			},
+		},
+		{schema: "", wantErr: true},
+		{schema: "kernel", wantErr: true},
+		{schema: "kernel:bogus", wantErr: true},
+		{schema: "kernel:fact:bogus", wantErr: true},
+		{schema: "kernel:fact:string:extra", wantErr: true},
+		{schema: "kernel:fact,kernel:metric", wantErr: true},
+		{schema: "a:test,b:test", wantErr: true},
+		{schema: "bench:test:string", wantErr: true},
+		{schema: "test_name:fact", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.schema, func(t *testing.T) {
+			got, err := csvimport.ParseSchema(tc.schema)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseSchema(%q) succeeded, want error", tc.schema)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchema(%q) failed: %v", tc.schema, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected schema (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	schema, err := csvimport.ParseSchema("kernel:fact,latency:metric:int,bench:test")
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	csv := "bench,kernel,ignored,latency\n" +
+		"fio,6.1,x,100\n" +
+		"fio,,y,\n" +
+		"\"a,b\",6.2,z, 200 \n"
+	r, err := csvimport.NewReader(strings.NewReader(csv), ',', schema)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	var got []*csvimport.Row
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		got = append(got, row)
+	}
+	artifacts := func(facts, metrics string) []csvimport.Artifact {
+		return []csvimport.Artifact{
+			{Name: "facts.json", Content: []byte(facts)},
+			{Name: "metrics.json", Content: []byte(metrics)},
+		}
+	}
+	want := []*csvimport.Row{
+		{Line: 2, TestName: "fio", Artifacts: artifacts(`{"kernel":"6.1"}`, `{"latency":100}`)},
+		{Line: 3, TestName: "fio", Artifacts: artifacts(`{}`, `{}`)},
+		{Line: 4, TestName: "a,b", Artifacts: artifacts(`{"kernel":"6.2"}`, `{"latency":200}`)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected rows (-want +got):\n%s", diff)
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	schema, err := csvimport.ParseSchema("kernel:fact,latency:metric:int")
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	if _, err := csvimport.NewReader(strings.NewReader("kernel,other\n"), ',', schema); err == nil {
+		t.Errorf("NewReader succeeded with a schema column missing from the header")
+	}
+	if _, err := csvimport.NewReader(strings.NewReader("kernel,latency,kernel\n"), ',', schema); err == nil {
+		t.Errorf("NewReader succeeded with a duplicated header column")
+	}
+
+	r, err := csvimport.NewReader(strings.NewReader("kernel\tlatency\n6.1\tfast\n"), '\t', schema)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Next() with a bad int gave error %v, want one mentioning line 2", err)
+	}
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobsDirName is the content-addressed artifact store in the root of a DB.
+// It's hidden so ReadDB doesn't treat it as a result. Blobs are stored at
+// .blobs/<first 2 chars of SHA-256>/<SHA-256> and results hardlink their
+// artifacts to them, so artifacts that several results share only take up
+// disk space once. Since they're hardlinks, readResult doesn't need to know
+// about them.
+const BlobsDirName = ".blobs"
+
+// Prefix of the temp files that blobs are written to before they're renamed
+// into place.
+const blobTempPrefix = ".tmp-"
+
+func blobPath(dbDir string, sha string) string {
+	return filepath.Join(dbDir, BlobsDirName, sha[:2], sha)
+}
+
+// LinkBlob makes dst a hardlink to the blob with the given SHA-256 (as a hex
+// string), first copying src into the store if the blob isn't there yet. If
+// hardlinks don't work (e.g. the filesystem doesn't support them) it returns
+// an error and dst isn't created, the caller can fall back to copying.
+func LinkBlob(dbDir string, sha string, src string, dst string) error {
+	if len(sha) < 2 {
+		return fmt.Errorf("invalid blob hash %q", sha)
+	}
+	path := blobPath(dbDir, sha)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := writeBlob(path, src); err != nil {
+			return fmt.Errorf("adding %v to blob store: %v", src, err)
+		}
+	} else if err != nil {
+		return err
+	}
+	return os.Link(path, dst)
+}
+
+// writeBlob copies src to path via a temp file, so a failure doesn't leave a
+// truncated blob behind for the next import to link to.
+func writeBlob(path string, src string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), blobTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Blobs are shared, editing one in place would change every result that
+	// links to it.
+	if err := tmp.Chmod(0444); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// PruneBlobs deletes blobs that no result in the DB links to any more (e.g.
+// after the results were deleted by prune), returning how many were deleted.
+func PruneBlobs(dbDir string) (int, error) {
+	blobsDir := filepath.Join(dbDir, BlobsDirName)
+	// Blobs by size, so we don't need to compare every artifact with every
+	// blob.
+	blobs := make(map[int64][]string)
+	infos := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(blobsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Temp files might belong to an import that's still writing them.
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), blobTempPrefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		blobs[info.Size()] = append(blobs[info.Size()], path)
+		infos[path] = info
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading blob store: %v", err)
+	}
+
+	entries, err := os.ReadDir(dbDir)
+	if err != nil {
+		return 0, fmt.Errorf("reading DB dir: %v", err)
+	}
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		// Results that are still being imported count too, they might be
+		// about to link to a blob we'd otherwise delete.
+		if entry.Name() == BlobsDirName || !entry.IsDir() {
+			continue
+		}
+		artifactsDir := filepath.Join(dbDir, entry.Name(), "artifacts")
+		err := filepath.WalkDir(artifactsDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			for _, blob := range blobs[info.Size()] {
+				if os.SameFile(info, infos[blob]) {
+					used[blob] = true
+				}
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("reading artifacts of %v: %v", entry.Name(), err)
+		}
+	}
+
+	deleted := 0
+	for path := range infos {
+		if used[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return deleted, fmt.Errorf("deleting blob: %v", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bjackman/falba/internal/db"
+)
+
+func TestBlobs(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(src, []byte("foo"), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "config", "metric": {"name": "m", "type": "string"}}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	// Not the real hash but it doesn't matter.
+	sha := "abcdef"
+
+	var dsts []string
+	for _, result := range []string{"test:1", "test:2"} {
+		artifactsDir := filepath.Join(tempDir, result, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		dst := filepath.Join(artifactsDir, "config")
+		if err := db.LinkBlob(tempDir, sha, src, dst); err != nil {
+			t.Fatalf("LinkBlob failed: %v", err)
+		}
+		dsts = append(dsts, dst)
+	}
+	for _, dst := range dsts {
+		content, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatalf("Reading linked artifact: %v", err)
+		}
+		if string(content) != "foo" {
+			t.Errorf("Linked artifact %v has content %q, want %q", dst, content, "foo")
+		}
+	}
+	info1, err := os.Stat(dsts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	info2, err := os.Stat(dsts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(info1, info2) {
+		t.Errorf("Artifacts weren't linked to the same blob")
+	}
+
+	// The blob store shouldn't look like a result.
+	if _, err := db.ReadDB(tempDir, nil); err != nil {
+		t.Errorf("Failed to read DB: %v", err)
+	}
+
+	// Still used by test:2.
+	if err := os.RemoveAll(filepath.Join(tempDir, "test:1")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.PruneBlobs(tempDir); err != nil || n != 0 {
+		t.Errorf("PruneBlobs with a result still using the blob gave (%d, %v), want (0, nil)", n, err)
+	}
+	if err := os.RemoveAll(filepath.Join(tempDir, "test:2")); err != nil {
+		t.Fatal(err)
+	}
+	// Looks like a blob that's still being written by an import.
+	tmpBlob := filepath.Join(tempDir, db.BlobsDirName, "ab", ".tmp-123")
+	if err := os.WriteFile(tmpBlob, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.PruneBlobs(tempDir); err != nil || n != 1 {
+		t.Errorf("PruneBlobs with no results gave (%d, %v), want (1, nil)", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, db.BlobsDirName, "ab", sha)); !os.IsNotExist(err) {
+		t.Errorf("Blob still exists after PruneBlobs (stat: %v)", err)
+	}
+	if _, err := os.Stat(tmpBlob); err != nil {
+		t.Errorf("PruneBlobs deleted a temp file: %v", err)
+	}
+}
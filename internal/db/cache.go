@@ -0,0 +1,114 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// Bump this whenever the tables created by InsertIntoDuckDB change, so that
+// old DuckDB files don't get reused.
+const duckDBSchemaVersion = 4
+
+// buildIdentity identifies the running falba build, so that tables made by an
+// older one (e.g. before a parser fix) aren't reused after an upgrade. The
+// version and VCS revision don't change when you rebuild with local edits, so
+// the executable's size and mtime go in too.
+var buildIdentity = sync.OnceValue(func() string {
+	var b strings.Builder
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "%s %s", info.Main.Path, info.Main.Version)
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				fmt.Fprintf(&b, " %s=%s", setting.Key, setting.Value)
+			}
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			fmt.Fprintf(&b, " exe %d %d", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+})
+
+// Hashes the falba build and the names, sizes and mtimes of all the files that
+// went into reading the DB. This doesn't look at file contents so it's cheap,
+// but it means that if you go out of your way to modify a file without
+// changing its mtime, you need --rebuild.
+func hashInputs(configPaths []string, results map[string]*falba.Result, opts ReadOptions) (string, error) {
+	h := sha256.New()
+	// FailFast only matters when reading fails, in which case there's nothing
+	// to reuse anyway.
+	opts.FailFast = false
+	fmt.Fprintf(h, "schema %d\nbuild %s\nopts %+v\n", duckDBSchemaVersion, buildIdentity(), opts)
+	hashFile := func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%q %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	}
+	for _, path := range configPaths {
+		if err := hashFile(path); err != nil {
+			return "", err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(results)) {
+		io.WriteString(h, "result "+id+"\n")
+		for _, a := range results[id].Artifacts {
+			if err := hashFile(a.Path); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Reads the InputsHash that was stored by LoadIntoDuckDB, or "" if there isn't
+// one.
+func storedInputsHash(sqlDB *sql.DB) string {
+	var hash string
+	// If the table doesn't exist (e.g. it's a new DuckDB file) that's just a
+	// cache miss.
+	if err := sqlDB.QueryRow("SELECT inputs_hash FROM falba_meta").Scan(&hash); err != nil {
+		return ""
+	}
+	return hash
+}
+
+// LoadIntoDuckDB is like InsertIntoDuckDB, but if the DuckDB database was
+// already loaded from the same inputs (according to InputsHash), it's left
+// alone. Set rebuild to always reload it. Returns whether the existing tables
+// were reused.
+func (d *DB) LoadIntoDuckDB(sqlDB *sql.DB, rebuild bool) (bool, error) {
+	if !rebuild && d.InputsHash != "" && storedInputsHash(sqlDB) == d.InputsHash {
+		return true, nil
+	}
+	// Drop the old hash first so that if anything goes wrong below, the
+	// tables don't get reused next time.
+	if _, err := sqlDB.Exec("DROP TABLE IF EXISTS falba_meta"); err != nil {
+		return false, fmt.Errorf("dropping falba_meta table: %v", err)
+	}
+	if err := d.InsertIntoDuckDB(sqlDB); err != nil {
+		return false, err
+	}
+	if d.InputsHash == "" {
+		return false, nil
+	}
+	if _, err := sqlDB.Exec("CREATE TABLE falba_meta AS SELECT ? AS inputs_hash", d.InputsHash); err != nil {
+		return false, fmt.Errorf("creating falba_meta table: %v", err)
+	}
+	return false, nil
+}
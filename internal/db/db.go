@@ -1,42 +1,280 @@
 // Package db contains the logic to glue data together into a database.
+//
+// The DuckDB parts only use database/sql, it's up to the caller to import a
+// driver. So if you just want to read the results (with ReadDB) you don't need
+// CGo or the DuckDB library.
 package db
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/fs"
+	"io"
 	"log"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 
+	"github.com/bjackman/falba/internal/deriver"
 	"github.com/bjackman/falba/internal/falba"
 	"github.com/bjackman/falba/internal/parser"
+	"github.com/bjackman/falba/internal/unit"
+	"github.com/bjackman/falba/internal/walk"
+	"gopkg.in/yaml.v3"
 )
 
 var (
+	// %s is the columns, see resultsColumns.
 	createResultsSQL = `
 		CREATE OR REPLACE TABLE results
-		AS SELECT * FROM read_json(?, format='array')
+		AS SELECT * FROM read_json(?, format='array', columns={%s})
 	`
+	// The schema is explicit here so that the table (and the helpers below)
+	// still make sense when there are no metrics at all. %s is the columns,
+	// see metricsColumns.
 	createMetricsSQL = `
 		CREATE OR REPLACE TABLE metrics
-		AS SELECT * FROM read_json(?, format='array')
+		AS SELECT * FROM read_json(?, format='array', columns={%s})
 	`
+	createParseErrorsSQL = `
+		CREATE OR REPLACE TABLE parse_errors
+		AS SELECT * FROM read_json(?, format='array', columns={%s})
+	`
+)
+
+// Errors that ReadDB and ReadDBs can return, wrapped with more details, so
+// callers can check for them with errors.Is.
+var (
+	// A directory in the DB root isn't named $test_name:$result_id.
+	ErrInvalidResultName = errors.New("invalid result name")
+	// Two parsers (or derivers, or defaults) produced the same fact for a
+	// result.
+	ErrDuplicateFact = errors.New("duplicate fact")
+	// Two parsers (or derivers) produce the same fact or metric with
+	// different types.
+	ErrTypeConflict = errors.New("type conflict")
+	// There was no parser configuration.
+	ErrNoParsers = errors.New("no parsers")
+	// A fact has a value that isn't in its enum.
+	ErrInvalidEnumValue = errors.New("invalid enum value")
+	// DuckDB doesn't have the functions we need.
+	ErrDuckDBTooOld = errors.New("DuckDB missing required functions")
+	// ReadResult didn't find a result with that ID.
+	ErrResultNotFound = errors.New("result not found")
 )
 
-// A DB is a collection of results read from a directory. Each entry in the
-// directory is of the format $test_name:$test_id. It contains a directory
-// called artifacts/ which contains the artifacts.
+// Helpers for finding out which results have which metrics. These are mostly
+// for use in --filter expressions, like
+// "has_metric(metric_samples, 'latency')", to exclude results where some part
+// of the test didn't run. DuckDB won't let a macro refer to a column directly so
+// you have to pass metric_samples in explicitly.
+var createMetricHelpersSQL = []string{
+	`CREATE OR REPLACE VIEW metric_counts AS
+		SELECT result_id, metric, count(*) AS samples
+		FROM metrics GROUP BY result_id, metric`,
+	`ALTER TABLE results ADD COLUMN metric_samples MAP(VARCHAR, BIGINT)`,
+	`UPDATE results SET metric_samples = (
+		SELECT map(list(metric), list(samples)) FROM metric_counts c
+		WHERE c.result_id = results.result_id
+	)`,
+	`CREATE OR REPLACE MACRO metric_count(samples, name) AS
+		coalesce(map_extract(samples, name)[1], 0)`,
+	`CREATE OR REPLACE MACRO has_metric(samples, name) AS metric_count(samples, name) > 0`,
+}
+
+// A DB is a collection of results read from one or more directories. Each
+// entry in the directory is of the format $test_name:$test_id. It contains a
+// directory called artifacts/ which contains the artifacts.
 type DB struct {
-	RootDir string
+	RootDirs []string
 	// Keys of this map are the result ID.
 	Results     map[string]*falba.Result
-	FactTypes   map[string]falba.ValueType
+	FactTypes   map[string]falba.FactType
 	MetricTypes map[string]falba.MetricType
+	// Keys of this map are the parser name.
+	ParserStats map[string]*ParserStats
+	// Identifies the state of the files the DB was read from, see
+	// LoadIntoDuckDB. Empty if unknown.
+	InputsHash string
+	// Metrics have their Source set, and the metrics table gets parser and
+	// artifact columns. See ReadOptions.
+	MetricProvenance bool
+}
+
+// ParserStats records how much use a parser got while reading the DB. This is
+// mostly useful for spotting parsers that are misconfigured, for example with
+// a typo in their artifact_regexp.
+type ParserStats struct {
+	// Number of artifacts (across all results) that the parser matched.
+	MatchedArtifacts int
+	// Number of values (facts or metric samples) that the parser produced.
+	ProducedValues int
+}
+
+// UnmatchedParsers returns the sorted names of parsers that didn't match any
+// artifact in the whole DB.
+func (d *DB) UnmatchedParsers() []string {
+	var names []string
+	for name, stats := range d.ParserStats {
+		if stats.MatchedArtifacts == 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Filter returns a new DB with only the results that pred returns true for.
+// FactTypes and MetricTypes only have the facts and metrics that some remaining
+// result actually has. The results themselves are shared with d, and so are
+// the ParserStats, which are still about reading the whole DB.
+func (d *DB) Filter(pred func(*falba.Result) bool) *DB {
+	ret := &DB{
+		RootDirs:         d.RootDirs,
+		Results:          make(map[string]*falba.Result),
+		FactTypes:        make(map[string]falba.FactType),
+		MetricTypes:      make(map[string]falba.MetricType),
+		ParserStats:      d.ParserStats,
+		MetricProvenance: d.MetricProvenance,
+	}
+	for id, r := range d.Results {
+		if !pred(r) {
+			continue
+		}
+		ret.Results[id] = r
+		for name := range r.Facts {
+			if t, ok := d.FactTypes[name]; ok {
+				ret.FactTypes[name] = t
+			}
+		}
+		for _, m := range r.Metrics {
+			if t, ok := d.MetricTypes[m.Name]; ok {
+				ret.MetricTypes[m.Name] = t
+			}
+		}
+	}
+	// The DuckDB tables are different now, so they mustn't be confused with
+	// the unfiltered ones. The predicate can't be hashed, but which results
+	// it kept can.
+	if d.InputsHash != "" {
+		h := sha256.New()
+		io.WriteString(h, d.InputsHash+"\nfilter")
+		for _, id := range slices.Sorted(maps.Keys(ret.Results)) {
+			io.WriteString(h, " "+id)
+		}
+		ret.InputsHash = hex.EncodeToString(h.Sum(nil))
+	}
+	return ret
+}
+
+// FilterByArtifact drops the results that don't have any artifact whose name
+// (relative to the artifacts dir) matches the regexp.
+func (d *DB) FilterByArtifact(re *regexp.Regexp) {
+	*d = *d.Filter(func(r *falba.Result) bool {
+		return slices.ContainsFunc(r.Artifacts, func(a *falba.Artifact) bool { return re.MatchString(a.Name) })
+	})
+}
+
+// AddFact adds a fact that doesn't come from the parsers, e.g. one computed by
+// the caller from other data. values is keyed by result ID, results that
+// aren't in it don't get the fact. The name mustn't already be used by a fact
+// or metric.
+func (d *DB) AddFact(name string, factType falba.FactType, values map[string]falba.Value) error {
+	if falba.IsReservedFactName(name) {
+		return fmt.Errorf("%w: fact name %q is reserved (%s)", parser.ErrReservedName, name, falba.GetReservedFactNamesString())
+	}
+	if _, ok := d.FactTypes[name]; ok {
+		return fmt.Errorf("%w: there's already a fact called %q", ErrDuplicateFact, name)
+	}
+	if _, ok := d.MetricTypes[name]; ok {
+		return fmt.Errorf("%w: there's already a metric called %q", ErrTypeConflict, name)
+	}
+	for _, id := range slices.Sorted(maps.Keys(values)) {
+		if _, ok := d.Results[id]; !ok {
+			return fmt.Errorf("no result %q to add fact %q to", id, name)
+		}
+		if t := values[id].Type(); t != factType.Type {
+			return fmt.Errorf("%w: value for fact %q in result %v is %v, want %v", ErrTypeConflict, name, id, t, factType.Type)
+		}
+	}
+	for id, v := range values {
+		d.Results[id].Facts[name] = v
+	}
+	d.FactTypes[name] = factType
+	// Like for Filter, the DuckDB tables mustn't be confused with the ones
+	// without the fact.
+	if d.InputsHash != "" {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\nfact %q", d.InputsHash, name)
+		for _, id := range slices.Sorted(maps.Keys(values)) {
+			fmt.Fprintf(h, " %s=%v", id, falba.ValueValue(values[id]))
+		}
+		d.InputsHash = hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
+}
+
+// ConvertFact turns a string fact into an int or float fact, for when the
+// parsers captured something numeric as a string. It fails if any value (or
+// value in the enum) isn't a number. Surrounding whitespace is ignored.
+func (d *DB) ConvertFact(name string, t falba.ValueType) error {
+	factType, ok := d.FactTypes[name]
+	if !ok {
+		return fmt.Errorf("no fact %q", name)
+	}
+	if factType.Type == t {
+		return nil
+	}
+	if factType.Type != falba.ValueString {
+		return fmt.Errorf("%w: fact %q is %v, only string facts can be converted", ErrTypeConflict, name, factType.Type)
+	}
+	if t != falba.ValueInt && t != falba.ValueFloat {
+		return fmt.Errorf("can only convert facts to int or float, not %v", t)
+	}
+	convert := func(v falba.Value) (falba.Value, error) {
+		return falba.ParseValue(strings.TrimSpace(v.StringValue()), t)
+	}
+	// Check everything before changing anything.
+	converted := make(map[string]falba.Value)
+	for _, id := range slices.Sorted(maps.Keys(d.Results)) {
+		v, ok := d.Results[id].Facts[name]
+		if !ok {
+			continue
+		}
+		c, err := convert(v)
+		if err != nil {
+			return fmt.Errorf("result %v: %s = %q isn't a valid %v", id, name, v.StringValue(), t)
+		}
+		converted[id] = c
+	}
+	var enum []falba.Value
+	for _, v := range factType.Enum {
+		c, err := convert(v)
+		if err != nil {
+			return fmt.Errorf("enum value %q of %s isn't a valid %v", v.StringValue(), name, t)
+		}
+		enum = append(enum, c)
+	}
+	for id, v := range converted {
+		d.Results[id].Facts[name] = v
+	}
+	d.FactTypes[name] = falba.FactType{Type: t, Enum: enum}
+	// Like for AddFact, the DuckDB tables mustn't be confused with the ones
+	// with the string fact.
+	if d.InputsHash != "" {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\nconvert %q %v", d.InputsHash, name, t)
+		d.InputsHash = hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
 }
 
 // Er, I can't really explain this function except by translating the whole code
@@ -67,82 +305,350 @@ func feedJSONToStmt(sqlDB *sql.DB, query string, obj any) error {
 	return nil
 }
 
+func duckDBType(t falba.ValueType) string {
+	switch t {
+	case falba.ValueInt:
+		return "BIGINT"
+	case falba.ValueFloat:
+		return "DOUBLE"
+	case falba.ValueString:
+		return "VARCHAR"
+	case falba.ValueBool:
+		return "BOOLEAN"
+	default:
+		panic(fmt.Sprintf("Invalid ValueType %d", t))
+	}
+}
+
+// A column of one of the tables that InsertIntoDuckDB creates.
+type tableColumn struct {
+	name    string
+	sqlType string
+}
+
+// resultsColumns returns the columns of the results table. These are explicit
+// so that the table still has the right columns when it's empty, and so that
+// the column order is always the same: test_name, result_id, then the facts
+// sorted by name. (metric_samples gets added later, see
+// createMetricHelpersSQL.)
+func (d *DB) resultsColumns() []tableColumn {
+	cols := []tableColumn{{"test_name", "VARCHAR"}, {"result_id", "VARCHAR"}}
+	for _, name := range slices.Sorted(maps.Keys(d.FactTypes)) {
+		cols = append(cols, tableColumn{name, duckDBType(d.FactTypes[name].Type)})
+	}
+	return cols
+}
+
+// metricsColumns returns the columns of the metrics table, see
+// falba.Result.ForMetricsTable.
+func (d *DB) metricsColumns() []tableColumn {
+	cols := []tableColumn{
+		{"result_id", "VARCHAR"},
+		{"metric", "VARCHAR"},
+		{"unit_name", "VARCHAR"},
+		{"unit_short_name", "VARCHAR"},
+		{"unit_family", "VARCHAR"},
+		{"int_value", "BIGINT"},
+		{"float_value", "DOUBLE"},
+		{"string_value", "VARCHAR"},
+		{"bool_value", "BOOLEAN"},
+		{"labels", "MAP(VARCHAR, VARCHAR)"},
+		{"repetition", "BIGINT"},
+	}
+	if d.MetricProvenance {
+		cols = append(cols, tableColumn{"parser", "VARCHAR"}, tableColumn{"artifact", "VARCHAR"})
+	}
+	return cols
+}
+
+var parseErrorsColumns = []tableColumn{
+	{"result_id", "VARCHAR"},
+	{"parser", "VARCHAR"},
+	{"artifact", "VARCHAR"},
+	{"message", "VARCHAR"},
+}
+
+// readJSONColumns formats the columns for the 'columns' argument of read_json.
+func readJSONColumns(cols []tableColumn) string {
+	var parts []string
+	for _, c := range cols {
+		parts = append(parts, fmt.Sprintf("'%s': '%s'", strings.ReplaceAll(c.name, "'", "''"), c.sqlType))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SchemaSQL returns CREATE TABLE statements for the results, metrics and
+// parse_errors tables, with the same columns that InsertIntoDuckDB would create
+// (including metric_samples in the results table). This is for creating
+// matching tables somewhere else, nothing gets executed. The types are
+// DuckDB's, which mostly match standard SQL apart from the MAPs.
+func (d *DB) SchemaSQL() string {
+	var b strings.Builder
+	for _, table := range []struct {
+		name string
+		cols []tableColumn
+	}{
+		{"results", append(d.resultsColumns(), tableColumn{"metric_samples", "MAP(VARCHAR, BIGINT)"})},
+		{"metrics", d.metricsColumns()},
+		{"parse_errors", parseErrorsColumns},
+	} {
+		fmt.Fprintf(&b, "CREATE TABLE %s (\n", table.name)
+		for i, c := range table.cols {
+			sep := ","
+			if i == len(table.cols)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, "    %s %s%s\n", quoteIdent(c.name), c.sqlType, sep)
+		}
+		b.WriteString(");\n")
+	}
+	return b.String()
+}
+
+// quoteIdent quotes a column name for use in SQL.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// resultsRow is like r.ForResultsTable but ensures that there is a column for
+// every defined fact, this keeps queries simple. Is this a dumb hack? I'm not
+// sure, it might be or it might be sensible.
+func (d *DB) resultsRow(r *falba.Result) map[string]any {
+	row := r.ForResultsTable()
+	for factName := range d.FactTypes {
+		if _, ok := row[factName]; !ok {
+			row[factName] = nil
+		}
+	}
+	return row
+}
+
+// FlatRecords returns one record per result, sorted by result ID, for feeding
+// into dataframe libraries, JSON or whatever without going through DuckDB.
+// Each record has the test_name, result_id and facts (nil if the result doesn't
+// have them) just like the results table. Then for each metric there's
+// $metric_samples, the number of samples. For numeric metrics there are also
+// $metric_mean, $metric_min and $metric_max (float64, nil if there are no
+// samples). If one of those collides with the name of a fact, the fact wins.
+func (d *DB) FlatRecords() []map[string]any {
+	var records []map[string]any
+	for _, resultID := range slices.Sorted(maps.Keys(d.Results)) {
+		r := d.Results[resultID]
+		samples := make(map[string][]falba.Value)
+		for _, m := range r.Metrics {
+			samples[m.Name] = append(samples[m.Name], m.Value)
+		}
+
+		aggs := make(map[string]any)
+		for name, metricType := range d.MetricTypes {
+			vals := samples[name]
+			aggs[name+"_samples"] = len(vals)
+			if metricType.Type != falba.ValueInt && metricType.Type != falba.ValueFloat {
+				continue
+			}
+			aggs[name+"_mean"] = nil
+			aggs[name+"_min"] = nil
+			aggs[name+"_max"] = nil
+			if len(vals) == 0 {
+				continue
+			}
+			var sum float64
+			lo, hi := math.Inf(1), math.Inf(-1)
+			for _, v := range vals {
+				f := v.FloatValue()
+				if v.Type() == falba.ValueInt {
+					f = float64(v.IntValue())
+				}
+				sum += f
+				lo = math.Min(lo, f)
+				hi = math.Max(hi, f)
+			}
+			aggs[name+"_mean"] = sum / float64(len(vals))
+			aggs[name+"_min"] = lo
+			aggs[name+"_max"] = hi
+		}
+
+		record := d.resultsRow(r)
+		// The results table rows have Values, which are only for JSON.
+		for k, v := range record {
+			if val, ok := v.(falba.Value); ok {
+				record[k] = falba.ValueValue(val)
+			}
+		}
+		for k, v := range aggs {
+			if _, ok := record[k]; !ok {
+				record[k] = v
+			}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// DuckDB functions that Falba relies on, here or in the anal package. Older
+// DuckDB versions don't have all of them.
+var requiredDuckDBFunctions = []string{
+	"read_json", "map_extract", "histogram", "equi_width_bins", "quantile_disc", "median",
+}
+
+// CheckDuckDB checks that the DuckDB behind sqlDB has all the functions Falba
+// needs. Otherwise queries fail later on with cryptic errors, this gives a
+// clearer one that includes the DuckDB version.
+func CheckDuckDB(sqlDB *sql.DB) error {
+	var version string
+	if err := sqlDB.QueryRow("SELECT version()").Scan(&version); err != nil {
+		return fmt.Errorf("getting DuckDB version (is this really DuckDB?): %v", err)
+	}
+	rows, err := sqlDB.Query("SELECT DISTINCT function_name FROM duckdb_functions()")
+	if err != nil {
+		return fmt.Errorf("listing functions in DuckDB %v: %v", version, err)
+	}
+	defer rows.Close()
+	have := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("scanning function names: %v", err)
+		}
+		have[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating function names: %v", err)
+	}
+	var missing []string
+	for _, name := range requiredDuckDBFunctions {
+		if !have[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: DuckDB %v lacks %s, try a newer go-duckdb",
+			ErrDuckDBTooOld, version, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // Insert a 'results' and a 'metrics' table into the SQL database, which
-// probably only works for DuckDB.
+// probably only works for DuckDB. This also sets up a 'metric_counts' view, a
+// 'metric_samples' column in the results table and
+// 'metric_count(metric_samples, metric)' and
+// 'has_metric(metric_samples, metric)' macros.
 func (d *DB) InsertIntoDuckDB(sqlDB *sql.DB) error {
+	// Sort the rows too so that SELECT * is stable from one run to the next.
+	resultIDs := slices.Sorted(maps.Keys(d.Results))
 	resultsRows := []map[string]any{}
-	for _, r := range d.Results {
-		// Ensure that there is a column for every defined fact, this keeps
-		// queries simple. Is this a dumb hack? I'm not sure, it might be or it
-		// might be sensible.
-		row := r.ForResultsTable()
-		for factName := range d.FactTypes {
-			if _, ok := row[factName]; !ok {
-				row[factName] = nil
-			}
-		}
-		resultsRows = append(resultsRows, row)
+	for _, id := range resultIDs {
+		resultsRows = append(resultsRows, d.resultsRow(d.Results[id]))
 	}
-	err := feedJSONToStmt(sqlDB, createResultsSQL, resultsRows)
+	err := feedJSONToStmt(sqlDB, fmt.Sprintf(createResultsSQL, readJSONColumns(d.resultsColumns())), resultsRows)
 	if err != nil {
 		return fmt.Errorf("inserting results JSON into SQL DB: %w", err)
 	}
 
 	metricsRows := []map[string]any{}
-	for _, r := range d.Results {
-		metricsRows = append(metricsRows, r.ForMetricsTable()...)
+	for _, id := range resultIDs {
+		metricsRows = append(metricsRows, d.Results[id].ForMetricsTable()...)
 	}
-	err = feedJSONToStmt(sqlDB, createMetricsSQL, metricsRows)
+	err = feedJSONToStmt(sqlDB, fmt.Sprintf(createMetricsSQL, readJSONColumns(d.metricsColumns())), metricsRows)
 	if err != nil {
 		return fmt.Errorf("inserting metrics JSON into SQL DB: %w", err)
 	}
 
+	parseErrorsRows := []map[string]any{}
+	for _, id := range resultIDs {
+		for _, e := range d.Results[id].ParseErrors {
+			parseErrorsRows = append(parseErrorsRows, map[string]any{
+				"result_id": id,
+				"parser":    e.Parser,
+				"artifact":  e.Artifact,
+				"message":   e.Message,
+			})
+		}
+	}
+	err = feedJSONToStmt(sqlDB, fmt.Sprintf(createParseErrorsSQL, readJSONColumns(parseErrorsColumns)), parseErrorsRows)
+	if err != nil {
+		return fmt.Errorf("inserting parse errors JSON into SQL DB: %w", err)
+	}
+
+	for _, stmt := range createMetricHelpersSQL {
+		if _, err := sqlDB.Exec(stmt); err != nil {
+			return fmt.Errorf("creating metric helpers: %w", err)
+		}
+	}
+
+	if _, err := sqlDB.Exec(d.resultsWideSQL()); err != nil {
+		return fmt.Errorf("creating results_wide view: %w", err)
+	}
+
 	return nil
 }
 
-func isDir(path string) (bool, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return false, err
+// Returns SQL to create the results_wide view. This is the results table with
+// an extra column for each numeric metric, holding the mean of its samples
+// for that result (NULL if there are none). Samples with different labels get
+// averaged together too. DuckDB only allows PIVOT in a view if the columns are
+// listed explicitly, so the query depends on the metrics in the DB.
+func (d *DB) resultsWideSQL() string {
+	var metrics []string
+	for _, name := range slices.Sorted(maps.Keys(d.MetricTypes)) {
+		switch d.MetricTypes[name].Type {
+		case falba.ValueInt, falba.ValueFloat:
+			metrics = append(metrics, "'"+strings.ReplaceAll(name, "'", "''")+"'")
+		}
+	}
+	if len(metrics) == 0 {
+		return "CREATE OR REPLACE VIEW results_wide AS SELECT * FROM results"
 	}
-	return info.IsDir(), nil
+	return fmt.Sprintf(`
+		CREATE OR REPLACE VIEW results_wide AS
+		SELECT r.*, w.* EXCLUDE (result_id)
+		FROM results r
+		LEFT JOIN (
+			PIVOT (
+				SELECT result_id, metric, coalesce(CAST(int_value AS DOUBLE), float_value) AS value
+				FROM metrics
+			)
+			ON metric IN (%s)
+			USING avg(value)
+			GROUP BY result_id
+		) w USING (result_id)
+	`, strings.Join(metrics, ", "))
 }
 
-func readResult(resultDir string, parsers []*parser.Parser) (*falba.Result, error) {
+// config.onDuplicate says what to do when parsers produce the same fact more
+// than once, facts that aren't in there get duplicateError. dbFacts are added
+// to the result unless it already has them, see readDBFacts.
+func readResult(resultDir string, config *dbConfig, dbFacts map[string]falba.Value, parserStats map[string]*ParserStats, opts ReadOptions) (*falba.Result, error) {
+	parsers, derivers, onDuplicate := config.parsers, config.derivers, config.onDuplicate
 	resultName := filepath.Base(resultDir)
 	testName, resultID, ok := strings.Cut(resultName, ":")
 	if !ok || testName == "" || resultID == "" {
-		return nil, fmt.Errorf("invalid result name (should be $result_name:$result_id) at %v", resultDir)
+		return nil, fmt.Errorf("%w (should be $result_name:$result_id) at %v", ErrInvalidResultName, resultDir)
 	}
 
 	// Find artifacts. At present every leaf file is an artifact. It might make
 	// sense to support having a whole directory be a single artifact at some
-	// point.
+	// point. See walk.Files for how symlinks are treated.
 	artifactsDirRel := filepath.Join(resultDir, "artifacts")
 	artifactsDir, err := filepath.Abs(artifactsDirRel)
 	if err != nil {
 		return nil, fmt.Errorf("converting artifacts dir path %v to absolute: %v", artifactsDirRel, err)
 	}
 	artifacts := []*falba.Artifact{}
-	visit := func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		isDir, err := isDir(path)
-		if err != nil {
-			return fmt.Errorf("check if %v is dir: %w", path, err)
-		}
-		if isDir {
-			return nil
-		}
+	visit := func(path string) error {
 		name, err := filepath.Rel(artifactsDir, path)
 		if err != nil {
 			log.Panicf("Encountered file %q not in artifacts dir %q while walking artifacts dir", path, artifactsDir)
 		}
+		// Use / on every OS so that artifact_regexp etc are portable.
+		name = filepath.ToSlash(name)
+		if config.excluded(name) {
+			return nil
+		}
 		artifacts = append(artifacts, &falba.Artifact{Name: name, Path: path})
 		return nil
 	}
-	if err := filepath.WalkDir(artifactsDir, visit); err != nil {
+	if err := walk.Files(artifactsDir, !opts.NoFollowSymlinks, visit); err != nil {
 		return nil, fmt.Errorf("walking artifacts/ dir: %w", err)
 	}
 
@@ -155,17 +661,28 @@ func readResult(resultDir string, parsers []*parser.Parser) (*falba.Result, erro
 	// for duplicates.
 	factToParser := map[string]string{}
 
-	matchedParsers := make(map[*parser.Parser]bool)
+	// Parsers that successfully parsed at least one artifact.
+	producedParsers := make(map[*parser.Parser]bool)
+
+	var parseErrors []*falba.ParseError
 
 	for _, artifact := range artifacts {
 		for _, parzer := range parsers {
-			if parzer.ArtifactRE.MatchString(artifact.Name) {
-				matchedParsers[parzer] = true
+			matches, err := parzer.Matches(artifact)
+			if err != nil {
+				return nil, fmt.Errorf("matching %v with %v: %w", artifact, parzer, err)
+			}
+			if !matches {
+				continue
 			}
-			result, err := parzer.Parse(artifact)
+			parserStats[parzer.Name].MatchedArtifacts++
+			result, err := parzer.ParseMatched(artifact)
 			// Parse failures are non-fatal.
 			if errors.Is(err, parser.ErrParseFailure) {
 				log.Printf("Parser %s failed to parse artifact %v: %v", parzer, artifact, err)
+				parseErrors = append(parseErrors, &falba.ParseError{
+					Parser: parzer.Name, Artifact: artifact.Name, Message: err.Error(),
+				})
 				continue
 			}
 			if err != nil {
@@ -174,20 +691,42 @@ func readResult(resultDir string, parsers []*parser.Parser) (*falba.Result, erro
 
 			// Store facts, checking duplicates.
 			for name, fact := range result.Facts {
+				if enum := parzer.Target.Enum; len(enum) > 0 && !falba.ValueIn(fact, enum) {
+					err := fmt.Errorf("%w: parser %s produced %s = %v, allowed values are %v",
+						ErrInvalidEnumValue, parzer.Name, name, falba.ValueValue(fact), falba.FormatValues(enum))
+					if !opts.WarnOnEnumMismatch {
+						return nil, err
+					}
+					log.Printf("Warning: %v in %v", err, artifact)
+				}
 				if _, ok := facts[name]; ok {
-					return nil, fmt.Errorf("parser %s produced fact %q, but that was already produced by parser %s", parzer, name, factToParser[name])
+					switch onDuplicate[name] {
+					case duplicateFirst:
+						continue
+					case duplicateLast:
+					default:
+						return nil, fmt.Errorf("%w: parser %s produced fact %q, but that was already produced by parser %s", ErrDuplicateFact, parzer, name, factToParser[name])
+					}
 				}
 				factToParser[name] = parzer.Name
 				facts[name] = fact
 			}
 
+			if opts.MetricProvenance {
+				for _, m := range result.Metrics {
+					m.Source = &falba.MetricSource{Parser: parzer.Name, Artifact: artifact.Name}
+				}
+			}
 			metrics = append(metrics, result.Metrics...)
+			producedParsers[parzer] = true
+			parserStats[parzer.Name].ProducedValues += len(result.Facts) + len(result.Metrics)
 		}
 	}
 
-	// Apply default values for parsers that didn't match any artifact.
+	// Apply default values for parsers that didn't produce anything, either
+	// because no artifact matched or because they all failed to parse.
 	for _, parzer := range parsers {
-		if !matchedParsers[parzer] && parzer.Default != nil {
+		if !producedParsers[parzer] && parzer.Default != nil {
 			// Only facts should have defaults, not metrics. (Should be enforced
 			// by config parser).
 			if parzer.Target.TargetType != parser.TargetFact {
@@ -195,23 +734,141 @@ func readResult(resultDir string, parsers []*parser.Parser) (*falba.Result, erro
 			}
 			name := parzer.Target.Name
 			if _, ok := facts[name]; ok {
-				return nil, fmt.Errorf("parser %s default value conflicted with already produced fact %q", parzer.Name, name)
+				// With a duplicate policy, defaults are just a fallback for
+				// when no parser produced the fact.
+				if onDuplicate[name] != duplicateError {
+					continue
+				}
+				return nil, fmt.Errorf("%w: parser %s default value conflicted with already produced fact %q", ErrDuplicateFact, parzer.Name, name)
 			}
 			factToParser[name] = parzer.Name
 			facts[name] = parzer.Default
 		}
 	}
 
-	return &falba.Result{
+	// Facts for the whole DB have the lowest priority, anything else can
+	// override them (including derivers, below).
+	fromDBFacts := make(map[string]bool)
+	for name, fact := range dbFacts {
+		if _, ok := facts[name]; !ok {
+			facts[name] = fact
+			fromDBFacts[name] = true
+		}
+	}
+
+	result := &falba.Result{
 		TestName: testName, ResultID: resultID, Artifacts: artifacts, Metrics: metrics, Facts: facts,
-	}, nil
+		ParseErrors: parseErrors,
+	}
 
+	// Run derivers. They only get to see what the parsers produced, not the
+	// output of other derivers, so the order doesn't matter.
+	derivedFacts := maps.Clone(facts)
+	derivedMetrics := slices.Clone(metrics)
+	for _, d := range derivers {
+		derived, err := d.Derive(result)
+		if err != nil {
+			return nil, fmt.Errorf("running deriver %v: %w", d, err)
+		}
+		for name, fact := range derived.Facts {
+			if _, ok := derivedFacts[name]; ok && !fromDBFacts[name] {
+				return nil, fmt.Errorf("%w: deriver %s produced fact %q, but that was already produced by %s", ErrDuplicateFact, d.Name(), name, factToParser[name])
+			}
+			factToParser[name] = d.Name()
+			derivedFacts[name] = fact
+			delete(fromDBFacts, name)
+		}
+		if opts.MetricProvenance {
+			for _, m := range derived.Metrics {
+				m.Source = &falba.MetricSource{Parser: d.Name()}
+			}
+		}
+		derivedMetrics = append(derivedMetrics, derived.Metrics...)
+	}
+	result.Facts = derivedFacts
+	result.Metrics = derivedMetrics
+
+	return result, nil
 }
 
 // Config file written by the user that tells Falba how to parse data out of the
 // artifacts.
 type ParsersConfig struct {
-	Parsers map[string]json.RawMessage `json:"parsers"`
+	Parsers  map[string]json.RawMessage `json:"parsers"`
+	Derivers map[string]json.RawMessage `json:"derivers"`
+	// Maps fact and metric names produced by parsers to the name they should
+	// really have. This is for harmonising data from sources that disagree
+	// about what to call things.
+	Rename map[string]string `json:"rename"`
+	// Other config files to merge in. Relative paths are relative to the
+	// directory containing this file (so for the main config of a DB, the
+	// DB root), never the current directory.
+	Include []string `json:"include"`
+	// Maps fact names (after renaming) to what to do when several parsers
+	// produce that fact for the same result, see parseDuplicatePolicy.
+	OnDuplicate map[string]string `json:"on_duplicate"`
+	// Regexps for artifact names that are ignored completely, as if they
+	// weren't there. This is for big irrelevant files like core dumps.
+	ExcludeArtifacts []string `json:"exclude_artifacts"`
+}
+
+// What to do when several parsers produce the same fact for one result.
+type duplicatePolicy int
+
+const (
+	// Fail to read the result. This is the default, since it usually means
+	// the parsers are misconfigured.
+	duplicateError duplicatePolicy = iota
+	// Keep the value that was produced first, i.e. from the artifact that
+	// comes first by path (and for the same artifact, from the parser that
+	// comes first by name).
+	duplicateFirst
+	// Keep the value that was produced last.
+	duplicateLast
+)
+
+func parseDuplicatePolicy(s string) (duplicatePolicy, error) {
+	switch s {
+	case "error":
+		return duplicateError, nil
+	case "first":
+		return duplicateFirst, nil
+	case "last":
+		return duplicateLast, nil
+	}
+	return duplicateError, fmt.Errorf("invalid on_duplicate value %q, expect error, first or last", s)
+}
+
+// File in the root of a DB with facts that apply to every result in it, see
+// readDBFacts.
+const dbFactsFileName = "db-facts.json"
+
+// Names the parser config can have in the root of a DB. Only one of them may
+// exist.
+var dbParsersConfigNames = []string{"parsers.json", "parsers.yaml", "parsers.yml"}
+
+// A directory in the root of a DB where every config file gets merged in, as
+// well as the main one. This is for splitting up big configs, e.g. a file per
+// benchmark tool.
+const dbParsersDirName = "parsers.d"
+
+func isParsersConfigFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// YAML configs are converted to JSON so that the rest of the config handling
+// (including the parser and deriver configs, which are decoded later) only has
+// to deal with one format.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
 }
 
 func parseParserConfig(configPath string) (*ParsersConfig, error) {
@@ -219,6 +876,12 @@ func parseParserConfig(configPath string) (*ParsersConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("reading DB config from %v: %w", configPath, err)
 	}
+	if ext := filepath.Ext(configPath); ext == ".yaml" || ext == ".yml" {
+		configContent, err = yamlToJSON(configContent)
+		if err != nil {
+			return nil, fmt.Errorf("decoding DB config from %v: %w", configPath, err)
+		}
+	}
 
 	decoder := json.NewDecoder(strings.NewReader(string(configContent)))
 	decoder.DisallowUnknownFields()
@@ -230,122 +893,646 @@ func parseParserConfig(configPath string) (*ParsersConfig, error) {
 	return &config, nil
 }
 
-func loadParsers(rootDir string, parsersPaths []string) ([]*parser.Parser, error) {
+// Merge a section of the config files, checking that entries of the same name
+// have the same configuration.
+func mergeConfigs(merged map[string]json.RawMessage, configs map[string]json.RawMessage, kind string, configPath string) error {
+	for name, config := range configs {
+		if existingConfig, exists := merged[name]; exists {
+			var val1, val2 any
+			if err := json.Unmarshal(existingConfig, &val1); err != nil {
+				return fmt.Errorf("unmarshalling existing %s config for %q: %w", kind, name, err)
+			}
+			if err := json.Unmarshal(config, &val2); err != nil {
+				return fmt.Errorf("unmarshalling new %s config for %q: %w", kind, name, err)
+			}
+			if !reflect.DeepEqual(val1, val2) {
+				return fmt.Errorf("duplicate %s name %q found in %v with different configuration", kind, name, configPath)
+			}
+			continue
+		}
+		merged[name] = config
+	}
+	return nil
+}
+
+func validateRename(rename map[string]string) error {
+	for from, to := range rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("invalid rename from %q to %q, names can't be empty", from, to)
+		}
+		if falba.IsReservedFactName(to) {
+			return fmt.Errorf("%w: can't rename %q to %q (%s)", parser.ErrReservedName, from, to, falba.GetReservedFactNamesString())
+		}
+		// Chains would be confusing, and they'd make the result depend on
+		// the order the renames get applied.
+		if next, ok := rename[to]; ok && to != from {
+			return fmt.Errorf("%q is renamed to %q, which is renamed again to %q. Rename it directly instead", from, to, next)
+		}
+	}
+	return nil
+}
+
+// Returns the paths of all the parser config files, in the order they get
+// merged.
+func parserConfigPaths(rootDirs []string, parsersPaths []string) ([]string, error) {
 	configPaths := []string{}
 
 	for _, dir := range parsersPaths {
-		entries, err := os.ReadDir(dir)
+		paths, err := configFilesInDir(dir)
 		if err != nil {
 			return nil, fmt.Errorf("reading directory from parsers path %v: %w", dir, err)
 		}
-		for _, entry := range entries {
-			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
-				configPaths = append(configPaths, filepath.Join(dir, entry.Name()))
+		configPaths = append(configPaths, paths...)
+	}
+
+	for _, rootDir := range rootDirs {
+		var found []string
+		for _, name := range dbParsersConfigNames {
+			dbParsersPath := filepath.Join(rootDir, name)
+			if _, err := os.Stat(dbParsersPath); err == nil {
+				found = append(found, dbParsersPath)
+			}
+		}
+		if len(found) > 1 {
+			return nil, fmt.Errorf("found several parser configs in %v (%v), there must be only one", rootDir, strings.Join(found, ", "))
+		}
+		configPaths = append(configPaths, found...)
+
+		dir := filepath.Join(rootDir, dbParsersDirName)
+		if _, err := os.Stat(dir); err == nil {
+			paths, err := configFilesInDir(dir)
+			if err != nil {
+				return nil, fmt.Errorf("reading %v: %w", dir, err)
 			}
+			configPaths = append(configPaths, paths...)
 		}
 	}
+	return expandIncludes(configPaths)
+}
 
-	dbParsersPath := filepath.Join(rootDir, "parsers.json")
-	if _, err := os.Stat(dbParsersPath); err == nil {
-		configPaths = append(configPaths, dbParsersPath)
+// expandIncludes adds the files that the configs include (and the ones those
+// include, etc) after the configs themselves. Each file only appears once, so
+// including something twice, or circular includes, are fine.
+func expandIncludes(configPaths []string) ([]string, error) {
+	var ret []string
+	seen := make(map[string]bool)
+	var visit func(path string) error
+	visit = func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if seen[abs] {
+			return nil
+		}
+		seen[abs] = true
+		ret = append(ret, path)
+		config, err := parseParserConfig(path)
+		if err != nil {
+			return err
+		}
+		for _, include := range config.Include {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(path), include)
+			}
+			if err := visit(include); err != nil {
+				return fmt.Errorf("included from %v: %w", path, err)
+			}
+		}
+		return nil
+	}
+	for _, path := range configPaths {
+		if err := visit(path); err != nil {
+			return nil, err
+		}
 	}
+	return ret, nil
+}
 
+// Returns the paths of the config files directly inside dir, sorted by name.
+func configFilesInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isParsersConfigFile(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// The returned map has the duplicate policy for each fact that has one
+// configured.
+func loadParsers(configPaths []string) (*dbConfig, error) {
 	mergedParsers := make(map[string]json.RawMessage)
+	mergedDerivers := make(map[string]json.RawMessage)
+	mergedRename := make(map[string]string)
+	onDuplicate := make(map[string]duplicatePolicy)
+	var excludeArtifacts []*regexp.Regexp
 
 	for _, configPath := range configPaths {
 		config, err := parseParserConfig(configPath)
 		if err != nil {
 			return nil, err
 		}
-		for name, parserConfig := range config.Parsers {
-			if existingConfig, exists := mergedParsers[name]; exists {
-				var val1, val2 any
-				if err := json.Unmarshal(existingConfig, &val1); err != nil {
-					return nil, fmt.Errorf("unmarshalling existing parser config for %q: %w", name, err)
-				}
-				if err := json.Unmarshal(parserConfig, &val2); err != nil {
-					return nil, fmt.Errorf("unmarshalling new parser config for %q: %w", name, err)
-				}
-				if !reflect.DeepEqual(val1, val2) {
-					return nil, fmt.Errorf("duplicate parser name %q found in %v with different configuration", name, configPath)
-				}
-				continue
+		if err := mergeConfigs(mergedParsers, config.Parsers, "parser", configPath); err != nil {
+			return nil, err
+		}
+		if err := mergeConfigs(mergedDerivers, config.Derivers, "deriver", configPath); err != nil {
+			return nil, err
+		}
+		for from, to := range config.Rename {
+			if existing, ok := mergedRename[from]; ok && existing != to {
+				return nil, fmt.Errorf("%v renames %q to %q, but another config renames it to %q", configPath, from, to, existing)
+			}
+			mergedRename[from] = to
+		}
+		for name, s := range config.OnDuplicate {
+			policy, err := parseDuplicatePolicy(s)
+			if err != nil {
+				return nil, fmt.Errorf("%v: fact %q: %v", configPath, name, err)
+			}
+			if existing, ok := onDuplicate[name]; ok && existing != policy {
+				return nil, fmt.Errorf("%v sets on_duplicate for %q to %q, but another config sets something else", configPath, name, s)
 			}
-			mergedParsers[name] = parserConfig
+			onDuplicate[name] = policy
+		}
+		for _, pattern := range config.ExcludeArtifacts {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%v: exclude_artifacts: %v", configPath, err)
+			}
+			excludeArtifacts = append(excludeArtifacts, re)
 		}
 	}
+	if err := validateRename(mergedRename); err != nil {
+		return nil, err
+	}
 
+	// The order of the parsers determines which value wins for the "first"
+	// and "last" duplicate policies, so keep it stable.
 	var parsers []*parser.Parser
-	for name, parserConfig := range mergedParsers {
-		parser, err := parser.FromConfig(parserConfig, name)
+	for _, name := range slices.Sorted(maps.Keys(mergedParsers)) {
+		ps, err := parser.ParsersFromConfig(mergedParsers[name], name)
 		if err != nil {
 			return nil, fmt.Errorf("configuring parser %q: %w", name, err)
 		}
-		parsers = append(parsers, parser)
+		parsers = append(parsers, ps...)
+	}
+	// Renaming the targets means that the rest of the code only ever sees
+	// the new names. So if two parsers end up producing the same fact, that
+	// gets checked just like if they were configured that way.
+	for _, p := range parsers {
+		if to, ok := mergedRename[p.Target.Name]; ok {
+			p.Target.Name = to
+		}
 	}
 	if len(parsers) == 0 {
-		return nil, fmt.Errorf("no 'parsers' defined or could not find any parsers configuration")
+		return nil, fmt.Errorf("%w: no 'parsers' defined or could not find any parsers configuration", ErrNoParsers)
+	}
+
+	// Same for the derivers, so the derived metrics (and which broken
+	// deriver gets reported) don't change from run to run.
+	var derivers []deriver.Deriver
+	for _, name := range slices.Sorted(maps.Keys(mergedDerivers)) {
+		d, err := deriver.FromConfig(mergedDerivers[name], name)
+		if err != nil {
+			return nil, fmt.Errorf("configuring deriver %q: %w", name, err)
+		}
+		derivers = append(derivers, d)
+	}
+	return &dbConfig{
+		parsers:          parsers,
+		derivers:         derivers,
+		onDuplicate:      onDuplicate,
+		excludeArtifacts: excludeArtifacts,
+	}, nil
+}
+
+// ReadOptions tweaks how a DB is read. The zero value gives the defaults.
+type ReadOptions struct {
+	// Don't follow symlinks when looking for artifacts, just ignore them.
+	NoFollowSymlinks bool
+	// Just log a warning (and keep the value) when a fact has a value that
+	// isn't in its enum, instead of failing.
+	WarnOnEnumMismatch bool
+	// Give up at the first result that can't be read. Otherwise, all the
+	// results are read (up to maxResultErrors failures) so that you can see
+	// everything that's broken at once.
+	FailFast bool
+	// Record which parser and artifact each metric sample came from. This is
+	// off by default since it makes the metrics table a lot bigger.
+	MetricProvenance bool
+}
+
+// When reading the DB, stop collecting errors after this many broken results.
+const maxResultErrors = 20
+
+// Collects the types of all the facts and metrics that the parsers and
+// derivers produce, checking that everything agrees.
+type typeRegistry struct {
+	factTypes   map[string]falba.FactType
+	metricTypes map[string]falba.MetricType
+	// Facts and metrics share a namespace for this.
+	valueTypes map[string]falba.ValueType
+}
+
+func newTypeRegistry() *typeRegistry {
+	return &typeRegistry{
+		factTypes:   make(map[string]falba.FactType),
+		metricTypes: make(map[string]falba.MetricType),
+		valueTypes:  make(map[string]falba.ValueType),
+	}
+}
+
+// producer describes where the target came from, for error messages.
+func (r *typeRegistry) record(target *parser.ParserTarget, producer string) error {
+	if t, ok := r.valueTypes[target.Name]; ok && target.ValueType != t {
+		return fmt.Errorf("%w: %v produced fact/metric %q of type %v, but another outputs this as %v",
+			ErrTypeConflict, producer, target.Name, target.ValueType, t)
+	}
+	r.valueTypes[target.Name] = target.ValueType
+
+	if target.TargetType == parser.TargetFact {
+		if ft, ok := r.factTypes[target.Name]; ok && !sameEnum(ft.Enum, target.Enum) {
+			return fmt.Errorf("%w: %v produced fact %q with enum %v, but another has enum %v",
+				ErrTypeConflict, producer, target.Name, falba.FormatValues(target.Enum), falba.FormatValues(ft.Enum))
+		}
+		r.factTypes[target.Name] = falba.FactType{Type: target.ValueType, Enum: target.Enum}
+		return nil
+	}
+
+	// Mixing units would make the numbers meaningless, even if they're in the
+	// same family, since nothing converts them.
+	if mt, ok := r.metricTypes[target.Name]; ok && !sameUnit(mt.Unit, target.Unit) {
+		return fmt.Errorf("%w: %v produced metric %q with unit %v, but another has unit %v",
+			ErrTypeConflict, producer, target.Name, unitString(target.Unit), unitString(mt.Unit))
+	}
+	r.metricTypes[target.Name] = falba.MetricType{Type: target.ValueType, Unit: target.Unit}
+	return nil
+}
+
+func sameUnit(a, b *unit.Unit) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func unitString(u *unit.Unit) string {
+	if u == nil {
+		return "<none>"
+	}
+	return fmt.Sprintf("%q", u.ShortName)
+}
+
+// sameEnum reports whether the enums allow the same values, in any order.
+func sameEnum(a, b []falba.Value) bool {
+	for _, v := range a {
+		if !falba.ValueIn(v, b) {
+			return false
+		}
+	}
+	for _, v := range b {
+		if !falba.ValueIn(v, a) {
+			return false
+		}
+	}
+	return true
+}
+
+// readDBFacts reads the db-facts.json in the root of a DB, if there is one. This
+// is a JSON object of facts like {"machine": "foo", "cpus": 8}, which get added
+// to every result in that DB that doesn't already have them. This is for stuff
+// that's the same for the whole DB, so it doesn't have to be in the artifacts
+// of every result. If the parsers or derivers produce one of the facts, the
+// value must suit their type, otherwise the type is guessed from the JSON, and
+// then it's recorded like any other fact. Returns nil if there's no file.
+func readDBFacts(rootDir string, types *typeRegistry) (map[string]falba.Value, error) {
+	path := filepath.Join(rootDir, dbFactsFileName)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	// So that ints can be told apart from floats.
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decoding %v: %v", path, err)
+	}
+	facts := make(map[string]falba.Value)
+	for _, name := range slices.Sorted(maps.Keys(raw)) {
+		if falba.IsReservedFactName(name) {
+			return nil, fmt.Errorf("%v: fact name %q is reserved (%s)", path, name, falba.GetReservedFactNamesString())
+		}
+		if _, ok := types.metricTypes[name]; ok {
+			return nil, fmt.Errorf("%w: %v has fact %q, but that's a metric", ErrTypeConflict, path, name)
+		}
+		valueType, ok := types.valueTypes[name]
+		if !ok {
+			valueType, err = guessDBFactType(raw[name])
+			if err != nil {
+				return nil, fmt.Errorf("%v: fact %q: %v", path, name, err)
+			}
+		}
+		val, err := dbFactValue(raw[name], valueType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v: fact %q: %v", ErrTypeConflict, path, name, err)
+		}
+		enum := types.factTypes[name].Enum
+		if len(enum) > 0 && !falba.ValueIn(val, enum) {
+			return nil, fmt.Errorf("%w: %v has %s = %v, allowed values are %v",
+				ErrInvalidEnumValue, path, name, falba.ValueValue(val), falba.FormatValues(enum))
+		}
+		target := &parser.ParserTarget{Name: name, TargetType: parser.TargetFact, ValueType: valueType, Enum: enum}
+		if err := types.record(target, path); err != nil {
+			return nil, err
+		}
+		facts[name] = val
+	}
+	return facts, nil
+}
+
+// Guesses the type of a value from db-facts.json, decoded with UseNumber.
+func guessDBFactType(raw any) (falba.ValueType, error) {
+	switch v := raw.(type) {
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return falba.ValueInt, nil
+		}
+		return falba.ValueFloat, nil
+	case string:
+		return falba.ValueString, nil
+	case bool:
+		return falba.ValueBool, nil
+	default:
+		return 0, fmt.Errorf("unsupported value %v, want a string, number or bool", raw)
+	}
+}
+
+// Converts a value from db-facts.json to the given type. Ints are fine for
+// float facts, but that's the only conversion.
+func dbFactValue(raw any, t falba.ValueType) (falba.Value, error) {
+	n, ok := raw.(json.Number)
+	if !ok {
+		v, err := falba.ValueFromAny(raw)
+		if err != nil {
+			return nil, err
+		}
+		if v.Type() != t {
+			return nil, fmt.Errorf("value %v is %v, want %v", raw, v.Type(), t)
+		}
+		return v, nil
+	}
+	switch t {
+	case falba.ValueInt:
+		i, err := n.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("value %v isn't an int", n)
+		}
+		return &falba.IntValue{Value: i}, nil
+	case falba.ValueFloat:
+		f, err := n.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &falba.FloatValue{Value: f}, nil
+	default:
+		return nil, fmt.Errorf("value %v is a number, want %v", n, t)
 	}
-	return parsers, nil
 }
 
 // Read all the results from a DB directory and parse all their facts and
 // metrics.
 func ReadDB(rootDir string, parsersPaths []string) (*DB, error) {
-	parsers, err := loadParsers(rootDir, parsersPaths)
+	return ReadDBs([]string{rootDir}, parsersPaths, ReadOptions{})
+}
+
+// ReadDBs is like ReadDB but it reads several DB directories and treats them as
+// a single logical DB. The parser configs from each directory get merged just
+// like the ones from the parsers path, so they must not conflict.
+func ReadDBs(rootDirs []string, parsersPaths []string, opts ReadOptions) (*DB, error) {
+	config, err := loadDBConfig(rootDirs, parsersPaths)
 	if err != nil {
 		return nil, err
 	}
+	parsers, dbFacts := config.parsers, config.dbFacts
+	factTypes, metricTypes := config.types.factTypes, config.types.metricTypes
+
+	parserStats := make(map[string]*ParserStats)
+	for _, p := range parsers {
+		parserStats[p.Name] = &ParserStats{}
+	}
+	results := make(map[string]*falba.Result)
+	// Remember where each result came from, for error messages.
+	resultDirs := make(map[string]string)
+	var resultErrs []error
+	numBroken := 0
+	for _, rootDir := range rootDirs {
+		dir, err := os.ReadDir(rootDir)
+		if err != nil {
+			return nil, fmt.Errorf("opening DB root: %w", err)
+		}
+		for _, entry := range dir {
+			if !isResultEntry(entry.Name()) {
+				continue
+			}
+			resultDir := filepath.Join(rootDir, entry.Name())
+			result, err := readResult(resultDir, config, dbFacts[rootDir], parserStats, opts)
+			if err == nil {
+				if otherDir, ok := resultDirs[result.ResultID]; ok {
+					err = fmt.Errorf("duplicate result ID %q (%v vs %v)", result.ResultID, resultDir, otherDir)
+				}
+			} else {
+				err = fmt.Errorf("reading result from %v: %w", resultDir, err)
+			}
+			if err != nil {
+				if opts.FailFast {
+					return nil, err
+				}
+				numBroken++
+				if len(resultErrs) < maxResultErrors {
+					resultErrs = append(resultErrs, err)
+				}
+				continue
+			}
+			results[result.ResultID] = result
+			resultDirs[result.ResultID] = resultDir
+		}
+	}
+	if numBroken > len(resultErrs) {
+		resultErrs = append(resultErrs, fmt.Errorf("... and %d more broken results", numBroken-len(resultErrs)))
+	}
+	if err := errors.Join(resultErrs...); err != nil {
+		return nil, err
+	}
+	inputsHash, err := hashInputs(config.inputPaths, results, opts)
+	if err != nil {
+		return nil, fmt.Errorf("hashing DB inputs: %w", err)
+	}
+	return &DB{
+		RootDirs:         rootDirs,
+		Results:          results,
+		FactTypes:        factTypes,
+		MetricTypes:      metricTypes,
+		ParserStats:      parserStats,
+		InputsHash:       inputsHash,
+		MetricProvenance: opts.MetricProvenance,
+	}, nil
+}
+
+// isResultEntry reports whether an entry in the root of a DB should be a
+// result, as opposed to config or something hidden.
+func isResultEntry(name string) bool {
+	if slices.Contains(dbParsersConfigNames, name) || name == dbParsersDirName || name == dbFactsFileName {
+		return false
+	}
+	// Hidden entries are ignored, this includes results that are still being
+	// imported.
+	return !strings.HasPrefix(name, ".")
+}
+
+// CheckTestName returns an error if the name can't be used as a test name. The
+// result dir is called $test_name:$result_id, so the name mustn't contain ':',
+// and it mustn't be able to point anywhere other than an entry in the root of
+// the DB, or be hidden so that the result gets ignored.
+func CheckTestName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("empty test name")
+	case strings.Contains(name, ":"):
+		return fmt.Errorf("invalid test name %q, can't contain ':'", name)
+	case strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) || filepath.Base(name) != name:
+		return fmt.Errorf("invalid test name %q, can't contain a path separator", name)
+	case strings.HasPrefix(name, "."):
+		// This includes . and ..
+		return fmt.Errorf("invalid test name %q, can't start with '.'", name)
+	}
+	return nil
+}
+
+// ReadResult reads a single result from the DBs, with the same parsers and
+// derivers that ReadDBs would use, without reading all the others. This is for
+// quickly checking what a parser config does to a known result.
+func ReadResult(rootDirs []string, parsersPaths []string, resultID string, opts ReadOptions) (*falba.Result, error) {
+	config, err := loadDBConfig(rootDirs, parsersPaths)
+	if err != nil {
+		return nil, err
+	}
+	var resultDir, resultRoot string
+	for _, rootDir := range rootDirs {
+		dir, err := os.ReadDir(rootDir)
+		if err != nil {
+			return nil, fmt.Errorf("opening DB root: %w", err)
+		}
+		for _, entry := range dir {
+			if _, id, ok := strings.Cut(entry.Name(), ":"); !ok || id != resultID || !isResultEntry(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(rootDir, entry.Name())
+			if resultDir != "" {
+				return nil, fmt.Errorf("duplicate result ID %q (%v vs %v)", resultID, path, resultDir)
+			}
+			resultDir, resultRoot = path, rootDir
+		}
+	}
+	if resultDir == "" {
+		return nil, fmt.Errorf("%w: %q in %v", ErrResultNotFound, resultID, strings.Join(rootDirs, ", "))
+	}
+	parserStats := make(map[string]*ParserStats)
+	for _, p := range config.parsers {
+		parserStats[p.Name] = &ParserStats{}
+	}
+	result, err := readResult(resultDir, config, config.dbFacts[resultRoot], parserStats, opts)
+	if err != nil {
+		return nil, fmt.Errorf("reading result from %v: %w", resultDir, err)
+	}
+	return result, nil
+}
+
+// dbConfig is everything that's needed to read results, apart from the
+// results themselves.
+type dbConfig struct {
+	parsers     []*parser.Parser
+	derivers    []deriver.Deriver
+	onDuplicate map[string]duplicatePolicy
+	// Artifacts whose names match any of these are ignored.
+	excludeArtifacts []*regexp.Regexp
+	types            *typeRegistry
+	// Keyed by root dir.
+	dbFacts map[string]map[string]falba.Value
+	// The files that the config came from, for the cache.
+	inputPaths []string
+}
+
+func loadDBConfig(rootDirs []string, parsersPaths []string) (*dbConfig, error) {
+	configPaths, err := parserConfigPaths(rootDirs, parsersPaths)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadParsers(configPaths)
+	if err != nil {
+		return nil, err
+	}
+	parsers, derivers, onDuplicate := config.parsers, config.derivers, config.onDuplicate
 
 	// Ensure parsers produce the same type for each fact and metric.
 	// Note that it's not fundamentally forbidden to have two parsers that
 	// produce the same output. For metrics that's just totally fine. For facts
 	// it will produce an error later if multiple parsers produce a fact for the
-	// same result, though.
+	// same result, though, unless on_duplicate says otherwise.
 	// While we're at it, also remember the fact types as they'll be used to
 	// construct a results tablellater.
-	factTypes := map[string]falba.ValueType{}
-	metricTypes := map[string]falba.MetricType{}
-	allTypes := map[string]falba.ValueType{}
+	types := newTypeRegistry()
 	for _, p := range parsers {
-		if t, ok := allTypes[p.Target.Name]; ok && p.Target.ValueType != t {
-			return nil, fmt.Errorf("parser %v produced fact/metric %q of type %v, but another outputs this as %v",
-				p, p.Target.Name, p.Target.ValueType, t)
+		if err := types.record(p.Target, fmt.Sprintf("parser %v", p)); err != nil {
+			return nil, err
 		}
-		if p.Target.TargetType == parser.TargetFact {
-			factTypes[p.Target.Name] = p.Target.ValueType
-		} else {
-			metricTypes[p.Target.Name] = falba.MetricType{
-				Type: p.Target.ValueType,
-				Unit: p.Target.Unit,
+	}
+	for _, d := range derivers {
+		for _, target := range d.Targets() {
+			if err := types.record(target, fmt.Sprintf("deriver %v", d)); err != nil {
+				return nil, err
 			}
 		}
-		allTypes[p.Target.Name] = p.Target.ValueType
-	}
-
-	dir, err := os.ReadDir(rootDir)
-	if err != nil {
-		return nil, fmt.Errorf("opening DB root: %w", err)
 	}
-	results := make(map[string]*falba.Result)
-	for _, entry := range dir {
-		if entry.Name() == "parsers.json" {
-			continue
+	for _, name := range slices.Sorted(maps.Keys(onDuplicate)) {
+		if _, ok := types.factTypes[name]; !ok {
+			return nil, fmt.Errorf("on_duplicate configured for %q, but no parser produces a fact with that name", name)
 		}
-		resultDir := filepath.Join(rootDir, entry.Name())
-		result, err := readResult(resultDir, parsers)
+	}
+	// Keyed by root dir.
+	dbFacts := make(map[string]map[string]falba.Value)
+	// The DB facts files are inputs too, for the cache.
+	inputPaths := slices.Clone(configPaths)
+	for _, rootDir := range rootDirs {
+		facts, err := readDBFacts(rootDir, types)
 		if err != nil {
-			return nil, fmt.Errorf("reading result from %v: %w", resultDir, err)
+			return nil, err
 		}
-		if other, ok := results[result.ResultID]; ok {
-			return nil, fmt.Errorf("duplicate result ID %q (%v vs %v)", result.ResultID, resultDir, other.ResultDir(rootDir))
+		if facts != nil {
+			dbFacts[rootDir] = facts
+			inputPaths = append(inputPaths, filepath.Join(rootDir, dbFactsFileName))
 		}
-		results[result.ResultID] = result
 	}
-	return &DB{
-		RootDir:     rootDir,
-		Results:     results,
-		FactTypes:   factTypes,
-		MetricTypes: metricTypes,
-	}, nil
+	config.types = types
+	config.dbFacts = dbFacts
+	config.inputPaths = inputPaths
+	return config, nil
+}
+
+func (c *dbConfig) excluded(artifactName string) bool {
+	for _, re := range c.excludeArtifacts {
+		if re.MatchString(artifactName) {
+			return true
+		}
+	}
+	return false
 }
@@ -2,13 +2,22 @@ package db_test
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/bjackman/falba/internal/db"
 	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
 	"github.com/bjackman/falba/internal/test"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -130,9 +139,83 @@ func TestReadDB_DuplicateFactInResult(t *testing.T) {
 		t.Fatalf("Expected ReadDB to return an error for duplicate fact production, but got nil")
 	}
 
-	wantMsg := `produced fact "duplicate_fact", but that was already produced by parser parser_file1`
-	if !strings.Contains(err.Error(), wantMsg) {
-		t.Errorf("Expected error to contain %q, got: %v", wantMsg, err)
+	if !errors.Is(err, db.ErrDuplicateFact) {
+		t.Errorf("Expected ErrDuplicateFact, got: %v", err)
+	}
+}
+
+func TestReadDB_OnDuplicate(t *testing.T) {
+	parsers := `
+		"parser_file1": {
+			"type": "single_metric",
+			"artifact_regexp": "file1\\.txt",
+			"fact": {"name": "duplicate_fact", "type": "string"}
+		},
+		"parser_file2": {
+			"type": "single_metric",
+			"artifact_regexp": "file2\\.txt",
+			"fact": {"name": "duplicate_fact", "type": "string"}
+		}`
+	// Doesn't match anything, so it always falls back to its default.
+	defaultParser := `,
+		"parser_default": {
+			"type": "single_metric",
+			"artifact_regexp": "nonexistent\\.txt",
+			"fact": {"name": "duplicate_fact", "type": "string", "default": "fallback"}
+		}`
+	testCases := []struct {
+		desc        string
+		parsers     string
+		onDuplicate string
+		want        string
+		wantErr     bool
+	}{
+		{desc: "unset", parsers: parsers, wantErr: true},
+		{desc: "error", parsers: parsers, onDuplicate: `{"duplicate_fact": "error"}`, wantErr: true},
+		{desc: "first", parsers: parsers, onDuplicate: `{"duplicate_fact": "first"}`, want: "content1"},
+		{desc: "last", parsers: parsers, onDuplicate: `{"duplicate_fact": "last"}`, want: "content2"},
+		{desc: "default error", parsers: parsers + defaultParser, onDuplicate: `{"duplicate_fact": "error"}`, wantErr: true},
+		{desc: "default first", parsers: parsers + defaultParser, onDuplicate: `{"duplicate_fact": "first"}`, want: "content1"},
+		{desc: "default last", parsers: parsers + defaultParser, onDuplicate: `{"duplicate_fact": "last"}`, want: "content2"},
+		{desc: "invalid", parsers: parsers, onDuplicate: `{"duplicate_fact": "random"}`, wantErr: true},
+		{desc: "unknown fact", parsers: parsers, onDuplicate: `{"other_fact": "first"}`, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tempDir := t.TempDir()
+			config := `{"parsers": {` + tc.parsers + `}`
+			if tc.onDuplicate != "" {
+				config += `, "on_duplicate": ` + tc.onDuplicate
+			}
+			config += "}"
+			if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to write parsers.json: %v", err)
+			}
+			artifactsDir := filepath.Join(tempDir, "test_result:dup123", "artifacts")
+			if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+				t.Fatalf("Failed to create artifacts dir: %v", err)
+			}
+			for name, content := range map[string]string{"file1.txt": "content1", "file2.txt": "content2"} {
+				if err := os.WriteFile(filepath.Join(artifactsDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %v: %v", name, err)
+				}
+			}
+
+			falbaDB, err := db.ReadDB(tempDir, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ReadDB succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadDB failed: %v", err)
+			}
+			got := falbaDB.Results["dup123"].Facts["duplicate_fact"]
+			if diff := cmp.Diff(&falba.StringValue{Value: tc.want}, got); diff != "" {
+				t.Errorf("Unexpected duplicate_fact (-want +got):\n%s", diff)
+			}
+		})
 	}
 }
 
@@ -205,6 +288,77 @@ func TestReadDB_InvalidJSONParsersFile(t *testing.T) {
 	}
 }
 
+func TestReadDB_YAMLParsersFile(t *testing.T) {
+	validYAML := `
+# Comments are the whole point.
+parsers:
+  parser1:
+    type: single_metric
+    artifact_regexp: "value\\.txt"
+    metric: {name: my_metric, type: int}
+`
+	testCases := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{name: "yaml", files: map[string]string{"parsers.yaml": validYAML}},
+		{name: "yml", files: map[string]string{"parsers.yml": validYAML}},
+		{
+			name:    "unknown-field",
+			files:   map[string]string{"parsers.yaml": validYAML + "unknown_field: foo\n"},
+			wantErr: "unknown field",
+		},
+		{
+			name:    "unknown-parser-field",
+			files:   map[string]string{"parsers.yaml": validYAML + "    unknown_field: foo\n"},
+			wantErr: "unknown field",
+		},
+		{
+			name:    "invalid",
+			files:   map[string]string{"parsers.yaml": "parsers: [\n"},
+			wantErr: "decoding DB config",
+		},
+		{
+			name:    "ambiguous",
+			files:   map[string]string{"parsers.yaml": validYAML, "parsers.json": `{"parsers": {}}`},
+			wantErr: "several parser configs",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for name, content := range tc.files {
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write %v: %v", name, err)
+				}
+			}
+			artifactsDir := filepath.Join(tempDir, "test:123", "artifacts")
+			if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+				t.Fatalf("Failed to create artifacts dir: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(artifactsDir, "value.txt"), []byte("42"), 0644); err != nil {
+				t.Fatalf("Failed to write artifact: %v", err)
+			}
+
+			d, err := db.ReadDB(tempDir, nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("ReadDB() error = %v, want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadDB() failed: %v", err)
+			}
+			want := []*falba.Metric{{Name: "my_metric", Value: &falba.IntValue{Value: 42}}}
+			if diff := cmp.Diff(want, d.Results["123"].Metrics); diff != "" {
+				t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 // This test was written by Google Jules.
 func TestReadDB_EmptyParsersMap(t *testing.T) {
 	tempDir := t.TempDir()
@@ -217,8 +371,8 @@ func TestReadDB_EmptyParsersMap(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected ReadDB to return an error for empty parsers map, but got nil")
 	}
-	if !strings.Contains(err.Error(), "no 'parsers' defined") {
-		t.Errorf("Expected error to mention 'no 'parsers' defined', got: %v", err)
+	if !errors.Is(err, db.ErrNoParsers) {
+		t.Errorf("Expected ErrNoParsers, got: %v", err)
 	}
 }
 
@@ -231,8 +385,8 @@ func TestReadDB_MissingParsersFile(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected ReadDB to return an error when parsers.json is missing, but got nil")
 	}
-	if !strings.Contains(err.Error(), "no 'parsers' defined or could not find any parsers configuration") {
-		t.Errorf("Expected error to mention no 'parsers' defined, got: %v", err)
+	if !errors.Is(err, db.ErrNoParsers) {
+		t.Errorf("Expected ErrNoParsers, got: %v", err)
 	}
 }
 
@@ -306,6 +460,261 @@ func TestReadDB_FALBAParsersPath(t *testing.T) {
 }
 
 // This test was written by Google Jules.
+func TestReadDB_ParsersDir(t *testing.T) {
+	dbRoot := t.TempDir()
+	parsersDir := filepath.Join(dbRoot, "parsers.d")
+	if err := os.MkdirAll(parsersDir, 0755); err != nil {
+		t.Fatalf("Failed to create parsers.d: %v", err)
+	}
+	files := map[string]string{
+		"parsers.json":          `{"parsers": {"a": {"type": "single_metric", "artifact_regexp": "a\\.txt", "metric": {"name": "a", "type": "int"}}}}`,
+		"parsers.d/fio.json":    `{"parsers": {"b": {"type": "single_metric", "artifact_regexp": "b\\.txt", "metric": {"name": "b", "type": "int"}}}}`,
+		"parsers.d/kernel.yaml": `parsers: {c: {type: single_metric, artifact_regexp: 'c\.txt', fact: {name: c, type: string}}}`,
+		// Not a config file, should be ignored.
+		"parsers.d/README":             "Parsers for each tool",
+		"my_test:res1/artifacts/a.txt": "1",
+		"my_test:res1/artifacts/b.txt": "2",
+		"my_test:res1/artifacts/c.txt": "foo",
+	}
+	for name, content := range files {
+		path := filepath.Join(dbRoot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %v: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	falbaDB, err := db.ReadDB(dbRoot, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	result := falbaDB.Results["res1"]
+	if len(result.Metrics) != 2 || result.Facts["c"] == nil {
+		t.Errorf("Expected metrics a and b and fact c from the merged configs, got %v and %v", result.Metrics, result.Facts)
+	}
+
+	// A parser with the same name but a different config in another file is
+	// an error.
+	conflicting := `{"parsers": {"b": {"type": "single_metric", "artifact_regexp": "other\\.txt", "metric": {"name": "b", "type": "int"}}}}`
+	if err := os.WriteFile(filepath.Join(parsersDir, "other.json"), []byte(conflicting), 0644); err != nil {
+		t.Fatalf("Failed to write other.json: %v", err)
+	}
+	_, err = db.ReadDB(dbRoot, nil)
+	if err == nil || !strings.Contains(err.Error(), `duplicate parser name "b"`) {
+		t.Errorf("Expected duplicate parser error, got: %v", err)
+	}
+}
+
+func TestReadDB_Include(t *testing.T) {
+	tempDir := t.TempDir()
+	dbRoot := filepath.Join(tempDir, "db")
+	files := map[string]string{
+		// Relative to the DB root. The directory is hidden so that it isn't
+		// mistaken for a result.
+		"parsers.json": `{"include": [".shared/a.json"]}`,
+		// Relative to parsers.d, and including something that's already
+		// included is fine.
+		"parsers.d/b.json": `{"include": ["../.shared/c.json", "../.shared/a.json"],
+			"parsers": {"b": {"type": "single_metric", "artifact_regexp": "b\\.txt", "metric": {"name": "b", "type": "int"}}}}`,
+		// Includes can be circular.
+		".shared/a.json":               `{"include": ["c.json"], "parsers": {"a": {"type": "single_metric", "artifact_regexp": "a\\.txt", "metric": {"name": "a", "type": "int"}}}}`,
+		".shared/c.json":               `{"include": ["a.json"], "parsers": {"c": {"type": "single_metric", "artifact_regexp": "c\\.txt", "fact": {"name": "c", "type": "string"}}}}`,
+		"my_test:res1/artifacts/a.txt": "1",
+		"my_test:res1/artifacts/b.txt": "2",
+		"my_test:res1/artifacts/c.txt": "foo",
+	}
+	for name, content := range files {
+		path := filepath.Join(dbRoot, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %v: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+	}
+
+	// The includes must work no matter where we run from, and whether the DB
+	// root is given as a relative path or not.
+	otherDir := t.TempDir()
+	for _, tc := range []struct {
+		cwd, root string
+	}{
+		{cwd: tempDir, root: "db"},
+		{cwd: dbRoot, root: "."},
+		{cwd: otherDir, root: dbRoot},
+		{cwd: filepath.Join(dbRoot, ".shared"), root: ".."},
+	} {
+		t.Run(tc.root, func(t *testing.T) {
+			t.Chdir(tc.cwd)
+			falbaDB, err := db.ReadDBs([]string{tc.root}, nil, db.ReadOptions{})
+			if err != nil {
+				t.Fatalf("Failed to read DB: %v", err)
+			}
+			result := falbaDB.Results["res1"]
+			if len(result.Metrics) != 2 || result.Facts["c"] == nil {
+				t.Errorf("Expected metrics a and b and fact c from the included configs, got %v and %v", result.Metrics, result.Facts)
+			}
+		})
+	}
+
+	if err := os.WriteFile(filepath.Join(dbRoot, "parsers.json"), []byte(`{"include": ["missing.json"]}`), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	_, err := db.ReadDB(dbRoot, nil)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dbRoot, "missing.json")) {
+		t.Errorf("Expected error about missing.json, got: %v", err)
+	}
+}
+
+func TestReadDB_DBFacts(t *testing.T) {
+	writeDB := func(t *testing.T, dbFacts string) string {
+		dbRoot := t.TempDir()
+		files := map[string]string{
+			"parsers.json": `{"parsers": {
+				"machine": {"type": "single_metric", "artifact_regexp": "machine\\.txt", "fact": {"name": "machine", "type": "string"}},
+				"scale": {"type": "single_metric", "artifact_regexp": "scale\\.txt", "fact": {"name": "scale", "type": "float"}},
+				"a": {"type": "single_metric", "artifact_regexp": "a\\.txt", "metric": {"name": "a", "type": "int"}}
+			}}`,
+			"db-facts.json":                      dbFacts,
+			"my_test:res1/artifacts/a.txt":       "1",
+			"my_test:res2/artifacts/machine.txt": "special-box",
+		}
+		for name, content := range files {
+			path := filepath.Join(dbRoot, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("Failed to create dir for %v: %v", name, err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %v: %v", name, err)
+			}
+		}
+		return dbRoot
+	}
+
+	falbaDB, err := db.ReadDB(writeDB(t, `{"machine": "default-box", "cpus": 8, "scale": 2, "nested": false}`), nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	want := map[string]map[string]falba.Value{
+		"res1": {
+			"machine": &falba.StringValue{Value: "default-box"},
+			"cpus":    &falba.IntValue{Value: 8},
+			"scale":   &falba.FloatValue{Value: 2},
+			"nested":  &falba.BoolValue{Value: false},
+		},
+		// The result's own fact wins.
+		"res2": {
+			"machine": &falba.StringValue{Value: "special-box"},
+			"cpus":    &falba.IntValue{Value: 8},
+			"scale":   &falba.FloatValue{Value: 2},
+			"nested":  &falba.BoolValue{Value: false},
+		},
+	}
+	for id, wantFacts := range want {
+		if diff := cmp.Diff(wantFacts, falbaDB.Results[id].Facts); diff != "" {
+			t.Errorf("Unexpected facts for %v (-want +got):\n%s", id, diff)
+		}
+	}
+	if got := falbaDB.FactTypes["cpus"].Type; got != falba.ValueInt {
+		t.Errorf("Fact type for cpus: got %v, want int", got)
+	}
+
+	for _, tc := range []struct {
+		dbFacts string
+		wantErr error
+	}{
+		// Doesn't match the parser's type.
+		{dbFacts: `{"machine": 3}`, wantErr: db.ErrTypeConflict},
+		{dbFacts: `{"scale": "big"}`, wantErr: db.ErrTypeConflict},
+		// Facts and metrics share a namespace.
+		{dbFacts: `{"a": 1}`, wantErr: db.ErrTypeConflict},
+		{dbFacts: `{"test_name": "foo"}`},
+		{dbFacts: `{"list": [1, 2]}`},
+		{dbFacts: `not json`},
+	} {
+		_, err := db.ReadDB(writeDB(t, tc.dbFacts), nil)
+		if err == nil {
+			t.Errorf("ReadDB with db-facts.json %s succeeded, want error", tc.dbFacts)
+		} else if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("ReadDB with db-facts.json %s: got error %v, want %v", tc.dbFacts, err, tc.wantErr)
+		}
+	}
+}
+
+func TestReadResult(t *testing.T) {
+	dbRoot := t.TempDir()
+	otherRoot := t.TempDir()
+	files := map[string]string{
+		filepath.Join(dbRoot, "parsers.json"): `{"parsers": {
+			"kernel": {"type": "single_metric", "artifact_regexp": "kernel\\.txt", "fact": {"name": "kernel", "type": "string"}},
+			"a": {"type": "single_metric", "artifact_regexp": "a\\.txt", "metric": {"name": "a", "type": "int"}}
+		}}`,
+		filepath.Join(dbRoot, "db-facts.json"):                     `{"machine": "box"}`,
+		filepath.Join(dbRoot, "my_test:res1/artifacts/kernel.txt"): "6.1",
+		filepath.Join(dbRoot, "my_test:res1/artifacts/a.txt"):      "1",
+		// These would make ReadDB fail, ReadResult only looks at them if
+		// asked to.
+		filepath.Join(dbRoot, "my_test:broken/artifacts/kernel.txt"):     "6.1",
+		filepath.Join(dbRoot, "my_test:broken/artifacts/old/kernel.txt"): "5.15",
+		filepath.Join(dbRoot, "not-a-result"):                            "",
+		filepath.Join(otherRoot, "other_test:res2/artifacts/a.txt"):      "2",
+		// Hidden, so it doesn't count as a duplicate.
+		filepath.Join(otherRoot, ".importing-res1/artifacts/a.txt"): "3",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %v: %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", path, err)
+		}
+	}
+	rootDirs := []string{dbRoot, otherRoot}
+
+	result, err := db.ReadResult(rootDirs, nil, "res1", db.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ReadResult failed: %v", err)
+	}
+	wantFacts := map[string]falba.Value{
+		"kernel":  &falba.StringValue{Value: "6.1"},
+		"machine": &falba.StringValue{Value: "box"},
+	}
+	if diff := cmp.Diff(wantFacts, result.Facts); diff != "" {
+		t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+	}
+	wantMetrics := []*falba.Metric{{Name: "a", Value: &falba.IntValue{Value: 1}}}
+	if diff := cmp.Diff(wantMetrics, result.Metrics); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	// The DB facts only apply to their own DB.
+	result, err = db.ReadResult(rootDirs, nil, "res2", db.ReadOptions{})
+	if err != nil {
+		t.Fatalf("ReadResult failed: %v", err)
+	}
+	if diff := cmp.Diff(map[string]falba.Value{}, result.Facts); diff != "" {
+		t.Errorf("Unexpected facts for res2 (-want +got):\n%s", diff)
+	}
+
+	if _, err := db.ReadResult(rootDirs, nil, "nope", db.ReadOptions{}); !errors.Is(err, db.ErrResultNotFound) {
+		t.Errorf("ReadResult for a missing result gave %v, want ErrResultNotFound", err)
+	}
+	if _, err := db.ReadResult(rootDirs, nil, "broken", db.ReadOptions{}); err == nil {
+		t.Errorf("ReadResult for a broken result succeeded, want error")
+	}
+
+	// Same ID in both DBs.
+	dupDir := filepath.Join(otherRoot, "other_test:res1", "artifacts")
+	if err := os.MkdirAll(dupDir, 0755); err != nil {
+		t.Fatalf("Failed to create %v: %v", dupDir, err)
+	}
+	if _, err := db.ReadResult(rootDirs, nil, "res1", db.ReadOptions{}); err == nil {
+		t.Errorf("ReadResult for a duplicated result ID succeeded, want error")
+	}
+}
+
 func TestReadDB_FALBAParsersPath_Duplicate(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -437,12 +846,58 @@ func TestReadDB_ConflictingTypes(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected ReadDB to return an error due to conflicting types, but got nil")
 	} else {
-		if !strings.Contains(err.Error(), "produced fact/metric \"shared_name\" of type") || !strings.Contains(err.Error(), "but another outputs this as") {
-			t.Errorf("Expected error to contain type mismatch for 'shared_name', got: %v", err)
+		if !errors.Is(err, db.ErrTypeConflict) {
+			t.Errorf("Expected ErrTypeConflict, got: %v", err)
 		}
 	}
 }
 
+func TestReadDB_ConflictingUnits(t *testing.T) {
+	testCases := []struct {
+		name    string
+		unit1   string
+		unit2   string
+		wantErr bool
+	}{
+		{name: "same", unit1: `"unit": "B",`, unit2: `"unit": "B",`},
+		{name: "none", unit1: "", unit2: ""},
+		{name: "different", unit1: `"unit": "B",`, unit2: `"unit": "KiB",`, wantErr: true},
+		{name: "one-missing", unit1: `"unit": "ns",`, unit2: "", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			parsersFileContent := fmt.Sprintf(`{
+				"parsers": {
+					"parser1": {
+						"type": "command",
+						"artifact_regexp": ".*\\.bin",
+						"args": ["wc", "-c"],
+						"metric": {"name": "shared_name", %s "type": "int"}
+					},
+					"parser2": {
+						"type": "single_metric",
+						"artifact_regexp": ".*\\.txt",
+						"metric": {"name": "shared_name", %s "type": "int"}
+					}
+				}
+			}`, tc.unit1, tc.unit2)
+			if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+				t.Fatalf("Failed to write parsers.json: %v", err)
+			}
+
+			_, err := db.ReadDB(tempDir, nil)
+			if tc.wantErr {
+				if !errors.Is(err, db.ErrTypeConflict) {
+					t.Errorf("Expected ErrTypeConflict, got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("ReadDB failed: %v", err)
+			}
+		})
+	}
+}
+
 // This test was written by Google Jules.
 func TestReadDB_InvalidResultDirName(t *testing.T) {
 	tempDir := t.TempDir()
@@ -462,22 +917,22 @@ func TestReadDB_InvalidResultDirName(t *testing.T) {
 	testCases := []struct {
 		name          string
 		dirName       string
-		expectedError string
+		expectedError error
 	}{
 		{
 			name:          "missing colon",
 			dirName:       "testnameresultid",
-			expectedError: "invalid result name",
+			expectedError: db.ErrInvalidResultName,
 		},
 		{
 			name:          "empty test name",
 			dirName:       ":resultid",
-			expectedError: "invalid result name",
+			expectedError: db.ErrInvalidResultName,
 		},
 		{
 			name:          "empty result id",
 			dirName:       "testname:",
-			expectedError: "invalid result name",
+			expectedError: db.ErrInvalidResultName,
 		},
 	}
 
@@ -500,8 +955,287 @@ func TestReadDB_InvalidResultDirName(t *testing.T) {
 			if err == nil {
 				t.Fatalf("Expected ReadDB to return an error for dir %s, but got nil", tc.dirName)
 			}
-			if !strings.Contains(err.Error(), tc.expectedError) {
-				t.Errorf("Expected error for dir %s to contain '%s', got: %v", tc.dirName, tc.expectedError, err)
+			if !errors.Is(err, tc.expectedError) {
+				t.Errorf("Expected error for dir %s to be %v, got: %v", tc.dirName, tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestReadDB_Rename(t *testing.T) {
+	const parsers = `
+		"parsers": {
+			"num_cpus": {
+				"type": "single_metric",
+				"artifact_regexp": "num_cpus",
+				"fact": {"name": "num_cpus", "type": "int"}
+			},
+			"nr_cpus": {
+				"type": "single_metric",
+				"artifact_regexp": "nr_cpus",
+				"fact": {"name": "nr_cpus", "type": %q}
+			},
+			"lat": {
+				"type": "single_metric",
+				"artifact_regexp": "lat",
+				"metric": {"name": "lat", "type": "int"}
+			}
+		}`
+	testCases := []struct {
+		name      string
+		nrType    string
+		rename    string
+		artifacts map[string][]string
+		wantErr   error
+		wantFacts map[string]map[string]falba.Value
+	}{
+		{
+			name:   "harmonise",
+			nrType: "int",
+			rename: `{"nr_cpus": "num_cpus", "lat": "latency"}`,
+			artifacts: map[string][]string{
+				"test:a": {"num_cpus", "lat"},
+				"test:b": {"nr_cpus"},
+			},
+			wantFacts: map[string]map[string]falba.Value{
+				"a": {"num_cpus": &falba.IntValue{Value: 4}},
+				"b": {"num_cpus": &falba.IntValue{Value: 4}},
+			},
+		},
+		{
+			name:   "collision",
+			nrType: "int",
+			rename: `{"nr_cpus": "num_cpus"}`,
+			artifacts: map[string][]string{
+				"test:a": {"num_cpus", "nr_cpus"},
+			},
+			wantErr: db.ErrDuplicateFact,
+		},
+		{
+			name:      "type-conflict",
+			nrType:    "string",
+			rename:    `{"nr_cpus": "num_cpus"}`,
+			artifacts: map[string][]string{"test:a": {"num_cpus"}},
+			wantErr:   db.ErrTypeConflict,
+		},
+		{
+			name:      "reserved",
+			nrType:    "int",
+			rename:    `{"nr_cpus": "test_name"}`,
+			artifacts: map[string][]string{"test:a": {"num_cpus"}},
+			wantErr:   parser.ErrReservedName,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			config := fmt.Sprintf("{"+parsers+`, "rename": %s}`, tc.nrType, tc.rename)
+			if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(config), 0644); err != nil {
+				t.Fatalf("Failed to write parsers.json: %v", err)
+			}
+			for resultName, artifacts := range tc.artifacts {
+				artifactsDir := filepath.Join(tempDir, resultName, "artifacts")
+				if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+					t.Fatalf("Failed to create artifacts dir: %v", err)
+				}
+				for _, a := range artifacts {
+					if err := os.WriteFile(filepath.Join(artifactsDir, a), []byte("4"), 0644); err != nil {
+						t.Fatalf("Failed to write artifact: %v", err)
+					}
+				}
+			}
+
+			d, err := db.ReadDB(tempDir, nil)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("ReadDB() error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadDB() failed: %v", err)
+			}
+			gotFacts := make(map[string]map[string]falba.Value)
+			for id, r := range d.Results {
+				gotFacts[id] = r.Facts
+			}
+			if diff := cmp.Diff(tc.wantFacts, gotFacts); diff != "" {
+				t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+			}
+			if _, ok := d.FactTypes["nr_cpus"]; ok {
+				t.Errorf("FactTypes still has the old name: %v", d.FactTypes)
+			}
+			if _, ok := d.MetricTypes["latency"]; !ok {
+				t.Errorf("MetricTypes doesn't have the new name: %v", d.MetricTypes)
+			}
+			if m := d.Results["a"].Metrics; len(m) != 1 || m[0].Name != "latency" {
+				t.Errorf("Unexpected metrics: %v", m)
+			}
+		})
+	}
+}
+
+func TestReadDB_RenameConfigErrors(t *testing.T) {
+	for _, rename := range []string{
+		`{"a": ""}`,
+		`{"a": "b", "b": "c"}`,
+		`{"a": "b", "bogus": 1}`,
+	} {
+		tempDir := t.TempDir()
+		config := `{"parsers": {"p": {"type": "single_metric", "artifact_regexp": "x", "fact": {"name": "a", "type": "int"}}}, "rename": ` + rename + `}`
+		if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write parsers.json: %v", err)
+		}
+		if _, err := db.ReadDB(tempDir, nil); err == nil {
+			t.Errorf("ReadDB with rename %s succeeded, want error", rename)
+		}
+	}
+}
+
+func TestReadDB_ReportsAllBrokenResults(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"parser1": {
+				"type": "single_metric",
+				"artifact_regexp": "value",
+				"metric": {"name": "my_metric", "type": "int"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	// Two broken results (a bad name, and no artifacts dir) and a good one.
+	for _, name := range []string{"test:good", "noresultid"} {
+		artifactsDir := filepath.Join(tempDir, name, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatalf("Failed to create artifacts dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(artifactsDir, "value"), []byte("1"), 0644); err != nil {
+			t.Fatalf("Failed to write artifact: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "test:bad"), 0755); err != nil {
+		t.Fatalf("Failed to create result dir: %v", err)
+	}
+
+	_, err := db.ReadDB(tempDir, nil)
+	if err == nil {
+		t.Fatalf("ReadDB succeeded, want error")
+	}
+	if !errors.Is(err, db.ErrInvalidResultName) {
+		t.Errorf("Got error %v, want it to include ErrInvalidResultName", err)
+	}
+	for _, want := range []string{"test:bad", "noresultid"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error doesn't mention %q: %v", want, err)
+		}
+	}
+
+	// With FailFast, only the first one (in directory order) is reported.
+	_, err = db.ReadDBs([]string{tempDir}, nil, db.ReadOptions{FailFast: true})
+	if err == nil {
+		t.Fatalf("ReadDBs with FailFast succeeded, want error")
+	}
+	if !errors.Is(err, db.ErrInvalidResultName) || strings.Contains(err.Error(), "test:bad") {
+		t.Errorf("Got error %v with FailFast, want only the noresultid error", err)
+	}
+}
+
+func TestReadDB_CapsBrokenResults(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"parser1": {
+				"type": "single_metric",
+				"artifact_regexp": ".*",
+				"fact": {"name": "dummy", "type": "string"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	for i := range 30 {
+		if err := os.MkdirAll(filepath.Join(tempDir, fmt.Sprintf("broken%02d", i), "artifacts"), 0755); err != nil {
+			t.Fatalf("Failed to create artifacts dir: %v", err)
+		}
+	}
+
+	_, err := db.ReadDB(tempDir, nil)
+	if err == nil {
+		t.Fatalf("ReadDB succeeded, want error")
+	}
+	if got := strings.Count(err.Error(), "reading result from"); got != 20 {
+		t.Errorf("Error reports %d results, want 20: %v", got, err)
+	}
+	if !strings.Contains(err.Error(), "and 10 more broken results") {
+		t.Errorf("Error doesn't say how many were left out: %v", err)
+	}
+}
+
+func TestSchemaSQL(t *testing.T) {
+	for _, provenance := range []bool{false, true} {
+		t.Run(fmt.Sprintf("provenance=%v", provenance), func(t *testing.T) {
+			falbaDB := &db.DB{
+				Results: map[string]*falba.Result{
+					"r1": {TestName: "t", ResultID: "r1", Facts: map[string]falba.Value{
+						"kernel":       &falba.StringValue{Value: "6.1"},
+						"cpus":         &falba.IntValue{Value: 8},
+						`it's "odd"`:   &falba.BoolValue{Value: true},
+						"scale factor": &falba.FloatValue{Value: 1.5},
+					}, Metrics: []*falba.Metric{{Name: "iops", Value: &falba.IntValue{Value: 1}}}},
+				},
+				FactTypes: map[string]falba.FactType{
+					"kernel":       {Type: falba.ValueString},
+					"cpus":         {Type: falba.ValueInt},
+					`it's "odd"`:   {Type: falba.ValueBool},
+					"scale factor": {Type: falba.ValueFloat},
+				},
+				MetricTypes:      map[string]falba.MetricType{"iops": {Type: falba.ValueInt}},
+				MetricProvenance: provenance,
+			}
+
+			// The tables created from the DDL should look exactly like the
+			// ones that InsertIntoDuckDB creates.
+			columns := func(setup func(*sql.DB) error) []string {
+				sqlDB, err := sql.Open("duckdb", ":memory:")
+				if err != nil {
+					t.Fatalf("Failed to open DuckDB: %v", err)
+				}
+				defer sqlDB.Close()
+				if err := setup(sqlDB); err != nil {
+					t.Fatalf("Setting up tables: %v", err)
+				}
+				rows, err := sqlDB.Query(`
+					SELECT table_name, column_name, data_type FROM information_schema.columns
+					WHERE table_name IN ('results', 'metrics', 'parse_errors')
+					ORDER BY table_name, ordinal_position`)
+				if err != nil {
+					t.Fatalf("Querying columns: %v", err)
+				}
+				defer rows.Close()
+				var ret []string
+				for rows.Next() {
+					var table, column, dataType string
+					if err := rows.Scan(&table, &column, &dataType); err != nil {
+						t.Fatalf("Scanning columns: %v", err)
+					}
+					ret = append(ret, table+"."+column+" "+dataType)
+				}
+				return ret
+			}
+			want := columns(falbaDB.InsertIntoDuckDB)
+			got := columns(func(sqlDB *sql.DB) error {
+				_, err := sqlDB.Exec(falbaDB.SchemaSQL())
+				return err
+			})
+			if len(want) == 0 {
+				t.Fatalf("InsertIntoDuckDB created no columns")
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Tables from SchemaSQL differ from InsertIntoDuckDB (-want +got):\n%s\nSQL:\n%s", diff, falbaDB.SchemaSQL())
 			}
 		})
 	}
@@ -515,8 +1249,9 @@ func TestInsertIntoDuckDB(t *testing.T) {
 	}
 	defer sqlDB.Close()
 
+	repetition := int64(2)
 	db := &db.DB{
-		RootDir: "testdata/results",
+		RootDirs: []string{"testdata/results"},
 		Results: resultsMap(t, []*falba.Result{
 			{
 				TestName: "test1",
@@ -540,18 +1275,18 @@ func TestInsertIntoDuckDB(t *testing.T) {
 					"fact_bool_false": &falba.BoolValue{Value: false},
 				},
 				Metrics: []*falba.Metric{
-					{Name: "metric3", Value: &falba.IntValue{Value: 100}},
+					{Name: "metric3", Value: &falba.IntValue{Value: 100}, Repetition: &repetition},
 					{Name: "metric_bool_true", Value: &falba.BoolValue{Value: true}},
 				},
 			},
 		}),
-		FactTypes: map[string]falba.ValueType{
-			"fact1":           falba.ValueString,
-			"fact2":           falba.ValueInt,
-			"fact3":           falba.ValueString, // This is a string fact that happens to be "true"
-			"fact_bool_true":  falba.ValueBool,
-			"fact_bool_false": falba.ValueBool,
-			"missing_fact":    falba.ValueString,
+		FactTypes: map[string]falba.FactType{
+			"fact1":           {Type: falba.ValueString},
+			"fact2":           {Type: falba.ValueInt},
+			"fact3":           {Type: falba.ValueString}, // This is a string fact that happens to be "true"
+			"fact_bool_true":  {Type: falba.ValueBool},
+			"fact_bool_false": {Type: falba.ValueBool},
+			"missing_fact":    {Type: falba.ValueString},
 		},
 		MetricTypes: map[string]falba.MetricType{
 			"metric1":           {Type: falba.ValueFloat},
@@ -718,6 +1453,24 @@ func TestInsertIntoDuckDB(t *testing.T) {
 	if diff := cmp.Diff(expectedMetrics, gotMetrics); diff != "" {
 		t.Errorf("Unexpected metrics (-want +got): %v", diff)
 	}
+
+	var gotRepetitions []string
+	repRows, err := sqlDB.Query("SELECT metric, repetition FROM metrics WHERE repetition IS NOT NULL")
+	if err != nil {
+		t.Fatalf("Failed to query repetitions: %v", err)
+	}
+	defer repRows.Close()
+	for repRows.Next() {
+		var metric string
+		var rep int64
+		if err := repRows.Scan(&metric, &rep); err != nil {
+			t.Fatalf("Failed to scan repetition row: %v", err)
+		}
+		gotRepetitions = append(gotRepetitions, fmt.Sprintf("%s %d", metric, rep))
+	}
+	if diff := cmp.Diff([]string{"metric3 2"}, gotRepetitions); diff != "" {
+		t.Errorf("Unexpected repetitions (-want +got): %v", diff)
+	}
 }
 
 func TestReadDB_ParserDefaultValue(t *testing.T) {
@@ -733,6 +1486,11 @@ func TestReadDB_ParserDefaultValue(t *testing.T) {
 				"type": "single_metric",
 				"artifact_regexp": "missing\\.txt",
 				"fact": {"name": "fact_missing", "type": "string", "default": "default_value"}
+			},
+			"parser_broken": {
+				"type": "single_metric",
+				"artifact_regexp": "broken\\.txt",
+				"fact": {"name": "fact_broken", "type": "int", "default": 0}
 			}
 		}
 	}`
@@ -750,6 +1508,10 @@ func TestReadDB_ParserDefaultValue(t *testing.T) {
 		t.Fatalf("Failed to write present.txt: %v", err)
 	}
 	// missing.txt is NOT created
+	// broken.txt fails to parse as an int, so the default should be used.
+	if err := os.WriteFile(filepath.Join(artifactsDir, "broken.txt"), []byte("not an int"), 0644); err != nil {
+		t.Fatalf("Failed to write broken.txt: %v", err)
+	}
 
 	dbInstance, err := db.ReadDB(tempDir, nil)
 	if err != nil {
@@ -764,9 +1526,1254 @@ func TestReadDB_ParserDefaultValue(t *testing.T) {
 	wantFacts := map[string]falba.Value{
 		"fact_present": &falba.StringValue{Value: "present_content"},
 		"fact_missing": &falba.StringValue{Value: "default_value"},
+		"fact_broken":  &falba.IntValue{Value: 0},
 	}
 
 	if diff := cmp.Diff(wantFacts, res.Facts); diff != "" {
 		t.Errorf("Unexpected facts (-want +got):\n%s", diff)
 	}
 }
+
+func TestReadDB_ParseErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"count": {
+				"type": "single_metric",
+				"artifact_regexp": "count\\.txt",
+				"metric": {"name": "count", "type": "int"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	for resultID, content := range map[string]string{"good": "1", "bad": "lots"} {
+		artifactsDir := filepath.Join(tempDir, "my_test:"+resultID, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatalf("Failed to create artifacts dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(artifactsDir, "count.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write count.txt: %v", err)
+		}
+	}
+
+	falbaDB, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	if got := falbaDB.Results["good"].ParseErrors; got != nil {
+		t.Errorf("Unexpected parse errors for good result: %v", got)
+	}
+	got := falbaDB.Results["bad"].ParseErrors
+	if len(got) != 1 || got[0].Parser != "count" || got[0].Artifact != "count.txt" || got[0].Message == "" {
+		t.Fatalf("Unexpected parse errors for bad result: %+v", got)
+	}
+
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("InsertIntoDuckDB failed: %v", err)
+	}
+	var resultID, parserName, artifact, message string
+	err = sqlDB.QueryRow("SELECT result_id, parser, artifact, message FROM parse_errors").Scan(&resultID, &parserName, &artifact, &message)
+	if err != nil {
+		t.Fatalf("Failed to query parse_errors: %v", err)
+	}
+	if resultID != "bad" || parserName != "count" || artifact != "count.txt" || message != got[0].Message {
+		t.Errorf("Unexpected parse_errors row: %q %q %q %q", resultID, parserName, artifact, message)
+	}
+}
+
+func TestReadDB_MetricProvenance(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"count": {
+				"type": "single_metric",
+				"artifact_regexp": "count\\.txt",
+				"metric": {"name": "count", "type": "int"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	artifactsDir := filepath.Join(tempDir, "my_test:res1", "artifacts", "run1")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("Failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "count.txt"), []byte("3"), 0644); err != nil {
+		t.Fatalf("Failed to write count.txt: %v", err)
+	}
+
+	for _, provenance := range []bool{false, true} {
+		t.Run(fmt.Sprintf("provenance-%v", provenance), func(t *testing.T) {
+			falbaDB, err := db.ReadDBs([]string{tempDir}, nil, db.ReadOptions{MetricProvenance: provenance})
+			if err != nil {
+				t.Fatalf("Failed to read DB: %v", err)
+			}
+			var wantSource *falba.MetricSource
+			if provenance {
+				wantSource = &falba.MetricSource{Parser: "count", Artifact: "run1/count.txt"}
+			}
+			metrics := falbaDB.Results["res1"].Metrics
+			if len(metrics) != 1 {
+				t.Fatalf("Expected 1 metric, got %v", metrics)
+			}
+			if diff := cmp.Diff(wantSource, metrics[0].Source); diff != "" {
+				t.Errorf("Unexpected metric source (-want +got):\n%s", diff)
+			}
+
+			sqlDB, err := sql.Open("duckdb", ":memory:")
+			if err != nil {
+				t.Fatalf("Failed to open DuckDB: %v", err)
+			}
+			defer sqlDB.Close()
+			if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+				t.Fatalf("InsertIntoDuckDB failed: %v", err)
+			}
+			var parserName, artifact string
+			err = sqlDB.QueryRow("SELECT parser, artifact FROM metrics").Scan(&parserName, &artifact)
+			if !provenance {
+				// The columns shouldn't be there at all.
+				if err == nil {
+					t.Errorf("Expected no parser and artifact columns without provenance")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to query metrics: %v", err)
+			}
+			if parserName != "count" || artifact != "run1/count.txt" {
+				t.Errorf("Got parser %q artifact %q, want count and run1/count.txt", parserName, artifact)
+			}
+		})
+	}
+}
+
+func TestReadDB_FactEnum(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"fs": {
+				"type": "single_metric",
+				"artifact_regexp": "fs\\.txt",
+				"fact": {"name": "fs", "type": "string", "enum": ["ext4", "xfs"]}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	for resultID, fs := range map[string]string{"res1": "ext4", "res2": "btrfs"} {
+		artifactsDir := filepath.Join(tempDir, "my_test:"+resultID, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatalf("Failed to create artifacts dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(artifactsDir, "fs.txt"), []byte(fs), 0644); err != nil {
+			t.Fatalf("Failed to write fs.txt: %v", err)
+		}
+	}
+
+	_, err := db.ReadDB(tempDir, nil)
+	if !errors.Is(err, db.ErrInvalidEnumValue) {
+		t.Errorf("Expected ErrInvalidEnumValue, got: %v", err)
+	}
+
+	dbInstance, err := db.ReadDBs([]string{tempDir}, nil, db.ReadOptions{WarnOnEnumMismatch: true})
+	if err != nil {
+		t.Fatalf("Failed to read DB with WarnOnEnumMismatch: %v", err)
+	}
+	if got := dbInstance.Results["res2"].Facts["fs"]; !cmp.Equal(got, falba.Value(&falba.StringValue{Value: "btrfs"})) {
+		t.Errorf("Expected mismatching value to be kept, got %v", got)
+	}
+	if got := len(dbInstance.FactTypes["fs"].Enum); got != 2 {
+		t.Errorf("Expected FactTypes to record the enum, got %d values", got)
+	}
+}
+
+func TestReadDB_FactEnumConflicts(t *testing.T) {
+	testCases := []struct {
+		name         string
+		otherEnum    string
+		wantConflict bool
+	}{
+		{name: "same-order", otherEnum: `["ext4", "xfs"]`},
+		{name: "different-order", otherEnum: `["xfs", "ext4"]`},
+		{name: "different-values", otherEnum: `["ext4", "btrfs"]`, wantConflict: true},
+		{name: "subset", otherEnum: `["ext4"]`, wantConflict: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			parsersFileContent := fmt.Sprintf(`{
+				"parsers": {
+					"fs1": {
+						"type": "single_metric",
+						"artifact_regexp": "fs1\\.txt",
+						"fact": {"name": "fs", "type": "string", "enum": ["ext4", "xfs"]}
+					},
+					"fs2": {
+						"type": "single_metric",
+						"artifact_regexp": "fs2\\.txt",
+						"fact": {"name": "fs", "type": "string", "enum": %s}
+					}
+				}
+			}`, tc.otherEnum)
+			if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+				t.Fatalf("Failed to write parsers.json: %v", err)
+			}
+			_, err := db.ReadDB(tempDir, nil)
+			if tc.wantConflict {
+				if !errors.Is(err, db.ErrTypeConflict) {
+					t.Errorf("Expected ErrTypeConflict, got: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Failed to read DB: %v", err)
+			}
+		})
+	}
+}
+
+func TestReadDB_ParserStats(t *testing.T) {
+	db, err := db.ReadDB("testdata/results", nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"no_existo"}, db.UnmatchedParsers()); diff != "" {
+		t.Errorf("Unexpected unmatched parsers (-want +got):\n%s", diff)
+	}
+
+	stats, ok := db.ParserStats["raw_int_example"]
+	if !ok {
+		t.Fatalf("No stats for parser raw_int_example")
+	}
+	if stats.MatchedArtifacts != 1 || stats.ProducedValues != 1 {
+		t.Errorf("Unexpected stats for raw_int_example: %+v", stats)
+	}
+}
+
+func TestReadDBs(t *testing.T) {
+	writeDB := func(t *testing.T, parsers string, resultName string, content string) string {
+		t.Helper()
+		dir := t.TempDir()
+		if parsers != "" {
+			if err := os.WriteFile(filepath.Join(dir, "parsers.json"), []byte(parsers), 0644); err != nil {
+				t.Fatalf("Failed to write parsers.json: %v", err)
+			}
+		}
+		artifactsDir := filepath.Join(dir, resultName, "artifacts")
+		if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+			t.Fatalf("Failed to create artifacts dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(artifactsDir, "val.txt"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write artifact: %v", err)
+		}
+		return dir
+	}
+	intParsers := `{
+		"parsers": {
+			"val": {
+				"type": "single_metric",
+				"artifact_regexp": "val\\.txt",
+				"metric": {"name": "val", "type": "int"}
+			}
+		}
+	}`
+
+	t.Run("union", func(t *testing.T) {
+		root1 := writeDB(t, intParsers, "test:aaa", "1")
+		root2 := writeDB(t, "", "test:bbb", "2")
+		dbInstance, err := db.ReadDBs([]string{root1, root2}, nil, db.ReadOptions{})
+		if err != nil {
+			t.Fatalf("ReadDBs failed: %v", err)
+		}
+		if len(dbInstance.Results) != 2 {
+			t.Errorf("Expected 2 results, got %d", len(dbInstance.Results))
+		}
+	})
+
+	t.Run("duplicate result", func(t *testing.T) {
+		root1 := writeDB(t, intParsers, "test:aaa", "1")
+		root2 := writeDB(t, "", "test:aaa", "1")
+		_, err := db.ReadDBs([]string{root1, root2}, nil, db.ReadOptions{})
+		if err == nil || !strings.Contains(err.Error(), "duplicate result ID") {
+			t.Errorf("Expected duplicate result ID error, got %v", err)
+		}
+	})
+
+	t.Run("incompatible parsers", func(t *testing.T) {
+		root1 := writeDB(t, intParsers, "test:aaa", "1")
+		root2 := writeDB(t, strings.ReplaceAll(intParsers, `"int"`, `"float"`), "test:bbb", "2")
+		_, err := db.ReadDBs([]string{root1, root2}, nil, db.ReadOptions{})
+		if err == nil || !strings.Contains(err.Error(), "duplicate parser name") {
+			t.Errorf("Expected duplicate parser error, got %v", err)
+		}
+	})
+}
+
+func TestReadDB_Derivers(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"kernel": {
+				"type": "single_metric",
+				"artifact_regexp": "uname\\.txt",
+				"fact": {"name": "kernel_version", "type": "string"}
+			}
+		},
+		"derivers": {
+			"kernel_version": {
+				"type": "version",
+				"fact": "kernel_version"
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	artifactsDir := filepath.Join(tempDir, "my_test:res123", "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("Failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "uname.txt"), []byte("6.6.3-rc2"), 0644); err != nil {
+		t.Fatalf("Failed to write uname.txt: %v", err)
+	}
+
+	dbInstance, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+
+	wantFacts := map[string]falba.Value{
+		"kernel_version": &falba.StringValue{Value: "6.6.3-rc2"},
+		"kernel_major":   &falba.IntValue{Value: 6},
+		"kernel_minor":   &falba.IntValue{Value: 6},
+		"kernel_patch":   &falba.IntValue{Value: 3},
+	}
+	if diff := cmp.Diff(wantFacts, dbInstance.Results["res123"].Facts); diff != "" {
+		t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+	}
+	if got := dbInstance.FactTypes["kernel_major"].Type; got != falba.ValueInt {
+		t.Errorf("Expected kernel_major to be int, got %v", got)
+	}
+}
+
+func TestReadDB_DeriverErrorOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	// Both derivers are broken, the first one by name should always be the
+	// one that gets reported.
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "x", "metric": {"name": "m", "type": "int"}}
+		},
+		"derivers": {
+			"b_broken": {"type": "nonexistent"},
+			"a_broken": {"type": "nonexistent"},
+			"c_broken": {"type": "nonexistent"}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	for range 10 {
+		_, err := db.ReadDB(tempDir, nil)
+		if err == nil || !strings.Contains(err.Error(), `"a_broken"`) {
+			t.Fatalf("ReadDB gave error %v, want one about a_broken", err)
+		}
+	}
+}
+
+func TestFlatRecords(t *testing.T) {
+	db := &db.DB{
+		Results: resultsMap(t, []*falba.Result{
+			{
+				TestName: "test2",
+				ResultID: "result2",
+				Facts: map[string]falba.Value{
+					"fact1": &falba.StringValue{Value: "foo"},
+				},
+			},
+			{
+				TestName: "test1",
+				ResultID: "result1",
+				Facts: map[string]falba.Value{
+					"fact1": &falba.StringValue{Value: "bar"},
+					"fact2": &falba.IntValue{Value: 42},
+				},
+				Metrics: []*falba.Metric{
+					{Name: "latency", Value: &falba.IntValue{Value: 1}},
+					{Name: "latency", Value: &falba.IntValue{Value: 5}},
+					{Name: "latency", Value: &falba.IntValue{Value: 3}},
+					{Name: "note", Value: &falba.StringValue{Value: "hello"}},
+				},
+			},
+		}),
+		FactTypes: map[string]falba.FactType{
+			"fact1": {Type: falba.ValueString},
+			"fact2": {Type: falba.ValueInt},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"latency": {Type: falba.ValueInt},
+			"note":    {Type: falba.ValueString},
+		},
+	}
+
+	want := []map[string]any{
+		{
+			"test_name":       "test1",
+			"result_id":       "result1",
+			"fact1":           "bar",
+			"fact2":           int64(42),
+			"latency_samples": 3,
+			"latency_mean":    3.0,
+			"latency_min":     1.0,
+			"latency_max":     5.0,
+			"note_samples":    1,
+		},
+		{
+			"test_name":       "test2",
+			"result_id":       "result2",
+			"fact1":           "foo",
+			"fact2":           nil,
+			"latency_samples": 0,
+			"latency_mean":    nil,
+			"latency_min":     nil,
+			"latency_max":     nil,
+			"note_samples":    0,
+		},
+	}
+	if diff := cmp.Diff(want, db.FlatRecords()); diff != "" {
+		t.Errorf("Unexpected FlatRecords (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadDB_Symlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"val": {
+				"type": "single_metric",
+				"artifact_regexp": "val\\.txt$",
+				"metric": {"name": "val", "type": "int"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	artifactsDir := filepath.Join(tempDir, "my_test:res123", "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("Failed to create artifacts dir: %v", err)
+	}
+	externalPath := filepath.Join(t.TempDir(), "val.txt")
+	if err := os.WriteFile(externalPath, []byte("5"), 0644); err != nil {
+		t.Fatalf("Failed to write val.txt: %v", err)
+	}
+	if err := os.Symlink(externalPath, filepath.Join(artifactsDir, "val.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	// A loop, this mustn't make us hang.
+	if err := os.Symlink(".", filepath.Join(artifactsDir, "loop")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	dbInstance, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	wantMetrics := []*falba.Metric{{Name: "val", Value: &falba.IntValue{Value: 5}}}
+	if diff := cmp.Diff(wantMetrics, dbInstance.Results["res123"].Metrics); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	dbInstance, err = db.ReadDBs([]string{tempDir}, nil, db.ReadOptions{NoFollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	if got := dbInstance.Results["res123"].Metrics; len(got) != 0 {
+		t.Errorf("Expected no metrics with NoFollowSymlinks, got %v", got)
+	}
+}
+
+func TestReadDB_NestedArtifactName(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"val": {
+				"type": "single_metric",
+				"artifact_regexp": "^iter/1/val\\.txt$",
+				"metric": {"name": "val", "type": "int"}
+			}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	nestedDir := filepath.Join(tempDir, "my_test:res123", "artifacts", "iter", "1")
+	if err := os.MkdirAll(nestedDir, 0755); err != nil {
+		t.Fatalf("Failed to create artifacts dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(nestedDir, "val.txt"), []byte("5"), 0644); err != nil {
+		t.Fatalf("Failed to write val.txt: %v", err)
+	}
+
+	dbInstance, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	result := dbInstance.Results["res123"]
+	if len(result.Artifacts) != 1 || result.Artifacts[0].Name != "iter/1/val.txt" {
+		t.Errorf("Got artifacts %v, want one named iter/1/val.txt", result.Artifacts)
+	}
+	wantMetrics := []*falba.Metric{{Name: "val", Value: &falba.IntValue{Value: 5}}}
+	if diff := cmp.Diff(wantMetrics, result.Metrics); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func TestInsertIntoDuckDB_MetricHelpers(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		results []*falba.Result
+		want    []string
+	}{
+		{
+			desc: "some-metrics",
+			results: []*falba.Result{
+				{
+					TestName: "test",
+					ResultID: "with",
+					Facts:    map[string]falba.Value{},
+					Metrics: []*falba.Metric{
+						{Name: "latency", Value: &falba.IntValue{Value: 1}},
+						{Name: "latency", Value: &falba.IntValue{Value: 2}},
+					},
+				},
+				{
+					TestName: "test",
+					ResultID: "without",
+					Facts:    map[string]falba.Value{},
+					Metrics: []*falba.Metric{
+						{Name: "throughput", Value: &falba.IntValue{Value: 1}},
+					},
+				},
+			},
+			want: []string{"with"},
+		},
+		{
+			desc: "no-metrics",
+			results: []*falba.Result{
+				{TestName: "test", ResultID: "empty", Facts: map[string]falba.Value{}},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			sqlDB, err := sql.Open("duckdb", ":memory:")
+			if err != nil {
+				t.Fatalf("Failed to open DuckDB: %v", err)
+			}
+			defer sqlDB.Close()
+
+			db := &db.DB{Results: resultsMap(t, tc.results)}
+			if err := db.InsertIntoDuckDB(sqlDB); err != nil {
+				t.Fatalf("Failed to insert into DuckDB: %v", err)
+			}
+
+			rows, err := sqlDB.Query("SELECT result_id FROM results WHERE has_metric(metric_samples, 'latency') AND metric_count(metric_samples, 'latency') = 2 ORDER BY result_id")
+			if err != nil {
+				t.Fatalf("Failed to query has_metric: %v", err)
+			}
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var resultID string
+				if err := rows.Scan(&resultID); err != nil {
+					t.Fatalf("Failed to scan row: %v", err)
+				}
+				got = append(got, resultID)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected has_metric results (-want +got):\n%s", diff)
+			}
+
+			var samples int
+			err = sqlDB.QueryRow("SELECT coalesce(sum(samples), 0) FROM metric_counts WHERE metric = 'latency'").Scan(&samples)
+			if err != nil {
+				t.Fatalf("Failed to query metric_counts: %v", err)
+			}
+			if wantSamples := 2 * len(tc.want); samples != wantSamples {
+				t.Errorf("Got %d latency samples from metric_counts, want %d", samples, wantSamples)
+			}
+		})
+	}
+}
+
+func TestInsertIntoDuckDB_ColumnOrder(t *testing.T) {
+	falbaDB := &db.DB{
+		Results: map[string]*falba.Result{},
+		FactTypes: map[string]falba.FactType{
+			"zeta":  {Type: falba.ValueString},
+			"alpha": {Type: falba.ValueInt},
+			"mid":   {Type: falba.ValueBool},
+		},
+		MetricTypes: map[string]falba.MetricType{},
+	}
+	for _, id := range []string{"c", "a", "b"} {
+		falbaDB.Results[id] = &falba.Result{
+			TestName: "test",
+			ResultID: id,
+			Facts:    map[string]falba.Value{"zeta": &falba.StringValue{Value: id}},
+		}
+	}
+	wantColumns := []string{"test_name", "result_id", "alpha", "mid", "zeta", "metric_samples"}
+	wantIDs := []string{"a", "b", "c"}
+
+	// Map iteration order is random so do it a few times to have a chance of
+	// noticing instability.
+	for i := 0; i < 5; i++ {
+		sqlDB, err := sql.Open("duckdb", ":memory:")
+		if err != nil {
+			t.Fatalf("Failed to open DuckDB: %v", err)
+		}
+		defer sqlDB.Close()
+		if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+			t.Fatalf("InsertIntoDuckDB failed: %v", err)
+		}
+		rows, err := sqlDB.Query("SELECT * FROM results")
+		if err != nil {
+			t.Fatalf("Querying results: %v", err)
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			t.Fatalf("Getting columns: %v", err)
+		}
+		rows.Close()
+		if diff := cmp.Diff(wantColumns, columns); diff != "" {
+			t.Fatalf("Unexpected columns (-want +got):\n%s", diff)
+		}
+
+		rows, err = sqlDB.Query("SELECT result_id FROM results")
+		if err != nil {
+			t.Fatalf("Querying results: %v", err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				t.Fatalf("Scanning: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if diff := cmp.Diff(wantIDs, ids); diff != "" {
+			t.Fatalf("Unexpected row order (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestCheckDuckDB(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+	// The bundled DuckDB should have everything.
+	if err := db.CheckDuckDB(sqlDB); err != nil {
+		t.Errorf("CheckDuckDB failed: %v", err)
+	}
+}
+
+func TestReadDB_IgnoresHiddenEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "val", "metric": {"name": "m", "type": "int"}}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	// A half-finished import, this name would be an error if it wasn't
+	// ignored.
+	for _, dir := range []string{".importing-123/artifacts", "test:123/artifacts"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	falbaDB, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	if got := slices.Collect(maps.Keys(falbaDB.Results)); !cmp.Equal(got, []string{"123"}) {
+		t.Errorf("Got results %v, want just 123", got)
+	}
+}
+
+func TestReadDB_ExcludeArtifacts(t *testing.T) {
+	tempDir := t.TempDir()
+	// Without the exclusion, the core dump would be a broken int and the
+	// other two would be a duplicate fact.
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "val", "metric": {"name": "m", "type": "int"}},
+			"f": {"type": "single_metric", "artifact_regexp": "kernel", "fact": {"name": "kernel", "type": "string"}}
+		},
+		"exclude_artifacts": ["^core\\.", "^old/"]
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	for name, content := range map[string]string{
+		"val":        "1",
+		"core.val":   "garbage",
+		"kernel":     "6.6",
+		"old/kernel": "6.1",
+	} {
+		path := filepath.Join(tempDir, "test:123", "artifacts", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write artifact: %v", err)
+		}
+	}
+
+	falbaDB, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	result := falbaDB.Results["123"]
+	var names []string
+	for _, a := range result.Artifacts {
+		names = append(names, a.Name)
+	}
+	if diff := cmp.Diff([]string{"kernel", "val"}, names); diff != "" {
+		t.Errorf("Unexpected artifacts (-want +got):\n%s", diff)
+	}
+	if len(result.Metrics) != 1 || len(result.ParseErrors) != 0 {
+		t.Errorf("Got metrics %v and parse errors %v, want one metric and no errors", result.Metrics, result.ParseErrors)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(`{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "val", "metric": {"name": "m", "type": "int"}}
+		},
+		"exclude_artifacts": ["("]
+	}`), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	if _, err := db.ReadDB(tempDir, nil); err == nil {
+		t.Errorf("ReadDB succeeded with an invalid exclude_artifacts regexp")
+	}
+}
+
+func TestLoadIntoDuckDB_Reuse(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "val", "metric": {"name": "m", "type": "int"}}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	writeResult := func(name string, val string) {
+		dir := filepath.Join(tempDir, name, "artifacts")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "val"), []byte(val), 0644); err != nil {
+			t.Fatalf("Failed to write artifact: %v", err)
+		}
+	}
+	writeResult("test:1", "1")
+
+	sqlDB, err := sql.Open("duckdb", filepath.Join(t.TempDir(), "falba.duckdb"))
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Reads the DB and loads it into DuckDB, checks whether it was reused and
+	// the metric sum.
+	load := func(rebuild bool, wantReused bool, wantSum int64) {
+		t.Helper()
+		falbaDB, err := db.ReadDB(tempDir, nil)
+		if err != nil {
+			t.Fatalf("Failed to read DB: %v", err)
+		}
+		reused, err := falbaDB.LoadIntoDuckDB(sqlDB, rebuild)
+		if err != nil {
+			t.Fatalf("LoadIntoDuckDB failed: %v", err)
+		}
+		if reused != wantReused {
+			t.Errorf("LoadIntoDuckDB returned reused=%v, want %v", reused, wantReused)
+		}
+		var sum int64
+		if err := sqlDB.QueryRow("SELECT sum(int_value) FROM metrics").Scan(&sum); err != nil {
+			t.Fatalf("Failed to query metrics: %v", err)
+		}
+		if sum != wantSum {
+			t.Errorf("Got metric sum %d, want %d", sum, wantSum)
+		}
+	}
+
+	load(false, false, 1)
+	load(false, true, 1)
+	load(true, false, 1)
+
+	writeResult("test:2", "2")
+	load(false, false, 3)
+	load(false, true, 3)
+
+	// Rewrite an artifact, bumping the mtime in case the filesystem's
+	// timestamps are coarse.
+	writeResult("test:2", "20")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tempDir, "test:2", "artifacts", "val"), later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	load(false, false, 21)
+
+	// Changing the parser config also invalidates it.
+	if err := os.Chtimes(filepath.Join(tempDir, "parsers.json"), later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	load(false, false, 21)
+	load(false, true, 21)
+}
+
+func TestInsertIntoDuckDB_ResultsWide(t *testing.T) {
+	for _, tc := range []struct {
+		desc        string
+		metricTypes map[string]falba.MetricType
+		metrics     map[string][]*falba.Metric
+		query       string
+		want        [][]any
+	}{
+		{
+			desc: "pivot",
+			metricTypes: map[string]falba.MetricType{
+				"latency":    {Type: falba.ValueInt},
+				"throughput": {Type: falba.ValueFloat},
+				"outcome":    {Type: falba.ValueString},
+			},
+			metrics: map[string][]*falba.Metric{
+				"r1": {
+					{Name: "latency", Value: &falba.IntValue{Value: 1}},
+					{Name: "latency", Value: &falba.IntValue{Value: 2}},
+					{Name: "throughput", Value: &falba.FloatValue{Value: 0.5}},
+					{Name: "outcome", Value: &falba.StringValue{Value: "ok"}},
+				},
+				"r2": {
+					{Name: "latency", Value: &falba.IntValue{Value: 10}},
+				},
+			},
+			query: "SELECT result_id, latency, throughput FROM results_wide ORDER BY result_id",
+			want:  [][]any{{"r1", 1.5, 0.5}, {"r2", 10.0, nil}},
+		},
+		{
+			desc:        "no-metrics",
+			metricTypes: map[string]falba.MetricType{},
+			query:       "SELECT result_id FROM results_wide ORDER BY result_id",
+			want:        [][]any{{"r1"}, {"r2"}},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			sqlDB, err := sql.Open("duckdb", ":memory:")
+			if err != nil {
+				t.Fatalf("Failed to open DuckDB: %v", err)
+			}
+			defer sqlDB.Close()
+			falbaDB := &db.DB{
+				RootDirs:    []string{"dummy"},
+				Results:     map[string]*falba.Result{},
+				FactTypes:   map[string]falba.FactType{},
+				MetricTypes: tc.metricTypes,
+			}
+			for _, id := range []string{"r1", "r2"} {
+				falbaDB.Results[id] = &falba.Result{TestName: "test", ResultID: id, Facts: map[string]falba.Value{}, Metrics: tc.metrics[id]}
+			}
+			if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+				t.Fatalf("InsertIntoDuckDB failed: %v", err)
+			}
+
+			rows, err := sqlDB.Query(tc.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			defer rows.Close()
+			var got [][]any
+			for rows.Next() {
+				row := make([]any, len(tc.want[0]))
+				ptrs := make([]any, len(row))
+				for i := range row {
+					ptrs[i] = &row[i]
+				}
+				if err := rows.Scan(ptrs...); err != nil {
+					t.Fatalf("Scan failed: %v", err)
+				}
+				got = append(got, row)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected results_wide (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilterByArtifact(t *testing.T) {
+	result := func(id string, artifactNames ...string) *falba.Result {
+		r := &falba.Result{TestName: "test", ResultID: id, Facts: map[string]falba.Value{}}
+		for _, name := range artifactNames {
+			r.Artifacts = append(r.Artifacts, &falba.Artifact{Name: name, Path: "/dummy/" + name})
+		}
+		return r
+	}
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"traced":   result("traced", "out.json", "trace/trace.dat"),
+			"untraced": result("untraced", "out.json"),
+			"empty":    result("empty"),
+		},
+		InputsHash: "abc",
+	}
+	falbaDB.FilterByArtifact(regexp.MustCompile(`trace\.dat$`))
+	if got := slices.Sorted(maps.Keys(falbaDB.Results)); !cmp.Equal(got, []string{"traced"}) {
+		t.Errorf("Got results %v, want just traced", got)
+	}
+	if falbaDB.InputsHash == "abc" {
+		t.Errorf("InputsHash didn't change after filtering")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: map[string]*falba.Result{
+			"fio1": {TestName: "fio", ResultID: "fio1", Facts: map[string]falba.Value{
+				"kernel": &falba.StringValue{Value: "6.1"},
+			}, Metrics: []*falba.Metric{{Name: "iops", Value: &falba.IntValue{Value: 1}}}},
+			"fio2": {TestName: "fio", ResultID: "fio2", Facts: map[string]falba.Value{
+				"kernel": &falba.StringValue{Value: "6.2"},
+				"traced": &falba.BoolValue{Value: true},
+			}, Metrics: []*falba.Metric{{Name: "iops", Value: &falba.IntValue{Value: 2}}}},
+			"build1": {TestName: "build", ResultID: "build1", Facts: map[string]falba.Value{
+				"kernel": &falba.StringValue{Value: "6.1"},
+				"cc":     &falba.StringValue{Value: "gcc"},
+			}, Metrics: []*falba.Metric{{Name: "elapsed", Value: &falba.FloatValue{Value: 1.5}}}},
+		},
+		FactTypes: map[string]falba.FactType{
+			"kernel": {Type: falba.ValueString},
+			"traced": {Type: falba.ValueBool},
+			"cc":     {Type: falba.ValueString},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"iops":    {Type: falba.ValueInt},
+			"elapsed": {Type: falba.ValueFloat},
+		},
+		InputsHash: "abc",
+	}
+
+	fio := falbaDB.Filter(func(r *falba.Result) bool { return r.TestName == "fio" })
+	if got := slices.Sorted(maps.Keys(fio.Results)); !cmp.Equal(got, []string{"fio1", "fio2"}) {
+		t.Errorf("Got results %v, want fio1 and fio2", got)
+	}
+	if diff := cmp.Diff(map[string]falba.FactType{
+		"kernel": {Type: falba.ValueString},
+		"traced": {Type: falba.ValueBool},
+	}, fio.FactTypes); diff != "" {
+		t.Errorf("Unexpected fact types (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]falba.MetricType{"iops": {Type: falba.ValueInt}}, fio.MetricTypes); diff != "" {
+		t.Errorf("Unexpected metric types (-want +got):\n%s", diff)
+	}
+	if fio.InputsHash == "" || fio.InputsHash == "abc" {
+		t.Errorf("Got InputsHash %q after filtering, want a new one", fio.InputsHash)
+	}
+	// The original is untouched.
+	if len(falbaDB.Results) != 3 || len(falbaDB.FactTypes) != 3 || falbaDB.InputsHash != "abc" {
+		t.Errorf("Filter modified the original DB")
+	}
+
+	// Different results, different hash.
+	kernel61 := falbaDB.Filter(func(r *falba.Result) bool {
+		return r.Facts["kernel"].StringValue() == "6.1"
+	})
+	if got := slices.Sorted(maps.Keys(kernel61.Results)); !cmp.Equal(got, []string{"build1", "fio1"}) {
+		t.Errorf("Got results %v, want build1 and fio1", got)
+	}
+	if kernel61.InputsHash == fio.InputsHash {
+		t.Errorf("Differently filtered DBs have the same InputsHash")
+	}
+
+	none := falbaDB.Filter(func(r *falba.Result) bool { return false })
+	if len(none.Results) != 0 || len(none.FactTypes) != 0 || len(none.MetricTypes) != 0 {
+		t.Errorf("Filtering out everything left %v, %v, %v", none.Results, none.FactTypes, none.MetricTypes)
+	}
+}
+
+func TestAddFact(t *testing.T) {
+	newDB := func() *db.DB {
+		return &db.DB{
+			Results: map[string]*falba.Result{
+				"r1": {TestName: "t", ResultID: "r1", Facts: map[string]falba.Value{"kernel": &falba.StringValue{Value: "6.1"}}},
+				"r2": {TestName: "t", ResultID: "r2", Facts: map[string]falba.Value{"kernel": &falba.StringValue{Value: "6.2"}}},
+			},
+			FactTypes:   map[string]falba.FactType{"kernel": {Type: falba.ValueString}},
+			MetricTypes: map[string]falba.MetricType{"iops": {Type: falba.ValueInt}},
+			InputsHash:  "abc",
+		}
+	}
+
+	falbaDB := newDB()
+	err := falbaDB.AddFact("week", falba.FactType{Type: falba.ValueInt}, map[string]falba.Value{
+		"r1": &falba.IntValue{Value: 3},
+	})
+	if err != nil {
+		t.Fatalf("AddFact failed: %v", err)
+	}
+	if diff := cmp.Diff(&falba.IntValue{Value: 3}, falbaDB.Results["r1"].Facts["week"]); diff != "" {
+		t.Errorf("Unexpected value for r1 (-want +got):\n%s", diff)
+	}
+	if _, ok := falbaDB.Results["r2"].Facts["week"]; ok {
+		t.Errorf("r2 got the fact, but it had no value")
+	}
+	if falbaDB.FactTypes["week"].Type != falba.ValueInt {
+		t.Errorf("Got fact types %v, want week to be an int", falbaDB.FactTypes)
+	}
+	if falbaDB.InputsHash == "abc" {
+		t.Errorf("InputsHash didn't change after adding a fact")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		values  map[string]falba.Value
+		wantErr error
+	}{
+		{name: "kernel", wantErr: db.ErrDuplicateFact},
+		{name: "iops", wantErr: db.ErrTypeConflict},
+		{name: "test_name", wantErr: parser.ErrReservedName},
+		{name: "week", values: map[string]falba.Value{"r1": &falba.StringValue{Value: "3"}}, wantErr: db.ErrTypeConflict},
+		{name: "week", values: map[string]falba.Value{"nope": &falba.IntValue{Value: 3}}},
+	} {
+		falbaDB := newDB()
+		err := falbaDB.AddFact(tc.name, falba.FactType{Type: falba.ValueInt}, tc.values)
+		if err == nil {
+			t.Errorf("AddFact(%q, %v) succeeded, want error", tc.name, tc.values)
+		} else if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("AddFact(%q, %v): got error %v, want %v", tc.name, tc.values, err, tc.wantErr)
+		}
+		if len(falbaDB.FactTypes) != 1 || falbaDB.InputsHash != "abc" {
+			t.Errorf("Failed AddFact(%q, %v) modified the DB", tc.name, tc.values)
+		}
+	}
+}
+
+func TestConvertFact(t *testing.T) {
+	newDB := func(threads ...string) *db.DB {
+		d := &db.DB{
+			Results: map[string]*falba.Result{},
+			FactTypes: map[string]falba.FactType{
+				"threads": {Type: falba.ValueString},
+				"nr_cpus": {Type: falba.ValueInt},
+			},
+			InputsHash: "abc",
+		}
+		for i, v := range threads {
+			id := fmt.Sprintf("r%d", i)
+			d.Results[id] = &falba.Result{TestName: "t", ResultID: id, Facts: map[string]falba.Value{"threads": &falba.StringValue{Value: v}}}
+		}
+		// One result without the fact.
+		d.Results["none"] = &falba.Result{TestName: "t", ResultID: "none", Facts: map[string]falba.Value{}}
+		return d
+	}
+
+	falbaDB := newDB("8", " 16 ")
+	if err := falbaDB.ConvertFact("threads", falba.ValueInt); err != nil {
+		t.Fatalf("ConvertFact failed: %v", err)
+	}
+	got := map[string]falba.Value{}
+	for id, r := range falbaDB.Results {
+		if v, ok := r.Facts["threads"]; ok {
+			got[id] = v
+		}
+	}
+	want := map[string]falba.Value{"r0": &falba.IntValue{Value: 8}, "r1": &falba.IntValue{Value: 16}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected values (-want +got):\n%s", diff)
+	}
+	if falbaDB.FactTypes["threads"].Type != falba.ValueInt {
+		t.Errorf("Got fact types %v, want threads to be an int", falbaDB.FactTypes)
+	}
+	if falbaDB.InputsHash == "abc" {
+		t.Errorf("InputsHash didn't change after converting a fact")
+	}
+
+	for _, tc := range []struct {
+		name    string
+		t       falba.ValueType
+		values  []string
+		wantErr error
+	}{
+		{name: "threads", t: falba.ValueInt, values: []string{"8", "many"}},
+		{name: "threads", t: falba.ValueInt, values: []string{"8", "1.5"}},
+		{name: "threads", t: falba.ValueBool, values: []string{"8"}},
+		{name: "nr_cpus", t: falba.ValueFloat, wantErr: db.ErrTypeConflict},
+		{name: "nope", t: falba.ValueInt},
+	} {
+		falbaDB := newDB(tc.values...)
+		err := falbaDB.ConvertFact(tc.name, tc.t)
+		if err == nil {
+			t.Errorf("ConvertFact(%q, %v) with %q succeeded, want error", tc.name, tc.t, tc.values)
+		} else if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+			t.Errorf("ConvertFact(%q, %v): got error %v, want %v", tc.name, tc.t, err, tc.wantErr)
+		}
+		if falbaDB.FactTypes["threads"].Type != falba.ValueString || falbaDB.Results["r0"] != nil && falbaDB.Results["r0"].Facts["threads"].Type() != falba.ValueString || falbaDB.InputsHash != "abc" {
+			t.Errorf("Failed ConvertFact(%q, %v) modified the DB", tc.name, tc.t)
+		}
+	}
+}
+
+// The DuckDB driver needs CGo and takes ages to build, so library users that
+// only read the DB shouldn't have to depend on it.
+func TestNoDuckDBDriverDependency(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("No go binary: %v", err)
+	}
+	out, err := exec.Command(goBin, "list", "-deps", ".").Output()
+	if err != nil {
+		t.Fatalf("go list failed: %v", err)
+	}
+	for _, pkg := range strings.Fields(string(out)) {
+		if strings.Contains(pkg, "go-duckdb") {
+			t.Errorf("db package depends on %v", pkg)
+		}
+	}
+}
+
+// Values go to DuckDB via JSON, check that doesn't lose their types or precision.
+func TestInsertIntoDuckDB_ValueTypes(t *testing.T) {
+	sqlDB, err := sql.Open("duckdb", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open DuckDB: %v", err)
+	}
+	defer sqlDB.Close()
+
+	// Not representable as a float64.
+	const bigInt = int64(1<<53 + 1)
+	falbaDB := &db.DB{
+		RootDirs: []string{"dummy"},
+		Results: resultsMap(t, []*falba.Result{{
+			TestName: "test",
+			ResultID: "r1",
+			Facts: map[string]falba.Value{
+				"big":   &falba.IntValue{Value: bigInt},
+				"whole": &falba.FloatValue{Value: 5},
+				"nan":   &falba.FloatValue{Value: math.NaN()},
+			},
+			Metrics: []*falba.Metric{
+				{Name: "count", Value: &falba.IntValue{Value: bigInt}},
+				{Name: "ratio", Value: &falba.FloatValue{Value: math.Inf(1)}},
+			},
+		}}),
+		FactTypes: map[string]falba.FactType{
+			"big":   {Type: falba.ValueInt},
+			"whole": {Type: falba.ValueFloat},
+			"nan":   {Type: falba.ValueFloat},
+		},
+		MetricTypes: map[string]falba.MetricType{
+			"count": {Type: falba.ValueInt},
+			"ratio": {Type: falba.ValueFloat},
+		},
+	}
+	if err := falbaDB.InsertIntoDuckDB(sqlDB); err != nil {
+		t.Fatalf("InsertIntoDuckDB failed: %v", err)
+	}
+
+	var big int64
+	var whole, nan float64
+	var bigType, wholeType string
+	err = sqlDB.QueryRow("SELECT big, typeof(big), whole, typeof(whole), nan FROM results").Scan(&big, &bigType, &whole, &wholeType, &nan)
+	if err != nil {
+		t.Fatalf("Querying results failed: %v", err)
+	}
+	if big != bigInt || bigType != "BIGINT" {
+		t.Errorf("Int fact came back as %v %v, want BIGINT %v", bigType, big, bigInt)
+	}
+	if whole != 5 || wholeType != "DOUBLE" {
+		t.Errorf("Float fact came back as %v %v, want DOUBLE 5", wholeType, whole)
+	}
+	if !math.IsNaN(nan) {
+		t.Errorf("NaN fact came back as %v", nan)
+	}
+
+	var count int64
+	var ratio float64
+	err = sqlDB.QueryRow("SELECT (SELECT int_value FROM metrics WHERE metric = 'count'), (SELECT float_value FROM metrics WHERE metric = 'ratio')").Scan(&count, &ratio)
+	if err != nil {
+		t.Fatalf("Querying metrics failed: %v", err)
+	}
+	if count != bigInt {
+		t.Errorf("Int metric came back as %v, want %v", count, bigInt)
+	}
+	if !math.IsInf(ratio, 1) {
+		t.Errorf("Inf metric came back as %v", ratio)
+	}
+}
+
+func TestReadDB_MetricUnit(t *testing.T) {
+	tempDir := t.TempDir()
+	parsersFileContent := `{
+		"parsers": {
+			"p": {"type": "single_metric", "artifact_regexp": "latency", "metric": {"name": "latency", "type": "int", "unit": "us"}}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(tempDir, "parsers.json"), []byte(parsersFileContent), 0644); err != nil {
+		t.Fatalf("Failed to write parsers.json: %v", err)
+	}
+	artifactsDir := filepath.Join(tempDir, "test:123", "artifacts")
+	if err := os.MkdirAll(artifactsDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(artifactsDir, "latency"), []byte("1500\n"), 0644); err != nil {
+		t.Fatalf("Failed to write artifact: %v", err)
+	}
+
+	falbaDB, err := db.ReadDB(tempDir, nil)
+	if err != nil {
+		t.Fatalf("Failed to read DB: %v", err)
+	}
+	if u := falbaDB.MetricTypes["latency"].Unit; u == nil || u.ShortName != "us" {
+		t.Errorf("Got unit %v in MetricTypes, want us", u)
+	}
+	rows := falbaDB.Results["123"].ForMetricsTable()
+	if len(rows) != 1 {
+		t.Fatalf("Got %d metrics table rows, want 1", len(rows))
+	}
+	if got := rows[0]["unit_short_name"]; got != "us" {
+		t.Errorf("Got unit_short_name %v in the metrics table, want us", got)
+	}
+}
+
+func TestCheckTestName(t *testing.T) {
+	for _, name := range []string{"my_test", "my-test.v2", "x"} {
+		if err := db.CheckTestName(name); err != nil {
+			t.Errorf("CheckTestName(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "a:b", "a/b", "../../x", "/abs", ".", "..", ".hidden"} {
+		if err := db.CheckTestName(name); err == nil {
+			t.Errorf("CheckTestName(%q) succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// Severity says how worried you should be about a Finding.
+type Severity int
+
+const (
+	// Something is definitely wrong.
+	SeverityError Severity = iota
+	// Something is probably wrong.
+	SeverityWarning
+	// Something might be worth knowing about.
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "ERROR"
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityInfo:
+		return "INFO"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A Finding is a problem (or potential problem) spotted by Doctor.
+type Finding struct {
+	Severity Severity
+	// Short identifier of the check that produced the finding.
+	Check   string
+	Message string
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s [%s] %s", f.Severity, f.Check, f.Message)
+}
+
+// DoctorOptions configures Doctor. The zero value gives the defaults.
+type DoctorOptions struct {
+	// Metrics whose coefficient of variation (stddev / mean) within a single
+	// result is above this are reported. 0 means 0.1.
+	MaxCoV float64
+}
+
+// Doctor runs a bunch of sanity checks over the DB, to answer the question "is
+// my data any good?". The findings are sorted with the most severe first.
+func (d *DB) Doctor(opts DoctorOptions) []*Finding {
+	if opts.MaxCoV == 0 {
+		opts.MaxCoV = 0.1
+	}
+	var findings []*Finding
+	findings = append(findings, d.checkReservedNames()...)
+	findings = append(findings, d.checkUnmatchedParsers()...)
+	findings = append(findings, d.checkParseErrors()...)
+	findings = append(findings, d.checkEmptyMetrics()...)
+	findings = append(findings, d.checkMissingArtifacts()...)
+	findings = append(findings, d.checkCoV(opts.MaxCoV)...)
+	findings = append(findings, d.checkSingleValueFacts()...)
+	slices.SortStableFunc(findings, func(a, b *Finding) int {
+		return cmp.Compare(a.Severity, b.Severity)
+	})
+	return findings
+}
+
+// Parsers and derivers already reject reserved names, but this catches names
+// that are confusing in the SQL tables.
+func (d *DB) checkReservedNames() []*Finding {
+	var findings []*Finding
+	for _, name := range slices.Sorted(maps.Keys(d.FactTypes)) {
+		if falba.IsReservedFactName(name) {
+			findings = append(findings, &Finding{
+				Severity: SeverityError,
+				Check:    "reserved-name",
+				Message:  fmt.Sprintf("fact %q has a reserved name (%s)", name, falba.GetReservedFactNamesString()),
+			})
+		}
+		if _, ok := d.MetricTypes[name]; ok {
+			findings = append(findings, &Finding{
+				Severity: SeverityWarning,
+				Check:    "reserved-name",
+				Message:  fmt.Sprintf("%q is the name of both a fact and a metric", name),
+			})
+		}
+	}
+	return findings
+}
+
+func (d *DB) checkUnmatchedParsers() []*Finding {
+	var findings []*Finding
+	for _, name := range d.UnmatchedParsers() {
+		findings = append(findings, &Finding{
+			Severity: SeverityWarning,
+			Check:    "unmatched-parser",
+			Message:  fmt.Sprintf("parser %q didn't match any artifacts, maybe its artifact_regexp has a typo", name),
+		})
+	}
+	return findings
+}
+
+// Parse failures don't stop the DB from loading, they just mean the result is
+// missing some data. Reports one finding per parser.
+func (d *DB) checkParseErrors() []*Finding {
+	// Keyed by parser name.
+	failedArtifacts := make(map[string]int)
+	failedResults := make(map[string][]string)
+	examples := make(map[string]*falba.ParseError)
+	for _, resultID := range slices.Sorted(maps.Keys(d.Results)) {
+		seen := make(map[string]bool)
+		for _, e := range d.Results[resultID].ParseErrors {
+			failedArtifacts[e.Parser]++
+			if !seen[e.Parser] {
+				failedResults[e.Parser] = append(failedResults[e.Parser], resultID)
+				seen[e.Parser] = true
+			}
+			if examples[e.Parser] == nil {
+				examples[e.Parser] = e
+			}
+		}
+	}
+	var findings []*Finding
+	for _, name := range slices.Sorted(maps.Keys(failedResults)) {
+		ids := failedResults[name]
+		e := examples[name]
+		findings = append(findings, &Finding{
+			Severity: SeverityWarning,
+			Check:    "parse-failure",
+			Message: fmt.Sprintf("parser %q failed on %d artifacts in %d of %d results (e.g. %s in result %s: %s)",
+				name, failedArtifacts[name], len(ids), len(d.Results), e.Artifact, ids[0], e.Message),
+		})
+	}
+	return findings
+}
+
+func (d *DB) checkEmptyMetrics() []*Finding {
+	counts := make(map[string]int)
+	for _, r := range d.Results {
+		for _, m := range r.Metrics {
+			counts[m.Name]++
+		}
+	}
+	var findings []*Finding
+	for _, name := range slices.Sorted(maps.Keys(d.MetricTypes)) {
+		if counts[name] == 0 {
+			findings = append(findings, &Finding{
+				Severity: SeverityWarning,
+				Check:    "empty-metric",
+				Message:  fmt.Sprintf("metric %q has no samples in any result", name),
+			})
+		}
+	}
+	return findings
+}
+
+// Looks for facts and metrics that are present in some results for a test but
+// not others. That usually means some of the results are missing artifacts,
+// e.g. because the test script crashed partway through. Different tests are
+// expected to produce different facts and metrics so they're checked
+// separately.
+func (d *DB) checkMissingArtifacts() []*Finding {
+	byTest := make(map[string][]*falba.Result)
+	for _, resultID := range slices.Sorted(maps.Keys(d.Results)) {
+		r := d.Results[resultID]
+		byTest[r.TestName] = append(byTest[r.TestName], r)
+	}
+
+	var findings []*Finding
+	for _, testName := range slices.Sorted(maps.Keys(byTest)) {
+		results := byTest[testName]
+		// Names of things that results have, and IDs of results missing them.
+		present := make(map[string]bool)
+		missing := make(map[string][]string)
+		for _, r := range results {
+			names := make(map[string]bool)
+			for name := range r.Facts {
+				names["fact "+name] = true
+			}
+			for _, m := range r.Metrics {
+				names["metric "+m.Name] = true
+			}
+			for name := range names {
+				present[name] = true
+			}
+		}
+		for _, r := range results {
+			for name := range present {
+				has := false
+				if factName, ok := strings.CutPrefix(name, "fact "); ok {
+					_, has = r.Facts[factName]
+				} else {
+					metricName, _ := strings.CutPrefix(name, "metric ")
+					has = slices.ContainsFunc(r.Metrics, func(m *falba.Metric) bool { return m.Name == metricName })
+				}
+				if !has {
+					missing[name] = append(missing[name], r.ResultID)
+				}
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(missing)) {
+			ids := missing[name]
+			findings = append(findings, &Finding{
+				Severity: SeverityWarning,
+				Check:    "missing-artifacts",
+				Message: fmt.Sprintf("%d of %d results for test %q have no %s (e.g. %s), maybe they're missing artifacts",
+					len(ids), len(results), testName, name, ids[0]),
+			})
+		}
+	}
+	return findings
+}
+
+// Looks for metrics that are very noisy within a single result.
+func (d *DB) checkCoV(maxCoV float64) []*Finding {
+	type worst struct {
+		cov      float64
+		resultID string
+		count    int
+	}
+	worstByMetric := make(map[string]*worst)
+	for _, resultID := range slices.Sorted(maps.Keys(d.Results)) {
+		samples := make(map[string][]float64)
+		for _, m := range d.Results[resultID].Metrics {
+			switch m.Type() {
+			case falba.ValueInt:
+				samples[m.Name] = append(samples[m.Name], float64(m.IntValue()))
+			case falba.ValueFloat:
+				samples[m.Name] = append(samples[m.Name], m.FloatValue())
+			}
+		}
+		for name, vals := range samples {
+			cov, ok := coefficientOfVariation(vals)
+			if !ok || cov <= maxCoV {
+				continue
+			}
+			w, ok := worstByMetric[name]
+			if !ok {
+				w = &worst{}
+				worstByMetric[name] = w
+			}
+			w.count++
+			if cov > w.cov {
+				w.cov = cov
+				w.resultID = resultID
+			}
+		}
+	}
+
+	var findings []*Finding
+	for _, name := range slices.Sorted(maps.Keys(worstByMetric)) {
+		w := worstByMetric[name]
+		findings = append(findings, &Finding{
+			Severity: SeverityWarning,
+			Check:    "high-cov",
+			Message: fmt.Sprintf("metric %q has CoV above %.0f%% in %d results (worst: %.0f%% in %s)",
+				name, maxCoV*100, w.count, w.cov*100, w.resultID),
+		})
+	}
+	return findings
+}
+
+// Returns false if the CoV isn't meaningful.
+func coefficientOfVariation(vals []float64) (float64, bool) {
+	if len(vals) < 2 {
+		return 0, false
+	}
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	mean := sum / float64(len(vals))
+	if mean == 0 {
+		return 0, false
+	}
+	var sumSq float64
+	for _, v := range vals {
+		sumSq += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(sumSq / float64(len(vals)-1))
+	return math.Abs(stddev / mean), true
+}
+
+// Facts that are the same for every result are useless for grouping. This is
+// just informational, it's often fine.
+func (d *DB) checkSingleValueFacts() []*Finding {
+	if len(d.Results) < 2 {
+		return nil
+	}
+	values := make(map[string]map[string]bool)
+	for _, r := range d.Results {
+		for name, v := range r.Facts {
+			if values[name] == nil {
+				values[name] = make(map[string]bool)
+			}
+			values[name][fmt.Sprint(falba.ValueValue(v))] = true
+		}
+	}
+	var findings []*Finding
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if len(values[name]) == 1 {
+			findings = append(findings, &Finding{
+				Severity: SeverityInfo,
+				Check:    "single-value-fact",
+				Message: fmt.Sprintf("fact %q is %v for every result that has it, it's no use for grouping",
+					name, slices.Collect(maps.Keys(values[name]))[0]),
+			})
+		}
+	}
+	return findings
+}
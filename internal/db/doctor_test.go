@@ -0,0 +1,60 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDoctor(t *testing.T) {
+	metric := func(name string, v float64) *falba.Metric {
+		return &falba.Metric{Name: name, Value: &falba.FloatValue{Value: v}}
+	}
+	falbaDB := &db.DB{
+		Results: map[string]*falba.Result{
+			"res1": {
+				TestName: "test",
+				ResultID: "res1",
+				Facts:    map[string]falba.Value{"kernel": &falba.StringValue{Value: "6.6"}},
+				Metrics:  []*falba.Metric{metric("latency", 10), metric("latency", 11), metric("noisy", 1), metric("noisy", 10)},
+			},
+			"res2": {
+				TestName: "test",
+				ResultID: "res2",
+				Facts:    map[string]falba.Value{"kernel": &falba.StringValue{Value: "6.6"}},
+				Metrics:  []*falba.Metric{metric("noisy", 5)},
+				ParseErrors: []*falba.ParseError{
+					{Parser: "good", Artifact: "out.txt", Message: "no match"},
+				},
+			},
+		},
+		FactTypes: map[string]falba.FactType{"kernel": {Type: falba.ValueString}},
+		MetricTypes: map[string]falba.MetricType{
+			"latency": {Type: falba.ValueFloat},
+			"noisy":   {Type: falba.ValueFloat},
+			"unused":  {Type: falba.ValueFloat},
+		},
+		ParserStats: map[string]*db.ParserStats{
+			"good": {MatchedArtifacts: 3, ProducedValues: 3},
+			"bad":  {},
+		},
+	}
+
+	var got []string
+	for _, f := range falbaDB.Doctor(db.DoctorOptions{}) {
+		got = append(got, f.Severity.String()+" "+f.Check)
+	}
+	want := []string{
+		"WARNING unmatched-parser",
+		"WARNING parse-failure",
+		"WARNING empty-metric",
+		"WARNING missing-artifacts",
+		"WARNING high-cov",
+		"INFO single-value-fact",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected findings (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// PruneOptions says which results SelectForPrune should pick. At least one of
+// OlderThan and Keep must be set. If both are set, only results that are
+// selected by both get pruned.
+type PruneOptions struct {
+	// Prune results from before Now minus this.
+	OlderThan time.Duration
+	// Prune all but this many of the most recent results for each test.
+	Keep int
+	Now  time.Time
+}
+
+// ResultDir returns the directory the result was read from.
+func (d *DB) ResultDir(r *falba.Result) (string, error) {
+	for _, root := range d.RootDirs {
+		dir := r.ResultDir(root)
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("result %v not found in %v", r.ResultID, d.RootDirs)
+}
+
+// ResultTimes returns when each result was produced, keyed by result ID. If
+// timeFact is empty, that's the mtime of the result's directory. Otherwise
+// it's the value of that fact, which must be an int (Unix seconds) or a string
+// in RFC 3339 format. Results that don't have the fact are left out.
+func (d *DB) ResultTimes(timeFact string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	for id, r := range d.Results {
+		if timeFact == "" {
+			dir, err := d.ResultDir(r)
+			if err != nil {
+				return nil, err
+			}
+			info, err := os.Stat(dir)
+			if err != nil {
+				return nil, err
+			}
+			times[id] = info.ModTime()
+			continue
+		}
+
+		v, ok := r.Facts[timeFact]
+		if !ok {
+			log.Printf("Result %v has no fact %q, not considering it", id, timeFact)
+			continue
+		}
+		switch v.Type() {
+		case falba.ValueInt:
+			times[id] = time.Unix(v.IntValue(), 0)
+		case falba.ValueString:
+			t, err := time.Parse(time.RFC3339, v.StringValue())
+			if err != nil {
+				return nil, fmt.Errorf("result %v: parsing %q as a time: %v", id, timeFact, err)
+			}
+			times[id] = t
+		default:
+			return nil, fmt.Errorf("fact %q has type %v, need int (Unix time) or string (RFC 3339)", timeFact, v.Type())
+		}
+	}
+	return times, nil
+}
+
+// SelectForPrune returns the results that should be deleted according to the
+// options, sorted by test name and then time. Results that aren't in times are
+// never selected.
+func (d *DB) SelectForPrune(times map[string]time.Time, opts PruneOptions) ([]*falba.Result, error) {
+	if opts.OlderThan <= 0 && opts.Keep <= 0 {
+		return nil, fmt.Errorf("need a positive age or number of results to keep")
+	}
+
+	byTest := make(map[string][]*falba.Result)
+	for id, r := range d.Results {
+		if _, ok := times[id]; ok {
+			byTest[r.TestName] = append(byTest[r.TestName], r)
+		}
+	}
+
+	var ret []*falba.Result
+	for _, testName := range slices.Sorted(maps.Keys(byTest)) {
+		results := byTest[testName]
+		// Newest first.
+		slices.SortFunc(results, func(a, b *falba.Result) int {
+			return cmp.Or(times[b.ResultID].Compare(times[a.ResultID]), cmp.Compare(a.ResultID, b.ResultID))
+		})
+		var selected []*falba.Result
+		for i, r := range results {
+			if opts.Keep > 0 && i < opts.Keep {
+				continue
+			}
+			if opts.OlderThan > 0 && !times[r.ResultID].Before(opts.Now.Add(-opts.OlderThan)) {
+				continue
+			}
+			selected = append(selected, r)
+		}
+		slices.Reverse(selected)
+		ret = append(ret, selected...)
+	}
+	return ret, nil
+}
@@ -0,0 +1,82 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjackman/falba/internal/db"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSelectForPrune(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	falbaDB := &db.DB{Results: map[string]*falba.Result{}}
+	times := map[string]time.Time{}
+	// Results a0..a3 and b0..b1 for two tests, with the number being the age
+	// in days.
+	for _, r := range []struct {
+		test string
+		id   string
+		age  int
+	}{
+		{"a", "a0", 0}, {"a", "a1", 1}, {"a", "a2", 2}, {"a", "a3", 3},
+		{"b", "b0", 0}, {"b", "b5", 5},
+	} {
+		falbaDB.Results[r.id] = &falba.Result{TestName: r.test, ResultID: r.id}
+		times[r.id] = now.Add(-time.Duration(r.age) * day)
+	}
+	// This one has no time, it should never be selected.
+	falbaDB.Results["x"] = &falba.Result{TestName: "a", ResultID: "x"}
+
+	testCases := []struct {
+		desc string
+		opts db.PruneOptions
+		want []string
+	}{
+		{desc: "older-than", opts: db.PruneOptions{OlderThan: 36 * time.Hour}, want: []string{"a3", "a2", "b5"}},
+		{desc: "keep", opts: db.PruneOptions{Keep: 1}, want: []string{"a3", "a2", "a1", "b5"}},
+		{desc: "both", opts: db.PruneOptions{OlderThan: 60 * time.Hour, Keep: 1}, want: []string{"a3", "b5"}},
+		{desc: "keep-all", opts: db.PruneOptions{Keep: 10}, want: nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.opts.Now = now
+			results, err := falbaDB.SelectForPrune(times, tc.opts)
+			if err != nil {
+				t.Fatalf("SelectForPrune failed: %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.ResultID)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := falbaDB.SelectForPrune(times, db.PruneOptions{Now: now}); err == nil {
+		t.Errorf("Expected error with no selectors, got nil")
+	}
+}
+
+func TestResultTimes_Fact(t *testing.T) {
+	falbaDB := &db.DB{Results: map[string]*falba.Result{
+		"int":  {ResultID: "int", Facts: map[string]falba.Value{"ts": &falba.IntValue{Value: 1700000000}}},
+		"str":  {ResultID: "str", Facts: map[string]falba.Value{"ts": &falba.StringValue{Value: "2025-01-02T03:04:05Z"}}},
+		"none": {ResultID: "none", Facts: map[string]falba.Value{}},
+	}}
+	got, err := falbaDB.ResultTimes("ts")
+	if err != nil {
+		t.Fatalf("ResultTimes failed: %v", err)
+	}
+	want := map[string]time.Time{
+		"int": time.Unix(1700000000, 0),
+		"str": time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected times (-want +got):\n%s", diff)
+	}
+}
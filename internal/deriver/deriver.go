@@ -0,0 +1,91 @@
+// Package deriver contains logic for producing facts and metrics from the
+// facts and metrics of a Result, as opposed to from its artifacts.
+package deriver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+)
+
+// A Deriver produces new facts and metrics for a Result, based on the ones
+// that were already extracted from its artifacts by the parsers. Derivers run
+// after all the parsers (and their defaults) have been applied.
+type Deriver interface {
+	fmt.Stringer
+	// Name of the deriver from the config.
+	Name() string
+	// Targets describes all the facts and metrics that the deriver might
+	// produce.
+	Targets() []*parser.ParserTarget
+	// Derive returns the new facts and metrics for the result. It mustn't
+	// modify the result.
+	Derive(result *falba.Result) (*parser.ParseResult, error)
+}
+
+type BaseDeriverConfig struct {
+	Type string `json:"type"`
+}
+
+// parseOnMismatch parses the 'on_mismatch' field that derivers matching a regexp
+// have. Returns whether a mismatch should be an error.
+func parseOnMismatch(s string) (bool, error) {
+	switch s {
+	case "", "skip":
+		return false, nil
+	case "error":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid 'on_mismatch' %q, expect 'skip' or 'error'", s)
+	}
+}
+
+// FromConfig reads a configuration entry for a single deriver and returns it.
+func FromConfig(rawConfig json.RawMessage, name string) (Deriver, error) {
+	var baseConfig BaseDeriverConfig
+	if err := json.Unmarshal(rawConfig, &baseConfig); err != nil {
+		return nil, fmt.Errorf("decoding 'type' for deriver: %v", err)
+	}
+
+	switch baseConfig.Type {
+	case "version":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config VersionDeriverConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding version deriver config: %v", err)
+		}
+		return NewVersionDeriver(name, &config)
+	case "result_name":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config ResultNameDeriverConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding result_name deriver config: %v", err)
+		}
+		return NewResultNameDeriver(name, &config)
+	case "threshold":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config ThresholdDeriverConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding threshold deriver config: %v", err)
+		}
+		return NewThresholdDeriver(name, &config)
+	case "rate":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config RateDeriverConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding rate deriver config: %v", err)
+		}
+		return NewRateDeriver(name, &config)
+	case "":
+		return nil, fmt.Errorf("missing/empty 'type' field")
+	default:
+		return nil, fmt.Errorf("unknown deriver type %q", baseConfig.Type)
+	}
+}
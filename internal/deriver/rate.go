@@ -0,0 +1,147 @@
+package deriver
+
+import (
+	"fmt"
+	"log"
+	"maps"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+	"github.com/bjackman/falba/internal/unit"
+)
+
+type RateDeriverConfig struct {
+	BaseDeriverConfig
+	// Name of the float metric to produce, in units of "/s".
+	Metric string `json:"metric"`
+	// The int or float metric to divide. It mustn't have a unit, since there
+	// isn't a unit for e.g. bytes per second.
+	CountMetric string `json:"count_metric"`
+	// The int or float metric to divide by. It must have a unit of time.
+	DurationMetric string `json:"duration_metric"`
+}
+
+// RateDeriver divides a count metric by a duration metric, e.g. ops / runtime,
+// to get a per-second rate.
+//
+// If the result has a single duration sample, every count sample is divided by
+// it. Otherwise each count sample is divided by the duration sample from the
+// same repetition. Count samples without a usable duration (missing,
+// ambiguous, or zero) are skipped with a log message.
+type RateDeriver struct {
+	name     string
+	metric   string
+	count    string
+	duration string
+	unit     *unit.Unit
+}
+
+func NewRateDeriver(name string, config *RateDeriverConfig) (*RateDeriver, error) {
+	if config.Metric == "" {
+		return nil, fmt.Errorf("missing/empty 'metric' field for rate deriver")
+	}
+	if config.CountMetric == "" || config.DurationMetric == "" {
+		return nil, fmt.Errorf("rate deriver needs both 'count_metric' and 'duration_metric'")
+	}
+	u, err := unit.Parse("/s")
+	if err != nil {
+		return nil, err
+	}
+	return &RateDeriver{
+		name:     name,
+		metric:   config.Metric,
+		count:    config.CountMetric,
+		duration: config.DurationMetric,
+		unit:     u,
+	}, nil
+}
+
+func (d *RateDeriver) Name() string {
+	return d.name
+}
+
+func (d *RateDeriver) Targets() []*parser.ParserTarget {
+	return []*parser.ParserTarget{{
+		Name:       d.metric,
+		TargetType: parser.TargetMetric,
+		ValueType:  falba.ValueFloat,
+		Unit:       d.unit,
+	}}
+}
+
+// repetitionString is for log messages, and for matching up samples.
+func repetitionString(rep *int64) string {
+	if rep == nil {
+		return "<none>"
+	}
+	return fmt.Sprint(*rep)
+}
+
+func (d *RateDeriver) Derive(result *falba.Result) (*parser.ParseResult, error) {
+	ret := &parser.ParseResult{Facts: map[string]falba.Value{}}
+
+	// Durations in seconds, all of them and by repetition.
+	var allSeconds []float64
+	seconds := map[string][]float64{}
+	for _, m := range result.Metrics {
+		if m.Name != d.duration {
+			continue
+		}
+		v, ok := numericValue(m.Value)
+		if !ok {
+			return nil, fmt.Errorf("metric %q is %v, rate deriver needs an int or float", d.duration, m.Value.Type())
+		}
+		s, err := m.Unit.Seconds(v)
+		if err != nil {
+			return nil, fmt.Errorf("duration metric %q: %v", d.duration, err)
+		}
+		allSeconds = append(allSeconds, s)
+		rep := repetitionString(m.Repetition)
+		seconds[rep] = append(seconds[rep], s)
+	}
+
+	for _, m := range result.Metrics {
+		if m.Name != d.count {
+			continue
+		}
+		v, ok := numericValue(m.Value)
+		if !ok {
+			return nil, fmt.Errorf("metric %q is %v, rate deriver needs an int or float", d.count, m.Value.Type())
+		}
+		if m.Unit != nil {
+			return nil, fmt.Errorf("count metric %q has unit %s, rate deriver needs a plain count", d.count, m.Unit.ShortName)
+		}
+		candidates := allSeconds
+		if len(allSeconds) > 1 {
+			candidates = seconds[repetitionString(m.Repetition)]
+		}
+		switch {
+		case len(candidates) == 0:
+			log.Printf("Deriver %s: result %s: skipping %s sample (repetition %s), no %s sample to divide by",
+				d.name, result.ResultID, d.count, repetitionString(m.Repetition), d.duration)
+			continue
+		case len(candidates) > 1:
+			log.Printf("Deriver %s: result %s: skipping %s sample (repetition %s), %d %s samples to divide by",
+				d.name, result.ResultID, d.count, repetitionString(m.Repetition), len(candidates), d.duration)
+			continue
+		case candidates[0] == 0:
+			log.Printf("Deriver %s: result %s: skipping %s sample (repetition %s), %s is zero",
+				d.name, result.ResultID, d.count, repetitionString(m.Repetition), d.duration)
+			continue
+		}
+		ret.Metrics = append(ret.Metrics, &falba.Metric{
+			Name:       d.metric,
+			Unit:       d.unit,
+			Labels:     maps.Clone(m.Labels),
+			Repetition: m.Repetition,
+			Value:      &falba.FloatValue{Value: v / candidates[0]},
+		})
+	}
+	return ret, nil
+}
+
+func (d *RateDeriver) String() string {
+	return fmt.Sprintf("RateDeriver{%s = %s / %s}", d.metric, d.count, d.duration)
+}
+
+var _ Deriver = &RateDeriver{}
@@ -0,0 +1,104 @@
+package deriver_test
+
+import (
+	"testing"
+
+	"github.com/bjackman/falba/internal/deriver"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRateDeriver(t *testing.T) {
+	const config = `{"type": "rate", "metric": "ops_per_sec", "count_metric": "ops", "duration_metric": "runtime"}`
+	rep := func(i int64) *int64 { return &i }
+	ops := func(v int64, r *int64) *falba.Metric {
+		return &falba.Metric{Name: "ops", Repetition: r, Value: &falba.IntValue{Value: v}}
+	}
+	runtime := func(v float64, u string, r *int64) *falba.Metric {
+		return &falba.Metric{Name: "runtime", Unit: test.MustParseUnit(t, u), Repetition: r, Value: &falba.FloatValue{Value: v}}
+	}
+	rate := func(v float64, r *int64) *falba.Metric {
+		return &falba.Metric{Name: "ops_per_sec", Unit: test.MustParseUnit(t, "/s"), Repetition: r, Value: &falba.FloatValue{Value: v}}
+	}
+	testCases := []struct {
+		desc      string
+		metrics   []*falba.Metric
+		want      []*falba.Metric
+		expectErr bool
+	}{
+		{
+			desc:    "single duration",
+			metrics: []*falba.Metric{ops(100, nil), ops(300, nil), runtime(2, "s", nil)},
+			want:    []*falba.Metric{rate(50, nil), rate(150, nil)},
+		},
+		{
+			desc:    "converts units",
+			metrics: []*falba.Metric{ops(100, nil), runtime(500, "ms", nil)},
+			want:    []*falba.Metric{rate(200, nil)},
+		},
+		{
+			desc: "by repetition",
+			metrics: []*falba.Metric{
+				ops(100, rep(0)), ops(100, rep(1)), ops(100, rep(2)),
+				runtime(1, "s", rep(0)), runtime(4, "s", rep(1)),
+			},
+			// Repetition 2 has no duration, so it's skipped.
+			want: []*falba.Metric{rate(100, rep(0)), rate(25, rep(1))},
+		},
+		{
+			desc:    "zero duration",
+			metrics: []*falba.Metric{ops(100, nil), runtime(0, "s", nil)},
+		},
+		{
+			desc:    "missing duration",
+			metrics: []*falba.Metric{ops(100, nil)},
+		},
+		{
+			desc:      "duration without unit",
+			metrics:   []*falba.Metric{ops(100, nil), {Name: "runtime", Value: &falba.IntValue{Value: 1}}},
+			expectErr: true,
+		},
+		{
+			desc:      "count with unit",
+			metrics:   []*falba.Metric{{Name: "ops", Unit: test.MustParseUnit(t, "B"), Value: &falba.IntValue{Value: 1}}, runtime(1, "s", nil)},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d, err := deriver.FromConfig([]byte(config), "test_deriver")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result := &falba.Result{TestName: "test", ResultID: "id", Metrics: tc.metrics}
+			got, err := d.Derive(result)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Derive failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.Metrics); diff != "" {
+				t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRateDeriverFromConfig_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"type": "rate", "count_metric": "ops", "duration_metric": "runtime"}`,
+		`{"type": "rate", "metric": "r", "duration_metric": "runtime"}`,
+		`{"type": "rate", "metric": "r", "count_metric": "ops"}`,
+		`{"type": "rate", "metric": "r", "count_metric": "ops", "duration_metric": "runtime", "bogus": 1}`,
+	} {
+		if _, err := deriver.FromConfig([]byte(config), "test_deriver"); err == nil {
+			t.Errorf("Expected error for config %s, got nil", config)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package deriver
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+)
+
+type ResultNameDeriverConfig struct {
+	BaseDeriverConfig
+	// Which part of the result directory name to match: "result_id" (the
+	// default) or "test_name".
+	Field string `json:"field"`
+	// Regexp with named capture groups. Each named group produces a fact with
+	// the same name.
+	Regexp string `json:"regexp"`
+	// Types of the produced facts, keyed by group name. Groups that aren't in
+	// here produce string facts.
+	Types map[string]string `json:"types"`
+	// Same as for VersionDeriverConfig.
+	OnMismatch string `json:"on_mismatch"`
+}
+
+// ResultNameDeriver produces facts from the name of the result's directory,
+// i.e. the test name or result ID, for people who encode metadata in there
+// instead of in an artifact.
+type ResultNameDeriver struct {
+	name          string
+	field         string
+	re            *regexp.Regexp
+	types         map[string]falba.ValueType
+	errOnMismatch bool
+}
+
+func NewResultNameDeriver(name string, config *ResultNameDeriverConfig) (*ResultNameDeriver, error) {
+	field := config.Field
+	switch field {
+	case "":
+		field = "result_id"
+	case "result_id", "test_name":
+	default:
+		return nil, fmt.Errorf("invalid 'field' %q, expect 'result_id' or 'test_name'", config.Field)
+	}
+	if config.Regexp == "" {
+		return nil, fmt.Errorf("missing/empty 'regexp' field for result_name deriver")
+	}
+	re, err := regexp.Compile(config.Regexp)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regexp pattern %q: %v", config.Regexp, err)
+	}
+	types := make(map[string]falba.ValueType)
+	for _, group := range re.SubexpNames() {
+		if group != "" {
+			types[group] = falba.ValueString
+		}
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("regexp %q has no named capture groups", config.Regexp)
+	}
+	for group, typeStr := range config.Types {
+		if _, ok := types[group]; !ok {
+			return nil, fmt.Errorf("'types' has %q which isn't a named group in %q", group, config.Regexp)
+		}
+		t, err := falba.ParseValueType(typeStr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing type for %q: %v", group, err)
+		}
+		types[group] = t
+	}
+	errOnMismatch, err := parseOnMismatch(config.OnMismatch)
+	if err != nil {
+		return nil, err
+	}
+	d := &ResultNameDeriver{
+		name:          name,
+		field:         field,
+		re:            re,
+		types:         types,
+		errOnMismatch: errOnMismatch,
+	}
+	for _, target := range d.Targets() {
+		if falba.IsReservedFactName(target.Name) {
+			return nil, fmt.Errorf("%w: fact name %q is reserved (%s)", parser.ErrReservedName, target.Name, falba.GetReservedFactNamesString())
+		}
+	}
+	return d, nil
+}
+
+func (d *ResultNameDeriver) Name() string {
+	return d.name
+}
+
+func (d *ResultNameDeriver) Targets() []*parser.ParserTarget {
+	var targets []*parser.ParserTarget
+	for _, group := range d.re.SubexpNames() {
+		if group == "" {
+			continue
+		}
+		targets = append(targets, &parser.ParserTarget{
+			Name:       group,
+			TargetType: parser.TargetFact,
+			ValueType:  d.types[group],
+		})
+	}
+	return targets
+}
+
+func (d *ResultNameDeriver) Derive(result *falba.Result) (*parser.ParseResult, error) {
+	ret := &parser.ParseResult{Facts: map[string]falba.Value{}}
+	s := result.ResultID
+	if d.field == "test_name" {
+		s = result.TestName
+	}
+
+	match := d.re.FindStringSubmatch(s)
+	if match == nil {
+		if d.errOnMismatch {
+			return nil, fmt.Errorf("%s %q doesn't match regexp %v", d.field, s, d.re)
+		}
+		log.Printf("Deriver %s: skipping %s %q, doesn't match %v", d.name, d.field, s, d.re)
+		return ret, nil
+	}
+	for i, group := range d.re.SubexpNames() {
+		if group == "" || match[i] == "" {
+			continue
+		}
+		v, err := falba.ParseValue(match[i], d.types[group])
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: group %q: %v", d.field, s, group, err)
+		}
+		ret.Facts[group] = v
+	}
+	return ret, nil
+}
+
+func (d *ResultNameDeriver) String() string {
+	return fmt.Sprintf("ResultNameDeriver{%s: %v}", d.field, d.re)
+}
+
+var _ Deriver = &ResultNameDeriver{}
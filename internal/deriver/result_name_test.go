@@ -0,0 +1,94 @@
+package deriver_test
+
+import (
+	"testing"
+
+	"github.com/bjackman/falba/internal/deriver"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResultNameDeriver(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		config    string
+		testName  string
+		resultID  string
+		want      map[string]falba.Value
+		expectErr bool
+	}{
+		{
+			desc:     "result_id",
+			config:   `{"type": "result_name", "regexp": "^(?P<kernel>[\\d.]+)_(?P<arch>[^_]+)_"}`,
+			resultID: "6.6_x86_abc123",
+			want: map[string]falba.Value{
+				"kernel": &falba.StringValue{Value: "6.6"},
+				"arch":   &falba.StringValue{Value: "x86"},
+			},
+		},
+		{
+			desc:     "test_name with types",
+			config:   `{"type": "result_name", "field": "test_name", "regexp": "-(?P<threads>\\d+)t$", "types": {"threads": "int"}}`,
+			testName: "fio-16t",
+			want: map[string]falba.Value{
+				"threads": &falba.IntValue{Value: 16},
+			},
+		},
+		{
+			desc:     "mismatch skipped",
+			config:   `{"type": "result_name", "regexp": "^(?P<kernel>[\\d.]+)_"}`,
+			resultID: "abc123",
+			want:     map[string]falba.Value{},
+		},
+		{
+			desc:      "mismatch error",
+			config:    `{"type": "result_name", "regexp": "^(?P<kernel>[\\d.]+)_", "on_mismatch": "error"}`,
+			resultID:  "abc123",
+			expectErr: true,
+		},
+		{
+			desc:      "bad int",
+			config:    `{"type": "result_name", "regexp": "^(?P<n>[^_]+)_", "types": {"n": "int"}}`,
+			resultID:  "foo_abc123",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d, err := deriver.FromConfig([]byte(tc.config), "test_deriver")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result := &falba.Result{TestName: tc.testName, ResultID: tc.resultID, Facts: map[string]falba.Value{}}
+			got, err := d.Derive(result)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Derive failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.Facts); diff != "" {
+				t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResultNameDeriverFromConfig_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"type": "result_name"}`,
+		`{"type": "result_name", "regexp": "(\\d+)"}`,
+		`{"type": "result_name", "regexp": "(?P<n>\\d+)", "field": "artifact"}`,
+		`{"type": "result_name", "regexp": "(?P<n>\\d+)", "types": {"m": "int"}}`,
+		`{"type": "result_name", "regexp": "(?P<n>\\d+)", "types": {"n": "complex"}}`,
+		`{"type": "result_name", "regexp": "(?P<result_id>\\d+)"}`,
+	} {
+		if _, err := deriver.FromConfig([]byte(config), "test_deriver"); err == nil {
+			t.Errorf("Expected error for config %s, got nil", config)
+		}
+	}
+}
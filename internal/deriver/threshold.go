@@ -0,0 +1,141 @@
+package deriver
+
+import (
+	"fmt"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+)
+
+type ThresholdDeriverConfig struct {
+	BaseDeriverConfig
+	// Name of the bool fact to produce.
+	Fact string `json:"fact"`
+	// Exactly one of these is the int or float value to compare. For a
+	// metric with several samples, their mean is compared.
+	InputFact   string `json:"input_fact"`
+	InputMetric string `json:"input_metric"`
+	// One of >, >=, <, <=, == and !=.
+	Op        string   `json:"op"`
+	Threshold *float64 `json:"threshold"`
+}
+
+var thresholdOps = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// ThresholdDeriver turns a numeric fact or metric into a bool fact by
+// comparing it with a threshold, e.g. is_slow = latency_ms > 100. This is for
+// grouping results into categories based on a continuous measurement.
+type ThresholdDeriver struct {
+	name      string
+	fact      string
+	input     string
+	isMetric  bool
+	op        string
+	compare   func(a, b float64) bool
+	threshold float64
+}
+
+func NewThresholdDeriver(name string, config *ThresholdDeriverConfig) (*ThresholdDeriver, error) {
+	if config.Fact == "" {
+		return nil, fmt.Errorf("missing/empty 'fact' field for threshold deriver")
+	}
+	if falba.IsReservedFactName(config.Fact) {
+		return nil, fmt.Errorf("%w: fact name %q is reserved (%s)", parser.ErrReservedName, config.Fact, falba.GetReservedFactNamesString())
+	}
+	if (config.InputFact == "") == (config.InputMetric == "") {
+		return nil, fmt.Errorf("specify exactly one of 'input_fact' and 'input_metric'")
+	}
+	compare, ok := thresholdOps[config.Op]
+	if !ok {
+		return nil, fmt.Errorf("invalid 'op' %q, expect one of >, >=, <, <=, == or !=", config.Op)
+	}
+	if config.Threshold == nil {
+		return nil, fmt.Errorf("missing 'threshold' field for threshold deriver")
+	}
+	d := &ThresholdDeriver{
+		name:      name,
+		fact:      config.Fact,
+		input:     config.InputFact,
+		op:        config.Op,
+		compare:   compare,
+		threshold: *config.Threshold,
+	}
+	if config.InputMetric != "" {
+		d.input = config.InputMetric
+		d.isMetric = true
+	}
+	return d, nil
+}
+
+func (d *ThresholdDeriver) Name() string {
+	return d.name
+}
+
+func (d *ThresholdDeriver) Targets() []*parser.ParserTarget {
+	return []*parser.ParserTarget{{
+		Name:       d.fact,
+		TargetType: parser.TargetFact,
+		ValueType:  falba.ValueBool,
+	}}
+}
+
+// Returns false if the value isn't an int or float.
+func numericValue(v falba.Value) (float64, bool) {
+	switch v.Type() {
+	case falba.ValueInt:
+		return float64(v.IntValue()), true
+	case falba.ValueFloat:
+		return v.FloatValue(), true
+	default:
+		return 0, false
+	}
+}
+
+func (d *ThresholdDeriver) Derive(result *falba.Result) (*parser.ParseResult, error) {
+	ret := &parser.ParseResult{Facts: map[string]falba.Value{}}
+	var val float64
+	if d.isMetric {
+		var sum float64
+		var n int
+		for _, m := range result.Metrics {
+			if m.Name != d.input {
+				continue
+			}
+			f, ok := numericValue(m.Value)
+			if !ok {
+				return nil, fmt.Errorf("metric %q is %v, threshold deriver needs an int or float", d.input, m.Value.Type())
+			}
+			sum += f
+			n++
+		}
+		// No samples, no fact.
+		if n == 0 {
+			return ret, nil
+		}
+		val = sum / float64(n)
+	} else {
+		v, ok := result.Facts[d.input]
+		if !ok {
+			return ret, nil
+		}
+		val, ok = numericValue(v)
+		if !ok {
+			return nil, fmt.Errorf("fact %q is %v, threshold deriver needs an int or float", d.input, v.Type())
+		}
+	}
+	ret.Facts[d.fact] = &falba.BoolValue{Value: d.compare(val, d.threshold)}
+	return ret, nil
+}
+
+func (d *ThresholdDeriver) String() string {
+	return fmt.Sprintf("ThresholdDeriver{%s = %s %s %v}", d.fact, d.input, d.op, d.threshold)
+}
+
+var _ Deriver = &ThresholdDeriver{}
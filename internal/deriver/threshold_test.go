@@ -0,0 +1,104 @@
+package deriver_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bjackman/falba/internal/deriver"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestThresholdDeriver(t *testing.T) {
+	metric := func(v float64) *falba.Metric {
+		return &falba.Metric{Name: "latency_ms", Value: &falba.FloatValue{Value: v}}
+	}
+	testCases := []struct {
+		desc      string
+		config    string
+		facts     map[string]falba.Value
+		metrics   []*falba.Metric
+		want      map[string]falba.Value
+		expectErr bool
+	}{
+		{
+			desc:   "fact above",
+			config: `{"type": "threshold", "fact": "is_slow", "input_fact": "latency_ms", "op": ">", "threshold": 100}`,
+			facts:  map[string]falba.Value{"latency_ms": &falba.IntValue{Value: 150}},
+			want:   map[string]falba.Value{"is_slow": &falba.BoolValue{Value: true}},
+		},
+		{
+			desc:   "fact equal",
+			config: `{"type": "threshold", "fact": "is_slow", "input_fact": "latency_ms", "op": ">", "threshold": 100}`,
+			facts:  map[string]falba.Value{"latency_ms": &falba.IntValue{Value: 100}},
+			want:   map[string]falba.Value{"is_slow": &falba.BoolValue{Value: false}},
+		},
+		{
+			desc:   "fact equal with >=",
+			config: `{"type": "threshold", "fact": "is_slow", "input_fact": "latency_ms", "op": ">=", "threshold": 100}`,
+			facts:  map[string]falba.Value{"latency_ms": &falba.FloatValue{Value: 100}},
+			want:   map[string]falba.Value{"is_slow": &falba.BoolValue{Value: true}},
+		},
+		{
+			desc:   "metric mean",
+			config: `{"type": "threshold", "fact": "is_fast", "input_metric": "latency_ms", "op": "<", "threshold": 10}`,
+			// Mean is 9.
+			metrics: []*falba.Metric{metric(2), metric(16), metric(9)},
+			want:    map[string]falba.Value{"is_fast": &falba.BoolValue{Value: true}},
+		},
+		{
+			desc:   "missing input",
+			config: `{"type": "threshold", "fact": "is_slow", "input_metric": "latency_ms", "op": ">", "threshold": 100}`,
+			want:   map[string]falba.Value{},
+		},
+		{
+			desc:      "string fact",
+			config:    `{"type": "threshold", "fact": "is_slow", "input_fact": "latency_ms", "op": ">", "threshold": 100}`,
+			facts:     map[string]falba.Value{"latency_ms": &falba.StringValue{Value: "slow"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d, err := deriver.FromConfig([]byte(tc.config), "test_deriver")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result := &falba.Result{TestName: "test", ResultID: "id", Facts: tc.facts, Metrics: tc.metrics}
+			got, err := d.Derive(result)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Derive failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.Facts); diff != "" {
+				t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestThresholdDeriverFromConfig_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"type": "threshold", "input_fact": "x", "op": ">", "threshold": 1}`,
+		`{"type": "threshold", "fact": "f", "op": ">", "threshold": 1}`,
+		`{"type": "threshold", "fact": "f", "input_fact": "x", "input_metric": "y", "op": ">", "threshold": 1}`,
+		`{"type": "threshold", "fact": "f", "input_fact": "x", "op": "=>", "threshold": 1}`,
+		`{"type": "threshold", "fact": "f", "input_fact": "x", "op": ">"}`,
+	} {
+		if _, err := deriver.FromConfig([]byte(config), "test_deriver"); err == nil {
+			t.Errorf("Expected error for config %s, got nil", config)
+		}
+	}
+
+	config := `{"type": "threshold", "fact": "test_name", "input_fact": "x", "op": ">", "threshold": 1}`
+	if _, err := deriver.FromConfig([]byte(config), "test_deriver"); !errors.Is(err, parser.ErrReservedName) {
+		t.Errorf("Expected ErrReservedName, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package deriver
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+)
+
+// By default we pull out up to three dot-separated numeric components,
+// ignoring any suffix like "-rc2".
+const defaultVersionRegexp = `^(?P<major>\d+)(?:\.(?P<minor>\d+))?(?:\.(?P<patch>\d+))?`
+
+type VersionDeriverConfig struct {
+	BaseDeriverConfig
+	// Name of the string fact containing the version.
+	Fact string `json:"fact"`
+	// Regexp with named capture groups. Each named group produces an int fact
+	// called $prefix_$group. Defaults to defaultVersionRegexp.
+	Regexp string `json:"regexp"`
+	// Prefix for the produced fact names. Defaults to the fact name with any
+	// "_version" suffix removed.
+	Prefix string `json:"prefix"`
+	// What to do when the fact doesn't match the regexp: "skip" (the default)
+	// just logs it and produces no facts, "error" fails the whole DB read.
+	OnMismatch string `json:"on_mismatch"`
+}
+
+// VersionDeriver splits a version string fact, like "6.6.3-rc2", into numeric
+// component facts, like major=6 minor=6 patch=3, so that they can be used for
+// grouping and filtering numerically.
+type VersionDeriver struct {
+	name          string
+	fact          string
+	re            *regexp.Regexp
+	prefix        string
+	errOnMismatch bool
+}
+
+func NewVersionDeriver(name string, config *VersionDeriverConfig) (*VersionDeriver, error) {
+	if config.Fact == "" {
+		return nil, fmt.Errorf("missing/empty 'fact' field for version deriver")
+	}
+	pattern := config.Regexp
+	if pattern == "" {
+		pattern = defaultVersionRegexp
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regexp pattern %q: %v", pattern, err)
+	}
+	hasNamedGroup := false
+	for _, group := range re.SubexpNames() {
+		if group != "" {
+			hasNamedGroup = true
+		}
+	}
+	if !hasNamedGroup {
+		return nil, fmt.Errorf("regexp %q has no named capture groups", pattern)
+	}
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = strings.TrimSuffix(config.Fact, "_version")
+	}
+	errOnMismatch, err := parseOnMismatch(config.OnMismatch)
+	if err != nil {
+		return nil, err
+	}
+	d := &VersionDeriver{
+		name:          name,
+		fact:          config.Fact,
+		re:            re,
+		prefix:        prefix,
+		errOnMismatch: errOnMismatch,
+	}
+	for _, target := range d.Targets() {
+		if falba.IsReservedFactName(target.Name) {
+			return nil, fmt.Errorf("%w: fact name %q is reserved (%s)", parser.ErrReservedName, target.Name, falba.GetReservedFactNamesString())
+		}
+	}
+	return d, nil
+}
+
+func (d *VersionDeriver) Name() string {
+	return d.name
+}
+
+func (d *VersionDeriver) factName(group string) string {
+	return d.prefix + "_" + group
+}
+
+func (d *VersionDeriver) Targets() []*parser.ParserTarget {
+	var targets []*parser.ParserTarget
+	for _, group := range d.re.SubexpNames() {
+		if group == "" {
+			continue
+		}
+		targets = append(targets, &parser.ParserTarget{
+			Name:       d.factName(group),
+			TargetType: parser.TargetFact,
+			ValueType:  falba.ValueInt,
+		})
+	}
+	return targets
+}
+
+func (d *VersionDeriver) Derive(result *falba.Result) (*parser.ParseResult, error) {
+	ret := &parser.ParseResult{Facts: map[string]falba.Value{}}
+	val, ok := result.Facts[d.fact]
+	if !ok {
+		return ret, nil
+	}
+	if val.Type() != falba.ValueString {
+		return nil, fmt.Errorf("fact %q is %v, version deriver needs a string", d.fact, val.Type())
+	}
+	version := val.StringValue()
+
+	match := d.re.FindStringSubmatch(version)
+	if match == nil {
+		if d.errOnMismatch {
+			return nil, fmt.Errorf("%s = %q doesn't match version regexp %v", d.fact, version, d.re)
+		}
+		log.Printf("Deriver %s: skipping %s = %q, doesn't match %v", d.name, d.fact, version, d.re)
+		return ret, nil
+	}
+	for i, group := range d.re.SubexpNames() {
+		// Optional groups that didn't participate in the match just don't
+		// produce a fact.
+		if group == "" || match[i] == "" {
+			continue
+		}
+		v, err := falba.ParseValue(match[i], falba.ValueInt)
+		if err != nil {
+			return nil, fmt.Errorf("%s = %q: group %q: %v", d.fact, version, group, err)
+		}
+		ret.Facts[d.factName(group)] = v
+	}
+	return ret, nil
+}
+
+func (d *VersionDeriver) String() string {
+	return fmt.Sprintf("VersionDeriver{%q: %v -> %s_*}", d.fact, d.re, d.prefix)
+}
+
+var _ Deriver = &VersionDeriver{}
@@ -0,0 +1,121 @@
+package deriver_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bjackman/falba/internal/deriver"
+	"github.com/bjackman/falba/internal/falba"
+	"github.com/bjackman/falba/internal/parser"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVersionDeriver(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		config    string
+		fact      falba.Value
+		want      map[string]falba.Value
+		expectErr bool
+	}{
+		{
+			desc:   "full version",
+			config: `{"type": "version", "fact": "kernel_version"}`,
+			fact:   &falba.StringValue{Value: "6.6.3-rc2"},
+			want: map[string]falba.Value{
+				"kernel_major": &falba.IntValue{Value: 6},
+				"kernel_minor": &falba.IntValue{Value: 6},
+				"kernel_patch": &falba.IntValue{Value: 3},
+			},
+		},
+		{
+			desc:   "missing patch",
+			config: `{"type": "version", "fact": "kernel_version"}`,
+			fact:   &falba.StringValue{Value: "6.10"},
+			want: map[string]falba.Value{
+				"kernel_major": &falba.IntValue{Value: 6},
+				"kernel_minor": &falba.IntValue{Value: 10},
+			},
+		},
+		{
+			desc:   "custom regexp and prefix",
+			config: `{"type": "version", "fact": "kernel_version", "prefix": "k", "regexp": "-rc(?P<rc>\\d+)"}`,
+			fact:   &falba.StringValue{Value: "6.6.3-rc2"},
+			want: map[string]falba.Value{
+				"k_rc": &falba.IntValue{Value: 2},
+			},
+		},
+		{
+			desc:   "mismatch skipped",
+			config: `{"type": "version", "fact": "kernel_version"}`,
+			fact:   &falba.StringValue{Value: "dirty"},
+			want:   map[string]falba.Value{},
+		},
+		{
+			desc:   "missing fact",
+			config: `{"type": "version", "fact": "kernel_version"}`,
+			want:   map[string]falba.Value{},
+		},
+		{
+			desc:      "mismatch error",
+			config:    `{"type": "version", "fact": "kernel_version", "on_mismatch": "error"}`,
+			fact:      &falba.StringValue{Value: "dirty"},
+			expectErr: true,
+		},
+		{
+			desc:      "non-string fact",
+			config:    `{"type": "version", "fact": "kernel_version"}`,
+			fact:      &falba.IntValue{Value: 6},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d, err := deriver.FromConfig([]byte(tc.config), "test_deriver")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result := &falba.Result{TestName: "test", ResultID: "id", Facts: map[string]falba.Value{}}
+			if tc.fact != nil {
+				result.Facts["kernel_version"] = tc.fact
+			}
+			got, err := d.Derive(result)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Derive failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got.Facts); diff != "" {
+				t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVersionDeriverFromConfig_Invalid(t *testing.T) {
+	for _, config := range []string{
+		`{"type": "version"}`,
+		`{"type": "version", "fact": "v", "regexp": "(\\d+)"}`,
+		`{"type": "version", "fact": "v", "on_mismatch": "explode"}`,
+		`{"type": "version", "fact": "v", "bogus": 1}`,
+		`{"type": "version", "fact": "v", "prefix": "test", "regexp": "(?P<name>\\d+)"}`,
+		`{"type": "nonexistent"}`,
+	} {
+		if _, err := deriver.FromConfig([]byte(config), "test_deriver"); err == nil {
+			t.Errorf("Expected error for config %s, got nil", config)
+		}
+	}
+}
+
+func TestVersionDeriverFromConfig_ReservedName(t *testing.T) {
+	config := `{"type": "version", "fact": "v", "prefix": "test", "regexp": "(?P<name>\\d+)"}`
+	_, err := deriver.FromConfig([]byte(config), "test_deriver")
+	if !errors.Is(err, parser.ErrReservedName) {
+		t.Errorf("Expected ErrReservedName, got %v", err)
+	}
+}
@@ -2,10 +2,13 @@
 package falba
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"io"
 	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
@@ -20,6 +23,8 @@ var (
 	reservedFactNames = map[string]bool{
 		"test_name": true,
 		"result_id": true,
+		// Added to the results table by the db package.
+		"metric_samples": true,
 	}
 )
 
@@ -50,18 +55,30 @@ type Result struct {
 	// factors that are "environmental". That is, these are the "inputs" of the
 	// experiment.
 	Facts map[string]Value
+	// Parse failures are non-fatal, but they're recorded here so that you can
+	// find out about them. Nil if there weren't any.
+	ParseErrors []*ParseError
+}
+
+// ParseError records that a parser failed to parse one of a result's
+// artifacts.
+type ParseError struct {
+	Parser   string `json:"parser"`
+	Artifact string `json:"artifact"`
+	Message  string `json:"message"`
 }
 
 // ForResultsTable returns a representation of the Result that can be marshalled
-// as JSON or whatever, containing only the stuff that's once-per-result, i.e.
-// excluding metrics. Facts are flattened as direct columns.
+// as JSON, containing only the stuff that's once-per-result, i.e. excluding
+// metrics. Facts are flattened as direct columns. They're left as Values so
+// that they're marshalled with Value.MarshalJSON.
 func (r *Result) ForResultsTable() map[string]any {
 	result := map[string]any{
 		"test_name": r.TestName,
 		"result_id": r.ResultID,
 	}
 	for name, val := range r.Facts {
-		result[name] = ValueValue(val)
+		result[name] = val
 	}
 	return result
 }
@@ -84,7 +101,21 @@ func (r *Result) ForMetricsTable() []map[string]any {
 			obj["unit_short_name"] = ""
 			obj["unit_family"] = ""
 		}
-		obj[metric.Value.Type().MetricsColumn()] = ValueValue(metric.Value)
+		// Always have a map even if it's empty, so that you don't need to
+		// worry about NULLs when querying it.
+		labels := metric.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		obj["labels"] = labels
+		if metric.Repetition != nil {
+			obj["repetition"] = *metric.Repetition
+		}
+		if metric.Source != nil {
+			obj["parser"] = metric.Source.Parser
+			obj["artifact"] = metric.Source.Artifact
+		}
+		obj[metric.Value.Type().MetricsColumn()] = metric.Value
 		ret = append(ret, obj)
 	}
 	return ret
@@ -96,13 +127,19 @@ func (r *Result) ResultDir(dbRoot string) string {
 
 // An Artifact is a file in the database, associated with a Result.
 type Artifact struct {
-	// The name is just the path relative to the artifacts dir.
+	// The name is just the path relative to the artifacts dir, with / as the
+	// separator regardless of OS.
 	Name string
 	Path string
 }
 
+// Open returns a reader for the artifact's content. The caller must close it.
+func (a *Artifact) Open() (io.ReadCloser, error) {
+	return os.Open(a.Path)
+}
+
 func (a *Artifact) Content() ([]byte, error) {
-	f, err := os.Open(a.Path)
+	f, err := a.Open()
 	if err != nil {
 		return nil, err
 	}
@@ -164,6 +201,61 @@ type Value interface {
 	FloatValue() float64
 	StringValue() string
 	BoolValue() bool
+	// Equal reports whether the values are the same. Ints and floats are
+	// compared numerically, other types are never equal to each other.
+	Equal(other Value) bool
+	// Compare returns -1, 0 or 1 if the value is less than, equal to or
+	// greater than the other one. Ints and floats can be compared with each
+	// other, false is less than true. Comparing other types is an error.
+	Compare(other Value) (int, error)
+	// Values are marshalled so that the type survives the trip through JSON
+	// into DuckDB, see the MarshalJSON methods.
+	json.Marshaler
+}
+
+func isNumeric(t ValueType) bool {
+	return t == ValueInt || t == ValueFloat
+}
+
+// compareValues implements Value.Compare for all the types.
+func compareValues(a, b Value) (int, error) {
+	switch {
+	case b == nil:
+		return 0, fmt.Errorf("can't compare %v with nil", a.Type())
+	case a.Type() == ValueInt && b.Type() == ValueInt:
+		// Don't go via float64, that would lose precision for big ints.
+		return cmp.Compare(a.IntValue(), b.IntValue()), nil
+	case isNumeric(a.Type()) && isNumeric(b.Type()):
+		return cmp.Compare(numericValue(a), numericValue(b)), nil
+	case a.Type() != b.Type():
+		return 0, fmt.Errorf("can't compare %v with %v", a.Type(), b.Type())
+	case a.Type() == ValueString:
+		return cmp.Compare(a.StringValue(), b.StringValue()), nil
+	case a.Type() == ValueBool:
+		return cmp.Compare(boolInt(a.BoolValue()), boolInt(b.BoolValue())), nil
+	default:
+		return 0, fmt.Errorf("can't compare values of type %v", a.Type())
+	}
+}
+
+// Returns the value of an int or float as a float64.
+func numericValue(v Value) float64 {
+	if v.Type() == ValueInt {
+		return float64(v.IntValue())
+	}
+	return v.FloatValue()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func equalValues(a, b Value) bool {
+	c, err := compareValues(a, b)
+	return err == nil && c == 0
 }
 
 type IntValue struct {
@@ -190,6 +282,20 @@ func (v *IntValue) BoolValue() bool {
 	return false
 }
 
+func (v *IntValue) Equal(other Value) bool {
+	return equalValues(v, other)
+}
+
+func (v *IntValue) Compare(other Value) (int, error) {
+	return compareValues(v, other)
+}
+
+// MarshalJSON writes the exact integer, even where a float64 can't represent
+// it.
+func (v *IntValue) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, v.Value, 10), nil
+}
+
 type FloatValue struct {
 	Value float64
 }
@@ -214,6 +320,33 @@ func (v *FloatValue) BoolValue() bool {
 	return false
 }
 
+func (v *FloatValue) Equal(other Value) bool {
+	return equalValues(v, other)
+}
+
+func (v *FloatValue) Compare(other Value) (int, error) {
+	return compareValues(v, other)
+}
+
+// MarshalJSON always writes something that looks like a float, so 5 is "5.0".
+// JSON doesn't have NaN or infinities, so those are written as the strings
+// "NaN", "Infinity" and "-Infinity", which DuckDB casts back to DOUBLE.
+func (v *FloatValue) MarshalJSON() ([]byte, error) {
+	switch {
+	case math.IsNaN(v.Value):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v.Value, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(v.Value, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	b := strconv.AppendFloat(nil, v.Value, 'g', -1, 64)
+	if !bytes.ContainsAny(b, ".e") {
+		b = append(b, ".0"...)
+	}
+	return b, nil
+}
+
 type StringValue struct {
 	Value string
 }
@@ -238,6 +371,18 @@ func (v *StringValue) BoolValue() bool {
 	return false
 }
 
+func (v *StringValue) Equal(other Value) bool {
+	return equalValues(v, other)
+}
+
+func (v *StringValue) Compare(other Value) (int, error) {
+	return compareValues(v, other)
+}
+
+func (v *StringValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Value)
+}
+
 type BoolValue struct {
 	Value bool
 }
@@ -262,6 +407,18 @@ func (v *BoolValue) BoolValue() bool {
 	return v.Value
 }
 
+func (v *BoolValue) Equal(other Value) bool {
+	return equalValues(v, other)
+}
+
+func (v *BoolValue) Compare(other Value) (int, error) {
+	return compareValues(v, other)
+}
+
+func (v *BoolValue) MarshalJSON() ([]byte, error) {
+	return strconv.AppendBool(nil, v.Value), nil
+}
+
 func ValueValue(v Value) any {
 	switch v.Type() {
 	case ValueInt:
@@ -297,7 +454,15 @@ func ValueFromAny(a any) (Value, error) {
 func ParseValue(s string, t ValueType) (Value, error) {
 	switch t {
 	case ValueInt:
-		i, err := strconv.ParseInt(s, 0, 64)
+		// Base 0 lets you write hex etc, but it also means a leading zero makes
+		// it octal, which is never what you want for a benchmark result like
+		// "010". So only use it if there's an explicit prefix.
+		base := 10
+		digits := strings.TrimLeft(s, "+-")
+		if len(digits) > 1 && digits[0] == '0' && strings.ContainsRune("xXbBoO", rune(digits[1])) {
+			base = 0
+		}
+		i, err := strconv.ParseInt(s, base, 64)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't parse %s as int: %v", s, err)
 		}
@@ -359,9 +524,52 @@ func ParseValueFromJSONValue(raw json.RawMessage, t ValueType) (Value, error) {
 type Metric struct {
 	Name string
 	Unit *unit.Unit
+	// Optional extra dimensions, for when a benchmark produces the same
+	// metric for several things (e.g. latency for reads and writes).
+	Labels map[string]string
+	// When a result contains several runs of the benchmark, which one this
+	// sample came from. Nil if the result doesn't distinguish them.
+	Repetition *int64
+	// Where the sample came from. Only set if that was asked for when reading
+	// the DB, see db.ReadOptions.
+	Source *MetricSource
 	Value
 }
 
+// MetricSource says what produced a metric sample.
+type MetricSource struct {
+	// Name of the parser, or of the deriver for derived metrics.
+	Parser string
+	// Empty for derived metrics.
+	Artifact string
+}
+
+// FactType describes the type of a fact.
+type FactType struct {
+	Type ValueType
+	// If non-empty, the fact is only allowed to have one of these values.
+	Enum []Value
+}
+
+// ValueIn reports whether vals contains a value equal to v.
+func ValueIn(v Value, vals []Value) bool {
+	for _, val := range vals {
+		if val.Type() == v.Type() && val.Equal(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatValues formats values as a list for error messages.
+func FormatValues(vals []Value) string {
+	var strs []string
+	for _, v := range vals {
+		strs = append(strs, fmt.Sprintf("%v", ValueValue(v)))
+	}
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
 // MetricType describes the type of a metric, including its value type and unit.
 type MetricType struct {
 	Type ValueType
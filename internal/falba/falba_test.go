@@ -1,6 +1,8 @@
 package falba_test
 
 import (
+	"encoding/json"
+	"math"
 	"strings"
 	"testing"
 
@@ -100,12 +102,23 @@ func TestParseValue(t *testing.T) {
 		{"int_negative", "-456", falba.ValueInt, &falba.IntValue{Value: -456}, false},
 		{"int_zero", "0", falba.ValueInt, &falba.IntValue{Value: 0}, false},
 		{"int_invalid", "abc", falba.ValueInt, nil, true},
+		{"int_plus", "+7", falba.ValueInt, &falba.IntValue{Value: 7}, false},
+		{"int_leading_zero", "010", falba.ValueInt, &falba.IntValue{Value: 10}, false},
+		{"int_negative_leading_zero", "-007", falba.ValueInt, &falba.IntValue{Value: -7}, false},
+		{"int_hex", "0x10", falba.ValueInt, &falba.IntValue{Value: 16}, false},
+		{"int_negative_hex", "-0x10", falba.ValueInt, &falba.IntValue{Value: -16}, false},
+		{"int_scientific", "1e3", falba.ValueInt, nil, true},
 
 		// Float tests
 		{"float_simple", "123.45", falba.ValueFloat, &falba.FloatValue{Value: 123.45}, false},
 		{"float_negative", "-0.5", falba.ValueFloat, &falba.FloatValue{Value: -0.5}, false},
 		{"float_integer", "789", falba.ValueFloat, &falba.FloatValue{Value: 789}, false},
 		{"float_invalid", "def", falba.ValueFloat, nil, true},
+		{"float_scientific", "1.2e-9", falba.ValueFloat, &falba.FloatValue{Value: 1.2e-9}, false},
+		{"float_scientific_upper", "-1.5E+3", falba.ValueFloat, &falba.FloatValue{Value: -1500}, false},
+		{"float_plus", "+2.5", falba.ValueFloat, &falba.FloatValue{Value: 2.5}, false},
+		{"float_no_leading_digit", "-.5", falba.ValueFloat, &falba.FloatValue{Value: -0.5}, false},
+		{"float_negative_inf", "-Inf", falba.ValueFloat, &falba.FloatValue{Value: math.Inf(-1)}, false},
 
 		// String tests
 		{"string_simple", "hello", falba.ValueString, &falba.StringValue{Value: "hello"}, false},
@@ -124,7 +137,7 @@ func TestParseValue(t *testing.T) {
 				if err != nil {
 					t.Errorf("ParseValue(%q, %v) unexpected error: %v", tc.inputStr, tc.inputType, err)
 				}
-				if !equalValue(got, tc.expected) {
+				if got.Type() != tc.expected.Type() || !got.Equal(tc.expected) {
 					t.Errorf("ParseValue(%q, %v) = %#v, want %#v", tc.inputStr, tc.inputType, got, tc.expected)
 				}
 			}
@@ -132,28 +145,57 @@ func TestParseValue(t *testing.T) {
 	}
 }
 
-// equalValue is a helper to compare falba.Value interfaces.
-func equalValue(v1, v2 falba.Value) bool {
-	if v1 == nil && v2 == nil {
-		return true
-	}
-	if v1 == nil || v2 == nil {
-		return false
-	}
-	if v1.Type() != v2.Type() {
-		return false
-	}
-	switch v1.Type() {
-	case falba.ValueInt:
-		return v1.IntValue() == v2.IntValue()
-	case falba.ValueFloat:
-		return v1.FloatValue() == v2.FloatValue()
-	case falba.ValueString:
-		return v1.StringValue() == v2.StringValue()
-	case falba.ValueBool:
-		return v1.BoolValue() == v2.BoolValue()
-	default:
-		return false
+func TestValueCompare(t *testing.T) {
+	testCases := []struct {
+		name    string
+		a, b    falba.Value
+		want    int
+		wantErr bool
+	}{
+		{"int-less", &falba.IntValue{Value: 1}, &falba.IntValue{Value: 2}, -1, false},
+		{"int-equal", &falba.IntValue{Value: 2}, &falba.IntValue{Value: 2}, 0, false},
+		// These are only different at full int64 precision.
+		{"int-big", &falba.IntValue{Value: 1<<62 + 1}, &falba.IntValue{Value: 1 << 62}, 1, false},
+		{"float-greater", &falba.FloatValue{Value: 2.5}, &falba.FloatValue{Value: -1}, 1, false},
+		{"int-float-equal", &falba.IntValue{Value: 2}, &falba.FloatValue{Value: 2}, 0, false},
+		{"float-int-less", &falba.FloatValue{Value: 1.5}, &falba.IntValue{Value: 2}, -1, false},
+		{"string-less", &falba.StringValue{Value: "abc"}, &falba.StringValue{Value: "abd"}, -1, false},
+		{"string-equal", &falba.StringValue{Value: "x"}, &falba.StringValue{Value: "x"}, 0, false},
+		{"bool-false-less", &falba.BoolValue{Value: false}, &falba.BoolValue{Value: true}, -1, false},
+		{"bool-equal", &falba.BoolValue{Value: true}, &falba.BoolValue{Value: true}, 0, false},
+		{"string-int", &falba.StringValue{Value: "1"}, &falba.IntValue{Value: 1}, 0, true},
+		{"bool-int", &falba.BoolValue{Value: true}, &falba.IntValue{Value: 1}, 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.a.Compare(tc.b)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Compare(%v, %v) = %d, want error", tc.a, tc.b, got)
+				}
+				if tc.a.Equal(tc.b) {
+					t.Errorf("Equal(%v, %v) = true for incomparable values", tc.a, tc.b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compare(%v, %v) failed: %v", tc.a, tc.b, err)
+			}
+			if got != tc.want {
+				t.Errorf("Compare(%v, %v) = %d, want %d", tc.a, tc.b, got, tc.want)
+			}
+			if eq := tc.a.Equal(tc.b); eq != (tc.want == 0) {
+				t.Errorf("Equal(%v, %v) = %v, want %v", tc.a, tc.b, eq, tc.want == 0)
+			}
+			// Check it's antisymmetric.
+			if got, err := tc.b.Compare(tc.a); err != nil || got != -tc.want {
+				t.Errorf("Compare(%v, %v) = %d, %v, want %d", tc.b, tc.a, got, err, -tc.want)
+			}
+		})
+	}
+
+	if (&falba.IntValue{Value: 1}).Equal(nil) {
+		t.Errorf("Equal(nil) = true")
 	}
 }
 
@@ -224,3 +266,30 @@ func TestValueInterfaceMethods(t *testing.T) {
 		t.Error("StringValue.BoolValue() returned true, want false")
 	}
 }
+
+func TestValueMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		val  falba.Value
+		want string
+	}{
+		{val: &falba.IntValue{Value: 42}, want: `42`},
+		{val: &falba.IntValue{Value: math.MaxInt64}, want: `9223372036854775807`},
+		{val: &falba.FloatValue{Value: 5}, want: `5.0`},
+		{val: &falba.FloatValue{Value: -1.5}, want: `-1.5`},
+		{val: &falba.FloatValue{Value: 1e21}, want: `1e+21`},
+		{val: &falba.FloatValue{Value: math.NaN()}, want: `"NaN"`},
+		{val: &falba.FloatValue{Value: math.Inf(-1)}, want: `"-Infinity"`},
+		{val: &falba.StringValue{Value: `say "hi"`}, want: `"say \"hi\""`},
+		{val: &falba.BoolValue{Value: true}, want: `true`},
+	}
+	for _, tc := range testCases {
+		got, err := json.Marshal(tc.val)
+		if err != nil {
+			t.Errorf("Marshalling %v %v failed: %v", tc.val.Type(), falba.ValueValue(tc.val), err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("Marshalling %v %v gave %s, want %s", tc.val.Type(), falba.ValueValue(tc.val), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// ArtifactNameExtractor takes the value from the name of the artifact, e.g. 4
+// from throughput_4threads.txt. It never reads the content.
+type ArtifactNameExtractor struct {
+	// Must have exactly one capture group, that's the value.
+	re         *regexp.Regexp
+	resultType falba.ValueType
+	// Applied to the captured text before parsing it.
+	Format NumberFormat
+}
+
+func NewArtifactNameExtractor(pattern string, resultType falba.ValueType) (*ArtifactNameExtractor, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compiling regexp %q: %v", pattern, err)
+	}
+	if re.NumSubexp() != 1 {
+		return nil, fmt.Errorf("regexp %q has %d capture groups, want exactly 1", pattern, re.NumSubexp())
+	}
+	return &ArtifactNameExtractor{re: re, resultType: resultType}, nil
+}
+
+func (e *ArtifactNameExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, error) {
+	match := e.re.FindStringSubmatchIndex(artifact.Name)
+	if match == nil || match[2] < 0 {
+		return nil, fmt.Errorf("%w: artifact name %q doesn't match %v", ErrParseFailure, artifact.Name, e.re)
+	}
+	val, err := e.Format.parseValue(artifact.Name[match[2]:match[3]], e.resultType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from artifact name %q: %v", ErrParseFailure, artifact.Name, err)
+	}
+	return []falba.Value{val}, nil
+}
+
+func (e *ArtifactNameExtractor) String() string {
+	return fmt.Sprintf("ArtifactNameExtractor{%v, %v}", e.re, e.resultType)
+}
+
+var _ Extractor = &ArtifactNameExtractor{}
+
+// Config for a parser that reads the value out of the artifact name with the
+// capture group in 'artifact_regexp'.
+type ArtifactNameConfig struct {
+	BaseParserConfig
+	NumberFormatConfig
+}
+
+func (c *ArtifactNameConfig) ValidateFields() error {
+	if err := c.BaseParserConfig.ValidateFields(); err != nil {
+		return err
+	}
+	if c.ArtifactRegexp == "" {
+		return fmt.Errorf("missing/empty 'artifact_regexp' field, it needs a capture group for the value")
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/bjackman/falba/internal/falba"
 )
@@ -24,5 +25,33 @@ func (e *ArtifactPresenceExtractor) String() string {
 
 type ArtifactPresenceConfig struct {
 	BaseParserConfig
-	Result any `json:"result":`
+	Result any `json:"result"`
+}
+
+// artifactPresenceResult converts the 'result' from the config into a value of
+// the target's type. Strings get parsed for non-string targets (so "true" works
+// for a bool) and numbers and bools get stringified for string targets, like
+// the jsonpath parser's coerce option. Anything else that doesn't match is an
+// error.
+func artifactPresenceResult(raw any, valueType falba.ValueType) (falba.Value, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("missing")
+	}
+	raw, err := coerceJSONValue(raw, valueType)
+	if err != nil {
+		return nil, err
+	}
+	// JSON numbers always decode as float64, so whole numbers need squashing
+	// for int targets.
+	if f, ok := raw.(float64); ok && valueType == falba.ValueInt && f == math.Trunc(f) {
+		raw = int64(f)
+	}
+	result, err := falba.ValueFromAny(raw)
+	if err != nil {
+		return nil, err
+	}
+	if result.Type() != valueType {
+		return nil, fmt.Errorf("%v is %v, doesn't match target type %v", raw, result.Type(), valueType)
+	}
+	return result, nil
 }
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// How much of an artifact we read to guess its content type.
+const sniffBytes = 4096
+
+// Content types that can be used for the 'content_type' parser field.
+const (
+	ContentTypeJSON     = "json"
+	ContentTypeKeyValue = "keyvalue"
+	ContentTypeCSV      = "csv"
+)
+
+var contentTypeSniffers = map[string]func(prefix []byte, truncated bool) bool{
+	ContentTypeJSON:     looksLikeJSON,
+	ContentTypeKeyValue: looksLikeKeyValue,
+	ContentTypeCSV:      looksLikeCSV,
+}
+
+func validateContentType(contentType string) error {
+	if _, ok := contentTypeSniffers[contentType]; !ok {
+		return fmt.Errorf("unknown content_type %q, expect %q, %q or %q",
+			contentType, ContentTypeJSON, ContentTypeKeyValue, ContentTypeCSV)
+	}
+	return nil
+}
+
+// sniffContentType reports whether the start of the artifact looks like the
+// given content type. This is only a guess, it doesn't look at the whole file.
+func sniffContentType(artifact *falba.Artifact, contentType string) (bool, error) {
+	sniff, ok := contentTypeSniffers[contentType]
+	if !ok {
+		return false, validateContentType(contentType)
+	}
+	f, err := artifact.Open()
+	if err != nil {
+		return false, fmt.Errorf("opening artifact: %v", err)
+	}
+	defer f.Close()
+	// Read one byte more than we look at so we know if there was more data.
+	buf, err := io.ReadAll(io.LimitReader(f, sniffBytes+1))
+	if err != nil {
+		return false, fmt.Errorf("reading artifact: %v", err)
+	}
+	truncated := len(buf) > sniffBytes
+	if truncated {
+		buf = buf[:sniffBytes]
+	}
+	return sniff(buf, truncated), nil
+}
+
+// completeLines returns the lines of the prefix, dropping the last one if it
+// might have been cut off.
+func completeLines(prefix []byte, truncated bool) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(prefix))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if truncated && len(lines) > 0 && !bytes.HasSuffix(prefix, []byte("\n")) {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func looksLikeJSON(prefix []byte, truncated bool) bool {
+	trimmed := bytes.TrimSpace(prefix)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(prefix))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			// If we only have the start of the file, running out of data
+			// is fine, it's only a syntax error that tells us it's not JSON.
+			return truncated && errors.Is(err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+var keyValueLineRE = regexp.MustCompile(`^\s*(export\s+)?[A-Za-z_][A-Za-z0-9_]*=`)
+
+func looksLikeKeyValue(prefix []byte, truncated bool) bool {
+	var found bool
+	for _, line := range completeLines(prefix, truncated) {
+		trimmed := bytes.TrimSpace([]byte(line))
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		if !keyValueLineRE.MatchString(line) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// A CSV needs at least two rows (presumably a header and some data) with the
+// same number of fields, and more than one field, otherwise any text file
+// would look like a CSV.
+func looksLikeCSV(prefix []byte, truncated bool) bool {
+	var buf bytes.Buffer
+	for _, line := range completeLines(prefix, truncated) {
+		buf.WriteString(line + "\n")
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) < 2 {
+		return false
+	}
+	return len(records[0]) > 1
+}
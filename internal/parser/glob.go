@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// globToRegexp translates a glob into an equivalent anchored regexp. The
+// syntax is the same as path.Match, plus "**" which matches any number of
+// path components (including zero, so "**/foo.json" matches "foo.json" too).
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				i++
+				if strings.HasPrefix(glob[i+1:], "/") {
+					// "**/" can match nothing at all.
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+				j++
+			}
+			// A ']' straight after the '[' is part of the class.
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			for j < len(glob) && glob[j] != ']' {
+				j++
+			}
+			if j >= len(glob) {
+				return "", fmt.Errorf("unterminated '[' in glob %q", glob)
+			}
+			class := glob[i+1 : j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			// Backslash escapes work the same way in regexp classes.
+			b.WriteString("[" + class + "]")
+			i = j
+		case '\\':
+			if i+1 >= len(glob) {
+				return "", fmt.Errorf("trailing '\\' in glob %q", glob)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
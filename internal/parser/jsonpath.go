@@ -1,35 +1,251 @@
 package parser
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/bjackman/falba/internal/falba"
 )
 
+// DefaultMaxJSONBytes is the default limit on the (decompressed) size of a
+// JSON artifact. Artifacts bigger than this are a parse failure instead of
+// eating all the memory.
+const DefaultMaxJSONBytes = 1 << 30
+
+// JSONPathExtractor evaluates a JSONPath expression against a JSON artifact.
+// The artifact can be gzip-compressed, this is detected from its content.
+//
+// In general the whole artifact gets decoded into memory. But if the
+// expression is just a chain of object keys like $.foo.bar, it's evaluated by
+// streaming through the JSON, so only the value it points to gets decoded.
 type JSONPathExtractor struct {
 	resultType falba.ValueType
 	expression string
+	// Set if the expression is simple enough to be evaluated by streaming.
+	streamKeys []string
+	// Limit on the decompressed size of the artifact, or 0 for
+	// DefaultMaxJSONBytes, or negative for no limit.
+	MaxBytes int64
+	// If set, the decoded artifact is shared with other extractors, see
+	// jsonDocCache. Streaming isn't used in that case.
+	doc *jsonDocCache
+	// See coerceJSONValue.
+	Coerce bool
 }
 
+// Matches JSONPath expressions that are just a chain of object keys.
+var simpleJSONPathRE = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+
 func NewJSONPathExtractor(expr string, resultType falba.ValueType) (*JSONPathExtractor, error) {
+	var streamKeys []string
+	if simpleJSONPathRE.MatchString(expr) {
+		streamKeys = strings.Split(expr, ".")[1:]
+	}
 	return &JSONPathExtractor{
 		expression: expr,
 		resultType: resultType,
+		streamKeys: streamKeys,
 	}, nil
 }
 
-func (e *JSONPathExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, error) {
-	content, err := artifact.Content()
+// maxBytesReader is like io.LimitReader but reading past the limit is an error
+// instead of an EOF.
+type maxBytesReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		// Check if there's actually anything left.
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("content exceeds limit of %d bytes", r.limit)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// maybeGunzip returns a reader that decompresses r if its content starts with
+// the gzip magic number, otherwise it just returns the content as-is.
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// skipJSONValue consumes the next value from the decoder without keeping it
+// around.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// streamJSONPath evaluates a JSONPath that's a chain of object keys by
+// streaming through the JSON, only decoding the value the path points to.
+func (e *JSONPathExtractor) streamJSONPath(decoder *json.Decoder) (any, error) {
+	for i, key := range e.streamKeys {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading JSON: %v", ErrParseFailure, err)
+		}
+		if tok != json.Delim('{') {
+			// Same as jsonpath.Get, this is treated as fatal.
+			// E.g. the artifact is an array at the top level.
+			return nil, fmt.Errorf("failed to evaluate JSONPath: %s is not an object",
+				strings.Join(append([]string{"$"}, e.streamKeys[:i]...), "."))
+		}
+		found := false
+		for decoder.More() {
+			tok, err := decoder.Token()
+			if err != nil {
+				return nil, fmt.Errorf("%w: reading JSON: %v", ErrParseFailure, err)
+			}
+			if tok == key {
+				found = true
+				break
+			}
+			if err := skipJSONValue(decoder); err != nil {
+				return nil, fmt.Errorf("%w: reading JSON: %v", ErrParseFailure, err)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("failed to evaluate JSONPath: unknown key %s", key)
+		}
+	}
+	var obj any
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("%w: unmarshalling from JSON: %v", ErrParseFailure, err)
+	}
+	// Read through the rest so that we still notice if the JSON is invalid.
+	// The decoder doesn't complain about unclosed objects at EOF, so we have to
+	// track that ourselves.
+	depth := len(e.streamKeys)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			if depth != 0 {
+				return nil, fmt.Errorf("%w: reading JSON: %v", ErrParseFailure, io.ErrUnexpectedEOF)
+			}
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading JSON: %v", ErrParseFailure, err)
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return normalizeJSONNumbers(obj), nil
+}
+
+// openJSON returns a decoder for the artifact's content, decompressing it and
+// enforcing MaxBytes. The caller has to close the returned closer.
+func (e *JSONPathExtractor) openJSON(artifact *falba.Artifact) (*json.Decoder, io.Closer, error) {
+	f, err := artifact.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting artifact content: %v", err)
+	}
+	r, err := maybeGunzip(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: decompressing: %v", ErrParseFailure, err)
+	}
+	maxBytes := e.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxJSONBytes
+	}
+	if maxBytes > 0 {
+		r = &maxBytesReader{r: r, remaining: maxBytes, limit: maxBytes}
+	}
+
+	// Use json.Number so that large integers (e.g. nanosecond timestamps)
+	// don't get rounded by a trip through float64.
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder, f, nil
+}
+
+// decodeJSON decodes the whole artifact into memory.
+func (e *JSONPathExtractor) decodeJSON(artifact *falba.Artifact) (any, error) {
+	decoder, closer, err := e.openJSON(artifact)
 	if err != nil {
-		return nil, fmt.Errorf("getting artifact content: %v", err)
+		return nil, err
 	}
+	defer closer.Close()
 	var obj any
-	if err := json.Unmarshal(content, &obj); err != nil {
+	if err := decoder.Decode(&obj); err != nil {
 		return nil, fmt.Errorf("%w: unmarshalling from JSON: %v", ErrParseFailure, err)
 	}
+	return normalizeJSONNumbers(obj), nil
+}
 
+func (e *JSONPathExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, error) {
+	if e.doc != nil {
+		obj, err := e.doc.get(artifact, e.decodeJSON)
+		if err != nil {
+			return nil, err
+		}
+		return e.eval(obj)
+	}
+
+	if e.streamKeys != nil {
+		decoder, closer, err := e.openJSON(artifact)
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Close()
+		got, err := e.streamJSONPath(decoder)
+		if err != nil {
+			return nil, err
+		}
+		return evalJSONPathResult(got, e.resultType, e.Coerce, "JSONPath")
+	}
+
+	obj, err := e.decodeJSON(artifact)
+	if err != nil {
+		return nil, err
+	}
+	return e.eval(obj)
+}
+
+// eval evaluates the expression against a decoded JSON object.
+func (e *JSONPathExtractor) eval(obj any) ([]falba.Value, error) {
 	// We'd prefer to pre-compile the JSONPath expression but then evaluating it
 	// gies you a gval.Evaluable which I can't be bothered to deal with, I don't
 	// know how to get non-scalar objects out of it. So instead we just evaluate
@@ -42,10 +258,77 @@ func (e *JSONPathExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, er
 		return nil, fmt.Errorf("failed to evaluate JSONPath: %v", err)
 	}
 
-	return evalJSONPathResult(got, e.resultType, "JSONPath")
+	return evalJSONPathResult(got, e.resultType, e.Coerce, "JSONPath")
+}
+
+// Integers with a magnitude above this can't all be represented exactly as a
+// float64.
+const maxExactFloatInt = 1 << 53
+
+// normalizeJSONNumbers replaces the json.Number values in an object decoded
+// with UseNumber. Integers too big to survive a float64 become an int64,
+// everything else becomes a float64 just like json.Unmarshal would produce.
+// We stick to float64 where possible because the JSONPath library doesn't
+// consider int64(2) equal to the literal 2 in filter expressions.
+func normalizeJSONNumbers(obj any) any {
+	switch obj := obj.(type) {
+	case map[string]any:
+		for k, v := range obj {
+			obj[k] = normalizeJSONNumbers(v)
+		}
+		return obj
+	case []any:
+		for i, v := range obj {
+			obj[i] = normalizeJSONNumbers(v)
+		}
+		return obj
+	case json.Number:
+		if i, err := obj.Int64(); err == nil && (i > maxExactFloatInt || i < -maxExactFloatInt) {
+			return i
+		}
+		// This can only fail for numbers out of range for float64, in which
+		// case we get ±Inf, which seems fine.
+		f, _ := obj.Float64()
+		return f
+	default:
+		return obj
+	}
+}
+
+// coerceJSONValue converts a value decoded from JSON or YAML to suit the
+// resultType, where that makes sense. Numbers and bools get stringified for
+// string targets, and strings get parsed for the others. Other values are
+// returned unchanged, so evalJSONPathResult rejects them as usual.
+func coerceJSONValue(rawVal any, resultType falba.ValueType) (any, error) {
+	if resultType == falba.ValueString {
+		switch v := rawVal.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case int:
+			return strconv.Itoa(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return rawVal, nil
+	}
+	s, ok := rawVal.(string)
+	if !ok {
+		return rawVal, nil
+	}
+	val, err := falba.ParseValue(strings.TrimSpace(s), resultType)
+	if err != nil {
+		return nil, err
+	}
+	return falba.ValueValue(val), nil
 }
 
-func evalJSONPathResult(got any, resultType falba.ValueType, name string) ([]falba.Value, error) {
+// evalJSONPathResult converts the result of evaluating a JSONPath into values
+// of resultType. By default this is strict about the JSON types (apart from
+// ints vs floats, which JSON doesn't distinguish), with coerce it converts
+// between strings and other types too.
+func evalJSONPathResult(got any, resultType falba.ValueType, coerce bool, name string) ([]falba.Value, error) {
 	var rawValues []any
 	switch got := got.(type) {
 	case []any:
@@ -53,9 +336,21 @@ func evalJSONPathResult(got any, resultType falba.ValueType, name string) ([]fal
 	default:
 		rawValues = []any{got}
 	}
+	// E.g. $[*] on an empty array. The extractor isn't allowed to return no
+	// values.
+	if len(rawValues) == 0 {
+		return nil, fmt.Errorf("%w: %s matched nothing", ErrParseFailure, name)
+	}
 
 	var result []falba.Value
 	for _, rawVal := range rawValues {
+		if coerce {
+			var err error
+			rawVal, err = coerceJSONValue(rawVal, resultType)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrParseFailure, name, err)
+			}
+		}
 		var val falba.Value
 		switch resultType {
 		case falba.ValueInt:
@@ -66,6 +361,8 @@ func evalJSONPathResult(got any, resultType falba.ValueType, name string) ([]fal
 				val = &falba.IntValue{Value: int64(v)}
 			case int:
 				val = &falba.IntValue{Value: int64(v)}
+			case int64:
+				val = &falba.IntValue{Value: v}
 			default:
 				return nil, fmt.Errorf("%w: %s returned %T, wanted numeric", ErrParseFailure, name, rawVal)
 			}
@@ -76,11 +373,17 @@ func evalJSONPathResult(got any, resultType falba.ValueType, name string) ([]fal
 			}
 			val = &falba.StringValue{Value: v}
 		case falba.ValueFloat:
-			v, ok := rawVal.(float64)
-			if !ok {
+			switch v := rawVal.(type) {
+			case float64:
+				val = &falba.FloatValue{Value: v}
+			// YAML decodes numbers without a decimal point as int.
+			case int:
+				val = &falba.FloatValue{Value: float64(v)}
+			case int64:
+				val = &falba.FloatValue{Value: float64(v)}
+			default:
 				return nil, fmt.Errorf("%w: %s returned %T, wanted float64", ErrParseFailure, name, rawVal)
 			}
-			val = &falba.FloatValue{Value: v}
 		case falba.ValueBool:
 			v, ok := rawVal.(bool)
 			if !ok {
@@ -102,6 +405,10 @@ func (p *JSONPathExtractor) String() string {
 type JSONPPathConfig struct {
 	BaseParserConfig
 	JSONPath string `json:"jsonpath"`
+	// See JSONPathExtractor.MaxBytes.
+	MaxBytes int64 `json:"max_bytes"`
+	// Convert between strings and other types, see coerceJSONValue.
+	Coerce bool `json:"coerce"`
 }
 
 func (c *JSONPPathConfig) ValidateFields() error {
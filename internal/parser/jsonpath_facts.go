@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// jsonDocCache remembers the last artifact that was decoded, so that several
+// JSONPathExtractors reading the same artifact one after the other only decode
+// it once.
+type jsonDocCache struct {
+	mu   sync.Mutex
+	path string
+	obj  any
+	err  error
+}
+
+func (c *jsonDocCache) get(artifact *falba.Artifact, decode func(*falba.Artifact) (any, error)) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path != artifact.Path {
+		c.obj, c.err = decode(artifact)
+		c.path = artifact.Path
+	}
+	return c.obj, c.err
+}
+
+// Config for a parser that reads several facts out of one JSON artifact.
+type JSONPathFactsConfig struct {
+	Type           string `json:"type"`
+	ArtifactRegexp string `json:"artifact_regexp"`
+	ArtifactGlob   string `json:"artifact_glob"`
+	Exact          bool   `json:"exact"`
+	ContentType    string `json:"content_type"`
+	// See JSONPathExtractor.MaxBytes.
+	MaxBytes int64 `json:"max_bytes"`
+	// Applies to all the facts, see coerceJSONValue.
+	Coerce bool `json:"coerce"`
+	// Keyed by fact name.
+	Facts map[string]struct {
+		JSONPath string `json:"jsonpath"`
+		Type     string `json:"type"`
+		// Same as for the fact of a normal parser.
+		Default json.RawMessage `json:"default,omitempty"`
+		Enum    json.RawMessage `json:"enum,omitempty"`
+	} `json:"facts"`
+}
+
+// Turns a jsonpath_facts config into a jsonpath parser for each fact. They
+// share a jsonDocCache, and since they're next to each other in the returned
+// slice they get run one after the other on each artifact, so it's only
+// decoded once. The parsers are named like "$name.$fact".
+func jsonPathFactsFromConfig(rawConfig json.RawMessage, name string) ([]*Parser, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+	decoder.DisallowUnknownFields()
+	var config JSONPathFactsConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("decoding jsonpath_facts parser config: %v", err)
+	}
+	if len(config.Facts) == 0 {
+		return nil, fmt.Errorf("invalid \"jsonpath_facts\" parser config: missing/empty 'facts' field")
+	}
+
+	doc := &jsonDocCache{}
+	var parsers []*Parser
+	for _, factName := range slices.Sorted(maps.Keys(config.Facts)) {
+		fact := config.Facts[factName]
+		// Everything else is the same as a normal jsonpath parser, so just
+		// build the config for that and let FromConfig check it.
+		factConfig := map[string]any{"name": factName, "type": fact.Type}
+		if fact.Default != nil {
+			factConfig["default"] = fact.Default
+		}
+		if fact.Enum != nil {
+			factConfig["enum"] = fact.Enum
+		}
+		parserConfig := map[string]any{
+			"type":      "jsonpath",
+			"exact":     config.Exact,
+			"max_bytes": config.MaxBytes,
+			"coerce":    config.Coerce,
+			"jsonpath":  fact.JSONPath,
+			"fact":      factConfig,
+		}
+		for k, v := range map[string]string{
+			"artifact_regexp": config.ArtifactRegexp,
+			"artifact_glob":   config.ArtifactGlob,
+			"content_type":    config.ContentType,
+		} {
+			if v != "" {
+				parserConfig[k] = v
+			}
+		}
+		raw, err := json.Marshal(parserConfig)
+		if err != nil {
+			return nil, fmt.Errorf("fact %q: %v", factName, err)
+		}
+		p, err := FromConfig(raw, name+"."+factName)
+		if err != nil {
+			return nil, fmt.Errorf("fact %q: %v", factName, err)
+		}
+		p.Extractor.(*JSONPathExtractor).doc = doc
+		parsers = append(parsers, p)
+	}
+	return parsers, nil
+}
@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// NumberFormat describes how to get a number out of text like "95%" or
+// "12.3ms", for the extractors that parse text. The zero value just parses
+// the text as-is.
+type NumberFormat struct {
+	// Removed from the end of the text (after surrounding whitespace) if it's
+	// there, e.g. "%" or "ms". Whitespace between the number and the suffix is
+	// allowed.
+	StripSuffix string
+	// If non-zero, the value is multiplied by this, e.g. 0.01 to turn a
+	// percentage into a fraction or 1000000 to turn ms into ns. For int
+	// targets the result is rounded to the nearest int.
+	Scale float64
+}
+
+// parseValue is like falba.ParseValue but applies the NumberFormat first. With
+// the zero NumberFormat it's exactly the same.
+func (f *NumberFormat) parseValue(s string, t falba.ValueType) (falba.Value, error) {
+	if f.StripSuffix != "" {
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), f.StripSuffix))
+	}
+	if f.Scale == 0 {
+		return falba.ParseValue(s, t)
+	}
+	// Scaling an int can make it fractional (and the text might have been
+	// fractional in the first place, like "1.5ms"), so go via a float.
+	v, err := falba.ParseValue(s, falba.ValueFloat)
+	if err != nil {
+		return nil, err
+	}
+	scaled := v.FloatValue() * f.Scale
+	if t == falba.ValueInt {
+		if math.IsInf(scaled, 0) || math.Abs(scaled) > math.MaxInt64 {
+			return nil, fmt.Errorf("%v scaled by %v doesn't fit in an int", s, f.Scale)
+		}
+		return &falba.IntValue{Value: int64(math.Round(scaled))}, nil
+	}
+	return &falba.FloatValue{Value: scaled}, nil
+}
+
+// NumberFormatConfig is the config for a NumberFormat, for embedding in the
+// configs of parsers that read text.
+type NumberFormatConfig struct {
+	StripSuffix string   `json:"strip_suffix"`
+	Scale       *float64 `json:"scale"`
+}
+
+func (c *NumberFormatConfig) numberFormat(target *ParserTarget) (NumberFormat, error) {
+	if c.StripSuffix == "" && c.Scale == nil {
+		return NumberFormat{}, nil
+	}
+	if target.ValueType != falba.ValueInt && target.ValueType != falba.ValueFloat {
+		return NumberFormat{}, fmt.Errorf("'strip_suffix' and 'scale' are only allowed for int and float values")
+	}
+	f := NumberFormat{StripSuffix: c.StripSuffix}
+	if c.Scale != nil {
+		if *c.Scale == 0 || math.IsNaN(*c.Scale) || math.IsInf(*c.Scale, 0) {
+			return NumberFormat{}, fmt.Errorf("invalid 'scale' %v", *c.Scale)
+		}
+		f.Scale = *c.Scale
+	}
+	return f, nil
+}
@@ -2,10 +2,12 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/bjackman/falba/internal/falba"
@@ -29,6 +31,10 @@ func emptyParseResult() *ParseResult {
 
 var ErrParseFailure = errors.New("parse failure")
 
+// ErrReservedName means the config tried to produce a fact with a name that
+// Falba uses itself, like test_name.
+var ErrReservedName = errors.New("reserved name")
+
 // An Extractor contains the core logic for reading a value from an artifact.
 type Extractor interface {
 	fmt.Stringer
@@ -51,6 +57,17 @@ type ParserTarget struct {
 	TargetType TargetType
 	ValueType  falba.ValueType
 	Unit       *unit.Unit
+	// Only for metrics, see falba.Metric.
+	Labels map[string]string
+	// Only for metrics. If set, it's matched against the artifact name and its
+	// capture group is the repetition, see falba.Metric.
+	RepetitionRE *regexp.Regexp
+	// Only for int and float metrics. If set, values outside this range are
+	// treated as parse failures, since they usually mean the parser is broken
+	// (or the unit is wrong).
+	Min, Max *float64
+	// Only for facts, see falba.FactType.
+	Enum []falba.Value
 }
 
 // A Parser is a bundle of logic for extracting information from Artifacts.
@@ -58,7 +75,10 @@ type Parser struct {
 	Name string
 	// Only produce metrics for artifacts matching this regexp.
 	ArtifactRE *regexp.Regexp
-	Target     *ParserTarget
+	// If non-empty, additionally only produce metrics for artifacts whose
+	// content looks like this type (e.g. ContentTypeJSON).
+	ContentType string
+	Target      *ParserTarget
 	Extractor
 	// Must be nil if target is a metric.
 	Default falba.Value
@@ -79,15 +99,37 @@ func NewParser(name string, artifactPattern string, target *ParserTarget, extrac
 	}, nil
 }
 
+// Matches reports whether the parser should be applied to the artifact. This
+// only reads the artifact if the parser has a ContentType.
+func (p *Parser) Matches(artifact *falba.Artifact) (bool, error) {
+	if !p.ArtifactRE.MatchString(artifact.Name) {
+		return false, nil
+	}
+	if p.ContentType == "" {
+		return true, nil
+	}
+	return sniffContentType(artifact, p.ContentType)
+}
+
 // Parse extract facts and metrics from an artifact.
 //
 // Ahhh right, clarity: Yes, we want the flexibility to output _multiple samples
 // of the same metric_. We don't really care about producing multiple different
 // facts or metrics, I think.
 func (p *Parser) Parse(artifact *falba.Artifact) (*ParseResult, error) {
-	if !p.ArtifactRE.MatchString(artifact.Name) {
+	matches, err := p.Matches(artifact)
+	if err != nil {
+		return nil, fmt.Errorf("checking content type of %v: %v", artifact, err)
+	}
+	if !matches {
 		return emptyParseResult(), nil
 	}
+	return p.ParseMatched(artifact)
+}
+
+// ParseMatched is like Parse, for when the caller already checked Matches.
+// That way a ContentType parser doesn't have to sniff the artifact twice.
+func (p *Parser) ParseMatched(artifact *falba.Artifact) (*ParseResult, error) {
 	vals, err := p.Extractor.Extract(artifact)
 	if err != nil {
 		return nil, err
@@ -100,8 +142,17 @@ func (p *Parser) Parse(artifact *falba.Artifact) (*ParseResult, error) {
 	// TODO: Is it OK that we are kinda forgetting the expected type here?
 	r := emptyParseResult()
 	if p.Target.TargetType == TargetMetric {
+		repetition, err := p.Target.repetition(artifact)
+		if err != nil {
+			return nil, err
+		}
 		for _, val := range vals {
-			r.Metrics = append(r.Metrics, &falba.Metric{Name: p.Target.Name, Value: val, Unit: p.Target.Unit})
+			if err := p.Target.checkRange(val); err != nil {
+				return nil, fmt.Errorf("%w: %v in %v", ErrParseFailure, err, artifact)
+			}
+			r.Metrics = append(r.Metrics, &falba.Metric{
+				Name: p.Target.Name, Value: val, Unit: p.Target.Unit, Labels: p.Target.Labels, Repetition: repetition,
+			})
 		}
 	} else {
 		if len(vals) != 1 {
@@ -112,6 +163,37 @@ func (p *Parser) Parse(artifact *falba.Artifact) (*ParseResult, error) {
 	return r, nil
 }
 
+// Returns nil if there's no RepetitionRE or the artifact doesn't match it, so
+// you can have a mix of repeated and unrepeated runs.
+func (t *ParserTarget) repetition(artifact *falba.Artifact) (*int64, error) {
+	if t.RepetitionRE == nil {
+		return nil, nil
+	}
+	match := t.RepetitionRE.FindStringSubmatch(artifact.Name)
+	if match == nil {
+		return nil, nil
+	}
+	rep, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: repetition %q from %v isn't an integer", ErrParseFailure, match[1], artifact)
+	}
+	return &rep, nil
+}
+
+func (t *ParserTarget) checkRange(val falba.Value) error {
+	f := val.FloatValue()
+	if val.Type() == falba.ValueInt {
+		f = float64(val.IntValue())
+	}
+	if t.Min != nil && f < *t.Min {
+		return fmt.Errorf("value %v of metric %q is below 'min' %v", falba.ValueValue(val), t.Name, *t.Min)
+	}
+	if t.Max != nil && f > *t.Max {
+		return fmt.Errorf("value %v of metric %q is above 'max' %v", falba.ValueValue(val), t.Name, *t.Max)
+	}
+	return nil
+}
+
 // RegexpExtractor is an extractor that uses regexps provided by the user to
 // extract facts and metrics.
 type RegexpExtractor struct {
@@ -121,6 +203,11 @@ type RegexpExtractor struct {
 	// group, the metric is taken from the submatch, otherwise from the match of
 	// the full regexp.
 	re *regexp.Regexp
+	// Which match to take, counting from 1. Negative counts from the end, so
+	// -1 is the last match. If 0, there must be exactly one match.
+	Occurrence int
+	// Applied to the match before parsing it.
+	Format NumberFormat
 }
 
 func NewRegexpExtractor(pattern string, resultType falba.ValueType) (*RegexpExtractor, error) {
@@ -140,17 +227,32 @@ func (e *RegexpExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, erro
 		return nil, fmt.Errorf("getting artifact content: %v", err)
 	}
 
-	matches := e.re.FindAllSubmatch(content, -1)
+	matches := e.re.FindAllSubmatch(normalizeNewlines(content), -1)
 	if len(matches) == 0 {
 		return nil, fmt.Errorf("%w: no matches for %v in %v", ErrParseFailure, e.re, artifact)
 	}
-	// TODO: Support multiple matches
-	if len(matches) > 1 {
+	i := 0
+	switch {
+	case e.Occurrence == 0 && len(matches) > 1:
 		return nil, fmt.Errorf("%w: multple matches for %v in %v, only one is allowed", ErrParseFailure, e.re, artifact)
+	case e.Occurrence > 0:
+		i = e.Occurrence - 1
+	case e.Occurrence < 0:
+		i = len(matches) + e.Occurrence
+	}
+	if i < 0 || i >= len(matches) {
+		return nil, fmt.Errorf("%w: want occurrence %d of %v in %v but there are only %d matches",
+			ErrParseFailure, e.Occurrence, e.re, artifact, len(matches))
+	}
+	match := string(matches[i][e.re.NumSubexp()])
+	// It's easy to write a regexp that captures trailing whitespace (e.g. a
+	// \r from a CRLF file) which would break numbers, so trim them. Strings
+	// are left exactly as they were captured.
+	if e.resultType != falba.ValueString {
+		match = strings.TrimSpace(match)
 	}
-	match := matches[0][e.re.NumSubexp()]
 
-	val, err := falba.ParseValue(string(match), e.resultType)
+	val, err := e.Format.parseValue(match, e.resultType)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrParseFailure, err)
 	}
@@ -158,6 +260,31 @@ func (e *RegexpExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, erro
 	return []falba.Value{val}, nil
 }
 
+// normalizeNewlines turns Windows line endings into Unix ones. Otherwise a
+// regexp like "(?m)^foo: (.*)$" would capture a trailing \r from each line.
+// The extractors that work line by line trim each line instead.
+func normalizeNewlines(content []byte) []byte {
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// ParseOccurrence parses "first", "last" or a number N (counting from 1) into
+// a RegexpExtractor.Occurrence. Empty means there must be exactly one match.
+func ParseOccurrence(s string) (int, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "first":
+		return 1, nil
+	case "last":
+		return -1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid occurrence %q, want 'first', 'last' or a number from 1", s)
+	}
+	return n, nil
+}
+
 func (p *RegexpExtractor) String() string {
 	return fmt.Sprintf("RegexpExtractor{%v -> %v}", p.re, p.resultType)
 }
@@ -166,6 +293,8 @@ type FactConfig struct {
 	Name    string      `json:"name"`
 	Type    string      `json:"type"`
 	Default falba.Value `json:"-"`
+	// If set, the only values the fact is allowed to have.
+	Enum []falba.Value `json:"-"`
 }
 
 func (f *FactConfig) UnmarshalJSON(data []byte) error {
@@ -174,7 +303,8 @@ func (f *FactConfig) UnmarshalJSON(data []byte) error {
 	type Alias FactConfig
 	aux := &struct {
 		// Delay parsing "default" by capturing it as raw JSON until we know the "type".
-		Default json.RawMessage `json:"default"`
+		Default json.RawMessage   `json:"default"`
+		Enum    []json.RawMessage `json:"enum"`
 		*Alias
 	}{
 		Alias: (*Alias)(f),
@@ -194,19 +324,61 @@ func (f *FactConfig) UnmarshalJSON(data []byte) error {
 		}
 		f.Default = val
 	}
+
+	if aux.Enum != nil {
+		if len(aux.Enum) == 0 {
+			return fmt.Errorf("'enum' is empty, no value would be allowed")
+		}
+		valueType, err := falba.ParseValueType(f.Type)
+		if err != nil {
+			return fmt.Errorf("parsing fact type %q: %v", f.Type, err)
+		}
+		for _, raw := range aux.Enum {
+			val, err := falba.ParseValueFromJSONValue(raw, valueType)
+			if err != nil {
+				return fmt.Errorf("parsing enum value: %v", err)
+			}
+			f.Enum = append(f.Enum, val)
+		}
+		if f.Default != nil && !falba.ValueIn(f.Default, f.Enum) {
+			return fmt.Errorf("default value %v isn't in 'enum' %v",
+				falba.ValueValue(f.Default), falba.FormatValues(f.Enum))
+		}
+	}
 	return nil
 }
 
 type BaseParserConfig struct {
 	Type string `json:"type"`
 	// Parse the artifact if its path (relative to the artifacts dir) matches
-	// this regexp.
+	// this regexp. Note this is an unanchored match, so "os-release" also
+	// matches "config/os-release-notes.txt".
 	ArtifactRegexp string `json:"artifact_regexp"`
+	// Alternative to ArtifactRegexp, parse the artifact if its path matches
+	// this glob, e.g. "**/*.json". Unlike the regexp this has to match the
+	// whole path.
+	ArtifactGlob string `json:"artifact_glob"`
+	// If set, ArtifactRegexp has to match the whole relative path, as if it
+	// was wrapped in ^...$. An empty ArtifactRegexp still matches everything
+	// (e.g. with a ContentType).
+	Exact bool `json:"exact"`
+	// If set, only parse artifacts whose content looks like this type ("json",
+	// "keyvalue" or "csv"). This means reading the start of every artifact
+	// (that matches ArtifactRegexp, if that's set too) so it's opt-in.
+	ContentType string `json:"content_type"`
 	// Specify either the metric to produce, or the fact to produce.
 	Metric *struct {
 		Name string `json:"name"`
 		Type string `json:"type"`
 		Unit string `json:"unit"`
+		// Static labels to attach to every sample.
+		Labels map[string]string `json:"labels"`
+		// Bounds for plausible values, see ParserTarget.
+		Min *float64 `json:"min"`
+		Max *float64 `json:"max"`
+		// Regexp with one capture group, which extracts the repetition
+		// index from the artifact name, e.g. "run(\\d+)/".
+		RepetitionRegexp string `json:"repetition_regexp"`
 	} `json:"metric"`
 	Fact *FactConfig `json:"fact"`
 }
@@ -214,6 +386,8 @@ type BaseParserConfig struct {
 type ShellvarParserConfig struct {
 	BaseParserConfig
 	Var string `json:"var"` // Name of the shell variable to extract
+	// Longest line allowed in the artifact, 0 for the default.
+	MaxLineBytes int `json:"max_line_bytes"`
 }
 
 func (c *ShellvarParserConfig) ValidateFields() error {
@@ -223,6 +397,9 @@ func (c *ShellvarParserConfig) ValidateFields() error {
 	if c.Var == "" {
 		return fmt.Errorf("missing/empty 'var' field for shellvar parser")
 	}
+	if c.MaxLineBytes < 0 {
+		return fmt.Errorf("'max_line_bytes' can't be negative")
+	}
 	return nil
 }
 
@@ -247,8 +424,16 @@ func (c *BaseParserConfig) ValidateFields() error {
 	if c.Type == "" {
 		return fmt.Errorf("missing/empty 'type' field")
 	}
-	if c.ArtifactRegexp == "" {
-		return fmt.Errorf("missing/empty 'artifact_regexp' field")
+	if c.ArtifactRegexp != "" && c.ArtifactGlob != "" {
+		return fmt.Errorf("specify at most one of 'artifact_regexp' and 'artifact_glob'")
+	}
+	if c.ArtifactRegexp == "" && c.ArtifactGlob == "" && c.ContentType == "" {
+		return fmt.Errorf("specify at least one of 'artifact_regexp', 'artifact_glob' and 'content_type'")
+	}
+	if c.ContentType != "" {
+		if err := validateContentType(c.ContentType); err != nil {
+			return err
+		}
 	}
 	if (c.Metric != nil) == (c.Fact != nil) {
 		return fmt.Errorf("specify exactly one of 'metric' and 'fact'")
@@ -260,6 +445,19 @@ func (c *BaseParserConfig) ValidateFields() error {
 		if c.Metric.Type == "" {
 			return fmt.Errorf("missing/empty 'metric.type' field")
 		}
+		for k := range c.Metric.Labels {
+			if k == "" || strings.ContainsAny(k, "{}=,") {
+				return fmt.Errorf("invalid label name %q in 'metric.labels'", k)
+			}
+		}
+		if c.Metric.Min != nil || c.Metric.Max != nil {
+			if c.Metric.Type != "int" && c.Metric.Type != "float" {
+				return fmt.Errorf("'metric.min' and 'metric.max' are only allowed for int and float metrics")
+			}
+			if c.Metric.Min != nil && c.Metric.Max != nil && *c.Metric.Min > *c.Metric.Max {
+				return fmt.Errorf("'metric.min' (%v) is greater than 'metric.max' (%v)", *c.Metric.Min, *c.Metric.Max)
+			}
+		}
 	} else {
 		if c.Fact.Name == "" {
 			return fmt.Errorf("missing/empty 'fact.name' field")
@@ -275,6 +473,30 @@ func (c *BaseParserConfig) ValidateFields() error {
 // entire content.
 type SingleMetricConfig struct {
 	BaseParserConfig
+	NumberFormatConfig
+	// Whether to trim surrounding whitespace from the content before parsing
+	// it. Defaults to true.
+	Trim *bool `json:"trim"`
+}
+
+// Config for a parser that extracts a value from an artifact with a regexp.
+type RegexpParserConfig struct {
+	BaseParserConfig
+	NumberFormatConfig
+	// Zero or one capture groups, see RegexpExtractor.
+	Regexp string `json:"regexp"`
+	// Which match to use if there are several, see ParseOccurrence.
+	Occurrence string `json:"occurrence"`
+}
+
+func (c *RegexpParserConfig) ValidateFields() error {
+	if err := c.BaseParserConfig.ValidateFields(); err != nil {
+		return err
+	}
+	if c.Regexp == "" {
+		return fmt.Errorf("missing/empty 'regexp' field")
+	}
+	return nil
 }
 
 // Read a configuration entry for a single parser and return it.
@@ -301,10 +523,23 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 			Name:       baseConfig.Metric.Name,
 			ValueType:  valueType,
 			Unit:       u,
+			Labels:     baseConfig.Metric.Labels,
+			Min:        baseConfig.Metric.Min,
+			Max:        baseConfig.Metric.Max,
+		}
+		if baseConfig.Metric.RepetitionRegexp != "" {
+			re, err := regexp.Compile(baseConfig.Metric.RepetitionRegexp)
+			if err != nil {
+				return nil, fmt.Errorf("compiling 'metric.repetition_regexp': %v", err)
+			}
+			if re.NumSubexp() != 1 {
+				return nil, fmt.Errorf("'metric.repetition_regexp' %q has %d capture groups, want exactly 1", re, re.NumSubexp())
+			}
+			target.RepetitionRE = re
 		}
 	} else if baseConfig.Fact != nil {
 		if falba.IsReservedFactName(baseConfig.Fact.Name) {
-			return nil, fmt.Errorf("fact name %q is reserved (%s)", baseConfig.Fact.Name, falba.GetReservedFactNamesString())
+			return nil, fmt.Errorf("%w: fact name %q is reserved (%s)", ErrReservedName, baseConfig.Fact.Name, falba.GetReservedFactNamesString())
 		}
 		valueType, err := falba.ParseValueType(baseConfig.Fact.Type)
 		if err != nil {
@@ -314,6 +549,7 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 			TargetType: TargetFact,
 			Name:       baseConfig.Fact.Name,
 			ValueType:  valueType,
+			Enum:       baseConfig.Fact.Enum,
 		}
 	} else {
 		return nil, fmt.Errorf("must specify 'fact.type' or 'value.type'")
@@ -324,6 +560,18 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		defaultValue = baseConfig.Fact.Default
 	}
 
+	artifactPattern := baseConfig.ArtifactRegexp
+	if baseConfig.Exact && artifactPattern != "" {
+		artifactPattern = "^(?:" + artifactPattern + ")$"
+	}
+	if baseConfig.ArtifactGlob != "" {
+		var err error
+		artifactPattern, err = globToRegexp(baseConfig.ArtifactGlob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'artifact_glob': %v", err)
+		}
+	}
+
 	var extractor Extractor
 
 	switch baseConfig.Type {
@@ -337,11 +585,38 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		if err := config.ValidateFields(); err != nil {
 			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
-		var err error
-		extractor, err = NewRegexpExtractor(".+", target.ValueType)
+		format, err := config.numberFormat(&target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+		}
+		extractor = &SingleValueExtractor{
+			ResultType: target.ValueType,
+			NoTrim:     config.Trim != nil && !*config.Trim,
+			Format:     format,
+		}
+	case "regexp":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config RegexpParserConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding regexp parser config: %v", err)
+		}
+		if err := config.ValidateFields(); err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+		}
+		e, err := NewRegexpExtractor(config.Regexp, target.ValueType)
+		if err != nil {
+			return nil, fmt.Errorf("setting up regexp extractor: %v", err)
+		}
+		e.Occurrence, err = ParseOccurrence(config.Occurrence)
 		if err != nil {
-			return nil, fmt.Errorf("setting up single-value extractor: %v", err)
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
+		e.Format, err = config.numberFormat(&target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+		}
+		extractor = e
 	case "jsonpath":
 		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
 		decoder.DisallowUnknownFields()
@@ -352,11 +627,13 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		if err := config.ValidateFields(); err != nil {
 			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
-		var err error
-		extractor, err = NewJSONPathExtractor(config.JSONPath, target.ValueType)
+		e, err := NewJSONPathExtractor(config.JSONPath, target.ValueType)
 		if err != nil {
 			return nil, fmt.Errorf("setting up JSONPath extractor: %v", err)
 		}
+		e.MaxBytes = config.MaxBytes
+		e.Coerce = config.Coerce
+		extractor = e
 	case "jsonpath-yaml":
 		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
 		decoder.DisallowUnknownFields()
@@ -367,11 +644,12 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		if err := config.ValidateFields(); err != nil {
 			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
-		var err error
-		extractor, err = NewYAMLPathExtractor(config.JSONPath, target.ValueType)
+		e, err := NewYAMLPathExtractor(config.JSONPath, target.ValueType)
 		if err != nil {
 			return nil, fmt.Errorf("setting up YAMLPath extractor: %v", err)
 		}
+		e.Coerce = config.Coerce
+		extractor = e
 	case "shellvar":
 		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
 		decoder.DisallowUnknownFields()
@@ -382,11 +660,12 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		if err := config.ValidateFields(); err != nil {
 			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
-		var err error
-		extractor, err = NewShellvarExtractor(config.Var, target.ValueType)
+		shellvarExtractor, err := NewShellvarExtractor(config.Var, target.ValueType)
 		if err != nil {
 			return nil, fmt.Errorf("setting up Shellvar extractor: %v", err)
 		}
+		shellvarExtractor.MaxLineBytes = config.MaxLineBytes
+		extractor = shellvarExtractor
 	case "command":
 		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
 		decoder.DisallowUnknownFields()
@@ -412,14 +691,63 @@ func FromConfig(rawConfig json.RawMessage, name string) (*Parser, error) {
 		if err := config.ValidateFields(); err != nil {
 			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
 		}
-		result, err := falba.ValueFromAny(config.Result)
+		result, err := artifactPresenceResult(config.Result, target.ValueType)
 		if err != nil {
-			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+			return nil, fmt.Errorf("invalid %q parser config: 'result': %v", baseConfig.Type, err)
 		}
 		extractor = &ArtifactPresenceExtractor{result: result}
+	case "artifact_name":
+		decoder := json.NewDecoder(strings.NewReader(string(rawConfig)))
+		decoder.DisallowUnknownFields()
+		var config ArtifactNameConfig
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding artifact_name parser config: %v", err)
+		}
+		if err := config.ValidateFields(); err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+		}
+		// Use the same regexp that matches the artifact (including 'exact'),
+		// so that the capture group is the same as when it matched.
+		e, err := NewArtifactNameExtractor(artifactPattern, target.ValueType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: 'artifact_regexp': %v", baseConfig.Type, err)
+		}
+		e.Format, err = config.numberFormat(&target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q parser config: %v", baseConfig.Type, err)
+		}
+		extractor = e
 	default:
 		return nil, fmt.Errorf("unknown parser type %q", baseConfig.Type)
 	}
 
-	return NewParser(name, baseConfig.ArtifactRegexp, &target, extractor, defaultValue)
+	p, err := NewParser(name, artifactPattern, &target, extractor, defaultValue)
+	if err != nil {
+		// A common mistake is to write a glob here, like "*.json".
+		if strings.HasPrefix(baseConfig.ArtifactRegexp, "*") {
+			return nil, fmt.Errorf("%v (did you mean 'artifact_glob'?)", err)
+		}
+		return nil, err
+	}
+	p.ContentType = baseConfig.ContentType
+	return p, nil
+}
+
+// ParsersFromConfig is like FromConfig but it also supports config types that
+// produce several parsers.
+func ParsersFromConfig(rawConfig json.RawMessage, name string) ([]*Parser, error) {
+	var typeConfig struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(rawConfig, &typeConfig); err != nil {
+		return nil, fmt.Errorf("decoding 'type' for parser: %v", err)
+	}
+	if typeConfig.Type == "jsonpath_facts" {
+		return jsonPathFactsFromConfig(rawConfig, name)
+	}
+	p, err := FromConfig(rawConfig, name)
+	if err != nil {
+		return nil, err
+	}
+	return []*Parser{p}, nil
 }
@@ -1,8 +1,11 @@
 package parser_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -443,6 +446,35 @@ func TestNewShellvarExtractor_Error(t *testing.T) {
 	}
 }
 
+func TestShellvarExtractor_LongLine(t *testing.T) {
+	// Way past bufio.Scanner's default limit of 64KiB.
+	long := strings.Repeat("x", 3*1024*1024)
+	artifact := fakeArtifact(t, "BEFORE=1\nJUNK="+long+"\nMY_VAR="+long+"\n")
+
+	e, err := parser.NewShellvarExtractor("MY_VAR", falba.ValueString)
+	if err != nil {
+		t.Fatalf("NewShellvarExtractor failed: %v", err)
+	}
+	vals, err := e.Extract(artifact)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if len(vals) != 1 || vals[0].StringValue() != long {
+		t.Errorf("Extract returned %d values, want the 3MiB line", len(vals))
+	}
+
+	e.MaxLineBytes = 1024 * 1024
+	_, err = e.Extract(artifact)
+	if !errors.Is(err, parser.ErrParseFailure) || !strings.Contains(err.Error(), "line longer than") {
+		t.Errorf("Extract with a 1MiB limit returned %v, want ErrParseFailure about the line length", err)
+	}
+	// Lines before the long one are still fine.
+	e.VarName = "BEFORE"
+	if _, err := e.Extract(artifact); err != nil {
+		t.Errorf("Extract of a variable before the long line failed: %v", err)
+	}
+}
+
 func TestShellvarFromConfig(t *testing.T) {
 	configJSON := `{
 		"type": "shellvar",
@@ -538,6 +570,24 @@ func TestJSONPathParser(t *testing.T) {
 			parser:  mustNewJSONPathParser(t, "$.num", "my_metric", parser.TargetMetric, falba.ValueInt),
 			wantMet: &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 123}},
 		},
+		{
+			desc:    "int metric beyond float64 precision",
+			content: `{"num": 9007199254740993}`,
+			parser:  mustNewJSONPathParser(t, "$.num", "my_metric", parser.TargetMetric, falba.ValueInt),
+			wantMet: &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 9007199254740993}},
+		},
+		{
+			desc:    "float fact from integer",
+			content: `{"val": 45}`,
+			parser:  mustNewJSONPathParser(t, "$.val", "my_fact", parser.TargetFact, falba.ValueFloat),
+			want:    &falba.FloatValue{Value: 45},
+		},
+		{
+			desc:    "numeric filter",
+			content: `{"items": [{"name": "A", "val": 1}, {"name": "B", "val": 2}]}`,
+			parser:  mustNewJSONPathParser(t, "$.items[?(@.val == 2)].name", "my_fact", parser.TargetFact, falba.ValueString),
+			want:    &falba.StringValue{Value: "B"},
+		},
 		{
 			desc:    "float fact from number",
 			content: `{"val": 45.67}`,
@@ -586,6 +636,18 @@ func TestJSONPathParser(t *testing.T) {
 			parser:  mustNewJSONPathParser(t, "$.items[?(@.name=='B')].val", "my_metric", parser.TargetMetric, falba.ValueInt),
 			wantMet: &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 2}},
 		},
+		{
+			desc:    "top-level array",
+			content: `[{"value": 1}, {"value": 2}]`,
+			parser:  mustNewJSONPathParser(t, "$[1].value", "my_metric", parser.TargetMetric, falba.ValueInt),
+			wantMet: &falba.Metric{Name: "my_metric", Value: &falba.IntValue{Value: 2}},
+		},
+		{
+			desc:    "top-level array filter",
+			content: `[{"name": "A", "val": 1}, {"name": "B", "val": 2}]`,
+			parser:  mustNewJSONPathParser(t, "$[?(@.val == 1)].name", "my_fact", parser.TargetFact, falba.ValueString),
+			want:    &falba.StringValue{Value: "A"},
+		},
 	}
 
 	for _, tc := range happyPathTestCases {
@@ -664,6 +726,11 @@ func TestJSONPathParser(t *testing.T) {
 			content: `{"val": "notabool"}`,
 			parser:  mustNewJSONPathParser(t, "$.val", "my_fact", parser.TargetFact, falba.ValueBool),
 		},
+		{
+			desc:    "object key in top-level array",
+			content: `[{"val": 1}]`,
+			parser:  mustNewJSONPathParser(t, "$.val", "my_metric", parser.TargetMetric, falba.ValueInt),
+		},
 		{
 			desc:    "type mismatch (int 1 for bool)",
 			content: `{"val": 1}`, // JSONPath returns float64 for numbers
@@ -715,6 +782,38 @@ func TestJSONPathParser(t *testing.T) {
 		}
 	})
 
+	t.Run("Multiple values from top-level array", func(t *testing.T) {
+		for _, tc := range []struct {
+			jsonPath string
+			content  string
+			want     []int64
+		}{
+			{jsonPath: "$[*]", content: `[1, 2, 3]`, want: []int64{1, 2, 3}},
+			{jsonPath: "$[*].value", content: `[{"value": 4}, {"value": 5}]`, want: []int64{4, 5}},
+			// Nothing to extract is a parse failure, like a missing key.
+			{jsonPath: "$[*]", content: `[]`},
+		} {
+			p := mustNewJSONPathParser(t, tc.jsonPath, "my_metric", parser.TargetMetric, falba.ValueInt)
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if tc.want == nil {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Errorf("Parse() of %v with %v gave %v, want ErrParseFailure", tc.content, tc.jsonPath, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Parse() of %v with %v failed: %v", tc.content, tc.jsonPath, err)
+			}
+			var got []int64
+			for _, m := range result.Metrics {
+				got = append(got, m.Value.IntValue())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected values for %v with %v (-want +got):\n%s", tc.content, tc.jsonPath, diff)
+			}
+		}
+	})
+
 	t.Run("FromConfig jsonpath", func(t *testing.T) {
 		configJSON := `{
 			"type": "jsonpath",
@@ -814,8 +913,8 @@ func TestReservedFactNamesRejected(t *testing.T) {
 				if err == nil {
 					t.Fatalf("Expected error for reserved fact name %q, but got none", tc.factName)
 				}
-				if !strings.Contains(err.Error(), "reserved") {
-					t.Errorf("Expected error about reserved fact name, got: %v", err)
+				if !errors.Is(err, parser.ErrReservedName) {
+					t.Errorf("Expected ErrReservedName, got: %v", err)
 				}
 			} else {
 				if err != nil {
@@ -912,3 +1011,1102 @@ func TestParserFromConfig_FactDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestParserFromConfig_FactEnum(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fact        string
+		wantEnum    []falba.Value
+		expectError bool
+	}{
+		{
+			name:     "string",
+			fact:     `{"name": "f", "type": "string", "enum": ["ext4", "xfs"]}`,
+			wantEnum: []falba.Value{&falba.StringValue{Value: "ext4"}, &falba.StringValue{Value: "xfs"}},
+		},
+		{
+			name:     "int with default",
+			fact:     `{"name": "f", "type": "int", "enum": [1, 2], "default": 2}`,
+			wantEnum: []falba.Value{&falba.IntValue{Value: 1}, &falba.IntValue{Value: 2}},
+		},
+		{name: "empty", fact: `{"name": "f", "type": "string", "enum": []}`, expectError: true},
+		{name: "wrong type", fact: `{"name": "f", "type": "int", "enum": ["1"]}`, expectError: true},
+		{name: "default not in enum", fact: `{"name": "f", "type": "int", "enum": [1, 2], "default": 3}`, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{"type": "single_metric", "artifact_regexp": "fact.txt", "fact": %s}`, tc.fact)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if tc.expectError {
+				if err == nil {
+					t.Fatal("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantEnum, p.Target.Enum); diff != "" {
+				t.Errorf("Unexpected enum (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParserFromConfig_Exact(t *testing.T) {
+	testCases := []struct {
+		name         string
+		exact        bool
+		artifactName string
+		wantMatch    bool
+	}{
+		{name: "unanchored-exact-name", exact: false, artifactName: "os-release", wantMatch: true},
+		{name: "unanchored-substring", exact: false, artifactName: "config/os-release-notes.txt", wantMatch: true},
+		{name: "exact-exact-name", exact: true, artifactName: "os-release", wantMatch: true},
+		{name: "exact-substring", exact: true, artifactName: "config/os-release-notes.txt", wantMatch: false},
+		{name: "exact-prefix", exact: true, artifactName: "os-release.bak", wantMatch: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{
+				"type": "single_metric",
+				"artifact_regexp": "os-release|lsb-release",
+				"exact": %v,
+				"fact": {"name": "my_fact", "type": "string"}
+			}`, tc.exact)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			if got := p.ArtifactRE.MatchString(tc.artifactName); got != tc.wantMatch {
+				t.Errorf("ArtifactRE %v matching %q: got %v, want %v", p.ArtifactRE, tc.artifactName, got, tc.wantMatch)
+			}
+		})
+	}
+}
+
+func TestJSONPathParser_Compressed(t *testing.T) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(`{"other": [1, 2, {"x": 3}], "obj": {"num": 123}, "after": "foo"}`)); err != nil {
+		t.Fatalf("Compressing: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Compressing: %v", err)
+	}
+	artifact := fakeArtifact(t, b.String())
+
+	for _, expr := range []string{
+		// Streaming path.
+		"$.obj.num",
+		// Full decode path.
+		`$["obj"]["num"]`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			e, err := parser.NewJSONPathExtractor(expr, falba.ValueInt)
+			if err != nil {
+				t.Fatalf("NewJSONPathExtractor failed: %v", err)
+			}
+			got, err := e.Extract(artifact)
+			if err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if diff := cmp.Diff([]falba.Value{&falba.IntValue{Value: 123}}, got); diff != "" {
+				t.Errorf("Unexpected values (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONPathParser_MaxBytes(t *testing.T) {
+	artifact := fakeArtifact(t, `{"num": 123, "padding": "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"}`)
+	for _, expr := range []string{"$.num", `$["num"]`} {
+		t.Run(expr, func(t *testing.T) {
+			e, err := parser.NewJSONPathExtractor(expr, falba.ValueInt)
+			if err != nil {
+				t.Fatalf("NewJSONPathExtractor failed: %v", err)
+			}
+			e.MaxBytes = 16
+			_, err = e.Extract(artifact)
+			if !errors.Is(err, parser.ErrParseFailure) || !strings.Contains(err.Error(), "exceeds limit") {
+				t.Errorf("Expected size limit ErrParseFailure, got %v", err)
+			}
+
+			e.MaxBytes = -1
+			if _, err = e.Extract(artifact); err != nil {
+				t.Errorf("Unexpected error with no limit: %v", err)
+			}
+		})
+	}
+}
+
+func TestParsersFromConfig_JSONPathFacts(t *testing.T) {
+	configJSON := `{
+		"type": "jsonpath_facts",
+		"artifact_regexp": "artifact",
+		"facts": {
+			"cpu": {"jsonpath": "$.machine.cpu", "type": "string"},
+			"mem_gb": {"jsonpath": "$.machine.mem", "type": "int"},
+			"fs": {"jsonpath": "$.fs", "type": "string", "default": "ext4", "enum": ["ext4", "xfs"]}
+		}
+	}`
+	parsers, err := parser.ParsersFromConfig([]byte(configJSON), "report")
+	if err != nil {
+		t.Fatalf("ParsersFromConfig failed: %v", err)
+	}
+	var names []string
+	for _, p := range parsers {
+		names = append(names, p.Name)
+	}
+	if diff := cmp.Diff([]string{"report.cpu", "report.fs", "report.mem_gb"}, names); diff != "" {
+		t.Fatalf("Unexpected parser names (-want +got):\n%s", diff)
+	}
+	if got := parsers[1].Default; got == nil || got.StringValue() != "ext4" {
+		t.Errorf("Got default %v for fs, want ext4", got)
+	}
+	if got := len(parsers[1].Target.Enum); got != 2 {
+		t.Errorf("Got %d enum values for fs, want 2", got)
+	}
+
+	artifact := fakeArtifact(t, `{"machine": {"cpu": "Zen 4", "mem": 64}, "fs": "xfs"}`)
+	got := make(map[string]falba.Value)
+	for i, p := range parsers {
+		result, err := p.Parse(artifact)
+		if err != nil {
+			t.Fatalf("Parse with %v failed: %v", p.Name, err)
+		}
+		maps.Copy(got, result.Facts)
+		if i == 0 {
+			// The rest of the parsers should reuse the decoded JSON
+			// instead of reading the file again.
+			if err := os.Remove(artifact.Path); err != nil {
+				t.Fatalf("Removing artifact: %v", err)
+			}
+		}
+	}
+	want := map[string]falba.Value{
+		"cpu":    &falba.StringValue{Value: "Zen 4"},
+		"mem_gb": &falba.IntValue{Value: 64},
+		"fs":     &falba.StringValue{Value: "xfs"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+	}
+
+	// Normal configs just give a single parser.
+	parsers, err = parser.ParsersFromConfig([]byte(`{
+		"type": "jsonpath", "artifact_regexp": "x", "jsonpath": "$.x", "fact": {"name": "x", "type": "int"}
+	}`), "normal")
+	if err != nil || len(parsers) != 1 || parsers[0].Name != "normal" {
+		t.Errorf("ParsersFromConfig for a jsonpath parser returned %v, %v", parsers, err)
+	}
+}
+
+func TestParsersFromConfig_JSONPathFactsErrors(t *testing.T) {
+	for _, config := range []string{
+		`{"type": "jsonpath_facts", "artifact_regexp": "x"}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "facts": {}}`,
+		`{"type": "jsonpath_facts", "facts": {"a": {"jsonpath": "$.a", "type": "int"}}}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "facts": {"a": {"jsonpath": "$.a", "type": "blah"}}}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "facts": {"a": {"type": "int"}}}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "facts": {"a": {"jsonpath": "$.a", "type": "int", "bogus": 1}}}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "bogus": 1, "facts": {"a": {"jsonpath": "$.a", "type": "int"}}}`,
+		`{"type": "jsonpath_facts", "artifact_regexp": "x", "facts": {"test_name": {"jsonpath": "$.a", "type": "string"}}}`,
+	} {
+		if _, err := parser.ParsersFromConfig([]byte(config), "p"); err == nil {
+			t.Errorf("ParsersFromConfig(%s) succeeded, want error", config)
+		}
+	}
+}
+
+func TestParserFromConfig_ContentType(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+		content     string
+		wantMatch   bool
+	}{
+		{name: "json-object", contentType: "json", content: `{"foo": [1, 2]}`, wantMatch: true},
+		{name: "json-array", contentType: "json", content: "  \n[1, 2, 3]", wantMatch: true},
+		{name: "json-truncated", contentType: "json", content: `{"foo": "` + strings.Repeat("x", 5000) + `"}`, wantMatch: true},
+		{name: "json-not-json", contentType: "json", content: "{foo}", wantMatch: false},
+		{name: "json-keyvalue", contentType: "json", content: "FOO=bar\n", wantMatch: false},
+		{name: "keyvalue", contentType: "keyvalue", content: "# comment\nFOO=bar\nexport BAZ=\"qux\"\n", wantMatch: true},
+		{name: "keyvalue-json", contentType: "keyvalue", content: `{"foo": 1}`, wantMatch: false},
+		{name: "keyvalue-empty", contentType: "keyvalue", content: "", wantMatch: false},
+		{name: "csv", contentType: "csv", content: "a,b,c\n1,2,3\n4,5,6\n", wantMatch: true},
+		{name: "csv-ragged", contentType: "csv", content: "a,b,c\n1,2\n", wantMatch: false},
+		{name: "csv-single-column", contentType: "csv", content: "hello\nworld\n", wantMatch: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{
+				"type": "artifact_presence",
+				"content_type": %q,
+				"result": true,
+				"fact": {"name": "my_fact", "type": "bool"}
+			}`, tc.contentType)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			got, err := p.Matches(fakeArtifact(t, tc.content))
+			if err != nil {
+				t.Fatalf("Matches failed: %v", err)
+			}
+			if got != tc.wantMatch {
+				t.Errorf("Matches for content_type %q: got %v, want %v", tc.contentType, got, tc.wantMatch)
+			}
+		})
+	}
+
+	// "exact" doesn't stop an empty regexp from matching everything.
+	p, err := parser.FromConfig([]byte(`{
+		"type": "artifact_presence",
+		"content_type": "json",
+		"exact": true,
+		"result": true,
+		"fact": {"name": "my_fact", "type": "bool"}
+	}`), "test_parser")
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	if got, err := p.Matches(fakeArtifact(t, `{"foo": 1}`)); err != nil || !got {
+		t.Errorf("Matches with exact and no artifact_regexp: got (%v, %v), want (true, nil)", got, err)
+	}
+
+	// Unknown content types are rejected.
+	_, err = parser.FromConfig([]byte(`{
+		"type": "single_metric",
+		"content_type": "xml",
+		"fact": {"name": "my_fact", "type": "string"}
+	}`), "test_parser")
+	if err == nil {
+		t.Errorf("Expected error for unknown content_type, got nil")
+	}
+}
+
+func TestParserFromConfig_ArtifactPresence(t *testing.T) {
+	testCases := []struct {
+		result    string // JSON
+		valueType string
+		want      falba.Value // nil means FromConfig should fail.
+	}{
+		{result: "true", valueType: "bool", want: &falba.BoolValue{Value: true}},
+		{result: "false", valueType: "bool", want: &falba.BoolValue{Value: false}},
+		{result: `"true"`, valueType: "bool", want: &falba.BoolValue{Value: true}},
+		{result: `"yes"`, valueType: "bool"},
+		{result: "1", valueType: "bool"},
+		{result: `"perf"`, valueType: "string", want: &falba.StringValue{Value: "perf"}},
+		{result: "true", valueType: "string", want: &falba.StringValue{Value: "true"}},
+		{result: "12", valueType: "string", want: &falba.StringValue{Value: "12"}},
+		{result: "3", valueType: "int", want: &falba.IntValue{Value: 3}},
+		{result: `"3"`, valueType: "int", want: &falba.IntValue{Value: 3}},
+		{result: "1.5", valueType: "int"},
+		{result: "true", valueType: "int"},
+		{result: `"three"`, valueType: "int"},
+		{result: "2.5", valueType: "float", want: &falba.FloatValue{Value: 2.5}},
+		{result: "2", valueType: "float", want: &falba.FloatValue{Value: 2}},
+		{result: `"2.5"`, valueType: "float", want: &falba.FloatValue{Value: 2.5}},
+		{result: "false", valueType: "float"},
+		{result: "null", valueType: "bool"},
+		{result: "[true]", valueType: "bool"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.result+"_"+tc.valueType, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{
+				"type": "artifact_presence",
+				"artifact_regexp": "trace\\.dat",
+				"result": %s,
+				"fact": {"name": "traced", "type": %q}
+			}`, tc.result, tc.valueType)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("FromConfig succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(&falba.Artifact{Name: "trace.dat"})
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if diff := cmp.Diff(map[string]falba.Value{"traced": tc.want}, result.Facts); diff != "" {
+				t.Errorf("Unexpected facts (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The result is required.
+	_, err := parser.FromConfig([]byte(`{"type": "artifact_presence", "artifact_regexp": "x", "fact": {"name": "f", "type": "bool"}}`), "test_parser")
+	if err == nil {
+		t.Errorf("FromConfig succeeded without a result, want error")
+	}
+}
+
+func TestParserFromConfig_ArtifactName(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		config   string // JSON fields apart from type
+		artifact string
+		want     *parser.ParseResult
+		wantErr  bool // From Parse, FromConfig must always succeed.
+	}{
+		{
+			desc:     "int metric",
+			config:   `"artifact_regexp": "throughput_(\\d+)threads\\.txt", "metric": {"name": "threads", "type": "int"}`,
+			artifact: "throughput_4threads.txt",
+			want: &parser.ParseResult{
+				Facts:   map[string]falba.Value{},
+				Metrics: []*falba.Metric{{Name: "threads", Value: &falba.IntValue{Value: 4}}},
+			},
+		},
+		{
+			desc:     "string fact",
+			config:   `"artifact_regexp": "^results-(\\w+)/", "fact": {"name": "fs", "type": "string"}`,
+			artifact: "results-ext4/fio.json",
+			want: &parser.ParseResult{
+				Facts:   map[string]falba.Value{"fs": &falba.StringValue{Value: "ext4"}},
+				Metrics: []*falba.Metric{},
+			},
+		},
+		{
+			desc:     "exact",
+			config:   `"artifact_regexp": "run(\\d+)\\.log", "exact": true, "fact": {"name": "run", "type": "int"}`,
+			artifact: "run12.log",
+			want: &parser.ParseResult{
+				Facts:   map[string]falba.Value{"run": &falba.IntValue{Value: 12}},
+				Metrics: []*falba.Metric{},
+			},
+		},
+		{
+			desc:     "number format",
+			config:   `"artifact_regexp": "size_(\\w+)\\.txt", "strip_suffix": "k", "scale": 1024, "metric": {"name": "size", "type": "int"}`,
+			artifact: "size_4k.txt",
+			want: &parser.ParseResult{
+				Facts:   map[string]falba.Value{},
+				Metrics: []*falba.Metric{{Name: "size", Value: &falba.IntValue{Value: 4096}}},
+			},
+		},
+		{
+			desc:     "not an int",
+			config:   `"artifact_regexp": "throughput_(\\w+)threads\\.txt", "metric": {"name": "threads", "type": "int"}`,
+			artifact: "throughput_fourthreads.txt",
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			configJSON := `{"type": "artifact_name", ` + tc.config + `}`
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			// The artifact doesn't exist, the content must not be read.
+			artifact := &falba.Artifact{Name: tc.artifact, Path: filepath.Join(t.TempDir(), "nonexistent")}
+			result, err := p.Parse(artifact)
+			if tc.wantErr {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, result); diff != "" {
+				t.Errorf("Unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, config := range []string{
+		// No capture group.
+		`"artifact_regexp": "throughput\\.txt"`,
+		// Too many.
+		`"artifact_regexp": "(\\d+)_(\\d+)"`,
+		// Globs can't capture.
+		`"artifact_glob": "*.txt"`,
+		// Only numbers can be scaled.
+		`"artifact_regexp": "(\\w+)", "scale": 2, "fact": {"name": "f", "type": "string"}`,
+	} {
+		if !strings.Contains(config, "fact") {
+			config += `, "metric": {"name": "m", "type": "int"}`
+		}
+		configJSON := `{"type": "artifact_name", ` + config + `}`
+		if _, err := parser.FromConfig([]byte(configJSON), "test_parser"); err == nil {
+			t.Errorf("FromConfig(%s) succeeded, want error", configJSON)
+		}
+	}
+}
+
+func TestParserFromConfig_ArtifactGlob(t *testing.T) {
+	testCases := []struct {
+		glob      string
+		name      string
+		wantMatch bool
+	}{
+		{glob: "*.json", name: "foo.json", wantMatch: true},
+		{glob: "*.json", name: "foo.json.gz", wantMatch: false},
+		{glob: "*.json", name: "dir/foo.json", wantMatch: false},
+		{glob: "*.json", name: "foojson", wantMatch: false},
+		{glob: "**/*.json", name: "foo.json", wantMatch: true},
+		{glob: "**/*.json", name: "a/b/foo.json", wantMatch: true},
+		{glob: "dir/**", name: "dir/a/b", wantMatch: true},
+		{glob: "dir/**", name: "other/a", wantMatch: false},
+		{glob: "run-?.txt", name: "run-1.txt", wantMatch: true},
+		{glob: "run-?.txt", name: "run-10.txt", wantMatch: false},
+		{glob: "run-[0-4].txt", name: "run-3.txt", wantMatch: true},
+		{glob: "run-[!0-4].txt", name: "run-3.txt", wantMatch: false},
+		{glob: `a\*b`, name: "a*b", wantMatch: true},
+		{glob: `a\*b`, name: "axb", wantMatch: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.glob+"-"+tc.name, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{
+				"type": "artifact_presence",
+				"artifact_glob": %q,
+				"result": true,
+				"fact": {"name": "my_fact", "type": "bool"}
+			}`, tc.glob)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			got, err := p.Matches(&falba.Artifact{Name: tc.name})
+			if err != nil {
+				t.Fatalf("Matches failed: %v", err)
+			}
+			if got != tc.wantMatch {
+				t.Errorf("Matches(%q) for glob %q: got %v, want %v", tc.name, tc.glob, got, tc.wantMatch)
+			}
+		})
+	}
+
+	for _, config := range []string{
+		// Can't have both.
+		`{"type": "artifact_presence", "artifact_glob": "*.json", "artifact_regexp": "json", "result": true, "fact": {"name": "f", "type": "bool"}}`,
+		`{"type": "artifact_presence", "artifact_glob": "[abc", "result": true, "fact": {"name": "f", "type": "bool"}}`,
+	} {
+		if _, err := parser.FromConfig([]byte(config), "test_parser"); err == nil {
+			t.Errorf("Expected error for config %s, got nil", config)
+		}
+	}
+}
+
+func TestSingleMetricParser(t *testing.T) {
+	testCases := []struct {
+		name        string
+		valueType   string
+		trim        string // Raw JSON for the "trim" field, or empty to omit it.
+		content     string
+		want        any
+		expectError bool
+	}{
+		{name: "trailing-newline", valueType: "int", content: "42\n", want: int64(42)},
+		{name: "leading-spaces", valueType: "int", content: "   42", want: int64(42)},
+		{name: "surrounding-blank-lines", valueType: "float", content: "\n\n  1.5  \n\n", want: 1.5},
+		{name: "string", valueType: "string", content: "hello world\n", want: "hello world"},
+		{name: "multiple-lines", valueType: "string", content: "foo\nbar\n", expectError: true},
+		{name: "empty", valueType: "string", content: " \n", expectError: true},
+		{name: "no-trim", valueType: "string", trim: "false", content: " foo\n", want: " foo\n"},
+		{name: "no-trim-int", valueType: "int", trim: "false", content: "42\n", expectError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trim := ""
+			if tc.trim != "" {
+				trim = fmt.Sprintf(`"trim": %s,`, tc.trim)
+			}
+			configJSON := fmt.Sprintf(`{
+				"type": "single_metric",
+				"artifact_regexp": "artifact",
+				%s
+				"metric": {"name": "my_metric", "type": %q}
+			}`, trim, tc.valueType)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if tc.expectError {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(result.Metrics) != 1 {
+				t.Fatalf("Expected 1 metric, got %v", result.Metrics)
+			}
+			if got := falba.ValueValue(result.Metrics[0].Value); !cmp.Equal(got, tc.want) {
+				t.Errorf("Got %v (%T), want %v (%T)", got, got, tc.want, tc.want)
+			}
+		})
+	}
+}
+
+func TestParserFromConfig_MetricLabels(t *testing.T) {
+	configJSON := `{
+			"type": "single_metric",
+			"artifact_regexp": "artifact",
+			"metric": {
+				"name": "latency",
+				"type": "int",
+				"labels": {"op": "read"}
+			}
+		}`
+	p, err := parser.FromConfig([]byte(configJSON), "labelled")
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	result, err := p.Parse(fakeArtifact(t, "42"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(result.Metrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %v", result.Metrics)
+	}
+	if diff := cmp.Diff(map[string]string{"op": "read"}, result.Metrics[0].Labels); diff != "" {
+		t.Errorf("Unexpected labels (-want +got):\n%s", diff)
+	}
+
+	badJSON := `{
+			"type": "single_metric",
+			"artifact_regexp": "artifact",
+			"metric": {"name": "latency", "type": "int", "labels": {"": "read"}}
+		}`
+	if _, err := parser.FromConfig([]byte(badJSON), "bad_label"); err == nil {
+		t.Errorf("Expected error for empty label name, got nil")
+	}
+}
+
+func TestParserFromConfig_MetricUnit(t *testing.T) {
+	configJSON := `{
+			"type": "single_metric",
+			"artifact_regexp": "artifact",
+			"strip_suffix": "ns",
+			"metric": {"name": "latency", "type": "int", "unit": "ns"}
+		}`
+	p, err := parser.FromConfig([]byte(configJSON), "with_unit")
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	if p.Target.Unit == nil || p.Target.Unit.ShortName != "ns" {
+		t.Fatalf("Got target unit %v, want ns", p.Target.Unit)
+	}
+	result, err := p.Parse(fakeArtifact(t, "1500000ns\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(result.Metrics) != 1 {
+		t.Fatalf("Expected 1 metric, got %v", result.Metrics)
+	}
+	m := result.Metrics[0]
+	if m.Unit != p.Target.Unit {
+		t.Errorf("Got metric unit %v, want the target's unit %v", m.Unit, p.Target.Unit)
+	}
+	// This is what cmp shows.
+	if got := m.Unit.Format(float64(m.Value.IntValue())); got != "1.50ms" {
+		t.Errorf("Formatted metric as %q, want 1.50ms", got)
+	}
+
+	badJSON := `{
+			"type": "single_metric",
+			"artifact_regexp": "artifact",
+			"metric": {"name": "latency", "type": "int", "unit": "parsecs"}
+		}`
+	if _, err := parser.FromConfig([]byte(badJSON), "bad_unit"); err == nil {
+		t.Errorf("Expected error for unknown unit, got nil")
+	}
+}
+
+func TestParserFromConfig_MetricRange(t *testing.T) {
+	testCases := []struct {
+		name        string
+		valueType   string // Defaults to float.
+		bounds      string // Extra JSON fields for the metric.
+		content     string
+		expectError bool
+	}{
+		{name: "in-range", bounds: `"min": 0, "max": 100`, content: "50"},
+		{name: "on-bounds", bounds: `"min": 50, "max": 50`, content: "50"},
+		{name: "below-min", bounds: `"min": 0, "max": 100`, content: "-1", expectError: true},
+		{name: "above-max", bounds: `"min": 0, "max": 100`, content: "1e18", expectError: true},
+		{name: "only-min", bounds: `"min": 0`, content: "1e18"},
+		{name: "only-max", bounds: `"max": 1`, content: "-5"},
+		{name: "int-in-range", valueType: "int", bounds: `"min": 10, "max": 100`, content: "50"},
+		{name: "int-below-min", valueType: "int", bounds: `"min": 10`, content: "5", expectError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			valueType := tc.valueType
+			if valueType == "" {
+				valueType = "float"
+			}
+			configJSON := fmt.Sprintf(`{
+				"type": "single_metric",
+				"artifact_regexp": "artifact",
+				"metric": {"name": "latency", "type": %q, %s}
+			}`, valueType, tc.bounds)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if tc.expectError {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(result.Metrics) != 1 {
+				t.Errorf("Expected 1 metric, got %v", result.Metrics)
+			}
+		})
+	}
+
+	for _, metric := range []string{
+		`{"name": "latency", "type": "float", "min": 10, "max": 1}`,
+		`{"name": "name", "type": "string", "min": 0}`,
+	} {
+		configJSON := fmt.Sprintf(`{"type": "single_metric", "artifact_regexp": "artifact", "metric": %s}`, metric)
+		if _, err := parser.FromConfig([]byte(configJSON), "bad_range"); err == nil {
+			t.Errorf("Expected error for metric config %s, got nil", metric)
+		}
+	}
+}
+
+func TestParserFromConfig_Coerce(t *testing.T) {
+	testCases := []struct {
+		name      string
+		parseType string // Defaults to jsonpath.
+		valueType string
+		content   string
+		coerce    bool
+		want      falba.Value // Nil means expect ErrParseFailure.
+	}{
+		{name: "strict-int-to-string", valueType: "string", content: `{"v": 12}`},
+		{name: "int-to-string", valueType: "string", content: `{"v": 12}`, coerce: true, want: &falba.StringValue{Value: "12"}},
+		{name: "float-to-string", valueType: "string", content: `{"v": 1.5}`, coerce: true, want: &falba.StringValue{Value: "1.5"}},
+		{name: "bool-to-string", valueType: "string", content: `{"v": true}`, coerce: true, want: &falba.StringValue{Value: "true"}},
+		{name: "strict-string-to-int", valueType: "int", content: `{"v": "12"}`},
+		{name: "string-to-int", valueType: "int", content: `{"v": " 12 "}`, coerce: true, want: &falba.IntValue{Value: 12}},
+		{name: "string-to-float", valueType: "float", content: `{"v": "1.5"}`, coerce: true, want: &falba.FloatValue{Value: 1.5}},
+		{name: "string-to-bool", valueType: "bool", content: `{"v": "True"}`, coerce: true, want: &falba.BoolValue{Value: true}},
+		{name: "bad-string-to-int", valueType: "int", content: `{"v": "fast"}`, coerce: true},
+		// Things that aren't strings or scalars are still rejected.
+		{name: "object-to-string", valueType: "string", content: `{"v": {}}`, coerce: true},
+		{name: "yaml-int-to-string", parseType: "jsonpath-yaml", valueType: "string", content: "v: 12", coerce: true, want: &falba.StringValue{Value: "12"}},
+		{name: "yaml-string-to-int", parseType: "jsonpath-yaml", valueType: "int", content: `v: "12"`, coerce: true, want: &falba.IntValue{Value: 12}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			parseType := tc.parseType
+			if parseType == "" {
+				parseType = "jsonpath"
+			}
+			configJSON := fmt.Sprintf(`{
+				"type": %q,
+				"artifact_regexp": "artifact",
+				"jsonpath": "$.v",
+				"coerce": %v,
+				"fact": {"name": "my_fact", "type": %q}
+			}`, parseType, tc.coerce, tc.valueType)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if tc.want == nil {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, result.Facts["my_fact"]); diff != "" {
+				t.Errorf("Unexpected fact (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParserFromConfig_RegexpOccurrence(t *testing.T) {
+	content := "progress: 10\nprogress: 20\nprogress: 30\n"
+	testCases := []struct {
+		occurrence  string
+		want        int64
+		expectError bool
+	}{
+		{occurrence: "", expectError: true},
+		{occurrence: "first", want: 10},
+		{occurrence: "last", want: 30},
+		{occurrence: "2", want: 20},
+		{occurrence: "3", want: 30},
+		{occurrence: "4", expectError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.occurrence, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{
+				"type": "regexp",
+				"artifact_regexp": "artifact",
+				"regexp": "progress: (\\d+)",
+				"occurrence": %q,
+				"metric": {"name": "progress", "type": "int"}
+			}`, tc.occurrence)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, content))
+			if tc.expectError {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			want := []*falba.Metric{{Name: "progress", Value: &falba.IntValue{Value: tc.want}}}
+			if diff := cmp.Diff(want, result.Metrics); diff != "" {
+				t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, occurrence := range []string{"0", "-1", "middle"} {
+		configJSON := fmt.Sprintf(`{"type": "regexp", "artifact_regexp": "artifact", "regexp": "x", "occurrence": %q, "metric": {"name": "m", "type": "int"}}`, occurrence)
+		if _, err := parser.FromConfig([]byte(configJSON), "bad_occurrence"); err == nil {
+			t.Errorf("Expected error for occurrence %q, got nil", occurrence)
+		}
+	}
+}
+
+func TestParserFromConfig_NumberFormat(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		parser      string // JSON fields for the parser type
+		valueType   string
+		format      string // JSON fields for strip_suffix and scale
+		content     string
+		want        falba.Value
+		expectError bool
+	}{
+		{
+			desc:      "percentage",
+			parser:    `"type": "single_metric"`,
+			valueType: "float",
+			format:    `"strip_suffix": "%", "scale": 0.01`,
+			content:   "50%\n",
+			want:      &falba.FloatValue{Value: 0.5},
+		},
+		{
+			desc:      "suffix without scale",
+			parser:    `"type": "single_metric"`,
+			valueType: "int",
+			format:    `"strip_suffix": "ms"`,
+			content:   "12 ms",
+			want:      &falba.IntValue{Value: 12},
+		},
+		{
+			desc:      "suffix is optional",
+			parser:    `"type": "single_metric"`,
+			valueType: "int",
+			format:    `"strip_suffix": "ms"`,
+			content:   "12",
+			want:      &falba.IntValue{Value: 12},
+		},
+		{
+			desc:      "scaled to int",
+			parser:    `"type": "regexp", "regexp": "latency: (\\S+)"`,
+			valueType: "int",
+			format:    `"strip_suffix": "ms", "scale": 1000000`,
+			content:   "latency: 12.3ms\n",
+			want:      &falba.IntValue{Value: 12300000},
+		},
+		{
+			desc:      "scale without suffix",
+			parser:    `"type": "regexp", "regexp": "latency: (\\S+)"`,
+			valueType: "float",
+			format:    `"scale": 1000`,
+			content:   "latency: 1.5\n",
+			want:      &falba.FloatValue{Value: 1500},
+		},
+		{
+			desc:        "wrong suffix",
+			parser:      `"type": "single_metric"`,
+			valueType:   "float",
+			format:      `"strip_suffix": "ms"`,
+			content:     "12us",
+			expectError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			configJSON := fmt.Sprintf(`{%s, %s, "artifact_regexp": "artifact", "metric": {"name": "m", "type": %q}}`,
+				tc.parser, tc.format, tc.valueType)
+			p, err := parser.FromConfig([]byte(configJSON), "test_parser")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if tc.expectError {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			want := []*falba.Metric{{Name: "m", Value: tc.want}}
+			if diff := cmp.Diff(want, result.Metrics); diff != "" {
+				t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, configJSON := range []string{
+		// Only for numbers.
+		`{"type": "single_metric", "artifact_regexp": "a", "strip_suffix": "%", "metric": {"name": "m", "type": "string"}}`,
+		`{"type": "regexp", "artifact_regexp": "a", "regexp": "x", "scale": 2, "fact": {"name": "f", "type": "bool"}}`,
+		`{"type": "single_metric", "artifact_regexp": "a", "scale": 0, "metric": {"name": "m", "type": "float"}}`,
+		// Not supported by other parser types.
+		`{"type": "shellvar", "artifact_regexp": "a", "var": "X", "scale": 2, "metric": {"name": "m", "type": "float"}}`,
+	} {
+		if _, err := parser.FromConfig([]byte(configJSON), "bad_format"); err == nil {
+			t.Errorf("FromConfig(%s) succeeded, want error", configJSON)
+		}
+	}
+}
+
+func TestParserFromConfig_Repetition(t *testing.T) {
+	configJSON := `{
+			"type": "single_metric",
+			"artifact_regexp": "latency\\.txt",
+			"metric": {"name": "latency", "type": "int", "repetition_regexp": "run(\\w+)/"}
+		}`
+	p, err := parser.FromConfig([]byte(configJSON), "repeated")
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	testCases := []struct {
+		name        string
+		want        *int64
+		expectError bool
+	}{
+		{name: "run3/latency.txt", want: func() *int64 { v := int64(3); return &v }()},
+		{name: "latency.txt", want: nil},
+		{name: "runfoo/latency.txt", expectError: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			artifact := fakeArtifact(t, "42")
+			artifact.Name = tc.name
+			result, err := p.Parse(artifact)
+			if tc.expectError {
+				if !errors.Is(err, parser.ErrParseFailure) {
+					t.Fatalf("Expected ErrParseFailure, got %v (result %v)", err, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if len(result.Metrics) != 1 {
+				t.Fatalf("Expected 1 metric, got %v", result.Metrics)
+			}
+			if diff := cmp.Diff(tc.want, result.Metrics[0].Repetition); diff != "" {
+				t.Errorf("Unexpected repetition (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, re := range []string{`run\\d+/`, `(run)(\\d+)/`, `run(`} {
+		configJSON := fmt.Sprintf(`{
+				"type": "single_metric",
+				"artifact_regexp": "latency",
+				"metric": {"name": "latency", "type": "int", "repetition_regexp": %q}
+			}`, re)
+		if _, err := parser.FromConfig([]byte(configJSON), "bad_repetition"); err == nil {
+			t.Errorf("Expected error for repetition_regexp %q, got nil", re)
+		}
+	}
+}
+
+// Checks that all the extractors cope with the less common ways of writing
+// numbers.
+func TestNumericFormats(t *testing.T) {
+	testCases := []struct {
+		name      string
+		valueType falba.ValueType
+		raw       string
+		want      any
+	}{
+		{name: "scientific", valueType: falba.ValueFloat, raw: "1.2e-9", want: 1.2e-9},
+		{name: "scientific-upper", valueType: falba.ValueFloat, raw: "-1.5E+3", want: -1500.0},
+		{name: "negative-float", valueType: falba.ValueFloat, raw: "-0.25", want: -0.25},
+		{name: "plus-float", valueType: falba.ValueFloat, raw: "+2.5", want: 2.5},
+		{name: "float-without-point", valueType: falba.ValueFloat, raw: "3", want: 3.0},
+		{name: "negative-int", valueType: falba.ValueInt, raw: "-42", want: int64(-42)},
+		{name: "plus-int", valueType: falba.ValueInt, raw: "+42", want: int64(42)},
+	}
+	// Each of these produces an extractor and an artifact that contains the
+	// raw value.
+	extractors := []struct {
+		name  string
+		setup func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact)
+	}{
+		{
+			name: "regexp-crlf",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				e, err := parser.NewRegexpExtractor(`value: (.*)`, valueType)
+				if err != nil {
+					t.Fatalf("NewRegexpExtractor failed: %v", err)
+				}
+				return e, fakeArtifact(t, "value: "+raw+"\r\n")
+			},
+		},
+		{
+			name: "single-value",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				return &parser.SingleValueExtractor{ResultType: valueType}, fakeArtifact(t, raw+"\n")
+			},
+		},
+		{
+			name: "shellvar",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				e, err := parser.NewShellvarExtractor("VALUE", valueType)
+				if err != nil {
+					t.Fatalf("NewShellvarExtractor failed: %v", err)
+				}
+				return e, fakeArtifact(t, fmt.Sprintf("VALUE=%q\n", raw))
+			},
+		},
+		{
+			name: "jsonpath",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				e, err := parser.NewJSONPathExtractor("$.value", valueType)
+				if err != nil {
+					t.Fatalf("NewJSONPathExtractor failed: %v", err)
+				}
+				// JSON doesn't allow a leading +.
+				return e, fakeArtifact(t, fmt.Sprintf(`{"value": %s}`, strings.TrimPrefix(raw, "+")))
+			},
+		},
+		{
+			name: "yaml",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				e, err := parser.NewYAMLPathExtractor("$.value", valueType)
+				if err != nil {
+					t.Fatalf("NewYAMLPathExtractor failed: %v", err)
+				}
+				return e, fakeArtifact(t, "value: "+raw+"\n")
+			},
+		},
+		{
+			name: "command",
+			setup: func(t *testing.T, valueType falba.ValueType, raw string) (parser.Extractor, *falba.Artifact) {
+				e, err := parser.NewCommandExtractor([]string{"cat"}, valueType)
+				if err != nil {
+					t.Fatalf("NewCommandExtractor failed: %v", err)
+				}
+				return e, fakeArtifact(t, raw+"\n")
+			},
+		},
+	}
+	for _, ex := range extractors {
+		for _, tc := range testCases {
+			t.Run(ex.name+"/"+tc.name, func(t *testing.T) {
+				e, artifact := ex.setup(t, tc.valueType, tc.raw)
+				vals, err := e.Extract(artifact)
+				if err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+				if len(vals) != 1 {
+					t.Fatalf("Expected 1 value, got %v", vals)
+				}
+				if got := falba.ValueValue(vals[0]); !cmp.Equal(got, tc.want) {
+					t.Errorf("Got %v (%T), want %v (%T)", got, got, tc.want, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// Artifacts from Windows have \r\n line endings, the \r shouldn't end up in
+// the values.
+func TestCRLF(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		config  string
+		content string
+		want    any
+	}{
+		{
+			desc:    "single_metric",
+			config:  `{"type": "single_metric", "artifact_regexp": "artifact", "fact": {"name": "f", "type": "string"}}`,
+			content: "hello\r\n",
+			want:    "hello",
+		},
+		{
+			desc:    "shellvar",
+			config:  `{"type": "shellvar", "artifact_regexp": "artifact", "var": "NAME", "fact": {"name": "f", "type": "string"}}`,
+			content: "OTHER=1\r\nNAME=\"Fedora Linux\"\r\n",
+			want:    "Fedora Linux",
+		},
+		{
+			desc:    "shellvar unquoted",
+			config:  `{"type": "shellvar", "artifact_regexp": "artifact", "var": "NAME", "fact": {"name": "f", "type": "string"}}`,
+			content: "NAME=fedora\r\nOTHER=1\r\n",
+			want:    "fedora",
+		},
+		{
+			desc:    "jsonpath",
+			config:  `{"type": "jsonpath", "artifact_regexp": "artifact", "jsonpath": "$.name", "fact": {"name": "f", "type": "string"}}`,
+			content: "{\r\n  \"name\": \"fedora\"\r\n}\r\n",
+			want:    "fedora",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			p, err := parser.FromConfig([]byte(tc.config), "crlf")
+			if err != nil {
+				t.Fatalf("FromConfig failed: %v", err)
+			}
+			result, err := p.Parse(fakeArtifact(t, tc.content))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := falba.ValueValue(result.Facts["f"]); !cmp.Equal(got, tc.want) {
+				t.Errorf("Got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	// The regexp extractor doesn't have a config type.
+	p := test.MustNewRegexpParser(t, `(?m)^name: (.*)$`, "my-metric", falba.ValueString)
+	result, err := p.Parse(fakeArtifact(t, "name: fedora\r\nversion: 40\r\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := []*falba.Metric{{Name: "my-metric", Value: &falba.StringValue{Value: "fedora"}}}
+	if diff := cmp.Diff(want, result.Metrics); diff != "" {
+		t.Errorf("Unexpected metrics (-want +got):\n%s", diff)
+	}
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -17,8 +18,16 @@ import (
 type ShellvarExtractor struct {
 	VarName    string
 	ResultType falba.ValueType
+	// Longest line that can be read, in bytes. 0 means
+	// DefaultMaxLineBytes.
+	MaxLineBytes int
 }
 
+// DefaultMaxLineBytes is the default for ShellvarExtractor.MaxLineBytes. This is
+// way bigger than bufio.Scanner's default, since artifacts sometimes have
+// giant lines like minified JSON stuffed into a variable.
+const DefaultMaxLineBytes = 16 * 1024 * 1024
+
 func NewShellvarExtractor(varName string, resultType falba.ValueType) (*ShellvarExtractor, error) {
 	if varName == "" {
 		return nil, fmt.Errorf("variable name cannot be empty")
@@ -37,6 +46,12 @@ func (e *ShellvarExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, er
 
 	reader := strings.NewReader(string(content))
 	scanner := bufio.NewScanner(reader)
+	maxLineBytes := e.MaxLineBytes
+	if maxLineBytes == 0 {
+		maxLineBytes = DefaultMaxLineBytes
+	}
+	// The buffer needs room for the newline too.
+	scanner.Buffer(nil, maxLineBytes+1)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -68,6 +83,9 @@ func (e *ShellvarExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, er
 	}
 
 	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("%w: line longer than %d bytes (see max_line_bytes)", ErrParseFailure, maxLineBytes)
+		}
 		return nil, fmt.Errorf("scanning lines: %v", err)
 	}
 
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bjackman/falba/internal/falba"
+)
+
+// SingleValueExtractor takes the whole content of the artifact as the value.
+// By default surrounding whitespace (like the trailing newline that almost
+// every file has) is trimmed first.
+type SingleValueExtractor struct {
+	ResultType falba.ValueType
+	// Use the content verbatim, for string values where whitespace matters.
+	NoTrim bool
+	// Applied to the content before parsing it.
+	Format NumberFormat
+}
+
+func (e *SingleValueExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, error) {
+	content, err := artifact.Content()
+	if err != nil {
+		return nil, fmt.Errorf("getting artifact content: %v", err)
+	}
+
+	strVal := string(content)
+	if !e.NoTrim {
+		strVal = strings.TrimSpace(strVal)
+		// Catch people pointing this at a file with a whole list of values,
+		// that's probably a mistake.
+		if strings.Contains(strVal, "\n") {
+			return nil, fmt.Errorf("%w: %v has multiple lines, expected a single value", ErrParseFailure, artifact)
+		}
+	}
+	if strVal == "" {
+		return nil, fmt.Errorf("%w: %v is empty", ErrParseFailure, artifact)
+	}
+	val, err := e.Format.parseValue(strVal, e.ResultType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParseFailure, err)
+	}
+	return []falba.Value{val}, nil
+}
+
+func (e *SingleValueExtractor) String() string {
+	return fmt.Sprintf("SingleValueExtractor{%v}", e.ResultType)
+}
+
+var _ Extractor = &SingleValueExtractor{}
@@ -11,6 +11,8 @@ import (
 type YAMLPathExtractor struct {
 	resultType falba.ValueType
 	expression string
+	// See coerceJSONValue.
+	Coerce bool
 }
 
 func NewYAMLPathExtractor(expr string, resultType falba.ValueType) (*YAMLPathExtractor, error) {
@@ -35,7 +37,7 @@ func (e *YAMLPathExtractor) Extract(artifact *falba.Artifact) ([]falba.Value, er
 		return nil, fmt.Errorf("failed to evaluate JSONPath on YAML: %v", err)
 	}
 
-	return evalJSONPathResult(got, e.resultType, "YAMLPath")
+	return evalJSONPathResult(got, e.resultType, e.Coerce, "YAMLPath")
 }
 
 func (p *YAMLPathExtractor) String() string {
@@ -45,6 +47,8 @@ func (p *YAMLPathExtractor) String() string {
 type YAMLPathConfig struct {
 	BaseParserConfig
 	JSONPath string `json:"jsonpath"`
+	// Convert between strings and other types, see coerceJSONValue.
+	Coerce bool `json:"coerce"`
 }
 
 func (c *YAMLPathConfig) ValidateFields() error {
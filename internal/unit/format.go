@@ -0,0 +1,76 @@
+package unit
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+var printer = message.NewPrinter(language.English)
+
+// Multipliers to get from each unit to the base unit of its family.
+var (
+	nanoseconds = map[string]float64{"ns": 1, "us": 1e3, "ms": 1e6, "s": 1e9}
+	bytes       = map[string]float64{"B": 1, "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30}
+)
+
+// Format formats a value in this unit for humans, converting it to whichever
+// unit of the same family makes it most readable (e.g. 1500000ns is
+// "1.50ms"). A nil Unit formats the plain number, with thousands separators and
+// without decimals once it's big enough for them not to matter.
+func (u *Unit) Format(v float64) string {
+	// Deltas can be negative, format the magnitude so it gets the same scale.
+	if v < 0 {
+		return "-" + u.Format(-v)
+	}
+	if u == nil {
+		var opts []number.Option
+		if v > 100 {
+			opts = append(opts, number.MaxFractionDigits(0))
+		}
+		return printer.Sprintf("%v", number.Decimal(v, opts...))
+	}
+	if m, ok := nanoseconds[u.ShortName]; ok {
+		return formatTime(v * m)
+	}
+	if m, ok := bytes[u.ShortName]; ok {
+		return formatData(v * m)
+	}
+	return printer.Sprintf("%v%s", number.Decimal(v), u.ShortName)
+}
+
+func formatTime(ns float64) string {
+	if ns < 1000 {
+		return printer.Sprintf("%.0fns", number.Decimal(ns))
+	}
+	us := ns / 1e3
+	if us < 1000 {
+		return printer.Sprintf("%.2fus", number.Decimal(us))
+	}
+	ms := us / 1e3
+	if ms < 1000 {
+		return printer.Sprintf("%.2fms", number.Decimal(ms))
+	}
+	s := ms / 1e3
+	if s < 60 {
+		return printer.Sprintf("%.2fs", number.Decimal(s))
+	}
+	min := s / 60
+	if min < 60 {
+		return printer.Sprintf("%.2fm", number.Decimal(min))
+	}
+	hr := min / 60
+	return printer.Sprintf("%.2fh", number.Decimal(hr))
+}
+
+func formatData(b float64) string {
+	if b < 1<<10 {
+		return printer.Sprintf("%.0fB", number.Decimal(b))
+	}
+	for _, u := range []string{"KiB", "MiB", "GiB"} {
+		if v := b / bytes[u]; v < 1<<10 {
+			return printer.Sprintf("%.2f%s", number.Decimal(v), u)
+		}
+	}
+	return printer.Sprintf("%.2fTiB", number.Decimal(b/(1<<40)))
+}
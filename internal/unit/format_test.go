@@ -0,0 +1,76 @@
+package unit_test
+
+import (
+	"testing"
+
+	"github.com/bjackman/falba/internal/unit"
+)
+
+func mustParse(t *testing.T, shortName string) *unit.Unit {
+	u, err := unit.Parse(shortName)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", shortName, err)
+	}
+	return u
+}
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		unit string
+		val  float64
+		want string
+	}{
+		{unit: "", val: 1234567.8, want: "1,234,568"},
+		{unit: "", val: 1.5, want: "1.5"},
+		{unit: "ns", val: 999, want: "999ns"},
+		{unit: "ns", val: 1500000, want: "1.50ms"},
+		{unit: "us", val: 1500, want: "1.50ms"},
+		{unit: "s", val: 90, want: "1.50m"},
+		{unit: "s", val: 7200, want: "2.00h"},
+		{unit: "B", val: 512, want: "512B"},
+		{unit: "B", val: 1536, want: "1.50KiB"},
+		{unit: "KiB", val: 2048, want: "2.00MiB"},
+		{unit: "GiB", val: 3, want: "3.00GiB"},
+		{unit: "GiB", val: 2048, want: "2.00TiB"},
+		{unit: "/s", val: 1234.5, want: "1,234.5/s"},
+		// Negative values (e.g. deltas) are scaled the same as positive ones.
+		{unit: "", val: -1234567.8, want: "-1,234,568"},
+		{unit: "ns", val: -1500000, want: "-1.50ms"},
+		{unit: "B", val: -1536, want: "-1.50KiB"},
+	}
+	for _, tc := range testCases {
+		u := mustParse(t, tc.unit)
+		if got := u.Format(tc.val); got != tc.want {
+			t.Errorf("Format(%v %q) = %q, want %q", tc.val, tc.unit, got, tc.want)
+		}
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	testCases := []struct {
+		unit    string
+		val     float64
+		want    float64
+		wantErr bool
+	}{
+		{unit: "s", val: 2, want: 2},
+		{unit: "ms", val: 1500, want: 1.5},
+		{unit: "ns", val: 3e9, want: 3},
+		{unit: "B", val: 1, wantErr: true},
+		{unit: "", val: 1, wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := mustParse(t, tc.unit).Seconds(tc.val)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Seconds(%v %q) = %v, want error", tc.val, tc.unit, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Seconds(%v %q) failed: %v", tc.val, tc.unit, err)
+		} else if got != tc.want {
+			t.Errorf("Seconds(%v %q) = %v, want %v", tc.val, tc.unit, got, tc.want)
+		}
+	}
+}
@@ -24,6 +24,7 @@ var (
 		"KiB": {Name: "kibibyte", ShortName: "KiB", Family: "data"},
 		"MiB": {Name: "mebibyte", ShortName: "MiB", Family: "data"},
 		"GiB": {Name: "gibibyte", ShortName: "GiB", Family: "data"},
+		"/s":  {Name: "per second", ShortName: "/s", Family: "rate"},
 	}
 )
 
@@ -39,3 +40,16 @@ func Parse(shortName string) (*Unit, error) {
 	}
 	return &u, nil
 }
+
+// Seconds converts a value in this unit to seconds. It fails if this isn't a
+// unit of time.
+func (u *Unit) Seconds(v float64) (float64, error) {
+	if u == nil {
+		return 0, fmt.Errorf("no unit, expect a unit of time")
+	}
+	m, ok := nanoseconds[u.ShortName]
+	if !ok {
+		return 0, fmt.Errorf("%s isn't a unit of time", u.ShortName)
+	}
+	return v * m / nanoseconds["s"], nil
+}
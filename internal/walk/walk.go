@@ -0,0 +1,88 @@
+// Package walk contains logic for walking trees of artifact files.
+package walk
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Files calls fn for every file under root (but not for the directories),
+// in lexical order. Paths are passed to fn as root joined with the path
+// through the tree, even when that goes through a symlink.
+//
+// If followSymlinks is set, symlinks to files are treated like the files
+// themselves, and symlinks to directories are descended into. If a symlink
+// points at a directory that we're already inside, following it would go
+// round in circles forever, so it's skipped with a log message. Broken
+// symlinks are also skipped.
+//
+// If followSymlinks isn't set, symlinks are always skipped.
+func Files(root string, followSymlinks bool, fn func(path string) error) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("resolving %v: %w", root, err)
+	}
+	w := &walker{
+		followSymlinks: followSymlinks,
+		fn:             fn,
+		ancestors:      map[string]bool{},
+	}
+	return w.walkDir(root, realRoot)
+}
+
+type walker struct {
+	followSymlinks bool
+	fn             func(path string) error
+	// Real paths of the directories we're currently inside.
+	ancestors map[string]bool
+}
+
+func (w *walker) walkDir(dir string, realDir string) error {
+	w.ancestors[realDir] = true
+	defer delete(w.ancestors, realDir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("reading directory: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		realPath := filepath.Join(realDir, entry.Name())
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				log.Printf("Skipping symlink %v", path)
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Printf("Skipping broken symlink %v: %v", path, err)
+				continue
+			}
+			isDir = info.IsDir()
+			realPath, err = filepath.EvalSymlinks(path)
+			if err != nil {
+				return fmt.Errorf("resolving %v: %w", path, err)
+			}
+			if isDir && w.ancestors[realPath] {
+				log.Printf("Skipping symlink %v, it points to %v which would be a cycle", path, realPath)
+				continue
+			}
+		}
+
+		if isDir {
+			if err := w.walkDir(path, realPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := w.fn(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package walk_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bjackman/falba/internal/walk"
+	"github.com/google/go-cmp/cmp"
+)
+
+// Sets up this tree under a temp dir and returns the path to root:
+//
+//	root/file
+//	root/sub/file
+//	root/sub/loop -> root
+//	root/file-link -> root/file
+//	root/sub-link -> root/sub
+//	root/external-link -> external
+//	root/broken-link -> nonexistent
+//	external/file
+func setupTree(t *testing.T) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for _, d := range []string{root, filepath.Join(root, "sub"), filepath.Join(dir, "external")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("Creating dir: %v", err)
+		}
+	}
+	for _, f := range []string{"root/file", "root/sub/file", "external/file"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("hello"), 0644); err != nil {
+			t.Fatalf("Creating file: %v", err)
+		}
+	}
+	for link, target := range map[string]string{
+		"root/sub/loop":      root,
+		"root/file-link":     "file",
+		"root/sub-link":      "sub",
+		"root/external-link": "../external",
+		"root/broken-link":   "nonexistent",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatalf("Creating symlink: %v", err)
+		}
+	}
+	return root
+}
+
+func TestFiles(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		followSymlinks bool
+		want           []string
+	}{
+		{
+			desc:           "follow",
+			followSymlinks: true,
+			want: []string{
+				"external-link/file",
+				"file",
+				"file-link",
+				"sub/file",
+				// sub/loop is skipped, it points back to root.
+				"sub-link/file",
+				// sub-link/loop is skipped, it points back to root.
+			},
+		},
+		{
+			desc:           "no-follow",
+			followSymlinks: false,
+			want:           []string{"file", "sub/file"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			root := setupTree(t)
+			var got []string
+			err := walk.Files(root, tc.followSymlinks, func(path string) error {
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					t.Fatalf("Walked to %v, outside of %v", path, root)
+				}
+				got = append(got, rel)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Files failed: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFiles_Missing(t *testing.T) {
+	err := walk.Files(filepath.Join(t.TempDir(), "nonexistent"), true, func(path string) error { return nil })
+	if err == nil {
+		t.Errorf("Expected error for missing root, got nil")
+	}
+}